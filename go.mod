@@ -2,11 +2,19 @@ module landrop
 
 go 1.25.1
 
-require github.com/quic-go/quic-go v0.48.2
+require (
+	github.com/grandcat/zeroconf v1.0.0
+	github.com/klauspost/compress v1.20.1
+	github.com/quic-go/quic-go v0.48.2
+	github.com/zeebo/blake3 v0.2.4
+)
 
 require (
+	github.com/cenkalti/backoff v2.2.1+incompatible // indirect
 	github.com/go-task/slim-sprig v0.0.0-20230315185526-52ccab3ef572 // indirect
 	github.com/google/pprof v0.0.0-20210407192527-94a9f03dee38 // indirect
+	github.com/klauspost/cpuid/v2 v2.0.12 // indirect
+	github.com/miekg/dns v1.1.27 // indirect
 	github.com/onsi/ginkgo/v2 v2.9.5 // indirect
 	go.uber.org/mock v0.4.0 // indirect
 	golang.org/x/crypto v0.26.0 // indirect
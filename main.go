@@ -2,10 +2,24 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"landrop/p2p"
+	"net"
 	"os"
+	"os/signal"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
@@ -14,17 +28,45 @@ const (
 	DefaultPort = "8080"
 )
 
+// gitCommit is injected at build time: go build -ldflags "-X main.gitCommit=$(git rev-parse --short HEAD)"
+var gitCommit = ""
+
 var (
 	// Commands that should skip peer discovery
 	skipDiscoveryCommands = map[string]bool{
 		"discover":       true,
-		"recv-chunked":   true,  // Skip global discovery - we start it manually in the function
+		"recv":           true, // The receivers start their own listener with the right port
+		"recv-chunked":   true, // Skip global discovery - we start it manually in the function
 		"test-quic-send": true,
 		"test-quic-recv": true,
+		"version":        true,
+		"trust":          true,
+		"history":        true,
+		"get":            true, // Pulling a file doesn't make this machine a receiver others should find
+		"self-test":      true, // The loopback receiver isn't one other peers should find
+		"diagnose":       true,
+		"config":         true,
 	}
+
+	// settings are the defaults read from ~/.landrop/config.toml and LANDROP_* environment
+	// variables, which command-line flags override
+	settings     = p2p.DefaultSettings()
+	settingsPath string
+
+	// machineOutput is the real stdout when received data or JSON results are written to it;
+	// os.Stdout then points at stderr so status output and prompts can't corrupt it
+	machineOutput *os.File
+
+	// sendPriorities and sendLargeLast are send-chunked's --priority and --large-last, which
+	// send the paths through a p2p.TransferQueue
+	sendPriorities map[string]int
+	sendLargeLast  bool
 )
 
 func main() {
+	// --no-color applies to every command, so it's taken out before the command parses its flags
+	var noColor bool
+	os.Args, noColor = extractFlag(os.Args, "no-color")
 	if len(os.Args) < 2 {
 		printUsage()
 		return
@@ -32,6 +74,41 @@ func main() {
 
 	command := os.Args[1]
 
+	// Redirect before anything is printed, including TLS initialization messages
+	if writesMachineOutput(command, os.Args[2:]) {
+		machineOutput = os.Stdout
+		os.Stdout = os.Stderr
+	}
+
+	// The p2p package is silent by default; the CLI shows its progress and status output
+	p2p.SetLogger(p2p.StdoutLogger{})
+
+	// A broken configuration file or variable stops every command, rather than silently running with defaults
+	if path, err := p2p.DefaultSettingsPath(); err == nil {
+		settingsPath = path
+		if settings, err = p2p.LoadSettings(path); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		fmt.Printf("Warning: configuration file ignored: %v\n", err)
+	}
+
+	// Progress bars redraw one line with \r and ANSI colors; logs and pipes get plain lines instead
+	if !p2p.IsTerminal(os.Stdout) {
+		p2p.SetPlainProgress(true)
+	}
+	if os.Getenv(p2p.NoColorEnvVar) != "" || noColor || !settings.Color {
+		p2p.DisableColors()
+	}
+
+	// Keep an audit trail of every transfer in ~/.landrop/history.jsonl
+	if historyPath, err := p2p.DefaultHistoryPath(); err == nil {
+		p2p.SetHistoryPath(historyPath)
+	} else {
+		fmt.Printf("Warning: transfer history disabled: %v\n", err)
+	}
+
 	// Initialize TLS configuration
 	if err := p2p.InitializeTLS(); err != nil {
 		fmt.Printf("Warning: Failed to initialize TLS configuration: %v\n", err)
@@ -39,7 +116,10 @@ func main() {
 
 	// Start peer discovery listener for applicable commands
 	if !shouldSkipDiscovery(command) {
-		go p2p.ListenForDiscovery(p2p.DefaultPort)
+		if err := p2p.StartDiscoveryListener(settings.Port); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+			fmt.Println("Other peers may not be able to discover this machine while it runs.")
+		}
 	}
 
 	// Route command to appropriate handler
@@ -49,6 +129,40 @@ func main() {
 	}
 }
 
+// extractFlag removes every --name or -name boolean flag from args and reports whether one was present
+func extractFlag(args []string, name string) ([]string, bool) {
+	var rest []string
+	found := false
+	for _, arg := range args {
+		if arg == "--"+name || arg == "-"+name {
+			found = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return rest, found
+}
+
+// writesMachineOutput reports whether a command was asked to stream received data ("-")
+// or JSON results (--json) to stdout
+func writesMachineOutput(command string, args []string) bool {
+	for _, arg := range args {
+		if arg == "--json" || arg == "-json" || (arg == "-" && command == "recv-chunked") {
+			return true
+		}
+	}
+	return false
+}
+
+// enableJSONSummary sends transfer results to the real stdout as JSON
+func enableJSONSummary() {
+	if machineOutput != nil {
+		p2p.SetJSONSummary(machineOutput)
+		return
+	}
+	p2p.SetJSONSummary(os.Stdout)
+}
+
 // shouldSkipDiscovery determines if peer discovery should be skipped for a command
 func shouldSkipDiscovery(command string) bool {
 	return skipDiscoveryCommands[command]
@@ -71,8 +185,24 @@ func handleCommand(command string) error {
 		return handleChunkedSend()
 	case "recv-chunked":
 		return handleChunkedRecv()
+	case "send-text":
+		return handleSendText()
+	case "get":
+		return handleGet()
 	case "device-info":
 		return handleDeviceInfo()
+	case "version":
+		return handleVersion()
+	case "trust":
+		return handleTrust()
+	case "history":
+		return handleHistory()
+	case "self-test":
+		return handleSelfTest()
+	case "diagnose":
+		return handleDiagnose()
+	case "config":
+		return handleConfig()
 	default:
 		return fmt.Errorf("unknown command: %s", command)
 	}
@@ -80,30 +210,201 @@ func handleCommand(command string) error {
 
 // handleDiscover discovers and displays available peers on the network
 func handleDiscover() error {
-	peers := p2p.DiscoverPeers()
+	flags := flag.NewFlagSet("discover", flag.ContinueOnError)
+	discoverTimeout := discoverTimeoutFlag(flags)
+	watch := flags.Bool("watch", false, "keep discovering and print peers as they appear and disappear")
+	interval := flags.Duration("interval", p2p.DefaultWatchInterval, "time between discovery rounds with --watch")
+	staleAfter := flags.Duration("stale-after", 3*p2p.DefaultWatchInterval, "drop peers not seen for this long with --watch")
+	ping := flags.Bool("ping", false, "connect to each chunked receiver found to check it is reachable and show its fingerprint")
+	includeSelf := flags.Bool("include-self", false, "also list receivers running on this machine, for testing")
+	args, err := parseFlags(flags, os.Args[2:])
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 || *discoverTimeout <= 0 {
+		return fmt.Errorf("usage: landrop discover [--discover-timeout <duration>] [--ping] [--include-self] [--watch [--interval <duration>] [--stale-after <duration>]]")
+	}
+	p2p.SetIncludeSelf(*includeSelf)
+	if *watch && (*interval <= 0 || *staleAfter < *interval) {
+		return fmt.Errorf("invalid --interval or --stale-after: the interval must be positive and no longer than the staleness threshold")
+	}
+
+	if err := p2p.CheckDiscoveryPort(); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+		fmt.Println("Local discovery responses may be unavailable: only the process holding the port answers for this machine.")
+	}
+
+	if *watch {
+		return watchPeers(*discoverTimeout, *interval, *staleAfter)
+	}
+
+	peers, err := p2p.DiscoverPeersWithTimeout(*discoverTimeout)
+	if err != nil {
+		return err
+	}
 	if len(peers) == 0 {
 		fmt.Println("No other peers found on the network.")
 		return nil
 	}
 
+	var pings map[string]string
+	if *ping {
+		pings = pingPeers(peers)
+	}
+
 	fmt.Println("Available peers:")
-	for _, peer := range peers {
-		fmt.Printf("  - %s (%s)\n", peer.Hostname, peer.IP)
+	for key, peer := range peers {
+		fmt.Printf("  - %s (%s) [%s]\n", peer.DisplayName, peer.IP, peer.CapabilitiesString())
+		if fingerprint := peer.ShortFingerprint(); fingerprint != "" {
+			fmt.Printf("      fingerprint %s\n", fingerprint)
+		}
+		if len(peer.Ports) > 1 {
+			fmt.Printf("      also receiving on ports %s\n", otherPorts(peer))
+		}
+		if status, ok := pings[key]; ok {
+			fmt.Printf("      %s\n", status)
+		}
 	}
 	return nil
 }
 
+// otherPorts lists the ports a peer receives on besides the one in its address
+func otherPorts(peer p2p.Peer) string {
+	var ports []string
+	for _, port := range peer.Ports {
+		if port != peer.Port {
+			ports = append(ports, strconv.Itoa(port))
+		}
+	}
+	return strings.Join(ports, ", ")
+}
+
+// pingPeers pings every peer running a chunked receiver in parallel and returns a status line
+// for each, keyed like peers
+func pingPeers(peers map[string]p2p.Peer) map[string]string {
+	// The dial and TLS output of each ping would bury the results
+	p2p.SetLogger(nil)
+	defer p2p.SetLogger(p2p.StdoutLogger{})
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	statuses := make(map[string]string)
+	for key, peer := range peers {
+		if !peer.Supports(p2p.CapabilityQUICChunked) {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var status string
+			info, err := p2p.PingPeer(peer.IP)
+			switch {
+			case err == nil:
+				status = fmt.Sprintf("reachable, fingerprint %s", info.Fingerprint)
+			case errors.Is(err, p2p.ErrProtocolMismatch) && info.Fingerprint != "":
+				status = fmt.Sprintf("reachable (no ping support), fingerprint %s", info.Fingerprint)
+			default:
+				status = fmt.Sprintf("unreachable: %v", err)
+			}
+			mu.Lock()
+			statuses[key] = status
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return statuses
+}
+
+// watchPeers repeats discovery every interval until interrupted, printing peers as they appear
+// and once they haven't answered for staleAfter. Receivers announcing themselves in between
+// are shown as soon as the announcement arrives.
+func watchPeers(timeout, interval, staleAfter time.Duration) error {
+	ctx, stop := interruptContext()
+	defer stop()
+
+	// The per-round discovery output would bury the changes
+	p2p.SetLogger(nil)
+	defer p2p.SetLogger(p2p.StdoutLogger{})
+
+	fmt.Printf("Watching for peers every %s, dropping those unseen for %s (Ctrl+C to stop)...\n", interval, staleAfter)
+	tracker := p2p.NewPeerTracker(staleAfter)
+	report := func(found map[string]p2p.Peer) {
+		stamp := time.Now().Format("15:04:05")
+		added, removed := tracker.Update(found, time.Now())
+		for _, peer := range added {
+			fmt.Printf("[%s] + %s (%s) [%s]\n", stamp, peer.DisplayName, peer.IP, peer.CapabilitiesString())
+		}
+		for _, peer := range removed {
+			fmt.Printf("[%s] - %s (%s)\n", stamp, peer.DisplayName, peer.IP)
+		}
+		if len(added) > 0 || len(removed) > 0 {
+			fmt.Printf("[%s] %d peer(s) online\n", stamp, len(tracker.Peers()))
+		}
+	}
+
+	announcements := make(chan p2p.Peer, 16)
+	if err := p2p.StartAnnouncementListener(ctx, func(peer p2p.Peer) {
+		select {
+		case announcements <- peer:
+		default:
+		}
+	}); err != nil {
+		// Broadcast rounds still find everyone, just not between rounds
+		fmt.Printf("Not listening for announcements: %v\n", err)
+	}
+
+	for {
+		roundStart := time.Now()
+		found, err := p2p.DiscoverPeersWithTimeout(timeout)
+		if err != nil {
+			// Keep watching: the network may come back, and known peers age out as usual
+			fmt.Printf("[%s] %v\n", time.Now().Format("15:04:05"), err)
+		}
+		report(found)
+
+		next := time.After(interval - time.Since(roundStart))
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case peer := <-announcements:
+				peer.DisplayName = peer.Hostname
+				report(map[string]p2p.Peer{peer.Key(): peer})
+			case <-next:
+				break wait
+			}
+		}
+	}
+}
+
 // handleSend handles file sending to peers
 func handleSend() error {
-	if len(os.Args) != 4 {
-		return fmt.Errorf("usage: landrop send <filename> <peer-hostname|all>")
+	flags := flag.NewFlagSet("send", flag.ContinueOnError)
+	discoverTimeout := discoverTimeoutFlag(flags)
+	args, err := parseFlags(flags, os.Args[2:])
+	if err != nil {
+		return err
+	}
+	if len(args) != 2 || *discoverTimeout <= 0 {
+		return fmt.Errorf("usage: landrop send [--discover-timeout <duration>] <filename> <peer-hostname|ip:port|all>")
 	}
 
-	filename := os.Args[2]
-	target := os.Args[3]
+	filename := args[0]
+	target := args[1]
+
+	if isPeerAddress(target) {
+		if err := p2p.SendFile(filename, target); err != nil {
+			return fmt.Errorf("failed to send to %s: %w", target, err)
+		}
+		return nil
+	}
 
 	fmt.Println("Finding peers...")
-	peers := p2p.DiscoverPeers()
+	peers, err := p2p.DiscoverPeersWithTimeout(*discoverTimeout)
+	if err != nil {
+		return err
+	}
 	if len(peers) == 0 {
 		return fmt.Errorf("no peers found to send to")
 	}
@@ -120,37 +421,60 @@ func sendToAllPeers(filename string, peers map[string]p2p.Peer) error {
 	fmt.Printf("Preparing to broadcast '%s' to %d peers.\n", filename, len(peers))
 
 	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := 0
 	for _, peer := range peers {
 		wg.Add(1)
 		go func(peer p2p.Peer) {
 			defer wg.Done()
-			fmt.Printf("\n--- Starting transfer to %s ---\n", peer.Hostname)
-			p2p.SendFile(filename, peer.IP)
+			fmt.Printf("\n--- Starting transfer to %s ---\n", peer.DisplayName)
+			if err := p2p.SendFile(filename, peer.IP); err != nil {
+				fmt.Printf("Error sending to %s: %v\n", peer.DisplayName, err)
+				mu.Lock()
+				failed++
+				mu.Unlock()
+			}
 		}(peer)
 	}
 
 	wg.Wait()
 	fmt.Println("\n--- All broadcast transfers complete. ---")
+	if failed > 0 {
+		return fmt.Errorf("%d of %d transfers failed", failed, len(peers))
+	}
 	return nil
 }
 
 // sendToSinglePeer sends a file to a specific peer
 func sendToSinglePeer(filename, target string, peers map[string]p2p.Peer) error {
-	peer, exists := peers[target]
+	peer, exists := p2p.FindPeer(peers, target)
 	if !exists {
 		return fmt.Errorf("peer '%s' not found. Run 'landrop discover' to see available peers", target)
 	}
 
-	p2p.SendFile(filename, peer.IP)
+	if err := p2p.SendFile(filename, peer.IP); err != nil {
+		return fmt.Errorf("failed to send to %s: %w", peer.DisplayName, err)
+	}
 	return nil
 }
 
 // handleRecv handles file receiving
 func handleRecv() error {
-	port := getPortFromArgs(2)
+	flags := flag.NewFlagSet("recv", flag.ContinueOnError)
+	outputDir := flags.String("output-dir", settings.OutputDir, "directory to write received files to")
+	bind := bindFlag(flags)
+	args, err := parseFlags(flags, os.Args[2:])
+	if err != nil {
+		return err
+	}
+	if err := p2p.SetBindAddress(*bind); err != nil {
+		return fmt.Errorf("invalid --bind: %w", err)
+	}
+
+	port := getPortFromArgs(args, 0)
 	fmt.Printf("Starting receiver on TCP port %s\n", port)
 	fmt.Println("This machine is now discoverable by other peers.")
-	p2p.ReceiveFile(port)
+	p2p.ReceiveFile(port, *outputDir)
 	return nil
 }
 
@@ -170,7 +494,17 @@ func handleQUICSend() error {
 
 // handleQUICRecv handles QUIC message receiving for testing
 func handleQUICRecv() error {
-	port := getPortFromArgs(2)
+	flags := flag.NewFlagSet("test-quic-recv", flag.ContinueOnError)
+	bind := bindFlag(flags)
+	args, err := parseFlags(flags, os.Args[2:])
+	if err != nil {
+		return err
+	}
+	if err := p2p.SetBindAddress(*bind); err != nil {
+		return fmt.Errorf("invalid --bind: %w", err)
+	}
+
+	port := getPortFromArgs(args, 0)
 	if err := p2p.ReceiveQUICMessage(port); err != nil {
 		return fmt.Errorf("QUIC receive failed: %w", err)
 	}
@@ -179,41 +513,945 @@ func handleQUICRecv() error {
 
 // handleChunkedSend handles chunked file sending
 func handleChunkedSend() error {
-	if len(os.Args) != 4 {
-		return fmt.Errorf("usage: landrop send-chunked <filename> <peer-hostname|peer-address|all>")
+	flags := flag.NewFlagSet("send-chunked", flag.ContinueOnError)
+	chunkSize := flags.String("chunk-size", "", "chunk size, e.g. 512K or 1M (64K-64M, default 32M)")
+	autoChunk := flags.Bool("auto-chunk", false, "measure the connection first and pick the chunk size for it")
+	maxRate := flags.String("max-rate", "", "limit the send rate per second, e.g. 10M (default unlimited)")
+	compress := flags.String("compress", p2p.CompressionNone, "chunk compression: none, gzip or zstd")
+	hashAlgorithm := flags.String("hash", p2p.HashSHA256, "integrity hash: sha256 or blake3 (faster; the receiver must support it)")
+	hashUpfront := flags.Bool("hash-upfront", false, "hash the whole file before sending, for receivers without hash trailer support")
+	strict := flags.Bool("strict", false, "require interactive approval for every new device")
+	pin := flags.String("pin", "", "pair with a receiver started with --pin by entering the PIN it shows")
+	name := flags.String("name", p2p.DefaultStreamName, "filename to announce when sending stdin (-)")
+	dryRun := flags.Bool("dry-run", false, "ask the receiver to accept, then show what would be sent without sending it")
+	jsonOutput := flags.Bool("json", false, "print each transfer result as a line of JSON instead of the summary")
+	quiet := flags.Bool("quiet", false, "don't print progress bars or transfer summaries")
+	dialAttempts := flags.Int("dial-attempts", p2p.DefaultDialAttempts, "times to try connecting to the receiver, backing off in between")
+	chunkAttempts := flags.Int("chunk-attempts", p2p.MaxRetries, "times to send a chunk the receiver didn't store, backing off in between")
+	chunkRetryDelay := flags.Duration("chunk-retry-delay", p2p.DefaultChunkRetryDelay, "pause before a chunk is first resent; it doubles after each attempt")
+	reconnects := flags.Int("reconnects", p2p.DefaultReconnects, "times to reconnect and resume when the connection drops mid-transfer")
+	maxParallel := flags.Int("max-parallel", 8, "peers to send to at the same time when the target is all")
+	tcpFallback := flags.Bool("tcp-fallback", false, "send files unencrypted over TCP when UDP to the receiver is refused or unroutable")
+	follow := flags.Bool("follow", false, "keep running and send each file that appears or changes in the directory")
+	followInterval := flags.Duration("follow-interval", p2p.DefaultFollowInterval, "time between directory scans with --follow")
+	var priorities stringList
+	flags.Var(&priorities, "priority", "send a path before others of lower priority, as path=n (repeatable; default 0)")
+	largeLast := flags.Bool("large-last", false, "send smaller paths before larger ones of the same priority")
+	expectFingerprint := flags.String("expect-fingerprint", "", "abort unless the receiver's certificate fingerprint starts with this (at least 16 hex digits, from its 'landrop device-info')")
+	streamTimeout, transferTimeout := transferTimeoutFlags(flags)
+	discoverTimeout := discoverTimeoutFlag(flags)
+	args, err := parseFlags(flags, os.Args[2:])
+	if err != nil {
+		return err
+	}
+	p2p.SetStrictMode(*strict)
+	if err := p2p.SetSenderPairingPIN(*pin); err != nil {
+		return fmt.Errorf("invalid --pin: %w", err)
+	}
+	if *jsonOutput {
+		enableJSONSummary()
+	}
+
+	// At a terminal the target can be left out, or mistyped, and picked from the peers found instead;
+	// scripts keep getting an error
+	interactive := !*jsonOutput && p2p.IsTerminal(os.Stdin) && p2p.IsTerminal(os.Stdout)
+	if len(args) < 2 && !(interactive && len(args) == 1) {
+		return fmt.Errorf("usage: landrop send-chunked [--chunk-size <size>] [--auto-chunk] [--max-rate <rate>] [--compress <mode>] [--hash <algorithm>] [--hash-upfront] [--strict] [--pin <pin>] [--name <name>] [--dry-run] [--json] [--quiet] [--dial-attempts <n>] [--chunk-attempts <n>] [--chunk-retry-delay <duration>] [--reconnects <n>] [--tcp-fallback] [--stream-timeout <duration>] [--transfer-timeout <duration>] [--max-parallel <n>] [--follow [--follow-interval <duration>]] [--priority <path>=<n>]... [--large-last] [--expect-fingerprint <fingerprint>] [--discover-timeout <duration>] <file|directory|->... <peer-hostname|peer-address|all>")
+	}
+
+	config := p2p.DefaultSenderConfig()
+	if *autoChunk && *chunkSize != "" {
+		return fmt.Errorf("--auto-chunk and --chunk-size can't be used together")
+	}
+	config.AutoChunkSize = *autoChunk
+	if !*autoChunk {
+		config.ChunkSize = settings.ChunkSize
+	}
+	if *chunkSize != "" {
+		size, err := p2p.ParseByteSize(*chunkSize)
+		if err != nil {
+			return fmt.Errorf("invalid --chunk-size: %w", err)
+		}
+		if err := p2p.ValidateChunkSize(size); err != nil {
+			return fmt.Errorf("invalid --chunk-size: %w", err)
+		}
+		config.ChunkSize = size
+	}
+	if *maxRate != "" {
+		rate, err := p2p.ParseByteSize(*maxRate)
+		if err != nil {
+			return fmt.Errorf("invalid --max-rate: %w", err)
+		}
+		config.MaxRate = rate
+	}
+	if err := p2p.ValidateCompression(*compress); err != nil {
+		return fmt.Errorf("invalid --compress: %w", err)
+	}
+	config.Compression = *compress
+	if err := p2p.ValidateHashAlgorithm(*hashAlgorithm); err != nil {
+		return fmt.Errorf("invalid --hash: %w", err)
+	}
+	config.HashAlgorithm = *hashAlgorithm
+	config.HashUpfront = *hashUpfront
+	config.DryRun = *dryRun
+	config.Quiet = *quiet
+	if *dialAttempts < 1 {
+		return fmt.Errorf("invalid --dial-attempts: must be at least 1")
+	}
+	config.DialAttempts = *dialAttempts
+	if *chunkAttempts < 1 || *chunkRetryDelay < 0 {
+		return fmt.Errorf("invalid --chunk-attempts or --chunk-retry-delay: a chunk needs at least one attempt and the delay must not be negative")
+	}
+	config.ChunkAttempts = *chunkAttempts
+	config.ChunkRetryDelay = *chunkRetryDelay
+	if *reconnects < 0 {
+		return fmt.Errorf("invalid --reconnects: must not be negative")
+	}
+	config.Reconnects = *reconnects
+	config.TCPFallback = *tcpFallback
+	if *streamTimeout <= 0 || *transferTimeout < 0 {
+		return fmt.Errorf("invalid --stream-timeout or --transfer-timeout: the stream timeout must be positive and the transfer timeout not negative")
+	}
+	config.StreamTimeout = *streamTimeout
+	config.TransferTimeout = *transferTimeout
+	if *maxParallel < 1 {
+		return fmt.Errorf("invalid --max-parallel: must be at least 1")
+	}
+	if *discoverTimeout <= 0 {
+		return fmt.Errorf("invalid --discover-timeout: must be positive")
+	}
+	if *expectFingerprint != "" {
+		if err := p2p.ValidateExpectedFingerprint(*expectFingerprint); err != nil {
+			return fmt.Errorf("invalid --expect-fingerprint: %w", err)
+		}
+		config.ExpectFingerprint = *expectFingerprint
 	}
 
-	filename := os.Args[2]
-	target := os.Args[3]
+	paths := args[:len(args)-1]
+	target := args[len(args)-1]
+	if len(args) == 1 {
+		paths, target = args, ""
+	}
+	if *follow {
+		if len(paths) != 1 || target == "all" {
+			return fmt.Errorf("--follow takes one directory and a single peer")
+		}
+		if info, err := os.Stat(paths[0]); err != nil || !info.IsDir() {
+			return fmt.Errorf("--follow needs a directory, got '%s'", paths[0])
+		}
+		if *followInterval <= 0 {
+			return fmt.Errorf("invalid --follow-interval: must be positive")
+		}
+		if *dryRun {
+			return fmt.Errorf("--follow can't be combined with --dry-run")
+		}
+		if len(priorities) > 0 || *largeLast {
+			return fmt.Errorf("--follow can't be combined with --priority or --large-last")
+		}
+	}
+	if config.ExpectFingerprint != "" && target == "all" {
+		return fmt.Errorf("--expect-fingerprint names a single receiver, so it can't be used with all")
+	}
+	if sendPriorities, err = parsePriorities(priorities, paths); err != nil {
+		return err
+	}
+	sendLargeLast = *largeLast
+
+	// Read a piped payload up front, since its size and hash must be known before sending
+	for i, path := range paths {
+		if path != "-" {
+			continue
+		}
+		spooled, cleanup, err := p2p.SpoolToTempFile(os.Stdin, *name)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		paths[i] = spooled
+		if priority, ok := sendPriorities[path]; ok {
+			delete(sendPriorities, path)
+			sendPriorities[spooled] = priority
+		}
+		break
+	}
+
+	// A literal address is dialed directly, for peers on subnets discovery can't reach
+	if isPeerAddress(target) {
+		if *follow {
+			return followDirectory(paths[0], target, config, *followInterval)
+		}
+		return sendToSinglePeerChunked(paths, target, nil, config)
+	}
 
 	fmt.Println("Finding peers...")
-	peers := p2p.DiscoverPeers()
+	peers, err := p2p.DiscoverPeersWithTimeout(*discoverTimeout)
+	if err != nil {
+		return err
+	}
 	if len(peers) == 0 {
 		return fmt.Errorf("no peers found to send to")
 	}
 
 	if target == "all" {
-		return sendToAllPeersChunked(filename, peers)
+		return sendToAllPeersChunked(paths, peers, config, *maxParallel)
+	}
+
+	if _, err := p2p.ResolvePeer(peers, target); err != nil && interactive {
+		if target != "" {
+			fmt.Printf("%v\n", err)
+		}
+		target, err = choosePeer(peers, os.Stdin)
+		if err != nil {
+			return err
+		}
+	}
+
+	if *follow {
+		peer, err := p2p.ResolvePeer(peers, target)
+		if err != nil {
+			return fmt.Errorf("%w. Run 'landrop discover' to see available peers", err)
+		}
+		return followDirectory(paths[0], peer.IP, config, *followInterval)
+	}
+	return sendToSinglePeerChunked(paths, target, peers, config)
+}
+
+// followDirectory sends the files appearing in dir to peerAddr until interrupted
+func followDirectory(dir, peerAddr string, config p2p.SenderConfig, interval time.Duration) error {
+	ctx, stop := interruptContext()
+	defer stop()
+	fmt.Printf("Watching '%s' every %s; new and modified files go to %s (Ctrl+C to stop)...\n", dir, interval, peerAddr)
+	if err := p2p.FollowDirectoryChunked(ctx, dir, peerAddr, config, interval); err != nil {
+		return fmt.Errorf("failed to follow '%s': %w", dir, err)
+	}
+	return nil
+}
+
+// handleSendText sends a text snippet, from --message or stdin, for the receiver to show
+func handleSendText() error {
+	flags := flag.NewFlagSet("send-text", flag.ContinueOnError)
+	message := flags.String("message", "", "text to send instead of reading it from stdin")
+	strict := flags.Bool("strict", false, "require interactive approval for every new device")
+	pin := flags.String("pin", "", "pair with a receiver started with --pin by entering the PIN it shows")
+	jsonOutput := flags.Bool("json", false, "print each transfer result as a line of JSON instead of the summary")
+	discoverTimeout := discoverTimeoutFlag(flags)
+	args, err := parseFlags(flags, os.Args[2:])
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 || *discoverTimeout <= 0 {
+		return fmt.Errorf("usage: landrop send-text [--message <text>] [--strict] [--pin <pin>] [--json] [--discover-timeout <duration>] <peer-hostname|peer-address|all>")
+	}
+	p2p.SetStrictMode(*strict)
+	if err := p2p.SetSenderPairingPIN(*pin); err != nil {
+		return fmt.Errorf("invalid --pin: %w", err)
+	}
+	if *jsonOutput {
+		enableJSONSummary()
+	}
+
+	text := *message
+	if text == "" {
+		if p2p.IsTerminal(os.Stdin) {
+			fmt.Println("Type the text to send, then press Ctrl+D:")
+		}
+		input, err := io.ReadAll(io.LimitReader(os.Stdin, p2p.MaxTextSize+1))
+		if err != nil {
+			return fmt.Errorf("failed to read text from stdin: %w", err)
+		}
+		text = string(input)
+	}
+	if err := p2p.ValidateText(text); err != nil {
+		return err
+	}
+	path, cleanup, err := p2p.SpoolToTempFile(strings.NewReader(text), p2p.TextFilename(time.Now()))
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	config := p2p.DefaultSenderConfig()
+	config.ContentType = p2p.ContentTypeText
+	paths := []string{path}
+	target := args[0]
+
+	if isPeerAddress(target) {
+		return sendToSinglePeerChunked(paths, target, nil, config)
+	}
+
+	fmt.Println("Finding peers...")
+	peers, err := p2p.DiscoverPeersWithTimeout(*discoverTimeout)
+	if err != nil {
+		return err
+	}
+	if len(peers) == 0 {
+		return fmt.Errorf("no peers found to send to")
+	}
+	if target == "all" {
+		return sendToAllPeersChunked(paths, peers, config, len(peers))
+	}
+	return sendToSinglePeerChunked(paths, target, peers, config)
+}
+
+// choosePeer lists peers numbered by display name and reads the user's pick from in, asking
+// again after an invalid answer. It returns the chosen peer's key.
+func choosePeer(peers map[string]p2p.Peer, in io.Reader) (string, error) {
+	keys := make([]string, 0, len(peers))
+	for key := range peers {
+		keys = append(keys, key)
 	}
+	sort.Slice(keys, func(i, j int) bool {
+		return peers[keys[i]].DisplayName < peers[keys[j]].DisplayName
+	})
 
-	return sendToSinglePeerChunked(filename, target, peers)
+	fmt.Println("Available peers:")
+	for i, key := range keys {
+		peer := peers[key]
+		fmt.Printf("  %d) %s (%s)\n", i+1, peer.DisplayName, peer.IP)
+	}
+
+	reader := bufio.NewReader(in)
+	for {
+		fmt.Printf("Send to which peer? [1-%d, empty to cancel]: ", len(keys))
+		line, err := reader.ReadString('\n')
+		answer := strings.TrimSpace(line)
+		if answer == "" {
+			if err != nil && err != io.EOF {
+				return "", fmt.Errorf("failed to read peer choice: %w", err)
+			}
+			return "", fmt.Errorf("no peer chosen")
+		}
+		if n, convErr := strconv.Atoi(answer); convErr == nil && n >= 1 && n <= len(keys) {
+			return keys[n-1], nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("invalid peer choice %q", answer)
+		}
+		fmt.Printf("Please enter a number from 1 to %d.\n", len(keys))
+	}
 }
 
 // handleChunkedRecv handles chunked file receiving
 func handleChunkedRecv() error {
-	port := getPortFromArgs(2)
-	if err := p2p.ReceiveFileChunked(port); err != nil {
-		return fmt.Errorf("chunked receive failed: %w", err)
+	flags := flag.NewFlagSet("recv-chunked", flag.ContinueOnError)
+	outputDir := flags.String("output-dir", settings.OutputDir, "directory to write received files to")
+	strict := flags.Bool("strict", false, "require interactive approval for every new device")
+	pin := flags.Bool("pin", false, "show a one-time PIN that new devices must send with --pin before they're trusted")
+	daemon := flags.Bool("daemon", false, "keep running and accept transfers from many senders")
+	maxConnections := flags.Int("max-connections", p2p.DefaultMaxConnections, "senders a --daemon serves at once on each port; more are turned away until one finishes")
+	jsonOutput := flags.Bool("json", false, "print each transfer result as a line of JSON instead of the summary")
+	var autoAccept bool
+	flags.BoolVar(&autoAccept, "yes", settings.AutoAccept, "accept every incoming transfer without prompting")
+	flags.BoolVar(&autoAccept, "auto-accept", settings.AutoAccept, "same as --yes")
+	quiet := flags.Bool("quiet", false, "don't print progress bars or transfer summaries")
+	var allowed stringList
+	flags.Var(&allowed, "allow", "only accept transfers from this device ID or certificate fingerprint (repeatable)")
+	allowFile := flags.String("allow-file", "", "file listing allowed device IDs or certificate fingerprints, one per line")
+	maxSize := flags.String("max-size", "", "reject files larger than this, e.g. 2G (default unlimited)")
+	manifest := flags.Bool("manifest", false, "write <file>.manifest.json with every chunk's checksum next to each received file")
+	preserve := flags.Bool("preserve", false, "keep each file's permissions and modification time from the sender")
+	verifyExisting := flags.Bool("verify-existing", false, "record chunk checksums while receiving and re-check them before resuming")
+	notifySocket := flags.String("notify-socket", "", "write a JSON event for every finished transfer to this Unix socket or named pipe")
+	onConflict := flags.String("on-conflict", p2p.ConflictRename, "when a received file already exists: skip, overwrite or rename")
+	var shared stringList
+	flags.Var(&shared, "share", "let peers pull files from this directory with 'landrop get' (repeatable)")
+	upnp := flags.Bool("upnp", false, "ask the router to forward the port via UPnP, for senders outside the local network")
+	tcpFallback := flags.Bool("tcp-fallback", false, "also accept unencrypted TCP transfers from senders that can't reach this machine over UDP")
+	clipboard := flags.Bool("clipboard", false, "also copy text sent with 'landrop send-text' to the clipboard")
+	streamTimeout, transferTimeout := transferTimeoutFlags(flags)
+	bind := bindFlag(flags)
+	args, err := parseFlags(flags, os.Args[2:])
+	if err != nil {
+		return err
+	}
+	p2p.SetStrictMode(*strict)
+	if err := p2p.SetBindAddress(*bind); err != nil {
+		return fmt.Errorf("invalid --bind: %w", err)
+	}
+	p2p.SetNotifySocket(*notifySocket)
+	if *pin {
+		code, err := p2p.EnablePairingPIN()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("🔢 Pairing PIN: %s (valid for %v, one device)\n", code, p2p.PairingPINLifetime)
+		fmt.Printf("   On the sender, run: landrop send-chunked --pin %s <file> <this-device>\n", code)
+	}
+
+	for _, dir := range shared {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return fmt.Errorf("shared directory '%s' doesn't exist", dir)
+		}
+	}
+
+	if *allowFile != "" {
+		fromFile, err := p2p.LoadAllowlist(*allowFile)
+		if err != nil {
+			return err
+		}
+		if len(fromFile) == 0 {
+			return fmt.Errorf("allowlist '%s' is empty", *allowFile)
+		}
+		allowed = append(allowed, fromFile...)
+	}
+
+	config := p2p.DefaultReceiverConfig()
+	config.OutputDir = *outputDir
+	config.Daemon = *daemon
+	if *maxConnections <= 0 {
+		return fmt.Errorf("invalid --max-connections: must be positive")
+	}
+	config.MaxConnections = *maxConnections
+	config.AutoAccept = autoAccept
+	config.AllowedDevices = allowed
+	config.SharedDirs = shared
+	config.WriteManifest = *manifest
+	if err := p2p.ValidateConflictPolicy(*onConflict); err != nil {
+		return fmt.Errorf("invalid --on-conflict: %w", err)
+	}
+	config.OnConflict = *onConflict
+	config.VerifyExisting = *verifyExisting
+	config.PreserveAttributes = *preserve
+	config.TCPFallback = *tcpFallback
+	if *streamTimeout <= 0 || *transferTimeout < 0 {
+		return fmt.Errorf("invalid --stream-timeout or --transfer-timeout: the stream timeout must be positive and the transfer timeout not negative")
+	}
+	config.StreamTimeout = *streamTimeout
+	config.TransferTimeout = *transferTimeout
+	config.MaxFileSize = settings.MaxSize
+	if *maxSize != "" {
+		limit, err := p2p.ParseByteSize(*maxSize)
+		if err != nil {
+			return fmt.Errorf("invalid --max-size: %w", err)
+		}
+		config.MaxFileSize = limit
+	}
+	config.Quiet = *quiet
+	if *clipboard {
+		config.OnText = func(text string, stats *p2p.TransferStats) {
+			if err := p2p.CopyToClipboard(text); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+				return
+			}
+			fmt.Println("📋 Copied to the clipboard")
+		}
+	}
+
+	// "-" streams received data to stdout; any other argument is a port to receive on, optionally
+	// with its own output directory
+	var endpoints []receiveEndpoint
+	toStdout := false
+	for _, arg := range args {
+		if arg == "-" {
+			toStdout = true
+			continue
+		}
+		endpoint, err := parseReceiveEndpoint(arg, *outputDir)
+		if err != nil {
+			return err
+		}
+		for _, other := range endpoints {
+			if other.port == endpoint.port {
+				return fmt.Errorf("port %s is given more than once", endpoint.port)
+			}
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	if len(endpoints) == 0 {
+		endpoints = append(endpoints, receiveEndpoint{port: settings.Port, outputDir: *outputDir})
+	}
+	if toStdout {
+		if *daemon {
+			return fmt.Errorf("--daemon can't be combined with writing to stdout")
+		}
+		if *jsonOutput {
+			return fmt.Errorf("--json can't be combined with writing to stdout")
+		}
+		if len(endpoints) > 1 {
+			return fmt.Errorf("only one port can write to stdout")
+		}
+		config.Output = machineOutput
+	}
+	if *jsonOutput {
+		enableJSONSummary()
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	if *upnp {
+		for _, endpoint := range endpoints {
+			if remove := mapPortUPnP(ctx, endpoint.port); remove != nil {
+				defer remove()
+			}
+		}
+	}
+	if len(endpoints) == 1 {
+		config.OutputDir = endpoints[0].outputDir
+		if err := p2p.ReceiveFileChunkedContext(ctx, endpoints[0].port, config); err != nil {
+			return fmt.Errorf("chunked receive failed: %w", err)
+		}
+		return nil
+	}
+
+	// Each port is an independent receiver; a failing one doesn't stop the others
+	errs := make([]error, len(endpoints))
+	var wg sync.WaitGroup
+	for i, endpoint := range endpoints {
+		endpointConfig := config
+		endpointConfig.OutputDir = endpoint.outputDir
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p2p.ReceiveFileChunkedContext(ctx, endpoint.port, endpointConfig); err != nil {
+				errs[i] = fmt.Errorf("chunked receive on port %s failed: %w", endpoint.port, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// receiveEndpoint is a port recv-chunked receives on and the directory its files are written to
+type receiveEndpoint struct {
+	port      string
+	outputDir string
+}
+
+// parseReceiveEndpoint parses a port argument, either a bare port or port=dir to write that
+// port's files to dir instead of defaultDir
+func parseReceiveEndpoint(arg, defaultDir string) (receiveEndpoint, error) {
+	port, dir, hasDir := strings.Cut(arg, "=")
+	if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+		return receiveEndpoint{}, fmt.Errorf("invalid port '%s'", port)
+	}
+	if !hasDir {
+		dir = defaultDir
+	} else if dir == "" {
+		return receiveEndpoint{}, fmt.Errorf("missing output directory for port %s", port)
+	}
+	return receiveEndpoint{port: port, outputDir: dir}, nil
+}
+
+// mapPortUPnP forwards the receiver's UDP port through the router for as long as ctx lives and
+// returns a function that removes the mapping, or nil if it couldn't be made. Failing to map isn't
+// fatal, since senders on the local network can still connect.
+func mapPortUPnP(ctx context.Context, port string) func() {
+	portNumber, err := strconv.Atoi(port)
+	if err != nil {
+		fmt.Printf("Warning: can't map port '%s' via UPnP: not a port number\n", port)
+		return nil
+	}
+
+	description := "LanDrop receiver"
+	mapping, err := p2p.MapPortUPnP(ctx, portNumber, description)
+	if err != nil {
+		fmt.Printf("Warning: UPnP port mapping failed: %v\n", err)
+		fmt.Println("Only senders on the local network will be able to connect.")
+		return nil
+	}
+	fmt.Printf("UPnP: forwarding UDP port %d to %s:%d\n", mapping.ExternalPort, mapping.InternalIP, mapping.InternalPort)
+	fmt.Printf("Senders outside the local network can use: landrop send-chunked <file> %s\n", mapping.ExternalAddress())
+	go mapping.Maintain(ctx, description)
+
+	return func() {
+		// ctx is usually cancelled by now, so the removal gets its own deadline
+		removeCtx, cancel := context.WithTimeout(context.Background(), p2p.UPnPDiscoveryTimeout)
+		defer cancel()
+		if err := mapping.Remove(removeCtx); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+			return
+		}
+		fmt.Println("UPnP port mapping removed")
+	}
+}
+
+// handleGet pulls a file from a peer running recv-chunked with --share
+func handleGet() error {
+	flags := flag.NewFlagSet("get", flag.ContinueOnError)
+	outputDir := flags.String("output-dir", settings.OutputDir, "directory to write the file to")
+	quiet := flags.Bool("quiet", false, "don't print progress bars or transfer summaries")
+	discoverTimeout := discoverTimeoutFlag(flags)
+	args, err := parseFlags(flags, os.Args[2:])
+	if err != nil {
+		return err
+	}
+	if len(args) != 2 || *discoverTimeout <= 0 {
+		return fmt.Errorf("usage: landrop get [--output-dir <dir>] [--quiet] [--discover-timeout <duration>] <peer-hostname|ip:port> <remote-filename>")
+	}
+	target, remoteName := args[0], args[1]
+
+	peerAddr := target
+	if !isPeerAddress(target) {
+		fmt.Println("Finding peers...")
+		peers, err := p2p.DiscoverPeersWithTimeout(*discoverTimeout)
+		if err != nil {
+			return err
+		}
+		peer, exists := p2p.FindPeer(peers, target)
+		if !exists {
+			return fmt.Errorf("peer '%s' not found. Run 'landrop discover' to see available peers", target)
+		}
+		peerAddr = peer.IP
+	}
+
+	config := p2p.DefaultReceiverConfig()
+	config.OutputDir = *outputDir
+	config.Quiet = *quiet
+	ctx, stop := interruptContext()
+	defer stop()
+	if err := p2p.GetFileChunkedContext(ctx, peerAddr, remoteName, config); err != nil {
+		return fmt.Errorf("get failed: %w", err)
 	}
 	return nil
 }
 
+// interruptContext returns a context cancelled by the first SIGINT or SIGTERM, so the receiver can
+// close its listener and leave partial files resumable. A second signal terminates immediately.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(signals)
+		select {
+		case <-signals:
+			fmt.Println("\nInterrupted, shutting down (press Ctrl+C again to force quit)...")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// stringList is a flag that may be given several times, collecting every value
+type stringList []string
+
+// String implements flag.Value
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set implements flag.Value
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
 // getPortFromArgs extracts port from command line arguments, returns default if not provided
-func getPortFromArgs(argIndex int) string {
-	if len(os.Args) > argIndex {
-		return os.Args[argIndex]
+func getPortFromArgs(args []string, argIndex int) string {
+	if len(args) > argIndex {
+		return args[argIndex]
+	}
+	return settings.Port
+}
+
+// discoverTimeoutFlag registers --discover-timeout, the window for collecting discovery replies.
+// Raising it finds slow peers on large networks but delays every command that discovers.
+func discoverTimeoutFlag(flags *flag.FlagSet) *time.Duration {
+	return flags.Duration("discover-timeout", p2p.ReplyTimeout, "how long to wait for discovery replies, e.g. 5s")
+}
+
+// transferTimeoutFlags registers --stream-timeout and --transfer-timeout, shared by senders and receivers
+func transferTimeoutFlags(flags *flag.FlagSet) (*time.Duration, *time.Duration) {
+	streamTimeout := flags.Duration("stream-timeout", p2p.StreamTimeout, "give up on a chunk stream that can't be opened for this long")
+	transferTimeout := flags.Duration("transfer-timeout", p2p.DefaultTransferTimeout, "give up on the whole transfer after this long (0 for no deadline)")
+	return streamTimeout, transferTimeout
+}
+
+// bindFlag registers --bind, the interface IP a receiver listens on instead of all interfaces
+func bindFlag(flags *flag.FlagSet) *string {
+	return flags.String("bind", "", "listen on this interface IP only, e.g. 192.168.1.20 (default all interfaces)")
+}
+
+// parseFlags parses command flags that may appear before, between or after positional arguments
+// and returns the positional arguments in order
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// handleVersion prints the protocol version and build information
+func handleVersion() error {
+	fmt.Println("=== LanDrop Version ===")
+	fmt.Printf("Protocol:      %s\n", p2p.ProtocolVersion)
+	fmt.Printf("Go version:    %s\n", runtime.Version())
+	fmt.Printf("Git commit:    %s\n", buildCommit())
+	fmt.Printf("Platform:      %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	return nil
+}
+
+// buildCommit returns the injected git commit, falling back to the VCS info recorded by go build
+func buildCommit() string {
+	if gitCommit != "" {
+		return gitCommit
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" && len(setting.Value) >= 7 {
+				return setting.Value[:7]
+			}
+		}
+	}
+	return "unknown"
+}
+
+// handleTrust lists or revokes peers in the trust store
+func handleTrust() error {
+	if len(os.Args) < 3 {
+		return fmt.Errorf("usage: landrop trust <list|remove <device-id>|export <file>|import <file>>")
+	}
+
+	trustStore, err := p2p.OpenDefaultTrustStore()
+	if err != nil {
+		return fmt.Errorf("failed to open trust store: %w", err)
+	}
+
+	switch os.Args[2] {
+	case "list":
+		return listTrustedPeers(trustStore)
+	case "remove":
+		if len(os.Args) < 4 {
+			return fmt.Errorf("usage: landrop trust remove <device-id>")
+		}
+		if err := trustStore.RemoveTrustedPeer(os.Args[3]); err != nil {
+			return err
+		}
+		fmt.Printf("Removed '%s' from the trust store.\n", os.Args[3])
+		return nil
+	case "export":
+		if len(os.Args) < 4 {
+			return fmt.Errorf("usage: landrop trust export <file>")
+		}
+		if err := trustStore.Export(os.Args[3]); err != nil {
+			return err
+		}
+		fmt.Printf("Exported %d trusted peers to '%s'.\n", len(trustStore.GetAllTrustedPeers()), os.Args[3])
+		return nil
+	case "import":
+		if len(os.Args) < 4 {
+			return fmt.Errorf("usage: landrop trust import <file>")
+		}
+		result, err := trustStore.Import(os.Args[3])
+		if err != nil {
+			return err
+		}
+		for _, reason := range result.Skipped {
+			fmt.Printf("Skipped %s\n", reason)
+		}
+		fmt.Printf("Imported '%s': %d added, %d updated, %d already up to date, %d skipped.\n",
+			os.Args[3], result.Added, result.Updated, result.Unchanged, len(result.Skipped))
+		return nil
+	default:
+		return fmt.Errorf("unknown trust command: %s", os.Args[2])
+	}
+}
+
+// listTrustedPeers prints every trusted peer, sorted by device ID
+func listTrustedPeers(trustStore *p2p.FileTrustStore) error {
+	peers := trustStore.GetAllTrustedPeers()
+	if len(peers) == 0 {
+		fmt.Println("No trusted peers.")
+		return nil
+	}
+
+	deviceIDs := make([]string, 0, len(peers))
+	for deviceID := range peers {
+		deviceIDs = append(deviceIDs, deviceID)
+	}
+	sort.Strings(deviceIDs)
+
+	fmt.Printf("Trusted peers (%d):\n", len(peers))
+	for _, deviceID := range deviceIDs {
+		peer := peers[deviceID]
+		fmt.Printf("\n  Device ID:   %s\n", peer.DeviceID)
+		fmt.Printf("  Hostname:    %s\n", peer.Hostname)
+		fmt.Printf("  Fingerprint: %s\n", peer.Fingerprint)
+		fmt.Printf("  Approved:    %s\n", formatTimestamp(peer.ApprovedAt))
+		fmt.Printf("  Last seen:   %s\n", formatTimestamp(peer.LastSeen))
 	}
-	return p2p.DefaultPort
+	return nil
+}
+
+// formatTimestamp formats a Unix timestamp for display, or "never" when unset
+func formatTimestamp(unix int64) string {
+	if unix == 0 {
+		return "never"
+	}
+	return time.Unix(unix, 0).Format("2006-01-02 15:04:05")
+}
+
+// handleConfig prints the configuration file's path and the settings in effect, merged from the
+// environment, the file and the defaults
+func handleConfig() error {
+	flags := flag.NewFlagSet("config", flag.ContinueOnError)
+	if _, err := parseFlags(flags, os.Args[2:]); err != nil {
+		return err
+	}
+
+	if settingsPath != "" {
+		if _, err := os.Stat(settingsPath); err == nil {
+			fmt.Printf("# Configuration file: %s\n", settingsPath)
+		} else {
+			fmt.Printf("# Configuration file: %s (not created; using the defaults)\n", settingsPath)
+		}
+	}
+	return settings.WriteTOML(os.Stdout)
+}
+
+// handleHistory prints the most recent entries of the transfer history log
+func handleHistory() error {
+	flags := flag.NewFlagSet("history", flag.ContinueOnError)
+	limit := flags.Int("limit", 20, "number of recent transfers to show (0 for all)")
+	if _, err := parseFlags(flags, os.Args[2:]); err != nil {
+		return err
+	}
+
+	historyPath, err := p2p.DefaultHistoryPath()
+	if err != nil {
+		return err
+	}
+	entries, err := p2p.ReadHistory(historyPath, *limit)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Println("No transfers recorded yet.")
+		return nil
+	}
+
+	fmt.Printf("Recent transfers (%d):\n\n", len(entries))
+	fmt.Printf("%-19s  %-8s  %-9s  %10s  %-21s  %s\n", "TIME", "DIR", "STATUS", "SIZE", "PEER", "FILE")
+	for _, entry := range entries {
+		fmt.Printf("%-19s  %-8s  %-9s  %10s  %-21s  %s\n",
+			entry.Timestamp.Local().Format("2006-01-02 15:04:05"),
+			entry.Direction,
+			entry.Status,
+			fmt.Sprintf("%.2f MB", float64(entry.Size)/(1024*1024)),
+			entry.Peer,
+			entry.Filename)
+		if entry.Reason != "" {
+			fmt.Printf("%-19s  ↳ %s\n", "", entry.Reason)
+		}
+	}
+	return nil
+}
+
+// handleSelfTest sends a generated file to this process over loopback to check this install works
+// before trying another device
+func handleSelfTest() error {
+	flags := flag.NewFlagSet("self-test", flag.ContinueOnError)
+	size := flags.String("size", "64M", "size of the generated test file")
+	verbose := flags.Bool("verbose", false, "show the transfer's log output")
+	args, err := parseFlags(flags, os.Args[2:])
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 {
+		return fmt.Errorf("usage: landrop self-test [--size <size>] [--verbose]")
+	}
+	bytes, err := p2p.ParseByteSize(*size)
+	if err != nil {
+		return fmt.Errorf("invalid --size: %w", err)
+	}
+
+	// The test transfer isn't one to keep in the history
+	p2p.SetHistoryPath("")
+	if !*verbose {
+		p2p.SetLogger(nil)
+	}
+
+	fmt.Printf("Running self-test: sending %s to this machine over loopback...\n", p2p.FormatByteSize(bytes))
+	ctx, stop := interruptContext()
+	defer stop()
+	result, err := p2p.SelfTest(ctx, bytes)
+	if err != nil {
+		fmt.Println("❌ Self-test failed")
+		return err
+	}
+	fmt.Printf("✅ Self-test passed: %s sent, received and verified in %v (%.2f MB/s)\n",
+		p2p.FormatByteSize(result.Size), result.Duration.Round(time.Millisecond), result.Speed)
+	return nil
+}
+
+// handleDiagnose checks each step of reaching a peer: discovery, the QUIC handshake and the path
+// between the two devices, including whether it carries full-size packets
+func handleDiagnose() error {
+	flags := flag.NewFlagSet("diagnose", flag.ContinueOnError)
+	discoverTimeout := discoverTimeoutFlag(flags)
+	verbose := flags.Bool("verbose", false, "show the connection's log output")
+	args, err := parseFlags(flags, os.Args[2:])
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 || *discoverTimeout <= 0 {
+		return fmt.Errorf("usage: landrop diagnose [--discover-timeout <duration>] [--verbose] <peer-hostname|peer-address>")
+	}
+	target := args[0]
+	if !*verbose {
+		p2p.SetLogger(nil)
+	}
+
+	fmt.Printf("Diagnosing the connection to %s...\n", target)
+	peers, err := p2p.DiscoverPeersWithTimeout(*discoverTimeout)
+	if err != nil {
+		fmt.Printf("⚠️  Discovery: %v\n", err)
+	}
+	addr := target
+	if isPeerAddress(target) {
+		found := false
+		for _, peer := range peers {
+			found = found || peer.IP == target
+		}
+		if found {
+			fmt.Printf("✅ Discovery: %s answers discovery requests\n", target)
+		} else {
+			fmt.Printf("⚠️  Discovery: %s didn't answer discovery requests, so senders need its address (is UDP port %d blocked?)\n", target, p2p.DiscoveryPort)
+		}
+	} else {
+		peer, exists := p2p.FindPeer(peers, target)
+		if !exists {
+			fmt.Printf("❌ Discovery: no peer named '%s' answered within %v\n", target, *discoverTimeout)
+			return fmt.Errorf("peer '%s' not found. Try its ip:port, or a longer --discover-timeout", target)
+		}
+		addr = peer.IP
+		fmt.Printf("✅ Discovery: found %s at %s\n", peer.DisplayName, addr)
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	diagnosis, err := p2p.DiagnoseLink(ctx, addr)
+	if err != nil {
+		fmt.Printf("❌ QUIC handshake with %s failed\n", addr)
+		return err
+	}
+	fmt.Printf("✅ QUIC handshake: %v with %s (fingerprint %s)\n",
+		diagnosis.Handshake.Round(time.Millisecond), diagnosis.Device.Hostname, diagnosis.Device.Fingerprint)
+
+	if diagnosis.Throughput > 0 {
+		fmt.Printf("✅ Link: round trip %v, %.2f MB/s\n", diagnosis.RTT.Round(time.Microsecond), diagnosis.Throughput/(1024*1024))
+	} else {
+		fmt.Println("⚠️  Link: not measured, the receiver predates link calibration")
+	}
+	switch {
+	case diagnosis.PacketSize == 0:
+		fmt.Println("⚠️  Path MTU: not measured, the receiver predates this check")
+	case diagnosis.PathMTUWarning() != "":
+		fmt.Printf("⚠️  Path MTU: %s\n", diagnosis.PathMTUWarning())
+	default:
+		fmt.Printf("✅ Path MTU: %d-byte QUIC packets get through\n", diagnosis.PacketSize)
+	}
+	return nil
 }
 
 // handleDeviceInfo displays device information and security details
@@ -230,7 +1468,7 @@ func handleDeviceInfo() error {
 	fmt.Printf("Created:       %s\n", time.Unix(deviceInfo.CreatedAt, 0).Format("2006-01-02 15:04:05"))
 	fmt.Println("\n=== Security Status ===")
 	fmt.Println("✅ Embedded CA certificate: Active")
-	fmt.Println("✅ Device certificate: Active") 
+	fmt.Println("✅ Device certificate: Active")
 	fmt.Println("✅ Certificate pinning: Enabled")
 	fmt.Println("✅ Peer authentication: Required")
 	fmt.Println("\n=== Cross-Device Communication ===")
@@ -244,57 +1482,271 @@ func handleDeviceInfo() error {
 	return nil
 }
 
-// sendToAllPeersChunked broadcasts a file to all discovered peers using chunked protocol
-func sendToAllPeersChunked(filename string, peers map[string]p2p.Peer) error {
-	fmt.Printf("Preparing to broadcast '%s' to %d peers using chunked protocol.\n", filename, len(peers))
+// sendToAllPeersChunked broadcasts files to all discovered peers using chunked protocol
+func sendToAllPeersChunked(paths []string, peers map[string]p2p.Peer, config p2p.SenderConfig, maxParallel int) error {
+	fmt.Printf("Preparing to broadcast '%s' to %d peers using chunked protocol (up to %d at a time).\n", strings.Join(paths, "', '"), len(peers), maxParallel)
 
 	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, maxParallel)
+	results := make([]*broadcastResult, 0, len(peers))
 	for _, peer := range peers {
+		result := &broadcastResult{peer: peer}
+		results = append(results, result)
+
+		// Each peer's files are reported from its own goroutine, so each result gets its own config
+		peerConfig := config
+		peerConfig.OnResult = func(stats *p2p.TransferStats) {
+			result.files = append(result.files, stats)
+		}
+
 		wg.Add(1)
-		go func(peer p2p.Peer) {
+		go func() {
 			defer wg.Done()
-			fmt.Printf("\n--- Starting chunked transfer to %s ---\n", peer.Hostname)
-			if err := p2p.SendFileChunked(filename, peer.IP); err != nil {
-				fmt.Printf("Error sending to %s: %v\n", peer.Hostname, err)
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			fmt.Printf("\n--- Starting chunked transfer to %s ---\n", peer.DisplayName)
+			result.err = sendPathsToPeer(paths, peer, peerConfig)
+			if result.err != nil {
+				fmt.Printf("Error sending to %s: %v\n", peer.DisplayName, result.err)
 			}
-		}(peer)
+		}()
 	}
 
 	wg.Wait()
 	fmt.Println("\n--- All chunked broadcast transfers complete. ---")
+	if !config.Quiet {
+		printBroadcastSummary(results, config.DryRun)
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.status(config.DryRun) == "failed" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to send to %d of %d peers", failed, len(results))
+	}
 	return nil
 }
 
-// sendToSinglePeerChunked sends a file to a specific peer using chunked protocol
-func sendToSinglePeerChunked(filename, target string, peers map[string]p2p.Peer) error {
-	peer, exists := peers[target]
-	if !exists {
-		return fmt.Errorf("peer '%s' not found. Run 'landrop discover' to see available peers", target)
+// broadcastResult is the outcome of sending to one peer during a broadcast
+type broadcastResult struct {
+	peer  p2p.Peer
+	files []*p2p.TransferStats // One entry per file offered to the peer
+	err   error
+}
+
+// status summarizes the peer's outcome: "failed" if the send stopped with an error, "rejected" if
+// the peer declined any file, and "completed" (or "checked" for a dry run) otherwise
+func (r *broadcastResult) status(dryRun bool) string {
+	if r.err != nil {
+		return "failed"
+	}
+	for _, stats := range r.files {
+		if stats.Status == "failed" {
+			return "failed"
+		}
+	}
+	for _, stats := range r.files {
+		if stats.Status == "rejected" {
+			return "rejected"
+		}
 	}
+	if dryRun {
+		return "checked"
+	}
+	return "completed"
+}
 
-	if err := p2p.SendFileChunked(filename, peer.IP); err != nil {
+// reason returns why the peer's send didn't complete, or an empty string if it did
+func (r *broadcastResult) reason() string {
+	if r.err != nil {
+		return r.err.Error()
+	}
+	for _, stats := range r.files {
+		if stats.Reason != "" {
+			return stats.Reason
+		}
+	}
+	return ""
+}
+
+// printBroadcastSummary prints a table of every peer's outcome, sorted by name
+func printBroadcastSummary(results []*broadcastResult, dryRun bool) {
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].peer.DisplayName < results[j].peer.DisplayName
+	})
+
+	fmt.Println("\nBroadcast summary:")
+	fmt.Printf("  %-24s %-10s %7s %12s %10s %12s  %s\n", "PEER", "STATUS", "FILES", "SIZE", "DURATION", "SPEED", "REASON")
+	succeeded := 0
+	for _, result := range results {
+		var size int64
+		var duration time.Duration
+		completed := 0
+		for _, stats := range result.files {
+			if stats.Status == "completed" {
+				completed++
+				size += stats.FileSize
+			}
+			duration += stats.Duration
+		}
+		speed := "-"
+		if duration > 0 && size > 0 {
+			speed = p2p.FormatByteSize(int64(float64(size)/duration.Seconds())) + "/s"
+		}
+
+		status := result.status(dryRun)
+		if status == "completed" || status == "checked" {
+			succeeded++
+		}
+		fmt.Printf("  %-24s %-10s %7s %12s %10s %12s  %s\n",
+			result.peer.DisplayName,
+			status,
+			fmt.Sprintf("%d/%d", completed, len(result.files)),
+			p2p.FormatByteSize(size),
+			duration.Round(10*time.Millisecond),
+			speed,
+			result.reason())
+	}
+	fmt.Printf("%d of %d peers succeeded\n", succeeded, len(results))
+}
+
+// sendToSinglePeerChunked sends files to a specific peer using chunked protocol
+func sendToSinglePeerChunked(paths []string, target string, peers map[string]p2p.Peer, config p2p.SenderConfig) error {
+	peer := p2p.Peer{IP: target}
+	if !isPeerAddress(target) {
+		var err error
+		peer, err = p2p.ResolvePeer(peers, target)
+		if err != nil {
+			return fmt.Errorf("%w. Run 'landrop discover' to see available peers", err)
+		}
+	}
+
+	if err := sendPathsToPeer(paths, peer, config); err != nil {
 		return fmt.Errorf("chunked send failed: %w", err)
 	}
 
 	return nil
 }
 
+// sendPathsToPeer sends paths to peer, straight over TCP when discovery showed it only accepts the
+// legacy TCP protocol instead of waiting for a QUIC dial that gets no answer
+func sendPathsToPeer(paths []string, peer p2p.Peer, config p2p.SenderConfig) error {
+	if !peer.Supports(p2p.CapabilityTCP) || peer.Supports(p2p.CapabilityQUICChunked) {
+		return sendChunkedPaths(paths, peer.IP, config)
+	}
+
+	if !config.TCPFallback || p2p.StrictModeEnabled() || config.DryRun || config.ContentType != "" || config.ExpectFingerprint != "" {
+		return fmt.Errorf("%s only accepts the legacy TCP protocol, which can't verify it; use --tcp-fallback or 'landrop send' to send anyway", peer.IP)
+	}
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && !info.Mode().IsRegular() {
+			return fmt.Errorf("%s only accepts single files over the legacy TCP protocol, not '%s'", peer.IP, path)
+		}
+	}
+	fmt.Printf("⚠️  %s only accepts the legacy TCP protocol: sending unencrypted, without verifying it\n", peer.IP)
+	for _, path := range paths {
+		if err := p2p.SendFile(path, peer.IP); err != nil {
+			return fmt.Errorf("failed to send '%s' over TCP: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// isPeerAddress reports whether target is a literal IP:port, such as 192.168.1.20:8080 or [fe80::1]:8080,
+// rather than the name of a discovered peer
+func isPeerAddress(target string) bool {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil || net.ParseIP(host) == nil {
+		return false
+	}
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n <= 65535
+}
+
+// parsePriorities parses --priority values, each path=n naming one of the paths being sent
+func parsePriorities(values []string, paths []string) (map[string]int, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	priorities := make(map[string]int, len(values))
+	for _, value := range values {
+		path, n, ok := strings.Cut(value, "=")
+		priority, err := strconv.Atoi(n)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid --priority '%s': want <path>=<n> with a whole number n", value)
+		}
+		if !slices.Contains(paths, path) {
+			return nil, fmt.Errorf("invalid --priority '%s': '%s' is not one of the paths being sent", value, path)
+		}
+		priorities[path] = priority
+	}
+	return priorities, nil
+}
+
+// sendChunkedPaths sends a file or directory tree, or several of them over one connection
+func sendChunkedPaths(paths []string, peerAddr string, config p2p.SenderConfig) error {
+	if len(sendPriorities) > 0 || sendLargeLast {
+		return sendQueuedPaths(paths, peerAddr, config)
+	}
+	if len(paths) > 1 {
+		return p2p.SendFilesChunkedWithConfig(paths, peerAddr, config)
+	}
+
+	path := paths[0]
+	info, err := os.Stat(path)
+	if err == nil && info.IsDir() {
+		return p2p.SendDirectoryChunkedWithConfig(path, peerAddr, config)
+	}
+	return p2p.SendFileChunkedWithConfig(path, peerAddr, config)
+}
+
+// sendQueuedPaths sends paths over one connection in the order set by --priority and --large-last
+func sendQueuedPaths(paths []string, peerAddr string, config p2p.SenderConfig) error {
+	queue := p2p.NewTransferQueue()
+	queue.LargeLast = sendLargeLast
+	for _, path := range paths {
+		if _, err := queue.Add(path, sendPriorities[path]); err != nil {
+			return err
+		}
+	}
+	return queue.Run(context.Background(), peerAddr, config)
+}
+
 // printUsage displays the application usage information
 func printUsage() {
 	fmt.Println("LanDrop - Peer-to-peer file transfer over LAN")
-	fmt.Println("\nUsage: landrop <command> [options]")
+	fmt.Println("\nUsage: landrop <command> [options] [--no-color]")
 	fmt.Println("\nCommands:")
-	fmt.Println("  discover                  Find other peers on the LAN")
-	fmt.Println("  send <file> <hostname|all> Send a file to a specific peer or to all peers")
-	fmt.Println("  recv [port]               Listen for incoming files (default port: 8080)")
-	fmt.Println("  test-quic-recv [port]     Test QUIC receiver (default port: 8080)")
+	fmt.Println("  discover [--discover-timeout <duration>] [--ping] [--include-self] [--watch] [--interval <duration>] [--stale-after <duration>] Find other peers on the LAN (default window: 2s); --watch keeps a live list")
+	fmt.Println("  send <file> <hostname|ip:port|all> [--discover-timeout <duration>] Send a file to a specific peer or to all peers")
+	fmt.Println("  recv [port] [--output-dir <dir>] [--bind <ip>] Listen for incoming files (default port: 8080)")
+	fmt.Println("  test-quic-recv [port] [--bind <ip>] Test QUIC receiver (default port: 8080)")
 	fmt.Println("  test-quic-send <address>  Test QUIC sender to <address>")
-	fmt.Println("  send-chunked <file> <hostname|all> Send file using new chunked protocol")
-	fmt.Println("  recv-chunked [port]       Receive file using new chunked protocol")
+	fmt.Println("  send-chunked <file|dir|->... [hostname|all] [--chunk-size <size>] [--auto-chunk] [--max-rate <rate>] [--compress <mode>] [--hash <algorithm>] [--hash-upfront] [--strict] [--pin <pin>] [--name <name>] [--dry-run] [--json] [--quiet] [--dial-attempts <n>] [--chunk-attempts <n>] [--chunk-retry-delay <duration>] [--reconnects <n>] [--tcp-fallback] [--stream-timeout <duration>] [--transfer-timeout <duration>] [--max-parallel <n>] [--follow [--follow-interval <duration>]] [--priority <path>=<n>]... [--large-last] [--expect-fingerprint <fingerprint>] [--discover-timeout <duration>] Send a file or directory using new chunked protocol (an ip:port target skips discovery)")
+	fmt.Println("  recv-chunked [-] [port[=dir]...] [--output-dir <dir>] [--strict] [--pin] [--daemon [--max-connections <n>]] [--json] [--yes] [--quiet] [--allow <device>] [--allow-file <path>] [--max-size <size>] [--on-conflict <policy>] [--verify-existing] [--preserve] [--notify-socket <path>] [--stream-timeout <duration>] [--transfer-timeout <duration>] [--share <dir>] [--manifest] [--upnp] [--tcp-fallback] [--clipboard] [--bind <ip>] Receive file using new chunked protocol")
+	fmt.Println("  send-text [hostname|all] [--message <text>] [--strict] [--pin <pin>] [--json] [--discover-timeout <duration>] Send text from --message or stdin for the receiver to show")
+	fmt.Println("  get <hostname|ip:port> <remote-file> [--output-dir <dir>] [--quiet] [--discover-timeout <duration>] Pull a file a peer shares with recv-chunked --share")
+	fmt.Println("  self-test [--size <size>] [--verbose] Send a generated file to this machine over loopback to check the install works")
+	fmt.Println("  diagnose <hostname|ip:port> [--discover-timeout <duration>] [--verbose] Check discovery, the QUIC handshake and the path MTU to a chunked receiver")
 	fmt.Println("  device-info               Display device security information")
+	fmt.Println("  version                   Show protocol version and build information")
+	fmt.Println("  history [--limit <n>]     Show recent transfers from ~/.landrop/history.jsonl")
+	fmt.Println("  config                    Show the settings in effect, from LANDROP_* variables, ~/.landrop/config.toml and the defaults")
+	fmt.Println("  trust list                List trusted peer devices")
+	fmt.Println("  trust remove <device-id>  Revoke trust for a peer device")
+	fmt.Println("  trust export <file>       Save every trusted peer to a file, e.g. for a new machine")
+	fmt.Println("  trust import <file>       Merge an exported trust store, keeping the most recently seen entries")
 	fmt.Println("\n🔐 Security Features:")
 	fmt.Println("  ✅ Automatic peer authentication")
 	fmt.Println("  ✅ Trust-on-first-use (TOFU)")
 	fmt.Println("  ✅ No manual certificate sharing required")
 	fmt.Println("\nFirst connection between devices will show approval prompt.")
+	fmt.Println("Use --strict or LANDROP_STRICT_MODE=1 to require interactive approval for every new device.")
+	fmt.Println("Use --no-color or NO_COLOR=1 to turn off colored output.")
+	fmt.Println("Defaults for the port, output directory, chunk size, auto-accept, max size and color can be set in ~/.landrop/config.toml,")
+	fmt.Println("or with LANDROP_PORT, LANDROP_OUTPUT_DIR, LANDROP_CHUNK_SIZE, LANDROP_AUTO_ACCEPT, LANDROP_MAX_SIZE and LANDROP_COLOR, which win over the file.")
 }
@@ -0,0 +1,83 @@
+package p2p
+
+// PeerInfo describes the sender of a transfer request
+type PeerInfo struct {
+	Address     string // the sender's address
+	DeviceID    string // the device ID from the sender's certificate (empty if it presented none)
+	Hostname    string // the hostname recorded for the device in the trust store (empty if unknown)
+	Fingerprint string // the certificate fingerprint pinned for the device in the trust store (empty if unknown)
+}
+
+// AcceptPolicy decides on each transfer request a receiver would otherwise prompt for: requests
+// that passed the built-in checks and BeforeAccept, and aren't part of a directory accepted earlier.
+// Decide returns false with a reason for the sender to reject the request. It's called from
+// concurrent connections in daemon mode.
+type AcceptPolicy interface {
+	Decide(request *TransferRequest, peer PeerInfo) (accept bool, reason string)
+}
+
+// AcceptPolicyFunc adapts a function to an AcceptPolicy
+type AcceptPolicyFunc func(request *TransferRequest, peer PeerInfo) (accept bool, reason string)
+
+// Decide implements AcceptPolicy
+func (f AcceptPolicyFunc) Decide(request *TransferRequest, peer PeerInfo) (bool, string) {
+	return f(request, peer)
+}
+
+// PromptPolicy returns the default policy, which asks the user at the terminal
+func PromptPolicy() AcceptPolicy {
+	return AcceptPolicyFunc(promptForTransferConfirmation)
+}
+
+// AutoAcceptPolicy returns a policy that accepts every request
+func AutoAcceptPolicy() AcceptPolicy {
+	return AcceptPolicyFunc(func(*TransferRequest, PeerInfo) (bool, string) {
+		return true, ""
+	})
+}
+
+// MaxSizePolicy returns a policy that rejects files and directories larger than limit bytes
+func MaxSizePolicy(limit int64) AcceptPolicy {
+	return AcceptPolicyFunc(func(request *TransferRequest, _ PeerInfo) (bool, string) {
+		if request.FileSize > limit {
+			return false, "File exceeds the receiver's " + FormatByteSize(limit) + " limit"
+		}
+		return true, ""
+	})
+}
+
+// DevicePolicy returns a policy that only accepts senders whose device ID, or pinned certificate
+// fingerprint, is in allowed, like ReceiverConfig.AllowedDevices
+func DevicePolicy(allowed []string) AcceptPolicy {
+	return AcceptPolicyFunc(func(_ *TransferRequest, peer PeerInfo) (bool, string) {
+		if deviceListed(allowed, peer.DeviceID, peer.Fingerprint) {
+			return true, ""
+		}
+		return false, "Sender is not on the receiver's allowlist"
+	})
+}
+
+// AllPolicies returns a policy that asks each policy in turn and accepts only if all of them do.
+// The first rejection ends it, so a prompt listed last is only shown for requests the others accept.
+func AllPolicies(policies ...AcceptPolicy) AcceptPolicy {
+	return AcceptPolicyFunc(func(request *TransferRequest, peer PeerInfo) (bool, string) {
+		for _, policy := range policies {
+			if accept, reason := policy.Decide(request, peer); !accept {
+				return false, reason
+			}
+		}
+		return true, ""
+	})
+}
+
+// peerInfo describes the session's sender, with the hostname the trust store has for it
+func (s *receiveSession) peerInfo() PeerInfo {
+	peer := PeerInfo{Address: s.peerAddr, DeviceID: s.deviceID}
+	if trustStore := defaultTrustStore(); trustStore != nil && s.deviceID != "" {
+		if trusted, ok := trustStore.GetTrustedPeer(s.deviceID); ok {
+			peer.Hostname = trusted.Hostname
+			peer.Fingerprint = trusted.Fingerprint
+		}
+	}
+	return peer
+}
@@ -0,0 +1,80 @@
+package p2p
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAcceptPolicies(t *testing.T) {
+	small := NewTransferRequest("small.txt", 1024, "abc123", 512)
+	large := NewTransferRequest("large.iso", 10*1024*1024, "def456", 512)
+	known := PeerInfo{Address: "192.168.1.20:50000", DeviceID: "aaaa1111", Hostname: "laptop", Fingerprint: "0123abcd"}
+	stranger := PeerInfo{Address: "192.168.1.30:50000", DeviceID: "bbbb2222"}
+
+	tests := []struct {
+		name    string
+		policy  AcceptPolicy
+		request *TransferRequest
+		peer    PeerInfo
+		want    bool
+	}{
+		{"auto-accept", AutoAcceptPolicy(), large, stranger, true},
+		{"under the size limit", MaxSizePolicy(1024 * 1024), small, stranger, true},
+		{"over the size limit", MaxSizePolicy(1024 * 1024), large, stranger, false},
+		{"listed device ID", DevicePolicy([]string{"aaaa1111"}), small, known, true},
+		{"listed fingerprint", DevicePolicy([]string{"01:23:AB:CD"}), small, known, true},
+		{"listed hostname", DevicePolicy([]string{"laptop"}), small, known, false},
+		{"unlisted device", DevicePolicy([]string{"aaaa1111", "0123abcd"}), small, stranger, false},
+		{"all accept", AllPolicies(MaxSizePolicy(1024*1024), DevicePolicy([]string{"aaaa1111"})), small, known, true},
+		{"one rejects", AllPolicies(MaxSizePolicy(1024*1024), DevicePolicy([]string{"aaaa1111"})), large, known, false},
+	}
+	for _, tt := range tests {
+		accept, reason := tt.policy.Decide(tt.request, tt.peer)
+		if accept != tt.want {
+			t.Errorf("%s: expected accept=%v, got %v (%q)", tt.name, tt.want, accept, reason)
+		}
+		if !accept && reason == "" {
+			t.Errorf("%s: expected a reason for the rejection", tt.name)
+		}
+	}
+}
+
+func TestReceiverAsksAcceptPolicy(t *testing.T) {
+	// The policy must be asked even in test mode, which only bypasses the prompt
+	t.Setenv("LANDROP_TEST_MODE", "1")
+
+	testFile := filepath.Join(t.TempDir(), "quota.txt")
+	if err := os.WriteFile(testFile, []byte("over quota"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	var asked []PeerInfo
+	config := DefaultReceiverConfig()
+	config.OutputDir = t.TempDir()
+	config.AcceptPolicy = AcceptPolicyFunc(func(request *TransferRequest, peer PeerInfo) (bool, string) {
+		asked = append(asked, peer)
+		return false, "Quota for " + request.Filename + " used up"
+	})
+	err := receiveOnce(t, testFile, config)
+	if !errors.Is(err, ErrTransferRejected) {
+		t.Fatalf("Expected the policy to reject the transfer, got %v", err)
+	}
+	if len(asked) != 1 || asked[0].Address == "" {
+		t.Errorf("Expected the policy to be asked once with the sender's address, got %+v", asked)
+	}
+	if _, err := os.Stat(filepath.Join(config.OutputDir, "received_quota.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing to be written, got %v", err)
+	}
+
+	// AutoAccept skips the policy
+	asked = nil
+	config.AutoAccept = true
+	if err := receiveOnce(t, testFile, config); err != nil {
+		t.Fatalf("Expected AutoAccept to accept without the policy, got %v", err)
+	}
+	if len(asked) != 0 {
+		t.Errorf("Expected AutoAccept not to ask the policy, got %+v", asked)
+	}
+}
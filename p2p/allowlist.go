@@ -0,0 +1,83 @@
+package p2p
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/quic-go/quic-go"
+)
+
+// LoadAllowlist reads allowed sender device IDs or certificate fingerprints from a file, one per line.
+// Blank lines and lines starting with # are ignored.
+func LoadAllowlist(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open allowlist: %w", err)
+	}
+	defer file.Close()
+
+	var allowed []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		allowed = append(allowed, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read allowlist: %w", err)
+	}
+	return allowed, nil
+}
+
+// peerDeviceID returns the device ID (certificate CommonName) the peer authenticated with,
+// or an empty string if it presented no certificate
+func peerDeviceID(conn quic.Connection) string {
+	certs := conn.ConnectionState().TLS.PeerCertificates
+	if len(certs) == 0 {
+		return ""
+	}
+	return certs[0].Subject.CommonName
+}
+
+// senderAllowed reports whether a sender may transfer files. An empty allowlist allows everyone;
+// otherwise the device ID must be listed, or the certificate fingerprint the trust store pinned
+// for it. Hostnames aren't matched: they come from the name a device picked for itself.
+func senderAllowed(allowed []string, deviceID string, trustStore TrustStore) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	var fingerprint string
+	if trustStore != nil && deviceID != "" {
+		if peer, ok := trustStore.GetTrustedPeer(deviceID); ok {
+			fingerprint = peer.Fingerprint
+		}
+	}
+	return deviceListed(allowed, deviceID, fingerprint)
+}
+
+// deviceListed reports whether allowed holds deviceID or the full certificate fingerprint, in
+// any of the forms normalizeFingerprint accepts
+func deviceListed(allowed []string, deviceID, fingerprint string) bool {
+	if deviceID == "" {
+		return false
+	}
+	for _, entry := range allowed {
+		if entry == deviceID || (fingerprint != "" && normalizeFingerprint(entry) == normalizeFingerprint(fingerprint)) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultTrustStore returns the global TLS manager's trust store, or nil before InitializeTLS
+func defaultTrustStore() TrustStore {
+	if globalTLSManager == nil {
+		return nil
+	}
+	return globalTLSManager.trustStore
+}
@@ -0,0 +1,58 @@
+package p2p
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSenderAllowed(t *testing.T) {
+	store := NewFileTrustStore(filepath.Join(t.TempDir(), "trusted_peers.json"))
+	fingerprint := strings.Repeat("ab", 32)
+	if err := store.AddTrustedPeer(&TrustedPeer{DeviceID: "laptop (abcd1234)", Hostname: "laptop", Fingerprint: fingerprint}); err != nil {
+		t.Fatalf("Failed to add trusted peer: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		allowed  []string
+		deviceID string
+		want     bool
+	}{
+		{"empty allowlist allows everyone", nil, "", true},
+		{"listed device ID", []string{"laptop (abcd1234)"}, "laptop (abcd1234)", true},
+		{"pinned fingerprint", []string{strings.ToUpper(fingerprint)}, "laptop (abcd1234)", true},
+		{"fingerprint prefix", []string{fingerprint[:16]}, "laptop (abcd1234)", false},
+		{"hostname the device chose", []string{"laptop"}, "laptop (abcd1234)", false},
+		{"unlisted device", []string{"desktop (ffff0000)"}, "laptop (abcd1234)", false},
+		{"hostname of an untrusted device", []string{"phone"}, "phone (12345678)", false},
+		{"no certificate", []string{"laptop"}, "", false},
+	}
+	for _, tt := range tests {
+		if got := senderAllowed(tt.allowed, tt.deviceID, store); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestLoadAllowlist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allowlist")
+	content := "# Devices allowed to send\nlaptop (abcd1234)\n\n  desktop  \n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write allowlist: %v", err)
+	}
+
+	allowed, err := LoadAllowlist(path)
+	if err != nil {
+		t.Fatalf("Failed to load allowlist: %v", err)
+	}
+	if want := []string{"laptop (abcd1234)", "desktop"}; !reflect.DeepEqual(allowed, want) {
+		t.Errorf("Expected %v, got %v", want, allowed)
+	}
+
+	if _, err := LoadAllowlist(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Expected error for a missing allowlist")
+	}
+}
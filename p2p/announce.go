@@ -0,0 +1,156 @@
+package p2p
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// announceLimiter spaces out announcements for each TCP port, so several listeners serving the
+// same port in one process don't multiply the traffic
+var announceLimiter = struct {
+	mutex sync.Mutex
+	last  map[string]time.Time
+}{last: make(map[string]time.Time)}
+
+// allowAnnouncement reports whether an announcement for tcpPort may go out at now, and if so
+// records it
+func allowAnnouncement(tcpPort string, now time.Time) bool {
+	announceLimiter.mutex.Lock()
+	defer announceLimiter.mutex.Unlock()
+	if last, ok := announceLimiter.last[tcpPort]; ok && now.Sub(last) < MinAnnounceInterval {
+		return false
+	}
+	announceLimiter.last[tcpPort] = now
+	return true
+}
+
+// announcePresence broadcasts an announcement of the advertised ports from conn when called and
+// every AnnounceInterval after that, until conn is closed
+func announcePresence(conn *net.UDPConn) {
+	localIP := getLocalIP()
+	if ip := BindAddress(); ip != nil {
+		localIP = ip.String()
+	}
+	addresses := announceAddresses()
+
+	ticker := time.NewTicker(AnnounceInterval)
+	defer ticker.Stop()
+	for {
+		reply, ok := advertisedReply(localIP)
+		message, err := json.Marshal(reply)
+		if ok && err == nil && allowAnnouncement(strconv.Itoa(reply.Port), time.Now()) {
+			message = append([]byte(AnnounceMsg+" "), message...)
+			for _, address := range addresses {
+				udpAddr, err := net.ResolveUDPAddr("udp", address)
+				if err != nil {
+					continue
+				}
+				if _, err := conn.WriteToUDP(message, udpAddr); errors.Is(err, net.ErrClosed) {
+					return
+				}
+			}
+		}
+		<-ticker.C
+	}
+}
+
+// announceAddresses lists where announcements go: every broadcast address, or with a bind address
+// only those on its network
+func announceAddresses() []string {
+	addresses := broadcastAddresses(AnnouncePort)
+	ip := BindAddress()
+	if ip == nil {
+		return addresses
+	}
+	network := interfaceNetwork(ip)
+
+	var bound []string
+	for _, address := range addresses {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			continue
+		}
+		host, _, _ = strings.Cut(host, "%")
+		target := net.ParseIP(host)
+		if target == nil || network == nil {
+			continue
+		}
+		if network.Contains(target) || (target.IsMulticast() && ip.To4() == nil) {
+			bound = append(bound, address)
+		}
+	}
+	return bound
+}
+
+// parseAnnouncement decodes an announcement received from from. The announcing peer can't tell
+// which of its addresses reaches us, so the sender's address is used with the announced port.
+func parseAnnouncement(data []byte, from *net.UDPAddr) (Peer, error) {
+	payload, ok := strings.CutPrefix(string(data), AnnounceMsg+" ")
+	if !ok {
+		return Peer{}, fmt.Errorf("not an announcement")
+	}
+	peer, err := parseDiscoveryReply([]byte(payload))
+	if err != nil {
+		return Peer{}, err
+	}
+	if peer.Port <= 0 || from == nil {
+		return Peer{}, fmt.Errorf("announcement has no port")
+	}
+
+	host := from.IP.String()
+	if from.Zone != "" {
+		host += "%" + from.Zone
+	}
+	peer.IP = net.JoinHostPort(host, strconv.Itoa(peer.Port))
+	return peer, nil
+}
+
+// StartAnnouncementListener binds AnnouncePort and calls handler for every announcement received
+// until ctx is done. Binding happens before it returns; only one listener per machine can hold the
+// port, and a conflict fails with ErrDiscoveryFailed.
+func StartAnnouncementListener(ctx context.Context, handler func(Peer)) error {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: AnnouncePort})
+	if err != nil {
+		if errors.Is(err, syscall.EADDRINUSE) {
+			return fmt.Errorf("%w: UDP port %d is already in use (another LanDrop command may be watching)", ErrDiscoveryFailed, AnnouncePort)
+		}
+		return fmt.Errorf("%w: failed to listen on UDP port %d: %v", ErrDiscoveryFailed, AnnouncePort, err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	go func() {
+		buffer := DiscoveryBufferPool.Get()
+		defer DiscoveryBufferPool.Put(buffer)
+		for {
+			n, from, err := conn.ReadFromUDP(buffer)
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				continue
+			}
+			peer, err := parseAnnouncement(buffer[:n], from)
+			if err != nil {
+				continue
+			}
+			// This host hears its own announcements too
+			peers := map[string]Peer{peer.Key(): peer}
+			dropSelf(peers)
+			if len(peers) > 0 {
+				handler(peer)
+			}
+		}
+	}()
+	return nil
+}
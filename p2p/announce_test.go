@@ -0,0 +1,83 @@
+package p2p
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestAnnouncementsAreRateLimited(t *testing.T) {
+	now := time.Now()
+	if !allowAnnouncement("test-port", now) {
+		t.Fatal("Expected the first announcement to be allowed")
+	}
+	if allowAnnouncement("test-port", now.Add(MinAnnounceInterval/2)) {
+		t.Error("Expected an announcement right after another to be dropped")
+	}
+	if !allowAnnouncement("other-test-port", now.Add(MinAnnounceInterval/2)) {
+		t.Error("Expected another port to announce independently")
+	}
+	if !allowAnnouncement("test-port", now.Add(MinAnnounceInterval)) {
+		t.Error("Expected an announcement to be allowed once the interval passed")
+	}
+}
+
+func TestParseAnnouncement(t *testing.T) {
+	from := &net.UDPAddr{IP: net.ParseIP("192.168.1.40"), Port: DiscoveryPort}
+	peer, err := parseAnnouncement([]byte(AnnounceMsg+` {"hostname":"nas","ip":"10.0.0.5:9000","port":9000}`), from)
+	if err != nil {
+		t.Fatalf("Failed to parse announcement: %v", err)
+	}
+	if peer.IP != "192.168.1.40:9000" {
+		t.Errorf("Expected the sender's address with the announced port, got %s", peer.IP)
+	}
+
+	// Requests and replies aren't announcements
+	for _, message := range []string{DiscoveryMsg, `{"hostname":"nas","ip":"10.0.0.5:9000"}`, AnnounceMsg + ` {"hostname":"nas"}`} {
+		if _, err := parseAnnouncement([]byte(message), from); err == nil {
+			t.Errorf("Expected %q to be rejected", message)
+		}
+	}
+}
+
+func TestAnnouncementListener(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan Peer, 16)
+	handler := func(peer Peer) {
+		if peer.Hostname == "announce-test-host" {
+			received <- peer
+		}
+	}
+
+	// A listener from an earlier test may still be letting go of the port
+	var err error
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if err = StartAnnouncementListener(ctx, handler); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Skipf("Announcement port unavailable: %v", err)
+	}
+
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: AnnouncePort})
+	if err != nil {
+		t.Fatalf("Failed to open UDP socket: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(AnnounceMsg + ` {"hostname":"announce-test-host","ip":"10.0.0.5:9000","port":9000}`)); err != nil {
+		t.Fatalf("Failed to send announcement: %v", err)
+	}
+
+	select {
+	case peer := <-received:
+		if peer.IP != "127.0.0.1:9000" {
+			t.Errorf("Expected the announcement from 127.0.0.1:9000, got %s", peer.IP)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Announcement wasn't received")
+	}
+}
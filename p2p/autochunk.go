@@ -0,0 +1,194 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Chunk size calibration for SenderConfig.AutoChunkSize. Two small probes are dominated by the
+// round trip and a large one by throughput; a chunk should take long enough to send that the
+// round trip to acknowledge it is a small fraction of its time.
+const (
+	CalibrationSmallProbe   = int64(256 * 1024)
+	CalibrationLargeProbe   = int64(4 * 1024 * 1024)
+	CalibrationTimeout      = 10 * time.Second
+	AutoChunkTargetDuration = 250 * time.Millisecond
+	AutoChunkRTTMultiple    = 16
+
+	// maxCalibrationBytes bounds what a receiver reads for a sender's probes
+	maxCalibrationBytes  = 16 * 1024 * 1024
+	maxCalibrationProbes = 8
+)
+
+// calibrationProbes are the probe sizes a sender uses, in order
+var calibrationProbes = []int64{CalibrationSmallProbe, CalibrationSmallProbe, CalibrationLargeProbe}
+
+// chooseChunkSize picks the chunk size to send in about AutoChunkTargetDuration, or in
+// AutoChunkRTTMultiple round trips on slow links. Sizes are rounded down to a power of two within
+// MinChunkSize and MaxChunkSize, so repeated runs over the same link usually agree and an
+// interrupted transfer stays resumable.
+func chooseChunkSize(rtt time.Duration, throughput float64) int64 {
+	target := max(AutoChunkTargetDuration, AutoChunkRTTMultiple*rtt)
+	size := int64(throughput * target.Seconds())
+
+	chunkSize := MinChunkSize
+	for chunkSize*2 <= size && chunkSize*2 <= MaxChunkSize {
+		chunkSize *= 2
+	}
+	return chunkSize
+}
+
+// estimateLink derives the round-trip time and throughput in bytes per second from how long each
+// of calibrationProbes took
+func estimateLink(durations []time.Duration) (time.Duration, float64) {
+	small := min(durations[0], durations[1])
+	large := durations[2]
+
+	var throughput float64
+	if large > small {
+		throughput = float64(CalibrationLargeProbe-CalibrationSmallProbe) / (large - small).Seconds()
+	} else {
+		throughput = float64(CalibrationLargeProbe) / max(large, time.Microsecond).Seconds()
+	}
+
+	rtt := small - time.Duration(float64(CalibrationSmallProbe)/throughput*float64(time.Second))
+	return max(rtt, 0), throughput
+}
+
+// calibrateChunkSize sends calibrationProbes to the receiver and returns the chunk size to use.
+// It must run before the session's first request; a receiver that doesn't support calibration
+// drops the session, which then can't be used further.
+func (s *sendSession) calibrateChunkSize(ctx context.Context) (int64, error) {
+	rtt, throughput, err := s.measureLink(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	chunkSize := chooseChunkSize(rtt, throughput)
+	logf("Calibrated chunk size: %s (round trip %v, %.2f MB/s)\n",
+		FormatByteSize(chunkSize), rtt.Round(time.Microsecond), throughput/(1024*1024))
+	// The probes gave path MTU discovery long enough to find larger packets if the path allows them
+	if packetSize := pathPacketSize(s.conn); packetSize > 0 && packetSize <= LowPathPacketSize {
+		logf("⚠️  %s\n", lowPathMTUWarning(packetSize))
+	}
+	return chunkSize, nil
+}
+
+// measureLink sends calibrationProbes to the receiver and returns the round-trip time and the
+// throughput in bytes per second. Like calibrateChunkSize it must come before the first request.
+func (s *sendSession) measureLink(ctx context.Context) (time.Duration, float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, CalibrationTimeout)
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); ok {
+		s.controlStream.SetReadDeadline(deadline)
+		defer s.controlStream.SetReadDeadline(time.Time{})
+	}
+
+	if err := writeControlMessage(s.controlStream, NewCalibration(MessageCalibrate, calibrationProbes), s.framed); err != nil {
+		return 0, 0, fmt.Errorf("failed to send calibration request: %w", err)
+	}
+	messageType, data, err := readControlMessage(s.controlStream)
+	if err == nil && messageType != MessageCalibrateAck {
+		err = fmt.Errorf("unexpected %s", messageType)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: receiver didn't accept calibration, it may predate --auto-chunk: %v", ErrProtocolMismatch, err)
+	}
+	ack, err := DeserializeCalibration(data, MessageCalibrateAck)
+	if err != nil {
+		return 0, 0, err
+	}
+	s.framed = supportsFraming(ack.ProtocolVersion)
+
+	payload := make([]byte, CalibrationLargeProbe)
+	durations := make([]time.Duration, len(calibrationProbes))
+	for i, size := range calibrationProbes {
+		start := time.Now()
+		if err := s.sendProbe(ctx, payload[:size]); err != nil {
+			return 0, 0, fmt.Errorf("calibration probe failed: %w", err)
+		}
+		durations[i] = time.Since(start)
+	}
+
+	rtt, throughput := estimateLink(durations)
+	return rtt, throughput, nil
+}
+
+// sendProbe sends payload on a new stream and waits for the receiver to confirm it read all of it
+func (s *sendSession) sendProbe(ctx context.Context, payload []byte) error {
+	stream, err := s.conn.OpenStreamSync(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.CancelRead(0)
+	if deadline, ok := ctx.Deadline(); ok {
+		stream.SetDeadline(deadline)
+	}
+
+	if _, err := stream.Write(payload); err != nil {
+		return err
+	}
+	if err := stream.Close(); err != nil {
+		return err
+	}
+	ack := make([]byte, 1)
+	_, err = io.ReadFull(stream, ack)
+	return err
+}
+
+// answerCalibration acknowledges a sender's CALIBRATE and reads each probe it announced, confirming
+// every one once it has all arrived. The session then continues with the sender's first request.
+func (s *receiveSession) answerCalibration(ctx context.Context, data []byte) error {
+	calibration, err := DeserializeCalibration(data, MessageCalibrate)
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, size := range calibration.Probes {
+		if size <= 0 {
+			return fmt.Errorf("%w: invalid calibration probe size %d", ErrProtocolMismatch, size)
+		}
+		total += size
+	}
+	if len(calibration.Probes) > maxCalibrationProbes || total > maxCalibrationBytes {
+		return fmt.Errorf("%w: calibration of %d probes (%d bytes) exceeds the limit", ErrProtocolMismatch, len(calibration.Probes), total)
+	}
+
+	s.framed = supportsFraming(calibration.ProtocolVersion)
+	if err := writeControlMessage(s.controlStream, NewCalibration(MessageCalibrateAck, nil), s.framed); err != nil {
+		return fmt.Errorf("failed to answer calibration: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, CalibrationTimeout)
+	defer cancel()
+	for _, size := range calibration.Probes {
+		if err := s.receiveProbe(ctx, size); err != nil {
+			return fmt.Errorf("calibration probe failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// receiveProbe reads one calibration probe of size bytes and confirms it
+func (s *receiveSession) receiveProbe(ctx context.Context, size int64) error {
+	stream, err := s.conn.AcceptStream(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		stream.SetDeadline(deadline)
+	}
+
+	n, err := io.Copy(io.Discard, io.LimitReader(stream, size+1))
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("%w: expected a %d-byte probe, got %d bytes", ErrProtocolMismatch, size, n)
+	}
+	_, err = stream.Write([]byte{1})
+	return err
+}
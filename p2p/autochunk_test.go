@@ -0,0 +1,104 @@
+package p2p
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestChooseChunkSize(t *testing.T) {
+	tests := []struct {
+		name       string
+		rtt        time.Duration
+		throughput float64
+		expected   int64
+	}{
+		{"slow link stays at the minimum", 50 * time.Millisecond, 64 * 1024, MinChunkSize},
+		{"fast link is capped at the maximum", 100 * time.Microsecond, 10 * 1024 * 1024 * 1024, MaxChunkSize},
+		{"rounds down to a power of two", time.Millisecond, 100 * 1024 * 1024, 16 * 1024 * 1024},
+		{"long round trips need bigger chunks", 100 * time.Millisecond, 4 * 1024 * 1024, 4 * 1024 * 1024},
+	}
+	for _, test := range tests {
+		if got := chooseChunkSize(test.rtt, test.throughput); got != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.name, test.expected, got)
+		}
+		if err := ValidateChunkSize(chooseChunkSize(test.rtt, test.throughput)); err != nil {
+			t.Errorf("%s: chosen size is invalid: %v", test.name, err)
+		}
+	}
+}
+
+func TestEstimateLink(t *testing.T) {
+	// 1ms round trip plus 10ms per MiB
+	perMiB := 10 * time.Millisecond
+	duration := func(size int64) time.Duration {
+		return time.Millisecond + time.Duration(float64(size)/(1024*1024)*float64(perMiB))
+	}
+	rtt, throughput := estimateLink([]time.Duration{duration(CalibrationSmallProbe), duration(CalibrationSmallProbe) + time.Millisecond, duration(CalibrationLargeProbe)})
+
+	if rtt < 900*time.Microsecond || rtt > 1100*time.Microsecond {
+		t.Errorf("Expected a round trip of about 1ms, got %v", rtt)
+	}
+	if mbps := throughput / (1024 * 1024); mbps < 99 || mbps > 101 {
+		t.Errorf("Expected about 100 MB/s, got %.2f", mbps)
+	}
+}
+
+func TestAutoChunkTransferIntegration(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	testContent := make([]byte, 3*MinChunkSize+123)
+	for i := range testContent {
+		testContent[i] = byte(i * 31 % 251)
+	}
+	testFile := filepath.Join(t.TempDir(), "calibrated.bin")
+	if err := os.WriteFile(testFile, testContent, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	receiverConfig := DefaultReceiverConfig()
+	receiverConfig.OutputDir = t.TempDir()
+
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), receiverConfig)
+	}()
+
+	// Give receiver time to start
+	time.Sleep(100 * time.Millisecond)
+
+	senderConfig := DefaultSenderConfig()
+	senderConfig.AutoChunkSize = true
+	if err := SendFileChunkedWithConfig(testFile, fmt.Sprintf("127.0.0.1:%d", port), senderConfig); err != nil {
+		t.Fatalf("Sender failed: %v", err)
+	}
+
+	select {
+	case err := <-receiverDone:
+		if err != nil {
+			t.Fatalf("Receiver failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Test timed out")
+	}
+
+	receivedContent, err := os.ReadFile(filepath.Join(receiverConfig.OutputDir, "received_calibrated.bin"))
+	if err != nil {
+		t.Fatalf("Failed to read received file: %v", err)
+	}
+	if string(receivedContent) != string(testContent) {
+		t.Fatal("File content mismatch")
+	}
+}
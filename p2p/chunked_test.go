@@ -1,12 +1,22 @@
 package p2p
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/quic-go/quic-go"
 )
 
 func TestChunkedTransferIntegration(t *testing.T) {
@@ -95,14 +105,14 @@ func TestChunkedTransferIntegration(t *testing.T) {
 		t.Fatalf("Failed to calculate original file hash: %v", err)
 	}
 
-	if !verifyFileIntegrity(receivedFile, originalHash) {
+	if !verifyFileIntegrity(receivedFile, HashSHA256, originalHash) {
 		t.Fatal("File integrity verification failed")
 	}
 }
 
 func TestGetRequiredChunks(t *testing.T) {
 	// Test with non-existent file
-	chunks := getRequiredChunks("nonexistent.txt", 3072, 1024)
+	chunks := getRequiredChunks("nonexistent.txt", "", 3072, 1024)
 	if len(chunks) != 3 {
 		t.Errorf("Expected 3 chunks for non-existent file, got %d", len(chunks))
 	}
@@ -127,7 +137,7 @@ func TestGetRequiredChunks(t *testing.T) {
 	}
 	defer os.Remove(receivedPartialFile)
 
-	chunks = getRequiredChunks(partialFile, 3072, 1024)
+	chunks = getRequiredChunks(receivedPartialFile, "", 3072, 1024)
 	if len(chunks) != 2 {
 		t.Errorf("Expected 2 chunks for partial file, got %d", len(chunks))
 	}
@@ -140,3 +150,1255 @@ func TestGetRequiredChunks(t *testing.T) {
 		}
 	}
 }
+
+func TestGetRequiredChunksDetectsHoles(t *testing.T) {
+	// Chunks 0 and 2 were written out of order, chunk 1 is still a hole
+	sparseFile := filepath.Join(t.TempDir(), "received_sparse.bin")
+	file, err := os.Create(sparseFile)
+	if err != nil {
+		t.Fatalf("Failed to create sparse file: %v", err)
+	}
+	chunk := bytes.Repeat([]byte("A"), 1024)
+	if _, err := file.WriteAt(chunk, 0); err != nil {
+		t.Fatalf("Failed to write chunk 0: %v", err)
+	}
+	if _, err := file.WriteAt(chunk, 2048); err != nil {
+		t.Fatalf("Failed to write chunk 2: %v", err)
+	}
+	file.Close()
+
+	chunks := getRequiredChunks(sparseFile, "", 4000, 1024)
+	if len(chunks) != 2 || chunks[0] != 1 || chunks[1] != 3 {
+		t.Errorf("Expected the hole and the unwritten tail [1 3], got %v", chunks)
+	}
+
+	// A complete file needs nothing
+	if err := os.Truncate(sparseFile, 4000); err != nil {
+		t.Fatalf("Failed to extend file: %v", err)
+	}
+	file, err = os.OpenFile(sparseFile, os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open sparse file: %v", err)
+	}
+	file.WriteAt(chunk, 1024)
+	file.WriteAt(chunk[:928], 3072)
+	file.Close()
+	if chunks := getRequiredChunks(sparseFile, "", 4000, 1024); len(chunks) != 0 {
+		t.Errorf("Expected no chunks for a complete file, got %v", chunks)
+	}
+}
+
+func TestReceiveChunkRejectsOutOfRangeChunks(t *testing.T) {
+	// A 2500-byte file in 1024-byte chunks has chunks 0-2, the last one 452 bytes
+	expectedSize := func(chunkIndex int64) (int, error) {
+		return chunkSizeAt(2500, 1024, chunkIndex)
+	}
+	chunkStream := func(chunkIndex uint64, data []byte) *bytes.Reader {
+		header := make([]byte, ChunkHeaderSize)
+		binary.BigEndian.PutUint64(header[0:8], chunkIndex)
+		binary.BigEndian.PutUint32(header[8:12], uint32(len(data)))
+		checksum := sumChunk(HashSHA256, data)
+		copy(header[12:44], checksum[:])
+		return bytes.NewReader(append(header, data...))
+	}
+
+	chunk, err := receiveChunkReliably(context.Background(), chunkStream(2, make([]byte, 452)), CompressionNone, HashSHA256, expectedSize)
+	if err != nil {
+		t.Fatalf("Expected the last chunk to be accepted: %v", err)
+	}
+	chunk.release()
+
+	// An index far past the end would otherwise grow a sparse file to terabytes
+	if _, err := receiveChunkReliably(context.Background(), chunkStream(1<<40, make([]byte, 1024)), CompressionNone, HashSHA256, expectedSize); !errors.Is(err, ErrChunkCorrupted) {
+		t.Errorf("Expected ErrChunkCorrupted for an index past the file, got %v", err)
+	}
+	if _, err := receiveChunkReliably(context.Background(), chunkStream(1<<63, make([]byte, 1024)), CompressionNone, HashSHA256, expectedSize); !errors.Is(err, ErrChunkCorrupted) {
+		t.Errorf("Expected ErrChunkCorrupted for a negative index, got %v", err)
+	}
+
+	// So would a last chunk that runs past the announced size
+	if _, err := receiveChunkReliably(context.Background(), chunkStream(2, make([]byte, 1024)), CompressionNone, HashSHA256, expectedSize); !errors.Is(err, ErrChunkCorrupted) {
+		t.Errorf("Expected ErrChunkCorrupted for an oversized chunk, got %v", err)
+	}
+}
+
+func TestDirectoryTransferIntegration(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	// Build a small tree with a nested file, an empty directory and a symlink
+	sourceDir := filepath.Join(t.TempDir(), "photos")
+	if err := os.MkdirAll(filepath.Join(sourceDir, "2024", "summer"), 0755); err != nil {
+		t.Fatalf("Failed to create source tree: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(sourceDir, "empty"), 0755); err != nil {
+		t.Fatalf("Failed to create empty directory: %v", err)
+	}
+	files := map[string]string{
+		"cover.txt":             "top-level file",
+		"2024/summer/beach.txt": "nested file contents",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(sourceDir, filepath.FromSlash(name)), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(sourceDir, "cover.txt"), filepath.Join(sourceDir, "link.txt")); err != nil {
+		t.Logf("Symlinks unsupported, skipping symlink check: %v", err)
+	}
+
+	// Find an available port
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	outputDir := t.TempDir()
+	config := DefaultReceiverConfig()
+	config.OutputDir = outputDir
+
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), config)
+	}()
+
+	// Give receiver time to start
+	time.Sleep(100 * time.Millisecond)
+
+	if err := SendDirectoryChunked(sourceDir, fmt.Sprintf("127.0.0.1:%d", port)); err != nil {
+		t.Fatalf("Sender failed: %v", err)
+	}
+
+	select {
+	case err := <-receiverDone:
+		if err != nil {
+			t.Fatalf("Receiver failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Test timed out")
+	}
+
+	receivedRoot := filepath.Join(outputDir, "received_photos")
+	for name, content := range files {
+		data, err := ioutil.ReadFile(filepath.Join(receivedRoot, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("Failed to read received %s: %v", name, err)
+			continue
+		}
+		if string(data) != content {
+			t.Errorf("Content mismatch for %s", name)
+		}
+	}
+
+	if info, err := os.Stat(filepath.Join(receivedRoot, "empty")); err != nil || !info.IsDir() {
+		t.Errorf("Expected empty directory to be recreated")
+	}
+
+	if _, err := os.Lstat(filepath.Join(receivedRoot, "link.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected symlink to be skipped")
+	}
+}
+
+func TestParallelChunkTransferIntegration(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	// Use the smallest chunk size so the file spans many chunks sent concurrently
+	testContent := make([]byte, 20*MinChunkSize+123)
+	for i := range testContent {
+		testContent[i] = byte(i * 31 % 251)
+	}
+	testFile := filepath.Join(t.TempDir(), "parallel.bin")
+	if err := ioutil.WriteFile(testFile, testContent, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// Find an available port
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	receiverConfig := DefaultReceiverConfig()
+	receiverConfig.OutputDir = t.TempDir()
+
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), receiverConfig)
+	}()
+
+	// Give receiver time to start
+	time.Sleep(100 * time.Millisecond)
+
+	senderConfig := DefaultSenderConfig()
+	senderConfig.ChunkSize = MinChunkSize
+	if err := SendFileChunkedWithConfig(testFile, fmt.Sprintf("127.0.0.1:%d", port), senderConfig); err != nil {
+		t.Fatalf("Sender failed: %v", err)
+	}
+
+	select {
+	case err := <-receiverDone:
+		if err != nil {
+			t.Fatalf("Receiver failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Test timed out")
+	}
+
+	receivedContent, err := ioutil.ReadFile(filepath.Join(receiverConfig.OutputDir, "received_parallel.bin"))
+	if err != nil {
+		t.Fatalf("Failed to read received file: %v", err)
+	}
+	if string(receivedContent) != string(testContent) {
+		t.Fatal("File content mismatch")
+	}
+}
+
+func TestCompressedChunkTransferIntegration(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	// Repetitive text spanning several chunks compresses well
+	var testContent []byte
+	for i := 0; len(testContent) < int(3*MinChunkSize); i++ {
+		testContent = append(testContent, fmt.Sprintf("log line %d: transfer ok\n", i)...)
+	}
+	testFile := filepath.Join(t.TempDir(), "server.log")
+	if err := ioutil.WriteFile(testFile, testContent, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// Find an available port
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	receiverConfig := DefaultReceiverConfig()
+	receiverConfig.OutputDir = t.TempDir()
+
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), receiverConfig)
+	}()
+
+	// Give receiver time to start
+	time.Sleep(100 * time.Millisecond)
+
+	senderConfig := DefaultSenderConfig()
+	senderConfig.ChunkSize = MinChunkSize
+	senderConfig.Compression = CompressionZstd
+	if err := SendFileChunkedWithConfig(testFile, fmt.Sprintf("127.0.0.1:%d", port), senderConfig); err != nil {
+		t.Fatalf("Sender failed: %v", err)
+	}
+
+	select {
+	case err := <-receiverDone:
+		if err != nil {
+			t.Fatalf("Receiver failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Test timed out")
+	}
+
+	receivedContent, err := ioutil.ReadFile(filepath.Join(receiverConfig.OutputDir, "received_server.log"))
+	if err != nil {
+		t.Fatalf("Failed to read received file: %v", err)
+	}
+	if string(receivedContent) != string(testContent) {
+		t.Fatal("File content mismatch")
+	}
+}
+
+func TestBLAKE3ChunkTransferIntegration(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	testContent := make([]byte, 3*MinChunkSize+100)
+	for i := range testContent {
+		testContent[i] = byte(i * 31 % 251)
+	}
+	testFile := filepath.Join(t.TempDir(), "hashed.bin")
+	if err := ioutil.WriteFile(testFile, testContent, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// Find an available port
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	receiverConfig := DefaultReceiverConfig()
+	receiverConfig.OutputDir = t.TempDir()
+	receiverConfig.WriteManifest = true
+
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), receiverConfig)
+	}()
+
+	// Give receiver time to start
+	time.Sleep(100 * time.Millisecond)
+
+	senderConfig := DefaultSenderConfig()
+	senderConfig.ChunkSize = MinChunkSize
+	senderConfig.HashAlgorithm = HashBLAKE3
+	if err := SendFileChunkedWithConfig(testFile, fmt.Sprintf("127.0.0.1:%d", port), senderConfig); err != nil {
+		t.Fatalf("Sender failed: %v", err)
+	}
+
+	select {
+	case err := <-receiverDone:
+		if err != nil {
+			t.Fatalf("Receiver failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Test timed out")
+	}
+
+	outputFile := filepath.Join(receiverConfig.OutputDir, "received_hashed.bin")
+	receivedContent, err := ioutil.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read received file: %v", err)
+	}
+	if string(receivedContent) != string(testContent) {
+		t.Fatal("File content mismatch")
+	}
+
+	// The receiver verified with BLAKE3, so the manifest records it too
+	manifest, err := ReadManifest(outputFile + ManifestFileSuffix)
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	if manifest.HashAlgorithm != HashBLAKE3 {
+		t.Errorf("Expected the manifest to use blake3, got %q", manifest.HashAlgorithm)
+	}
+	if mismatched, err := manifest.Verify(outputFile); err != nil || len(mismatched) != 0 {
+		t.Errorf("Expected every chunk to verify, got %v (%v)", mismatched, err)
+	}
+}
+
+func TestDaemonReceiverServesMultipleTransfers(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	sourceDir := t.TempDir()
+	names := []string{"first.txt", "second.txt"}
+	for _, name := range names {
+		if err := ioutil.WriteFile(filepath.Join(sourceDir, name), []byte("contents of "+name), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	// Find an available port
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	receiverConfig := DefaultReceiverConfig()
+	receiverConfig.OutputDir = t.TempDir()
+	receiverConfig.Daemon = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileChunkedContext(ctx, fmt.Sprintf("%d", port), receiverConfig)
+	}()
+
+	// Give receiver time to start
+	time.Sleep(100 * time.Millisecond)
+
+	// Each send is a separate connection; a single-shot receiver would stop after the first.
+	// The bogus one in between must not take the listener down.
+	peerAddr := fmt.Sprintf("127.0.0.1:%d", port)
+	if err := SendFileChunked(filepath.Join(sourceDir, names[0]), peerAddr); err != nil {
+		t.Fatalf("First send failed: %v", err)
+	}
+	conn, err := quic.DialAddr(context.Background(), peerAddr, GetClientTLSConfig(), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial receiver: %v", err)
+	}
+	conn.CloseWithError(0, "")
+	if err := SendFileChunked(filepath.Join(sourceDir, names[1]), peerAddr); err != nil {
+		t.Fatalf("Second send failed: %v", err)
+	}
+
+	for _, name := range names {
+		content, err := ioutil.ReadFile(filepath.Join(receiverConfig.OutputDir, "received_"+name))
+		if err != nil {
+			t.Fatalf("Failed to read received file: %v", err)
+		}
+		if string(content) != "contents of "+name {
+			t.Errorf("Content mismatch for %s", name)
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-receiverDone:
+		if err != nil {
+			t.Fatalf("Daemon receiver returned error: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Daemon receiver did not stop after cancellation")
+	}
+}
+
+func TestDaemonRejectsDuplicateConcurrentTransfer(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+	duplicateTransferGrace = 100 * time.Millisecond
+	defer func() { duplicateTransferGrace = DuplicateTransferGrace }()
+
+	content := bytes.Repeat([]byte("bigfile "), int(8*MinChunkSize/8))
+	testFile := filepath.Join(t.TempDir(), "bigfile.bin")
+	if err := os.WriteFile(testFile, content, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	receiverConfig := DefaultReceiverConfig()
+	receiverConfig.OutputDir = t.TempDir()
+	receiverConfig.Daemon = true
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileChunkedContext(ctx, fmt.Sprintf("%d", port), receiverConfig)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// The first send is slowed down so the second arrives while it's still running
+	peerAddr := fmt.Sprintf("127.0.0.1:%d", port)
+	slowConfig := DefaultSenderConfig()
+	slowConfig.ChunkSize = MinChunkSize
+	slowConfig.MaxRate = 2 * MinChunkSize
+	firstDone := make(chan error, 1)
+	go func() {
+		firstDone <- SendFileChunkedWithConfig(testFile, peerAddr, slowConfig)
+	}()
+	time.Sleep(500 * time.Millisecond)
+
+	var rejection RejectionCode
+	duplicateConfig := DefaultSenderConfig()
+	duplicateConfig.ChunkSize = MinChunkSize
+	duplicateConfig.OnResult = func(stats *TransferStats) { rejection = stats.RejectionCode }
+	if err := SendFileChunkedWithConfig(testFile, peerAddr, duplicateConfig); err != nil {
+		t.Fatalf("Duplicate send failed: %v", err)
+	}
+	if rejection != RejectionInProgress {
+		t.Errorf("Expected the duplicate to be rejected with %q, got %q", RejectionInProgress, rejection)
+	}
+
+	select {
+	case err := <-firstDone:
+		if err != nil {
+			t.Fatalf("First send failed: %v", err)
+		}
+	case <-time.After(15 * time.Second):
+		t.Fatal("First send timed out")
+	}
+	received, err := os.ReadFile(filepath.Join(receiverConfig.OutputDir, "received_bigfile.bin"))
+	if err != nil || !bytes.Equal(received, content) {
+		t.Errorf("Expected the first transfer's file intact (%v)", err)
+	}
+	if _, err := os.Stat(filepath.Join(receiverConfig.OutputDir, "received_bigfile (1).bin")); !os.IsNotExist(err) {
+		t.Errorf("Expected no second copy of the file, got %v", err)
+	}
+}
+
+func TestChunkedTransferToStream(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	// Several chunks, so concurrent chunk streams can complete out of order
+	content := make([]byte, 5*MinChunkSize+123)
+	for i := range content {
+		content[i] = byte(i * 31 % 251)
+	}
+	path, cleanup, err := SpoolToTempFile(bytes.NewReader(content), "")
+	if err != nil {
+		t.Fatalf("Failed to spool test data: %v", err)
+	}
+	defer cleanup()
+
+	// Find an available port
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	var output bytes.Buffer
+	receiverConfig := DefaultReceiverConfig()
+	receiverConfig.OutputDir = t.TempDir()
+	receiverConfig.Output = &output
+
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), receiverConfig)
+	}()
+
+	// Give receiver time to start
+	time.Sleep(100 * time.Millisecond)
+
+	senderConfig := DefaultSenderConfig()
+	senderConfig.ChunkSize = MinChunkSize
+	if err := SendFileChunkedWithConfig(path, fmt.Sprintf("127.0.0.1:%d", port), senderConfig); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if err := <-receiverDone; err != nil {
+		t.Fatalf("Receive failed: %v", err)
+	}
+
+	if !bytes.Equal(output.Bytes(), content) {
+		t.Errorf("Expected streamed output to match the sent data (%d bytes), got %d bytes", len(content), output.Len())
+	}
+	if entries, _ := os.ReadDir(receiverConfig.OutputDir); len(entries) != 0 {
+		t.Errorf("Expected nothing written to the output directory, found %d entries", len(entries))
+	}
+}
+
+func TestChunkedDryRunSendsNoData(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	testFile := filepath.Join(t.TempDir(), "preview.txt")
+	if err := ioutil.WriteFile(testFile, []byte("not actually sent"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// Find an available port
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	receiverConfig := DefaultReceiverConfig()
+	receiverConfig.OutputDir = t.TempDir()
+
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), receiverConfig)
+	}()
+
+	// Give receiver time to start
+	time.Sleep(100 * time.Millisecond)
+
+	senderConfig := DefaultSenderConfig()
+	senderConfig.DryRun = true
+	if err := SendFileChunkedWithConfig(testFile, fmt.Sprintf("127.0.0.1:%d", port), senderConfig); err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+
+	select {
+	case err := <-receiverDone:
+		if err != nil {
+			t.Fatalf("Receiver failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Receiver did not finish after the dry run")
+	}
+
+	if entries, _ := os.ReadDir(receiverConfig.OutputDir); len(entries) != 0 {
+		t.Errorf("Expected a dry run to leave the output directory empty, found %d entries", len(entries))
+	}
+}
+
+func TestSendFilesChunkedUsesOneConnection(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	sourceDir := t.TempDir()
+	names := []string{"a.txt", "b.txt", "c.txt"}
+	var paths []string
+	for _, name := range names {
+		path := filepath.Join(sourceDir, name)
+		if err := ioutil.WriteFile(path, []byte("contents of "+name), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		paths = append(paths, path)
+	}
+
+	if err := SendFilesChunkedWithConfig(append(paths, filepath.Join(sourceDir, "missing.txt")), "127.0.0.1:1", DefaultSenderConfig()); err == nil {
+		t.Error("Expected error for a missing file before dialing")
+	}
+
+	// Find an available port
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	// A single-shot receiver only serves one connection, so every file must share it
+	receiverConfig := DefaultReceiverConfig()
+	receiverConfig.OutputDir = t.TempDir()
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), receiverConfig)
+	}()
+
+	// Give receiver time to start
+	time.Sleep(100 * time.Millisecond)
+
+	if err := SendFilesChunkedWithConfig(paths, fmt.Sprintf("127.0.0.1:%d", port), DefaultSenderConfig()); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if err := <-receiverDone; err != nil {
+		t.Fatalf("Receive failed: %v", err)
+	}
+
+	for _, name := range names {
+		content, err := ioutil.ReadFile(filepath.Join(receiverConfig.OutputDir, "received_"+name))
+		if err != nil {
+			t.Fatalf("Failed to read received file: %v", err)
+		}
+		if string(content) != "contents of "+name {
+			t.Errorf("Content mismatch for %s", name)
+		}
+	}
+}
+
+func TestReceiverRejectsSenderNotOnAllowlist(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	testFile := filepath.Join(t.TempDir(), "blocked.txt")
+	if err := ioutil.WriteFile(testFile, []byte("should not arrive"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// Find an available port
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	receiverConfig := DefaultReceiverConfig()
+	receiverConfig.OutputDir = t.TempDir()
+	receiverConfig.AllowedDevices = []string{"some-other-device (00000000)"}
+
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), receiverConfig)
+	}()
+
+	// Give receiver time to start
+	time.Sleep(100 * time.Millisecond)
+
+	if err := SendFileChunked(testFile, fmt.Sprintf("127.0.0.1:%d", port)); err != nil {
+		t.Fatalf("Expected the rejection to be reported as a normal outcome, got %v", err)
+	}
+	if err := <-receiverDone; !errors.Is(err, ErrTransferRejected) {
+		t.Errorf("Expected ErrTransferRejected from the receiver, got %v", err)
+	}
+	if entries, _ := os.ReadDir(receiverConfig.OutputDir); len(entries) != 0 {
+		t.Errorf("Expected nothing written for a rejected sender, found %d entries", len(entries))
+	}
+}
+
+func TestReceiverRejectsFileOverSizeLimit(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	testFile := filepath.Join(t.TempDir(), "large.bin")
+	if err := ioutil.WriteFile(testFile, make([]byte, 4096), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// Find an available port
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	receiverConfig := DefaultReceiverConfig()
+	receiverConfig.OutputDir = t.TempDir()
+	receiverConfig.MaxFileSize = 1024
+
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), receiverConfig)
+	}()
+
+	// Give receiver time to start
+	time.Sleep(100 * time.Millisecond)
+
+	if err := SendFileChunked(testFile, fmt.Sprintf("127.0.0.1:%d", port)); err != nil {
+		t.Fatalf("Expected the rejection to be reported as a normal outcome, got %v", err)
+	}
+	err = <-receiverDone
+	if !errors.Is(err, ErrFileTooLarge) || !errors.Is(err, ErrTransferRejected) {
+		t.Errorf("Expected a rejection wrapping ErrFileTooLarge, got %v", err)
+	}
+	if entries, _ := os.ReadDir(receiverConfig.OutputDir); len(entries) != 0 {
+		t.Errorf("Expected nothing written for an oversized file, found %d entries", len(entries))
+	}
+
+	// A negative limit would have meant unlimited, so it's refused instead
+	receiverConfig.MaxFileSize = -1
+	if err := ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), receiverConfig); err == nil {
+		t.Error("Expected a negative max file size to be rejected")
+	}
+}
+
+func TestSenderRetriesDialUntilReceiverStarts(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	testFile := filepath.Join(t.TempDir(), "early.txt")
+	if err := ioutil.WriteFile(testFile, []byte("sent before the receiver was up"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// Find an available port
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	peerAddr := fmt.Sprintf("127.0.0.1:%d", port)
+
+	senderConfig := DefaultSenderConfig()
+	senderConfig.DialAttempts = 2
+	senderConfig.DialTimeout = 100 * time.Millisecond
+	if err := SendFileChunkedWithConfig(testFile, peerAddr, senderConfig); !errors.Is(err, ErrConnectionFailed) {
+		t.Fatalf("Expected ErrConnectionFailed with no receiver, got %v", err)
+	}
+
+	// Start the receiver only after the first attempts have timed out
+	receiverConfig := DefaultReceiverConfig()
+	receiverConfig.OutputDir = t.TempDir()
+	receiverDone := make(chan error, 1)
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		receiverDone <- ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), receiverConfig)
+	}()
+
+	senderConfig.DialAttempts = 10
+	if err := SendFileChunkedWithConfig(testFile, peerAddr, senderConfig); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if err := <-receiverDone; err != nil {
+		t.Fatalf("Receive failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(receiverConfig.OutputDir, "received_early.txt")); err != nil {
+		t.Errorf("Expected the file to be received: %v", err)
+	}
+}
+
+// BenchmarkChunkedLoopbackTransfer measures end-to-end throughput of a chunked transfer over loopback
+func BenchmarkChunkedLoopbackTransfer(b *testing.B) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	// Many small chunks, so per-chunk overhead dominates
+	content := make([]byte, 64*1024*1024)
+	for i := range content {
+		content[i] = byte(i * 31 % 251)
+	}
+	testFile := filepath.Join(b.TempDir(), "bench.bin")
+	if err := ioutil.WriteFile(testFile, content, 0644); err != nil {
+		b.Fatalf("Failed to create test file: %v", err)
+	}
+
+	senderConfig := DefaultSenderConfig()
+	senderConfig.ChunkSize = 256 * 1024
+
+	b.SetBytes(int64(len(content)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		listener, err := net.Listen("tcp", ":0")
+		if err != nil {
+			b.Fatalf("Failed to find available port: %v", err)
+		}
+		port := listener.Addr().(*net.TCPAddr).Port
+		listener.Close()
+
+		receiverConfig := DefaultReceiverConfig()
+		receiverConfig.OutputDir = b.TempDir()
+		receiverDone := make(chan error, 1)
+		go func() {
+			receiverDone <- ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), receiverConfig)
+		}()
+		time.Sleep(100 * time.Millisecond)
+		b.StartTimer()
+
+		if err := SendFileChunkedWithConfig(testFile, fmt.Sprintf("127.0.0.1:%d", port), senderConfig); err != nil {
+			b.Fatalf("Send failed: %v", err)
+		}
+		if err := <-receiverDone; err != nil {
+			b.Fatalf("Receive failed: %v", err)
+		}
+	}
+}
+
+func TestResumeTruncatesOversizedPartialFile(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	testContent := make([]byte, 3*MinChunkSize+100)
+	for i := range testContent {
+		testContent[i] = byte(i * 31 % 251)
+	}
+	testFile := filepath.Join(t.TempDir(), "shrunk.bin")
+	if err := ioutil.WriteFile(testFile, testContent, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	info, err := os.Stat(testFile)
+	if err != nil {
+		t.Fatalf("Failed to stat test file: %v", err)
+	}
+
+	// The partial file holds the first two chunks, followed by leftovers from a larger file
+	receiverConfig := DefaultReceiverConfig()
+	receiverConfig.OutputDir = t.TempDir()
+	outputFile := filepath.Join(receiverConfig.OutputDir, "received_shrunk.bin")
+	partial := append(append([]byte{}, testContent[:2*MinChunkSize]...), bytes.Repeat([]byte{0xee}, int(3*MinChunkSize))...)
+	if err := ioutil.WriteFile(partialFilePath(outputFile), partial, 0644); err != nil {
+		t.Fatalf("Failed to create partial file: %v", err)
+	}
+	request := &TransferRequest{HashTrailer: true, SourceID: fileSourceID(testFile, info)}
+	progress := newChunkProgress(partialFilePath(outputFile), request.resumeKey(), int64(len(testContent)), MinChunkSize, []int{2, 3})
+	if err := progress.save(); err != nil {
+		t.Fatalf("Failed to save progress: %v", err)
+	}
+
+	// Find an available port
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), receiverConfig)
+	}()
+
+	// Give receiver time to start
+	time.Sleep(100 * time.Millisecond)
+
+	senderConfig := DefaultSenderConfig()
+	senderConfig.ChunkSize = MinChunkSize
+	if err := SendFileChunkedWithConfig(testFile, fmt.Sprintf("127.0.0.1:%d", port), senderConfig); err != nil {
+		t.Fatalf("Sender failed: %v", err)
+	}
+	if err := <-receiverDone; err != nil {
+		t.Fatalf("Receiver failed: %v", err)
+	}
+
+	receivedContent, err := ioutil.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read received file: %v", err)
+	}
+	if len(receivedContent) != len(testContent) {
+		t.Fatalf("Expected the file to be truncated to %d bytes, got %d", len(testContent), len(receivedContent))
+	}
+	if string(receivedContent) != string(testContent) {
+		t.Fatal("File content mismatch")
+	}
+}
+
+func TestCancelledReceiverKeepsPartialFileResumable(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	testContent := make([]byte, 8*MinChunkSize)
+	for i := range testContent {
+		testContent[i] = byte(i * 31 % 251)
+	}
+	testFile := filepath.Join(t.TempDir(), "partial.bin")
+	if err := ioutil.WriteFile(testFile, testContent, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// Find an available port
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	receiverConfig := DefaultReceiverConfig()
+	receiverConfig.OutputDir = t.TempDir()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileChunkedContext(ctx, fmt.Sprintf("%d", port), receiverConfig)
+	}()
+
+	// Give receiver time to start
+	time.Sleep(100 * time.Millisecond)
+
+	// Throttle the sender so the transfer is still running when the receiver is interrupted
+	senderConfig := DefaultSenderConfig()
+	senderConfig.ChunkSize = MinChunkSize
+	senderConfig.MaxRate = 2 * MinChunkSize
+	senderDone := make(chan error, 1)
+	go func() {
+		senderDone <- SendFileChunkedWithConfig(testFile, fmt.Sprintf("127.0.0.1:%d", port), senderConfig)
+	}()
+
+	time.Sleep(1500 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-receiverDone:
+		if err == nil {
+			t.Fatal("Expected the interrupted receive to fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Receiver didn't shut down after cancellation")
+	}
+	select {
+	case err := <-senderDone:
+		if err == nil {
+			t.Fatal("Expected the sender to notice the receiver shutting down")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Sender didn't notice the receiver shutting down")
+	}
+
+	// Until it's verified the file only exists under its partial name
+	outputFile := filepath.Join(receiverConfig.OutputDir, "received_partial.bin")
+	if _, err := os.Stat(partialFilePath(outputFile)); err != nil {
+		t.Fatalf("Expected the partial file to be kept: %v", err)
+	}
+	if _, err := os.Stat(outputFile); !os.IsNotExist(err) {
+		t.Fatalf("Expected nothing under the final name before the transfer completes, got %v", err)
+	}
+	// The hash only follows the last chunk, so the sidecar is keyed by the sender's source ID
+	info, err := os.Stat(testFile)
+	if err != nil {
+		t.Fatalf("Failed to stat test file: %v", err)
+	}
+	request := &TransferRequest{HashTrailer: true, SourceID: fileSourceID(testFile, info)}
+	progress, err := loadChunkProgress(partialFilePath(outputFile), request.resumeKey(), int64(len(testContent)), MinChunkSize)
+	if err != nil {
+		t.Fatalf("Expected a usable progress file: %v", err)
+	}
+	if missing := len(progress.missingChunks()); missing == 0 || missing == 8 {
+		t.Errorf("Expected some but not all chunks to be recorded, %d of 8 missing", missing)
+	}
+
+	// Sending again resumes into the same file and verifies it against the trailer
+	go func() {
+		receiverDone <- ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), receiverConfig)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	senderConfig.MaxRate = 0
+	if err := SendFileChunkedWithConfig(testFile, fmt.Sprintf("127.0.0.1:%d", port), senderConfig); err != nil {
+		t.Fatalf("Resumed send failed: %v", err)
+	}
+	if err := <-receiverDone; err != nil {
+		t.Fatalf("Resumed receive failed: %v", err)
+	}
+	receivedContent, err := ioutil.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read received file: %v", err)
+	}
+	if string(receivedContent) != string(testContent) {
+		t.Fatal("File content mismatch after resuming")
+	}
+	if _, err := os.Stat(partialFilePath(outputFile)); !os.IsNotExist(err) {
+		t.Errorf("Expected the partial file to be renamed, got %v", err)
+	}
+	if _, err := os.Stat(progressFilePath(partialFilePath(outputFile))); !os.IsNotExist(err) {
+		t.Errorf("Expected the progress file to be removed, got %v", err)
+	}
+}
+
+func TestReceiverTransferTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	config := DefaultReceiverConfig()
+	config.OutputDir = t.TempDir()
+	config.TransferTimeout = 200 * time.Millisecond
+	start := time.Now()
+	if err := ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), config); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the receiver to give up waiting, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the timeout to apply, took %v", elapsed)
+	}
+
+	config.TransferTimeout = -time.Second
+	if err := ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), config); err == nil {
+		t.Error("Expected a negative transfer timeout to be rejected")
+	}
+}
+
+func TestTransferContextWithoutDeadline(t *testing.T) {
+	ctx, cancel := transferContext(context.Background(), 0)
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("Expected a zero timeout to leave the transfer without a deadline")
+	}
+
+	streamCtx, streamCancel := createStreamContext(ctx, 0)
+	defer streamCancel()
+	if deadline, ok := streamCtx.Deadline(); !ok || time.Until(deadline) > StreamTimeout {
+		t.Error("Expected a zero stream timeout to fall back to StreamTimeout")
+	}
+}
+
+func TestChunkAckStopsRetriesOnPermanentFailure(t *testing.T) {
+	listener, err := quic.ListenAddr("127.0.0.1:0", GetServerTLSConfig(), newQUICConfig())
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	// The receiver only expects chunk 0, so chunk 5 is refused for good and chunk 0 with a bad
+	// checksum is worth retrying
+	attempts := make(chan int64, MaxRetries*2)
+	go func() {
+		conn, err := listener.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		expectedSize := func(chunkIndex int64) (int, error) {
+			return chunkSizeAt(100, 100, chunkIndex)
+		}
+		for {
+			stream, err := conn.AcceptStream(context.Background())
+			if err != nil {
+				return
+			}
+			chunk, err := receiveChunkReliably(context.Background(), stream, CompressionNone, HashBLAKE3, expectedSize)
+			var failed *chunkReceiveError
+			if !errors.As(err, &failed) {
+				t.Errorf("Expected the failure to name the chunk, got %v", err)
+				return
+			}
+			if chunk != nil {
+				chunk.release()
+			}
+			attempts <- failed.chunkIndex
+			acknowledgeChunk(stream, true, failed.chunkIndex, err, errors.Is(err, ErrChunkCorrupted))
+		}
+	}()
+
+	conn, err := quic.DialAddr(context.Background(), listener.Addr().String(), GetClientTLSConfig(), newQUICConfig())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.CloseWithError(0, "")
+
+	// The sender checksums with SHA-256, which the receiver checking BLAKE3 sums won't match
+	retry := retryPolicy{attempts: MaxRetries, delay: 20 * time.Millisecond}
+	made, err := sendChunkWithRetry(context.Background(), conn, nil, StreamTimeout, CompressionNone, HashSHA256, true, retry, 5, make([]byte, 100))
+	if !errors.Is(err, ErrChunkCorrupted) || !strings.Contains(err.Error(), "outside the file") {
+		t.Errorf("Expected the receiver's reason as ErrChunkCorrupted, got %v", err)
+	}
+	if n := len(attempts); n != 1 || made != 1 {
+		t.Errorf("Expected a permanent failure not to be retried, got %d attempts (%d reported)", n, made)
+	}
+
+	<-attempts
+	start := time.Now()
+	made, err = sendChunkWithRetry(context.Background(), conn, nil, StreamTimeout, CompressionNone, HashSHA256, true, retry, 0, make([]byte, 100))
+	if err == nil || errors.Is(err, ErrChunkCorrupted) || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("Expected the checksum failure to be reported, got %v", err)
+	}
+	if n := len(attempts); n != MaxRetries || made != MaxRetries {
+		t.Errorf("Expected a checksum failure to be retried %d times, got %d attempts (%d reported)", MaxRetries, n, made)
+	}
+	// The pause doubles after each resend
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("Expected backoff of 20ms and then 40ms between attempts, took %v", elapsed)
+	}
+}
+
+func TestChunkedTransferOfEmptyFile(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	testFile := filepath.Join(t.TempDir(), "empty.txt")
+	if err := os.WriteFile(testFile, nil, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	receiverConfig := DefaultReceiverConfig()
+	receiverConfig.OutputDir = t.TempDir()
+	receiverConfig.OnConflict = ConflictOverwrite
+	receivedFile := filepath.Join(receiverConfig.OutputDir, "received_empty.txt")
+
+	// With the hash in a trailer, then upfront, which looks for chunks to resume in the file just received
+	for _, hashUpfront := range []bool{false, true} {
+		listener, err := net.Listen("tcp", ":0")
+		if err != nil {
+			t.Fatalf("Failed to find available port: %v", err)
+		}
+		port := listener.Addr().(*net.TCPAddr).Port
+		listener.Close()
+
+		var received *TransferStats
+		receiverConfig.AfterReceive = func(path string, stats *TransferStats) error {
+			received = stats
+			return nil
+		}
+		receiverDone := make(chan error, 1)
+		go func() {
+			receiverDone <- ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), receiverConfig)
+		}()
+		time.Sleep(100 * time.Millisecond)
+
+		senderConfig := DefaultSenderConfig()
+		senderConfig.HashUpfront = hashUpfront
+		var sent *TransferStats
+		senderConfig.OnResult = func(stats *TransferStats) {
+			sent = stats
+		}
+		if err := SendFileChunkedWithConfig(testFile, fmt.Sprintf("127.0.0.1:%d", port), senderConfig); err != nil {
+			t.Fatalf("Sender failed (hash upfront %v): %v", hashUpfront, err)
+		}
+		select {
+		case err := <-receiverDone:
+			if err != nil {
+				t.Fatalf("Receiver failed (hash upfront %v): %v", hashUpfront, err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("Test timed out")
+		}
+
+		info, err := os.Stat(receivedFile)
+		if err != nil || info.Size() != 0 {
+			t.Fatalf("Expected an empty received file (hash upfront %v), got %v", hashUpfront, err)
+		}
+		if sent == nil || sent.Status != "completed" || sent.TotalChunks != 0 {
+			t.Errorf("Expected the send to complete with no chunks, got %+v", sent)
+		}
+		if received == nil || received.Status != "completed" {
+			t.Errorf("Expected the receiver to report the file as verified, got %+v", received)
+		}
+	}
+}
+
+// failingWriter fails every write
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("injected write failure")
+}
+
+func TestChunkRetriesAreCounted(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	// The first two chunk streams fail to write; those chunks are distinct, since resends wait
+	// for the retry delay while the first streams are opened straight away
+	var opened atomic.Int32
+	chunkWriter = func(ctx context.Context, writer io.Writer, limiter *rateLimiter) io.Writer {
+		if opened.Add(1) <= 2 {
+			return failingWriter{}
+		}
+		return newRateLimitedWriter(ctx, writer, limiter)
+	}
+	defer func() { chunkWriter = newRateLimitedWriter }()
+
+	content := bytes.Repeat([]byte("r"), int(4*MinChunkSize))
+	testFile := filepath.Join(t.TempDir(), "flaky.bin")
+	if err := os.WriteFile(testFile, content, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	receiverConfig := DefaultReceiverConfig()
+	receiverConfig.OutputDir = t.TempDir()
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), receiverConfig)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	senderConfig := DefaultSenderConfig()
+	senderConfig.ChunkSize = MinChunkSize
+	senderConfig.ChunkRetryDelay = 50 * time.Millisecond
+	var stats *TransferStats
+	senderConfig.OnResult = func(result *TransferStats) {
+		stats = result
+	}
+	if err := SendFileChunkedWithConfig(testFile, fmt.Sprintf("127.0.0.1:%d", port), senderConfig); err != nil {
+		t.Fatalf("Sender failed: %v", err)
+	}
+	select {
+	case err := <-receiverDone:
+		if err != nil {
+			t.Fatalf("Receiver failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Test timed out")
+	}
+
+	if stats == nil || stats.Status != "completed" {
+		t.Fatalf("Expected the transfer to complete after retrying, got %+v", stats)
+	}
+	if stats.ChunksRetried != 2 || stats.TotalRetries != 2 {
+		t.Errorf("Expected 2 chunks retried once each, got %d chunks and %d resends", stats.ChunksRetried, stats.TotalRetries)
+	}
+	if data, err := os.ReadFile(filepath.Join(receiverConfig.OutputDir, "received_flaky.bin")); err != nil || !bytes.Equal(data, content) {
+		t.Errorf("Expected the file to arrive intact, got %d bytes (%v)", len(data), err)
+	}
+}
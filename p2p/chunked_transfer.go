@@ -4,15 +4,20 @@ import (
 	"bufio"
 	"bytes"
 	"context"
-	"crypto/sha256"
+	"crypto/tls"
 	"encoding/binary"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/quic-go/quic-go"
@@ -20,66 +25,82 @@ import (
 
 
 
-// createStreamContext creates a context with timeout for stream operations
-func createStreamContext(parentCtx context.Context) (context.Context, context.CancelFunc) {
-	return context.WithTimeout(parentCtx, StreamTimeout)
+// createStreamContext creates a context with timeout for stream operations, StreamTimeout when
+// timeout is zero
+func createStreamContext(parentCtx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		timeout = StreamTimeout
+	}
+	return context.WithTimeout(parentCtx, timeout)
 }
 
-// sendChunkWithRetry sends a single chunk using the reliable protocol
-func sendChunkWithRetry(ctx context.Context, conn quic.Connection, file *os.File, chunkIndex int64, offset, size int64) error {
-	var lastErr error
-
-	for attempt := 0; attempt < MaxRetries; attempt++ {
-		if attempt > 0 {
-			fmt.Printf("\nRetrying chunk %d (attempt %d/%d)...", chunkIndex, attempt+1, MaxRetries)
-		}
+// transferContext bounds a whole transfer by timeout, or only by parentCtx when timeout is zero
+func transferContext(parentCtx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(parentCtx)
+	}
+	return context.WithTimeout(parentCtx, timeout)
+}
 
-		// Seek to chunk position
-		_, err := file.Seek(offset, io.SeekStart)
-		if err != nil {
-			lastErr = fmt.Errorf("failed to seek to chunk %d: %w", chunkIndex, err)
-			continue
-		}
+// retryPolicy is how many times a chunk is sent and how long to wait before resending it
+type retryPolicy struct {
+	attempts int           // zero means one attempt
+	delay    time.Duration // before the first resend, doubling after each one up to ChunkRetryMaxDelay
+}
 
-		// Read chunk data from file using buffer pool for large chunks
-		var chunkData []byte
-		if size <= ChunkBufferSize {
-			chunkData = ChunkBufferPool.Get()
-			defer ChunkBufferPool.Put(chunkData)
-		} else {
-			chunkData = make([]byte, size)
-		}
+// sendChunkWithRetry sends a single chunk using the reliable protocol, resending the same data
+// with backoff until the receiver reports a failure that resending can't fix. It returns how many
+// attempts were made, for TransferStats.AddRetry.
+func sendChunkWithRetry(ctx context.Context, conn quic.Connection, limiter *rateLimiter, streamTimeout time.Duration, compression, hashAlgorithm string, chunkAcks bool, retry retryPolicy, chunkIndex int64, chunkData []byte) (int, error) {
+	attempts := max(retry.attempts, 1)
+	delay := retry.delay
+	var lastErr error
 
-		bytesRead, err := io.ReadFull(file, chunkData[:size])
-		if err != nil {
-			lastErr = fmt.Errorf("failed to read chunk %d from file: %w", chunkIndex, err)
-			continue
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			logf("\nRetrying chunk %d in %v (attempt %d/%d)...", chunkIndex, delay, attempt, attempts)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return attempt - 1, ctx.Err()
+			}
+			delay = min(delay*2, ChunkRetryMaxDelay)
 		}
-
-		// Verify we read exactly what we expected
-		if int64(bytesRead) != size {
-			lastErr = fmt.Errorf("chunk %d file read mismatch: expected %d, got %d", chunkIndex, size, bytesRead)
-			continue
+		if ctx.Err() != nil {
+			return attempt - 1, ctx.Err()
 		}
 
 		// Send chunk using reliable protocol
-		err = sendChunkReliably(ctx, conn, chunkIndex, chunkData[:bytesRead])
+		err := sendChunkReliably(ctx, conn, limiter, streamTimeout, compression, hashAlgorithm, chunkAcks, chunkIndex, chunkData)
+		var rejected *chunkRejectedError
+		if errors.As(err, &rejected) {
+			logf("\nReceiver rejected chunk %d: %s\n", chunkIndex, rejected.reason)
+			if rejected.permanent {
+				return attempt, err
+			}
+		}
 		if err != nil {
 			lastErr = fmt.Errorf("failed to send chunk %d reliably: %w", chunkIndex, err)
 			continue
 		}
 
 		// Successfully sent chunk
-		return nil
+		return attempt, nil
 	}
 
-	return lastErr
+	return attempts, lastErr
 }
 
-// sendChunkReliably sends a chunk using fast binary protocol
-func sendChunkReliably(ctx context.Context, conn quic.Connection, chunkIndex int64, data []byte) error {
+// chunkWriter wraps each chunk stream for writing, pacing it through the rate limiter. Tests
+// replace it to make writes fail.
+var chunkWriter = newRateLimitedWriter
+
+// sendChunkReliably sends a chunk using fast binary protocol, pacing writes through limiter if set.
+// With compression negotiated the checksum still covers the uncompressed data. With chunkAcks the
+// receiver answers with a ChunkAck, whose reason is returned in a chunkRejectedError on failure.
+func sendChunkReliably(ctx context.Context, conn quic.Connection, limiter *rateLimiter, streamTimeout time.Duration, compression, hashAlgorithm string, chunkAcks bool, chunkIndex int64, data []byte) error {
 	// Open stream for this chunk
-	streamCtx, streamCancel := createStreamContext(ctx)
+	streamCtx, streamCancel := createStreamContext(ctx, streamTimeout)
 	chunkStream, err := conn.OpenStreamSync(streamCtx)
 	if err != nil {
 		streamCancel()
@@ -88,33 +109,58 @@ func sendChunkReliably(ctx context.Context, conn quic.Connection, chunkIndex int
 	defer chunkStream.Close()
 	defer streamCancel()
 
-	// Create simple binary header: [chunkIndex(8 bytes)][dataSize(4 bytes)][checksum(32 bytes)]
-	header := make([]byte, 44)
+	// Create simple binary header: [chunkIndex(8 bytes)][dataSize(4 bytes)][checksum(32 bytes)],
+	// followed by [wireSize(4 bytes)] when compression is negotiated
+	header := make([]byte, chunkHeaderLength(compression))
 	binary.BigEndian.PutUint64(header[0:8], uint64(chunkIndex))
 	binary.BigEndian.PutUint32(header[8:12], uint32(len(data)))
 
-	// Calculate SHA-256 checksum
-	hash := sha256.Sum256(data)
+	// Calculate the checksum with the negotiated hash algorithm
+	hash := sumChunk(hashAlgorithm, data)
 	copy(header[12:44], hash[:])
 
+	payload := data
+	if isCompressionEnabled(compression) {
+		compressed, err := compressChunk(compression, data)
+		if err != nil {
+			return err
+		}
+		// Incompressible chunks go out as-is, signalled by a zero wire size
+		if len(compressed) < len(data) {
+			payload = compressed
+			binary.BigEndian.PutUint32(header[44:48], uint32(len(compressed)))
+		}
+	}
+
+	writer := chunkWriter(ctx, chunkStream, limiter)
+
 	// Send header
-	_, err = chunkStream.Write(header)
+	_, err = writer.Write(header)
 	if err != nil {
 		return fmt.Errorf("failed to write chunk header: %w", err)
 	}
 
 	// Send data directly (no JSON overhead)
-	_, err = chunkStream.Write(data)
+	_, err = writer.Write(payload)
 	if err != nil {
 		return fmt.Errorf("failed to write chunk data: %w", err)
 	}
 
+	// Nothing else is sent on this stream, so finish the write side now
+	chunkStream.Close()
+
+	if chunkAcks {
+		return readChunkAck(chunkStream, chunkIndex)
+	}
+
 	// Wait for simple acknowledgment (1 byte: 1=success, 0=failure)
 	ack := make([]byte, 1)
-	_, err = chunkStream.Read(ack)
+	_, err = io.ReadFull(chunkStream, ack)
 	if err != nil {
 		return fmt.Errorf("failed to read chunk acknowledgment: %w", err)
 	}
+	// The ack is the only thing the receiver sends; discarding the rest lets QUIC retire the stream
+	chunkStream.CancelRead(0)
 
 	// Check if chunk was received successfully
 	if ack[0] != 1 {
@@ -124,11 +170,24 @@ func sendChunkReliably(ctx context.Context, conn quic.Connection, chunkIndex int
 	return nil
 }
 
-// receiveChunkReliably receives a chunk using fast binary protocol
-func receiveChunkReliably(ctx context.Context, chunkStream quic.Stream, expectedChunkIndex int64) (*ChunkData, error) {
-	// Read binary header (44 bytes)
-	header := make([]byte, 44)
-	_, err := io.ReadFull(chunkStream, header)
+// chunkSizeAt returns the size of chunk chunkIndex of a file, failing with ErrChunkCorrupted for
+// indices outside the file
+func chunkSizeAt(fileSize, chunkSize, chunkIndex int64) (int, error) {
+	totalChunks := (fileSize + chunkSize - 1) / chunkSize
+	if chunkIndex < 0 || chunkIndex >= totalChunks {
+		return 0, fmt.Errorf("%w: chunk index %d is outside the file's %d chunks", ErrChunkCorrupted, chunkIndex, totalChunks)
+	}
+	return int(min(chunkSize, fileSize-chunkIndex*chunkSize)), nil
+}
+
+// receiveChunkReliably receives a chunk using fast binary protocol.
+// Chunks can arrive in any order, so expectedSize checks that the index in the header was requested
+// and returns the chunk's size, before any data is read.
+// The chunk isn't acknowledged until the caller has stored it and calls acknowledgeChunk.
+func receiveChunkReliably(ctx context.Context, chunkStream io.Reader, compression, hashAlgorithm string, expectedSize func(chunkIndex int64) (int, error)) (_ *ChunkData, err error) {
+	// Read binary header (44 bytes, or 48 with compression)
+	header := make([]byte, chunkHeaderLength(compression))
+	_, err = io.ReadFull(chunkStream, header)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read chunk header: %w", err)
 	}
@@ -138,451 +197,2012 @@ func receiveChunkReliably(ctx context.Context, chunkStream quic.Stream, expected
 	dataSize := int(binary.BigEndian.Uint32(header[8:12]))
 	receivedChecksum := header[12:44]
 
-	// Verify chunk index matches expected
-	if receivedChunkIndex != expectedChunkIndex {
-		return nil, fmt.Errorf("received chunk index %d, expected %d", receivedChunkIndex, expectedChunkIndex)
+	// Failures from here on concern a known chunk, which the sender can be told about
+	defer func() {
+		if err != nil {
+			err = &chunkReceiveError{chunkIndex: receivedChunkIndex, err: err}
+		}
+	}()
+
+	// Verify the chunk is one we asked for and has the size the announced file gives it,
+	// so nothing is allocated or written beyond the file
+	size, err := expectedSize(receivedChunkIndex)
+	if err != nil {
+		return nil, err
+	}
+	if dataSize != size {
+		return nil, fmt.Errorf("%w: chunk %d is %d bytes, expected %d", ErrChunkCorrupted, receivedChunkIndex, dataSize, size)
+	}
+
+	// A non-zero wire size means the data was compressed, which the sender only does when it's smaller
+	wireSize := dataSize
+	compressed := false
+	if isCompressionEnabled(compression) {
+		if compressedSize := int(binary.BigEndian.Uint32(header[44:48])); compressedSize > 0 {
+			if compressedSize >= dataSize {
+				return nil, fmt.Errorf("%w: chunk %d has a compressed size of %d for %d bytes", ErrChunkCorrupted, receivedChunkIndex, compressedSize, dataSize)
+			}
+			wireSize = compressedSize
+			compressed = true
+		}
 	}
 
-	// Read data
-	data := make([]byte, dataSize)
+	// Read data using buffer pool for small chunks, like the sender
+	var data []byte
+	pooled := wireSize <= ChunkBufferSize
+	if pooled {
+		data = ChunkBufferPool.Get()[:wireSize]
+	} else {
+		data = make([]byte, wireSize)
+	}
 	_, err = io.ReadFull(chunkStream, data)
 	if err != nil {
+		if pooled {
+			ChunkBufferPool.Put(data[:cap(data)])
+		}
 		return nil, fmt.Errorf("failed to read chunk data: %w", err)
 	}
 
-	// Verify checksum
-	hash := sha256.Sum256(data)
-	if !bytes.Equal(hash[:], receivedChecksum) {
-		return nil, fmt.Errorf("chunk %d checksum verification failed", expectedChunkIndex)
+	if compressed {
+		wireData := data
+		data, err = decompressChunk(compression, wireData, dataSize)
+		// The decompressed data is a new buffer, so the wire buffer can go back right away
+		if pooled {
+			ChunkBufferPool.Put(wireData[:cap(wireData)])
+			pooled = false
+		}
+		if err != nil {
+			return nil, fmt.Errorf("chunk %d: %w", receivedChunkIndex, err)
+		}
 	}
 
-	// Send success acknowledgment (1 byte)
-	_, err = chunkStream.Write([]byte{1})
-	if err != nil {
-		// Non-fatal error, just log it
-		fmt.Printf("Warning: failed to send acknowledgment for chunk %d: %v\n", expectedChunkIndex, err)
+	// Verify checksum
+	hash := sumChunk(hashAlgorithm, data)
+	if !bytes.Equal(hash[:], receivedChecksum) {
+		if pooled {
+			ChunkBufferPool.Put(data[:cap(data)])
+		}
+		return nil, fmt.Errorf("chunk %d checksum verification failed", receivedChunkIndex)
 	}
 
-	// Return chunk data in the expected format for compatibility
+	// Return chunk data in the expected format for compatibility; the caller releases it once stored
 	return &ChunkData{
 		Type:       MessageChunkData,
 		ChunkIndex: receivedChunkIndex,
 		ChunkSize:  dataSize,
 		Data:       data,
 		Checksum:   hex.EncodeToString(receivedChecksum),
+		pooled:     pooled,
 	}, nil
 }
 
-// SendFileChunked sends a file using the new chunked QUIC protocol
-func SendFileChunked(filename string, peerAddr string) error {
-	// Longer timeout for large files and network delays
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Minute)
-	defer cancel()
+// chunkRejectedError is a chunk the receiver answered with a failed ChunkAck
+type chunkRejectedError struct {
+	chunkIndex int64
+	reason     string
+	permanent  bool
+}
 
-	// Get file info and calculate hash
-	file, err := os.Open(filename)
-	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
+func (e *chunkRejectedError) Error() string {
+	return fmt.Sprintf("receiver rejected chunk %d: %s", e.chunkIndex, e.reason)
+}
+
+// Unwrap lets a permanent rejection be recognised as ErrChunkCorrupted
+func (e *chunkRejectedError) Unwrap() error {
+	if e.permanent {
+		return ErrChunkCorrupted
 	}
-	defer file.Close()
+	return nil
+}
 
-	fileInfo, err := file.Stat()
+// readChunkAck reads the receiver's ChunkAck for chunkIndex, which it finishes the stream after
+func readChunkAck(chunkStream quic.Stream, chunkIndex int64) error {
+	data, err := io.ReadAll(io.LimitReader(chunkStream, MaxChunkAckSize+1))
+	// The ack is the only thing the receiver sends; discarding the rest lets QUIC retire the stream
+	chunkStream.CancelRead(0)
 	if err != nil {
-		return fmt.Errorf("failed to get file info: %w", err)
+		return fmt.Errorf("failed to read chunk acknowledgment: %w", err)
 	}
-
-	// Calculate file hash
-	hash := sha256.New()
-	if _, err := io.Copy(hash, file); err != nil {
-		return fmt.Errorf("failed to calculate file hash: %w", err)
+	if len(data) == 0 {
+		// A receiver that gave up on the stream closes it without answering
+		return fmt.Errorf("chunk %d was not acknowledged", chunkIndex)
+	}
+	if len(data) > MaxChunkAckSize {
+		return fmt.Errorf("%w: chunk acknowledgment exceeds %d bytes", ErrInvalidMessage, MaxChunkAckSize)
+	}
+	ack, err := DeserializeChunkAck(data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+	if ack.ChunkIndex != chunkIndex {
+		return fmt.Errorf("%w: acknowledgment for chunk %d on the stream of chunk %d", ErrInvalidMessage, ack.ChunkIndex, chunkIndex)
 	}
-	file.Seek(0, 0) // Reset for reading
+	if !ack.Received {
+		return &chunkRejectedError{chunkIndex: chunkIndex, reason: ack.ErrorMsg, permanent: ack.Permanent}
+	}
+	return nil
+}
 
-	fileHash := hex.EncodeToString(hash.Sum(nil))
-	chunkSize := DefaultChunkSize
-	totalChunks := (fileInfo.Size() + chunkSize - 1) / chunkSize
+// chunkReceiveError is a failure to receive a chunk whose header was read
+type chunkReceiveError struct {
+	chunkIndex int64
+	err        error
+}
 
-	fmt.Printf("Preparing to send '%s' (%.2f MB, %d chunks) to %s\n",
-		fileInfo.Name(),
-		float64(fileInfo.Size())/(1024*1024),
-		totalChunks,
-		peerAddr)
+func (e *chunkReceiveError) Error() string {
+	return e.err.Error()
+}
 
-	// Initialize transfer statistics
-	stats := NewTransferStats(fileInfo.Name(), fileInfo.Size(), int(totalChunks), peerAddr, "sent")
+func (e *chunkReceiveError) Unwrap() error {
+	return e.err
+}
+
+// acknowledgeChunk tells the sender a chunk was stored, or with failure set why it wasn't, then
+// finishes both directions of its stream. Senders without chunkAcks only understand success, so a
+// failure is left unanswered for them. Acking only after the write means a slow disk holds back the
+// sender, since each in-flight chunk occupies one of its worker slots until then.
+func acknowledgeChunk(chunkStream quic.Stream, chunkAcks bool, chunkIndex int64, failure error, permanent bool) {
+	var ack []byte
+	if chunkAcks {
+		message := NewChunkAck(chunkIndex, failure == nil, "")
+		if failure != nil {
+			message.ErrorMsg = failure.Error()
+			message.Permanent = permanent
+		}
+		ack, _ = SerializeMessage(message)
+	} else if failure == nil {
+		// Send success acknowledgment (1 byte)
+		ack = []byte{1}
+	}
+	if len(ack) > 0 {
+		if _, err := chunkStream.Write(ack); err != nil {
+			// Non-fatal error, just log it
+			logf("Warning: failed to send acknowledgment for chunk %d: %v\n", chunkIndex, err)
+		}
+	}
+	chunkStream.Close()
+	// The sender's FIN may not have been read yet; QUIC only releases the stream once it has or reading is cancelled
+	chunkStream.CancelRead(0)
+}
 
+// sendSession is an open QUIC connection and control stream to a receiving peer.
+// Several transfer requests can be exchanged sequentially over a single session.
+type sendSession struct {
+	conn          quic.Connection
+	controlStream quic.Stream
+	peerAddr      string
+	config        SenderConfig
+	limiter       *rateLimiter     // shared by all chunk streams; nil when unlimited
+	results       []*TransferStats // one per file sent in this session, for combined summaries
+	framed        bool             // the receiver reads length-prefixed control messages
+	directory     string           // top-level directory being sent, announced again after a reconnect
+	directorySize int64
+}
+
+// openSendSession dials the peer and opens the control stream used for metadata exchange
+func openSendSession(ctx context.Context, peerAddr string, config SenderConfig) (*sendSession, error) {
 	// Get client TLS config
 	tlsConfig := GetClientTLSConfig()
 
-	// Dial QUIC connection
-	conn, err := quic.DialAddr(ctx, peerAddr, tlsConfig, nil)
+	// Dial QUIC connection, retrying in case the receiver is still starting up
+	conn, err := dialWithRetry(ctx, peerAddr, tlsConfig, config.DialAttempts, config.DialTimeout)
 	if err != nil {
-		return fmt.Errorf("failed to dial QUIC: %w", err)
+		return nil, err
+	}
+	if err := verifyReceiverFingerprint(conn, config.ExpectFingerprint); err != nil {
+		return nil, err
 	}
-	defer conn.CloseWithError(0, "")
 
 	// Open control stream for metadata exchange
 	controlStream, err := conn.OpenStreamSync(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to open control stream: %w", err)
-	}
-
-	// Send transfer request
-	request := NewTransferRequest(
-		filepath.Base(filename),
-		fileInfo.Size(),
-		fileHash,
-		chunkSize,
-	)
-
-	requestData, err := SerializeMessage(request)
-	if err != nil {
-		return fmt.Errorf("failed to serialize transfer request: %w", err)
-	}
-
-	_, err = controlStream.Write(requestData)
-	if err != nil {
-		return fmt.Errorf("failed to send transfer request: %w", err)
+		conn.CloseWithError(0, "")
+		return nil, fmt.Errorf("failed to open control stream: %w", err)
 	}
 
-	// Ensure the request is sent immediately
-	if flusher, ok := controlStream.(interface{ Flush() error }); ok {
-		if err := flusher.Flush(); err != nil {
-			return fmt.Errorf("failed to flush transfer request: %w", err)
-		}
+	session := &sendSession{
+		conn:          conn,
+		controlStream: controlStream,
+		peerAddr:      peerAddr,
+		config:        config,
+		limiter:       newRateLimiter(config.MaxRate),
 	}
 
-	fmt.Println("Transfer request sent, waiting for response...")
-
-	// Read response from control stream with dynamic buffering
-	var responseBuffer []byte
-	buf := make([]byte, 4096)
-	for {
-		n, err := controlStream.Read(buf)
+	if config.AutoChunkSize {
+		chunkSize, err := session.calibrateChunkSize(ctx)
 		if err != nil {
-			if err == io.EOF {
-				break
+			conn.CloseWithError(0, "")
+			if ctx.Err() != nil {
+				return nil, err
 			}
-			return fmt.Errorf("failed to read transfer response: %w", err)
-		}
-		responseBuffer = append(responseBuffer, buf[:n]...)
-
-		// Try to parse the response to see if we have a complete message
-		if _, err := DeserializeTransferResponse(responseBuffer); err == nil {
-			break // Complete message received
+			// The receiver drops a session it can't make sense of, so start over without calibrating
+			logf("⚠️  %v - using the %s chunk size\n", err, FormatByteSize(config.ChunkSize))
+			config.AutoChunkSize = false
+			return openSendSession(ctx, peerAddr, config)
 		}
+		session.config.ChunkSize = chunkSize
 	}
+	return session, nil
+}
 
-	response, err := DeserializeTransferResponse(responseBuffer)
-	if err != nil {
-		return fmt.Errorf("failed to deserialize transfer response: %w", err)
-	}
+// dialQUIC dials a QUIC connection. Tests replace it to make dials fail in a given way.
+var dialQUIC = quic.DialAddr
 
-	if !response.Accepted {
-		stats.MarkRejected(response.RejectionMsg)
-		stats.PrintSummary()
-		fmt.Printf("Transfer rejected: %s\n", response.RejectionMsg)
-		return nil // Return nil instead of error since rejection is a normal outcome
+// dialWithRetry dials peerAddr up to attempts times with exponential backoff in between.
+// Handshake failures such as a rejected certificate aren't retried, since they would fail again.
+func dialWithRetry(ctx context.Context, peerAddr string, tlsConfig *tls.Config, attempts int, timeout time.Duration) (quic.Connection, error) {
+	if attempts < 1 {
+		attempts = 1
+	}
+	if timeout <= 0 {
+		timeout = DefaultDialTimeout
 	}
 
-	fmt.Printf("Transfer accepted! Need to send %d chunks.\n", len(response.ResumeChunks))
-	stats.TotalChunks = len(response.ResumeChunks) // Update to only required chunks
-
-	// Send required chunks with improved error handling and progress tracking
-	for i, chunkIndex := range response.ResumeChunks {
-		offset := int64(chunkIndex) * chunkSize
-		remaining := fileInfo.Size() - offset
-		if remaining <= 0 {
-			stats.IncrementSentChunks() // Skip empty chunks
-			continue
-		}
-
-		if remaining > chunkSize {
-			remaining = chunkSize
-		}
-
-		// Debug logging for first few chunks
-		if i < 3 {
-			fmt.Printf("DEBUG SENDER: Chunk %d - offset: %d, remaining: %d, fileInfo.Size: %d\n",
-				chunkIndex, offset, remaining, fileInfo.Size())
+	backoff := DialInitialBackoff
+	var lastErr error
+	attempt := 1
+	for ; ; attempt++ {
+		dialCtx, cancel := context.WithTimeout(ctx, timeout)
+		conn, err := dialQUIC(dialCtx, peerAddr, tlsConfig, newQUICConfig())
+		cancel()
+		if err == nil {
+			return conn, nil
 		}
-
-		// Send chunk with retry logic using array index for synchronization
-		err := sendChunkWithRetry(ctx, conn, file, int64(chunkIndex), offset, remaining)
-		if err != nil {
-			stats.MarkFailed(fmt.Sprintf("failed to send chunk %d: %v", chunkIndex, err))
-			stats.PrintSummary()
-			return fmt.Errorf("failed to send chunk %d: %w", chunkIndex, err)
+		lastErr = err
+		if attempt == attempts || ctx.Err() != nil || isHandshakeRejection(err) {
+			break
 		}
 
-		// Increment sent chunks and print progress
-		stats.IncrementSentChunks()
-		stats.UpdateBytesTransferred(int64(offset + remaining))
-		stats.PrintProgress()
-
-		// Optimize transfer speed consistency with adaptive pacing
-		if (i+1)%50 == 0 {
-			// Reduced pause for better throughput
-			time.Sleep(50 * time.Millisecond)
-		} else if (i+1)%10 == 0 {
-			// Very brief pause every 10 chunks to allow system I/O to stabilize
-			time.Sleep(2 * time.Millisecond)
+		logf("Dial attempt %d/%d to %s failed: %v (retrying in %v)\n", attempt, attempts, peerAddr, err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: dialing %s cancelled: %w", ErrConnectionFailed, peerAddr, ctx.Err())
 		}
-		// No delay for other chunks to maintain consistent speed
+		backoff = min(backoff*2, DialMaxBackoff)
 	}
 
-	// Give the receiver time to process the last chunk
-	time.Sleep(100 * time.Millisecond)
+	return nil, fmt.Errorf("%w: failed to dial QUIC %s after %d attempt(s): %w", ErrConnectionFailed, peerAddr, attempt, lastErr)
+}
 
-	// Clear the progress line and print completion message
-	fmt.Printf("\r%s\r", strings.Repeat(" ", 120)) // Clear the line with longer width
-	fmt.Printf("Transfer completed successfully!\n")
+// isConnectionLost reports whether err came from the QUIC connection dropping, such as when the
+// peer stopped answering on flaky Wi-Fi, rather than from either side ending it
+func isConnectionLost(err error) bool {
+	var idleErr *quic.IdleTimeoutError
+	var resetErr *quic.StatelessResetError
+	return errors.As(err, &idleErr) || errors.As(err, &resetErr)
+}
 
-	// Mark transfer as completed and print final statistics
-	stats.MarkCompleted()
-	fmt.Println() // New line after progress
-	stats.PrintSummary()
+// isHandshakeRejection reports whether the peer answered but refused the TLS handshake
+func isHandshakeRejection(err error) bool {
+	var transportErr *quic.TransportError
+	return errors.As(err, &transportErr) && transportErr.ErrorCode.IsCryptoError()
+}
 
-	return nil
+// Close tells the receiver no more requests follow and closes the connection once it has finished
+func (s *sendSession) Close() {
+	s.controlStream.Close()
+	waitForPeerClose(s.conn, 2*time.Second)
+	s.conn.CloseWithError(0, "")
 }
 
-// ReceiveFileChunked receives a file using the new chunked QUIC protocol
-func ReceiveFileChunked(port string) error {
-	// Start discovery listener in background with the correct port
-	go ListenForDiscovery(port)
-	
-	// Get server TLS config
-	tlsConfig := GetServerTLSConfig()
-	if tlsConfig == nil {
-		return fmt.Errorf("failed to get server TLS config")
+// exchangeRequest sends a transfer request on the control stream and waits for the receiver's response
+func (s *sendSession) exchangeRequest(request *TransferRequest) (*TransferResponse, error) {
+	if err := writeControlMessage(s.controlStream, request, s.framed); err != nil {
+		if busy := receiverBusyError(err); busy != nil {
+			return nil, busy
+		}
+		return nil, fmt.Errorf("failed to send transfer request: %w", err)
 	}
 
-	// Create UDP listener
-	udpAddr, err := net.ResolveUDPAddr("udp", ":"+port)
-	if err != nil {
-		return fmt.Errorf("failed to resolve UDP address: %w", err)
+	// Ensure the request is sent immediately
+	if flusher, ok := s.controlStream.(interface{ Flush() error }); ok {
+		if err := flusher.Flush(); err != nil {
+			return nil, fmt.Errorf("failed to flush transfer request: %w", err)
+		}
 	}
 
-	udpConn, err := net.ListenUDP("udp", udpAddr)
+	logln("Transfer request sent, waiting for response...")
+
+	_, data, err := readControlMessage(s.controlStream)
 	if err != nil {
-		return fmt.Errorf("failed to listen on UDP: %w", err)
+		// A daemon serving as many senders as it may closes the connection straight away
+		if busy := receiverBusyError(err); busy != nil {
+			return nil, busy
+		}
+		return nil, fmt.Errorf("failed to read transfer response: %w", err)
 	}
-	defer udpConn.Close()
-
-	fmt.Printf("Listening for chunked QUIC transfers on port %s...\n", port)
-
-	// Create QUIC listener
-	listener, err := quic.Listen(udpConn, tlsConfig, nil)
+	response, err := DeserializeTransferResponse(data)
 	if err != nil {
-		return fmt.Errorf("failed to create QUIC listener: %w", err)
+		return nil, fmt.Errorf("failed to deserialize transfer response: %w", err)
 	}
-	defer listener.Close()
 
-	// Accept connection with longer timeout for large files
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Minute)
-	defer cancel()
+	// Everything after the receiver's first answer is framed if its version reads frames
+	s.framed = supportsFraming(response.ProtocolVersion)
+	return response, nil
+}
 
-	conn, err := listener.Accept(ctx)
+// sendFile announces a single file over the session and streams the chunks the receiver asks for.
+// relativePath is empty for standalone files and set for entries of a directory transfer.
+func (s *sendSession) sendFile(ctx context.Context, filename string, relativePath string) error {
+	// Get file info and calculate hash
+	file, err := os.Open(filename)
 	if err != nil {
-		return fmt.Errorf("failed to accept QUIC connection: %w", err)
+		return fmt.Errorf("failed to open file: %w", err)
 	}
-	defer conn.CloseWithError(0, "")
+	defer file.Close()
 
-	// Accept control stream
-	controlStream, err := conn.AcceptStream(ctx)
+	fileInfo, err := file.Stat()
 	if err != nil {
-		return fmt.Errorf("failed to accept control stream: %w", err)
+		return fmt.Errorf("failed to get file info: %w", err)
 	}
 
-	// Read transfer request with dynamic buffering
-	var requestBuffer []byte
-	buf := make([]byte, 4096)
-	for {
-		n, err := controlStream.Read(buf)
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return fmt.Errorf("failed to read transfer request: %w", err)
-		}
-		requestBuffer = append(requestBuffer, buf[:n]...)
-
-		// Try to parse the request to see if we have a complete message
-		if _, err := DeserializeTransferRequest(requestBuffer); err == nil {
-			break // Complete message received
+	// Hash the file upfront only if asked to; otherwise it's hashed while the chunks are read for
+	// sending and the hash follows in the trailer, so the file is read once
+	hashAlgorithm := normalizeHashAlgorithm(s.config.HashAlgorithm)
+	hashTrailer := !s.config.HashUpfront
+	var fileHash string
+	if !hashTrailer {
+		hash := newHash(hashAlgorithm)
+		if _, err := io.Copy(hash, file); err != nil {
+			return fmt.Errorf("failed to calculate file hash: %w", err)
 		}
+		fileHash = hex.EncodeToString(hash.Sum(nil))
 	}
+	chunkSize := s.config.ChunkSize
+	totalChunks := (fileInfo.Size() + chunkSize - 1) / chunkSize
 
-	request, err := DeserializeTransferRequest(requestBuffer)
-	if err != nil {
-		return fmt.Errorf("failed to deserialize transfer request: %w", err)
+	displayName := fileInfo.Name()
+	if relativePath != "" {
+		displayName = relativePath
 	}
 
-	fmt.Printf("Received transfer request for '%s' (%.2f MB)\n",
-		request.Filename,
-		float64(request.FileSize)/(1024*1024))
-
-	// Prompt user for confirmation
-	accepted, rejectionMsg := promptForTransferConfirmation(request)
-
-	response := NewTransferResponse(accepted, getRequiredChunks(request.Filename, request.FileSize, request.ChunkSize), rejectionMsg)
+	logf("Preparing to send '%s' (%.2f MB, %d chunks) to %s\n",
+		displayName,
+		float64(fileInfo.Size())/(1024*1024),
+		totalChunks,
+		s.peerAddr)
 
 	// Initialize transfer statistics
-	peerAddr := conn.RemoteAddr().String()
-	totalChunks := int((request.FileSize + request.ChunkSize - 1) / request.ChunkSize)
-	stats := NewTransferStats(request.Filename, request.FileSize, totalChunks, peerAddr, "received")
-
-	responseData, err := SerializeMessage(response)
-	if err != nil {
-		return fmt.Errorf("failed to serialize transfer response: %w", err)
+	stats := NewTransferStats(fileInfo.Name(), fileInfo.Size(), int(totalChunks), s.peerAddr, "sent")
+	stats.Path = filename
+	stats.FileHash = fileHash
+	stats.OnProgress = s.config.OnProgress
+	stats.SetQuiet(s.config.Quiet)
+	s.results = append(s.results, stats)
+	if s.config.OnResult != nil {
+		defer s.config.OnResult(stats)
 	}
 
-	// Send response with proper flushing
-	_, err = controlStream.Write(responseData)
-	if err != nil {
-		return fmt.Errorf("failed to send transfer response: %w", err)
+	// Send transfer request
+	request := NewTransferRequest(
+		filepath.Base(filename),
+		fileInfo.Size(),
+		fileHash,
+		chunkSize,
+	)
+	request.RelativePath = relativePath
+	request.Compression = compressionForFile(s.config.Compression, filename)
+	request.DryRun = s.config.DryRun
+	request.HashAlgorithm = hashAlgorithm
+	request.ChunkAcks = true
+	request.FileMode = uint32(fileInfo.Mode().Perm())
+	request.ModTime = fileInfo.ModTime().UnixNano()
+	if relativePath == "" {
+		request.ContentType = s.config.ContentType
 	}
-
-	// Ensure the response is sent immediately
-	if flusher, ok := controlStream.(interface{ Flush() error }); ok {
-		if err := flusher.Flush(); err != nil {
-			return fmt.Errorf("failed to flush transfer response: %w", err)
-		}
+	if hashTrailer {
+		request.HashTrailer = true
+		request.SourceID = fileSourceID(filename, fileInfo)
 	}
 
-	// Wait a moment to ensure the response is sent and received
-	time.Sleep(50 * time.Millisecond)
-
-	if !accepted {
-		stats.MarkRejected(rejectionMsg)
-		stats.PrintSummary()
-		return fmt.Errorf("transfer rejected: %s", rejectionMsg)
-	}
+	return s.sendData(ctx, request, file, displayName, stats)
+}
 
-	fmt.Printf("Accepting transfer with %d chunks to receive\n", len(response.ResumeChunks))
-	stats.TotalChunks = len(response.ResumeChunks) // Update to only required chunks
+// sendData offers request to the receiver and sends the chunks it asks for, read from data.
+// After a reconnect the request is offered again and the chunks still missing are read once more.
+func (s *sendSession) sendData(ctx context.Context, request *TransferRequest, data io.ReaderAt, displayName string, stats *TransferStats) error {
+	hashAlgorithm := request.HashAlgorithm
+	hashTrailer := request.HashTrailer
+	totalChunks := (request.FileSize + request.ChunkSize - 1) / request.ChunkSize
 
-	// Create output file with prefix to avoid conflicts
-	outputFilename := "received_" + request.Filename
-	outputFile, err := os.OpenFile(outputFilename, os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
-	}
-	defer outputFile.Close()
+	for reconnects := 0; ; reconnects++ {
+		response, err := s.exchangeRequest(request)
+		if err != nil {
+			if s.reconnectAfter(ctx, err, reconnects) {
+				continue
+			}
+			return err
+		}
 
-	// Receive chunks using the reliable chunk protocol
-	for i := 0; i < len(response.ResumeChunks); i++ {
-		chunkIndex := response.ResumeChunks[i]
+		if !response.Accepted {
+			stats.RejectionCode = response.RejectionCode
+			stats.MarkRejected(response.RejectionMsg)
+			stats.PrintSummary()
+			logf("Transfer rejected: %s\n", response.RejectionMsg)
+			return rejectionError(response)
+		}
 
-		// Accept chunk stream with timeout
-		streamCtx, streamCancel := createStreamContext(ctx)
-		chunkStream, err := conn.AcceptStream(streamCtx)
-		if err != nil {
-			stats.MarkFailed(fmt.Sprintf("failed to accept chunk stream %d: %v", i, err))
+		// Older receivers don't echo the hash algorithm and verify with SHA-256, so any other
+		// algorithm would only fail once the whole file had been sent
+		if normalizeHashAlgorithm(response.HashAlgorithm) != hashAlgorithm {
+			err := fmt.Errorf("%w: receiver doesn't support %s hashing (send with sha256)", ErrProtocolMismatch, hashAlgorithm)
+			stats.MarkFailed(err.Error())
 			stats.PrintSummary()
-			streamCancel()
-			return fmt.Errorf("failed to accept chunk stream %d: %w", i, err)
+			return err
 		}
-		streamCancel()
 
-		// Receive chunk reliably using array index for synchronization
-		receivedChunk, err := receiveChunkReliably(ctx, chunkStream, int64(chunkIndex))
-		if err != nil {
-			stats.MarkFailed(fmt.Sprintf("failed to receive chunk %d: %v", chunkIndex, err))
+		// Older receivers would verify against the empty upfront hash instead of waiting for the trailer
+		if hashTrailer && !response.HashTrailer {
+			err := fmt.Errorf("%w: receiver doesn't support hash trailers (send with --hash-upfront)", ErrProtocolMismatch)
+			stats.MarkFailed(err.Error())
 			stats.PrintSummary()
-			return fmt.Errorf("failed to receive chunk %d: %w", chunkIndex, err)
+			return err
 		}
 
-		// Calculate offset for this chunk
-		offset := int64(chunkIndex) * request.ChunkSize
+		// Only compress if the receiver agreed; older receivers don't echo the field
+		compression := CompressionNone
+		if isCompressionEnabled(request.Compression) && response.Compression == request.Compression {
+			compression = request.Compression
+			logf("Using %s compression\n", compression)
+		}
+
+		if s.config.DryRun {
+			logln("Dry run: transfer accepted, not sending any data")
+			logf("  File:   %s\n", displayName)
+			logf("  Size:   %d bytes (%.2f MB)\n", request.FileSize, float64(request.FileSize)/(1024*1024))
+			logf("  Chunks: %d of %d needed by the receiver\n", len(response.ResumeChunks), totalChunks)
+			if request.FileHash != "" {
+				logf("  Hash:   %s\n", request.FileHash)
+			}
+			return nil
+		}
 
-		// Write chunk to file
-		_, err = outputFile.WriteAt(receivedChunk.Data, offset)
+		err = s.sendChunks(ctx, data, request.FileSize, response, compression, hashAlgorithm, hashTrailer, stats)
+		if err != nil && s.reconnectAfter(ctx, err, reconnects) {
+			// The receiver kept every acknowledged chunk, so the new request only asks for the rest
+			continue
+		}
 		if err != nil {
-			stats.MarkFailed(fmt.Sprintf("failed to write chunk %d: %v", chunkIndex, err))
+			stats.MarkFailed(err.Error())
 			stats.PrintSummary()
-			return fmt.Errorf("failed to write chunk %d: %w", chunkIndex, err)
+			return err
 		}
 
-		// Close chunk stream
-		chunkStream.Close()
+		// Every chunk was acknowledged after the receiver stored it, and with a trailer the receiver
+		// has also verified the file
+		// Clear the progress line and print completion message
+		clearProgressLine()
+		logf("Transfer completed successfully!\n")
 
-		// Increment received chunks and print progress
-		stats.IncrementReceivedChunks()
-		stats.UpdateBytesTransferred(offset + int64(len(receivedChunk.Data)))
-		stats.PrintProgress()
+		// Mark transfer as completed and print final statistics
+		stats.MarkCompleted()
+		logln() // New line after progress
+		stats.PrintSummary()
 
-		// Optimize receiver speed with adaptive pacing
-		if (i+1)%50 == 0 {
-			// Reduced pause for better throughput
-			time.Sleep(50 * time.Millisecond)
-		} else if (i+1)%10 == 0 {
-			// Very brief pause every 10 chunks to allow system I/O to stabilize
-			time.Sleep(2 * time.Millisecond)
-		}
-		// No delay for other chunks to maintain consistent speed
+		return nil
 	}
+}
 
-	// Clear the progress line and print completion message
-	fmt.Printf("\r%s\r", strings.Repeat(" ", 120)) // Clear the line with longer width
-	fmt.Printf("File transfer completed: %s\n", outputFilename)
+// sendChunks streams the chunks of file the receiver asked for in response, then with a hash
+// trailer sends the file's hash and waits for the receiver to verify it. file is read in order.
+func (s *sendSession) sendChunks(ctx context.Context, file io.ReaderAt, fileSize int64, response *TransferResponse, compression, hashAlgorithm string, hashTrailer bool, stats *TransferStats) error {
+	chunkSize := s.config.ChunkSize
+	totalChunks := (fileSize + chunkSize - 1) / chunkSize
 
-	// Verify file integrity
-	fmt.Println("Verifying file integrity...")
-	outputFile.Close() // Close before reading for hash verification
+	logf("Transfer accepted! Need to send %d chunks.\n", len(response.ResumeChunks))
+	// Only the required chunks count, on top of any sent before a reconnect
+	stats.TotalChunks = stats.SentChunks + len(response.ResumeChunks)
 
-	if verifyFileIntegrity(outputFilename, request.FileHash) {
+	// Send required chunks concurrently, bounded by MaxConcurrentChunks
+	sendCtx, cancelSend := context.WithCancel(ctx)
+	defer cancelSend()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	semaphore := make(chan struct{}, MaxConcurrentChunks)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancelSend()
+		})
+	}
+
+	required := make(map[int]bool, len(response.ResumeChunks))
+	for _, chunkIndex := range response.ResumeChunks {
+		if int64(chunkIndex) >= totalChunks {
+			stats.IncrementSentChunks() // Skip empty chunks
+			continue
+		}
+		required[chunkIndex] = true
+	}
+
+	// Read the file once, in order: required chunks are handed to the workers, and with a hash
+	// trailer every chunk, including those the receiver already has, is hashed on the way
+	fileHasher := newHash(hashAlgorithm)
+	sent := 0
+dispatch:
+	for chunkIndex := 0; int64(chunkIndex) < totalChunks; chunkIndex++ {
+		offset := int64(chunkIndex) * chunkSize
+		size := min(chunkSize, fileSize-offset)
+		if !required[chunkIndex] {
+			if !hashTrailer {
+				continue
+			}
+			if _, err := io.Copy(fileHasher, io.NewSectionReader(file, offset, size)); err != nil {
+				fail(fmt.Errorf("failed to read chunk %d from file: %w", chunkIndex, err))
+				break
+			}
+			continue
+		}
+
+		// Debug logging for first few chunks
+		if sent < 3 {
+			logf("DEBUG SENDER: Chunk %d - offset: %d, remaining: %d, fileInfo.Size: %d\n",
+				chunkIndex, offset, size, fileSize)
+		}
+		sent++
+
+		// Wait for a free worker slot, stopping early if another chunk already failed
+		select {
+		case semaphore <- struct{}{}:
+		case <-sendCtx.Done():
+			break dispatch
+		}
+
+		// Read chunk data from file using buffer pool for small chunks
+		var chunkData []byte
+		pooled := size <= ChunkBufferSize
+		if pooled {
+			chunkData = ChunkBufferPool.Get()[:size]
+		} else {
+			chunkData = make([]byte, size)
+		}
+		if _, err := io.ReadFull(io.NewSectionReader(file, offset, size), chunkData); err != nil {
+			<-semaphore
+			fail(fmt.Errorf("failed to read chunk %d from file: %w", chunkIndex, err))
+			break
+		}
+		if hashTrailer {
+			fileHasher.Write(chunkData)
+		}
+
+		wg.Add(1)
+		go func(chunkIndex int, chunkData []byte) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			if pooled {
+				defer ChunkBufferPool.Put(chunkData[:cap(chunkData)])
+			}
+
+			// Each chunk carries its own index in the header, so the receiver can place it in any order
+			retry := retryPolicy{attempts: s.config.ChunkAttempts, delay: s.config.ChunkRetryDelay}
+			attempts, err := sendChunkWithRetry(sendCtx, s.conn, s.limiter, s.config.StreamTimeout, compression, hashAlgorithm, response.ChunkAcks, retry, int64(chunkIndex), chunkData)
+			stats.AddRetry(chunkIndex, attempts)
+			if err != nil {
+				fail(fmt.Errorf("failed to send chunk %d: %w", chunkIndex, err))
+				return
+			}
+
+			// Increment sent chunks and print progress
+			stats.AddBytesTransferred(int64(len(chunkData)))
+			stats.IncrementSentChunks()
+			stats.PrintProgress()
+		}(chunkIndex, chunkData)
+	}
+
+	wg.Wait()
+
+	// The receiver verifies the file against the trailer and reports back
+	if firstErr == nil && ctx.Err() == nil && hashTrailer {
+		fileHash := hex.EncodeToString(fileHasher.Sum(nil))
+		if err := s.finishWithTrailer(fileHash); err != nil {
+			firstErr = err
+		} else {
+			stats.FileHash = fileHash
+		}
+	}
+
+	if firstErr == nil && ctx.Err() != nil {
+		firstErr = fmt.Errorf("transfer cancelled: %w", ctx.Err())
+	}
+	return firstErr
+}
+
+// reconnectAfter reports whether err lost the connection to the receiver mid-transfer and, if so,
+// whether a new session could be opened to resume over. reconnects counts earlier reconnects for
+// the same file, which are limited by SenderConfig.Reconnects.
+func (s *sendSession) reconnectAfter(ctx context.Context, err error, reconnects int) bool {
+	if ctx.Err() != nil || !isConnectionLost(err) || reconnects >= s.config.Reconnects {
+		return false
+	}
+	clearProgressLine()
+	logf("⚠️  Connection to %s lost (%v), reconnecting to resume (%d/%d)...\n", s.peerAddr, err, reconnects+1, s.config.Reconnects)
+
+	// Keep the chunk size, or the receiver's record of stored chunks wouldn't apply
+	config := s.config
+	config.AutoChunkSize = false
+	session, dialErr := openSendSession(ctx, s.peerAddr, config)
+	if dialErr != nil {
+		logf("Reconnecting to %s failed: %v\n", s.peerAddr, dialErr)
+		return false
+	}
+	s.conn.CloseWithError(0, "")
+	s.conn, s.controlStream, s.framed = session.conn, session.controlStream, session.framed
+
+	// The new connection is a new session on the receiver, so a directory being sent is announced
+	// again for its files to be accepted without prompting
+	if s.directory != "" {
+		if err := s.sendDirectoryEntry(s.directory, s.directorySize); err != nil {
+			logf("Reconnecting to %s failed: %v\n", s.peerAddr, err)
+			return false
+		}
+	}
+	return true
+}
+
+// finishWithTrailer sends the file hash after the last chunk and waits for the receiver's verdict
+func (s *sendSession) finishWithTrailer(fileHash string) error {
+	if err := writeControlMessage(s.controlStream, NewFileTrailer(fileHash), s.framed); err != nil {
+		return fmt.Errorf("failed to send file trailer: %w", err)
+	}
+
+	_, data, err := readControlMessage(s.controlStream)
+	if err != nil {
+		return fmt.Errorf("failed to read transfer result: %w", err)
+	}
+	complete, err := DeserializeTransferComplete(data)
+	if err != nil {
+		return err
+	}
+	if !complete.Verified {
+		return fmt.Errorf("%w: receiver reported: %s", ErrChecksumMismatch, complete.ErrorMsg)
+	}
+	return nil
+}
+
+// sendDirectoryEntry announces a directory so the receiver can recreate it (including empty ones).
+// totalSize is only meaningful for the top-level directory, where it's shown in the acceptance prompt.
+func (s *sendSession) sendDirectoryEntry(relativePath string, totalSize int64) error {
+	request := NewTransferRequest(path.Base(relativePath), totalSize, "", s.config.ChunkSize)
+	request.RelativePath = relativePath
+	request.IsDir = true
+	request.DryRun = s.config.DryRun
+
+	response, err := s.exchangeRequest(request)
+	if err != nil {
+		return err
+	}
+
+	if !response.Accepted {
+		logf("Transfer rejected: %s\n", response.RejectionMsg)
+		return rejectionError(response)
+	}
+
+	return nil
+}
+
+// rejectionError converts a rejected response into an error. Version mismatches are reported as
+// ErrUnsupportedVersion rather than ErrTransferRejected, since they aren't a user's decision.
+// Anything else is a *RejectionError carrying the receiver's reason code.
+func rejectionError(response *TransferResponse) error {
+	if !IsCompatibleVersion(response.ProtocolVersion) {
+		return fmt.Errorf("%w: peer speaks protocol %s, this device speaks %s",
+			ErrUnsupportedVersion, response.ProtocolVersion, ProtocolVersion)
+	}
+	return &RejectionError{Code: response.RejectionCode, Message: response.RejectionMsg}
+}
+
+// SendFileChunked sends a file using the new chunked QUIC protocol
+func SendFileChunked(filename string, peerAddr string) error {
+	return SendFileChunkedWithConfig(filename, peerAddr, DefaultSenderConfig())
+}
+
+// SendFileChunkedWithConfig sends a file using the chunked QUIC protocol with custom sender options
+func SendFileChunkedWithConfig(filename string, peerAddr string, config SenderConfig) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+
+	// Bound the whole send, which for large files over slow links may need TransferTimeout raised
+	ctx, cancel := transferContext(context.Background(), config.TransferTimeout)
+	defer cancel()
+
+	// Fail fast on unreadable files before dialing the peer
+	if _, err := os.Stat(filename); err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+
+	session, err := openSendSession(ctx, peerAddr, config)
+	if err != nil {
+		if canFallBackToTCP(ctx, err, []string{filename}, config) {
+			return sendOverTCP(ctx, []string{filename}, peerAddr, err)
+		}
+		return err
+	}
+	defer session.Close()
+
+	err = session.sendFile(ctx, filename, "")
+	if errors.Is(err, ErrTransferRejected) {
+		return nil // Return nil instead of error since rejection is a normal outcome
+	}
+	return err
+}
+
+// directoryEntry is a file or directory found while walking a directory for transfer
+type directoryEntry struct {
+	localPath    string // Path on the local filesystem
+	relativePath string // Slash-separated path starting with the transferred directory's name
+	isDir        bool
+}
+
+// collectDirectoryEntries walks dirPath and returns everything to transfer along with the total file size.
+// Symbolic links are skipped with a warning rather than followed.
+func collectDirectoryEntries(dirPath string) ([]directoryEntry, int64, error) {
+	absPath, err := filepath.Abs(dirPath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to resolve directory path: %w", err)
+	}
+	rootName := filepath.Base(absPath)
+
+	var entries []directoryEntry
+	var totalSize int64
+
+	err = filepath.WalkDir(dirPath, func(localPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if localPath == dirPath {
+			return nil // The root is announced separately
+		}
+
+		if d.Type()&fs.ModeSymlink != 0 {
+			logf("Warning: skipping symbolic link '%s'\n", localPath)
+			return nil
+		}
+
+		rel, err := filepath.Rel(dirPath, localPath)
+		if err != nil {
+			return err
+		}
+		relativePath := path.Join(rootName, filepath.ToSlash(rel))
+
+		if d.IsDir() {
+			entries = append(entries, directoryEntry{localPath: localPath, relativePath: relativePath, isDir: true})
+			return nil
+		}
+
+		if !d.Type().IsRegular() {
+			logf("Warning: skipping special file '%s'\n", localPath)
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		totalSize += info.Size()
+		entries = append(entries, directoryEntry{localPath: localPath, relativePath: relativePath})
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to walk directory: %w", err)
+	}
+
+	return entries, totalSize, nil
+}
+
+// SendDirectoryChunked sends a directory tree over a single QUIC connection, preserving relative paths
+func SendDirectoryChunked(dirPath string, peerAddr string) error {
+	return SendDirectoryChunkedWithConfig(dirPath, peerAddr, DefaultSenderConfig())
+}
+
+// SendDirectoryChunkedWithConfig sends a directory tree using custom sender options
+func SendDirectoryChunkedWithConfig(dirPath string, peerAddr string, config SenderConfig) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+
+	ctx, cancel := transferContext(context.Background(), config.TransferTimeout)
+	defer cancel()
+
+	entries, totalSize, err := collectDirectoryTransfer(dirPath)
+	if err != nil {
+		return err
+	}
+
+	session, err := openSendSession(ctx, peerAddr, config)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	err = session.sendDirectory(ctx, dirPath, entries, totalSize)
+	if errors.Is(err, ErrTransferRejected) {
+		return nil // Rejection is a normal outcome
+	}
+	return err
+}
+
+// collectDirectoryTransfer checks that dirPath is a directory and collects everything to send from it
+func collectDirectoryTransfer(dirPath string) ([]directoryEntry, int64, error) {
+	info, err := os.Stat(dirPath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, 0, fmt.Errorf("'%s' is not a directory", dirPath)
+	}
+
+	return collectDirectoryEntries(dirPath)
+}
+
+// sendDirectory sends a collected directory tree over the session, announcing the top-level directory first
+func (s *sendSession) sendDirectory(ctx context.Context, dirPath string, entries []directoryEntry, totalSize int64) error {
+	absPath, _ := filepath.Abs(dirPath)
+	rootName := filepath.Base(absPath)
+
+	fileCount := 0
+	for _, entry := range entries {
+		if !entry.isDir {
+			fileCount++
+		}
+	}
+
+	logf("Preparing to send directory '%s' (%.2f MB, %d files) to %s\n",
+		rootName,
+		float64(totalSize)/(1024*1024),
+		fileCount,
+		s.peerAddr)
+
+	// Announce the top-level directory first so the receiver approves the whole tree once
+	if err := s.sendDirectoryEntry(rootName, totalSize); err != nil {
+		return err
+	}
+	s.directory, s.directorySize = rootName, totalSize
+	defer func() { s.directory, s.directorySize = "", 0 }()
+
+	if s.config.DryRun {
+		logln("Dry run: directory accepted, not sending any data")
+		logf("  Directory: %s\n", rootName)
+		logf("  Size:      %d bytes (%.2f MB)\n", totalSize, float64(totalSize)/(1024*1024))
+		logf("  Files:     %d\n", fileCount)
+		return nil
+	}
+
+	for _, entry := range entries {
+		var err error
+		if entry.isDir {
+			err = s.sendDirectoryEntry(entry.relativePath, 0)
+		} else {
+			err = s.sendFile(ctx, entry.localPath, entry.relativePath)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to send '%s': %w", entry.relativePath, err)
+		}
+	}
+
+	logf("Directory transfer completed: %d files sent from '%s'\n", fileCount, rootName)
+	return nil
+}
+
+// SendFilesChunkedWithConfig sends several files or directories over a single QUIC connection, so the
+// handshake is paid once. Each path is a separate request on the control stream; a rejected path is
+// skipped and the rest are still offered. A combined summary is printed at the end.
+func SendFilesChunkedWithConfig(paths []string, peerAddr string, config SenderConfig) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+
+	ctx, cancel := transferContext(context.Background(), config.TransferTimeout)
+	defer cancel()
+
+	// Fail fast on unreadable paths before dialing the peer
+	directories := make(map[string][]directoryEntry)
+	directorySizes := make(map[string]int64)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to open '%s': %w", path, err)
+		}
+		if info.IsDir() {
+			entries, totalSize, err := collectDirectoryTransfer(path)
+			if err != nil {
+				return err
+			}
+			directories[path], directorySizes[path] = entries, totalSize
+		}
+	}
+
+	session, err := openSendSession(ctx, peerAddr, config)
+	if err != nil {
+		if canFallBackToTCP(ctx, err, paths, config) {
+			return sendOverTCP(ctx, paths, peerAddr, err)
+		}
+		return err
+	}
+	defer session.Close()
+
+	startTime := time.Now()
+	for _, path := range paths {
+		if entries, isDir := directories[path]; isDir {
+			err = session.sendDirectory(ctx, path, entries, directorySizes[path])
+		} else {
+			err = session.sendFile(ctx, path, "")
+		}
+		if err != nil && !errors.Is(err, ErrTransferRejected) {
+			err = fmt.Errorf("failed to send '%s': %w", path, err)
+			break
+		}
+		err = nil // Rejection is a normal outcome, so offer the next path
+	}
+
+	// A dry run hasn't transferred anything to summarize
+	if !config.DryRun && !config.Quiet {
+		printBatchSummary(session.results, time.Since(startTime))
+	}
+	return err
+}
+
+// ReceiveFileChunked receives a file using the new chunked QUIC protocol
+func ReceiveFileChunked(port string) error {
+	return ReceiveFileChunkedWithConfig(port, DefaultReceiverConfig())
+}
+
+// ReceiveFileChunkedWithConfig receives a file using the chunked QUIC protocol with custom receiver options
+func ReceiveFileChunkedWithConfig(port string, config ReceiverConfig) error {
+	return ReceiveFileChunkedContext(context.Background(), port, config)
+}
+
+// ReceiveFileChunkedContext is ReceiveFileChunkedWithConfig with a context. In daemon mode it keeps
+// serving connections until ctx is cancelled.
+func ReceiveFileChunkedContext(ctx context.Context, port string, config ReceiverConfig) error {
+	if config.Daemon && config.Output != nil {
+		// Concurrent connections would interleave their data in the stream
+		return fmt.Errorf("daemon mode can't write to a single output stream")
+	}
+	if err := config.validate(); err != nil {
+		return err
+	}
+	if err := ensureOutputDir(config.OutputDir); err != nil {
+		return err
+	}
+
+	// Start discovery listener in background with the correct port
+	capabilities := []string{CapabilityQUICChunked}
+	if config.TCPFallback {
+		capabilities = append(capabilities, CapabilityTCP)
+	}
+	if err := StartDiscoveryListener(port, capabilities...); err != nil {
+		logf("⚠️  %v - this receiver won't answer discovery requests, but senders can still use its address\n", err)
+	} else {
+		defer stopAdvertising(port)
+	}
+
+	// Get server TLS config
+	tlsConfig := GetServerTLSConfig()
+	if tlsConfig == nil {
+		return fmt.Errorf("failed to get server TLS config")
+	}
+
+	// Create UDP listener
+	udpAddr, err := net.ResolveUDPAddr("udp", listenAddress(port))
+	if err != nil {
+		return fmt.Errorf("failed to resolve UDP address: %w", err)
+	}
+
+	udpConn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on UDP: %w", err)
+	}
+	defer udpConn.Close()
+
+	logf("Listening for chunked QUIC transfers on port %s...\n", port)
+
+	// Create QUIC listener
+	listener, err := quic.Listen(udpConn, tlsConfig, newQUICConfig())
+	if err != nil {
+		return fmt.Errorf("failed to create QUIC listener: %w", err)
+	}
+	defer listener.Close()
+
+	var tcpListener net.Listener
+	if config.TCPFallback {
+		tcpListener, err = net.Listen("tcp", listenAddress(port))
+		if err != nil {
+			return fmt.Errorf("failed to listen on TCP port %s for the fallback: %w", port, err)
+		}
+		defer tcpListener.Close()
+	}
+
+	outputs := receivingOutputs
+	if config.Daemon {
+		if tcpListener != nil {
+			go serveTCPFallback(ctx, tcpListener, config, nil)
+		}
+		return serveChunkedConnections(ctx, listener, config, outputs)
+	}
+
+	// TransferTimeout bounds waiting for the sender as well as the transfer itself
+	ctx, cancel := transferContext(ctx, config.TransferTimeout)
+	defer cancel()
+
+	// A transfer over the TCP fallback ends the wait for a sender like one over QUIC
+	waitCtx, stopWaiting := context.WithCancel(ctx)
+	defer stopWaiting()
+	tcpResult := make(chan error, 1)
+	if tcpListener != nil {
+		go func() {
+			serveTCPFallback(ctx, tcpListener, config, tcpResult)
+			stopWaiting()
+		}()
+	}
+
+	// A ping only checks that this receiver is up, so the sender that follows still gets served.
+	// After a dropped connection the sender gets ReconnectWindow to come back and resume.
+	acceptCtx := waitCtx
+	var lostErr error
+	for {
+		conn, err := listener.Accept(acceptCtx)
+		if err != nil {
+			select {
+			case err := <-tcpResult:
+				return err
+			default:
+			}
+			if lostErr != nil {
+				return lostErr
+			}
+			if errors.Is(err, context.Canceled) {
+				return fmt.Errorf("receiver stopped before a sender connected: %w", err)
+			}
+			return fmt.Errorf("failed to accept QUIC connection: %w", err)
+		}
+
+		pinged, err := serveChunkedConnection(ctx, conn, config, outputs)
+		switch {
+		case pinged:
+		case isConnectionLost(err):
+			logf("Connection lost, waiting %v for the sender to reconnect...\n", ReconnectWindow)
+			lostErr = err
+			var cancelWait context.CancelFunc
+			acceptCtx, cancelWait = context.WithTimeout(waitCtx, ReconnectWindow)
+			defer cancelWait()
+		default:
+			return err
+		}
+	}
+}
+
+// serveChunkedConnections accepts connections until ctx is cancelled, serving each in its own goroutine
+// so a failing sender doesn't take the listener down with it. Connections beyond
+// config.MaxConnections are turned away, so a flood of them can't exhaust the receiver.
+func serveChunkedConnections(ctx context.Context, listener *quic.Listener, config ReceiverConfig, outputs *activeOutputs) error {
+	limit := newConnectionLimit(config.MaxConnections)
+	logf("Daemon mode: waiting for transfers, up to %d at once (Ctrl+C to stop)\n", limit.max)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := listener.Accept(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to accept QUIC connection: %w", err)
+		}
+
+		peerAddr := conn.RemoteAddr().String()
+		if !limit.acquire() {
+			logf("⚠️  Turned away %s: %d transfers already in progress\n", peerAddr, limit.max)
+			limit.turnAway(conn)
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pinged, err := serveChunkedConnection(ctx, conn, config, outputs)
+			limit.release()
+			if err != nil {
+				logf("Transfer from %s failed: %v (%d of %d active)\n", peerAddr, err, limit.count(), limit.max)
+			} else if pinged {
+				logf("Answered ping from %s\n", peerAddr)
+			} else {
+				logf("Transfer from %s finished (%d of %d active)\n", peerAddr, limit.count(), limit.max)
+			}
+		}()
+	}
+}
+
+// serveChunkedConnection runs the receive session for a single sender connection. pinged reports
+// that the connection was only a PingPeer check rather than a transfer.
+func serveChunkedConnection(ctx context.Context, conn quic.Connection, config ReceiverConfig, outputs *activeOutputs) (pinged bool, err error) {
+	defer conn.CloseWithError(0, "")
+
+	// Reads on the control stream don't take a context, so closing the connection is what
+	// unblocks a session waiting for the sender's next request when the receiver shuts down
+	stopClosing := context.AfterFunc(ctx, func() {
+		conn.CloseWithError(0, "receiver shutting down")
+	})
+	defer stopClosing()
+
+	// Accept control stream
+	controlStream, err := conn.AcceptStream(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to accept control stream: %w", err)
+	}
+
+	session := &receiveSession{
+		conn:          conn,
+		controlStream: controlStream,
+		config:        config,
+		peerAddr:      conn.RemoteAddr().String(),
+		deviceID:      peerDeviceID(conn),
+		acceptedRoots: make(map[string]bool),
+		outputs:       outputs,
+	}
+
+	err = session.run(ctx)
+	if err != nil {
+		drainControlStream(controlStream, 2*time.Second)
+	}
+	return session.pinged, err
+}
+
+// receiveSession handles the sequence of transfer requests arriving on one QUIC connection
+type receiveSession struct {
+	conn          quic.Connection
+	controlStream quic.Stream
+	config        ReceiverConfig
+	peerAddr      string
+	deviceID      string          // Device ID from the sender's certificate, empty if it sent none
+	acceptedRoots map[string]bool // Top-level directories approved during this session
+	outputs       *activeOutputs  // Output files being written by this or concurrent sessions
+	framed        bool            // The sender reads length-prefixed control messages
+	pinged        bool            // The peer only pinged this receiver
+	calibrated    bool            // The sender has measured the connection for --auto-chunk
+}
+
+// run serves transfer requests until the sender closes the control stream.
+// A rejection doesn't end the session, but it is reported once the sender disconnects.
+func (s *receiveSession) run(ctx context.Context) error {
+	var sessionErr error
+	handled := 0
+
+	for {
+		messageType, data, err := readControlMessage(s.controlStream)
+		if err == io.EOF {
+			if handled == 0 {
+				return fmt.Errorf("connection closed before a transfer request was received")
+			}
+			return sessionErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read transfer request: %w", err)
+		}
+
+		// A peer pulling a file asks for it instead of offering one
+		if messageType == MessageFileRequest && handled == 0 {
+			return s.serveFileRequest(ctx, data)
+		}
+		if messageType == MessagePing && handled == 0 {
+			return s.answerPing(data)
+		}
+		if messageType == MessageCalibrate && handled == 0 && !s.calibrated {
+			s.calibrated = true
+			if err := s.answerCalibration(ctx, data); err != nil {
+				return err
+			}
+			continue
+		}
+		request, err := DeserializeTransferRequest(data)
+		if err != nil {
+			return err
+		}
+		handled++
+
+		if err := s.handleRequest(ctx, request); err != nil {
+			if errors.Is(err, ErrTransferRejected) {
+				if sessionErr == nil {
+					sessionErr = err
+				}
+				continue
+			}
+			return err
+		}
+	}
+}
+
+// readControlMessage reads the next message from the control stream and returns its type along
+// with the raw JSON, for callers that accept more than one kind of message. Frames are told apart
+// from the unframed JSON of older peers by their first byte, which is only '{' for the latter.
+// It returns io.EOF once the peer has closed the stream and no further messages follow.
+func readControlMessage(controlStream io.Reader) (MessageType, []byte, error) {
+	first := make([]byte, 1)
+	if _, err := io.ReadFull(controlStream, first); err != nil {
+		if err == io.EOF || isGracefulClose(err) {
+			return "", nil, io.EOF
+		}
+		return "", nil, err
+	}
+
+	reader := io.MultiReader(bytes.NewReader(first), controlStream)
+	var data []byte
+	var err error
+	if first[0] == '{' {
+		data, err = readUnframedMessage(reader)
+	} else {
+		data, err = ReadFramedMessage(reader)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	var envelope struct {
+		Type MessageType `json:"type"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return "", nil, fmt.Errorf("failed to parse control message: %w", err)
+	}
+	return envelope.Type, data, nil
+}
+
+// readUnframedMessage reads a bare JSON message, as peers before version 1.2 send them, by
+// growing the buffer until it holds valid JSON
+func readUnframedMessage(reader io.Reader) ([]byte, error) {
+	var messageBuffer []byte
+	buf := make([]byte, 4096)
+	for {
+		n, err := reader.Read(buf)
+		messageBuffer = append(messageBuffer, buf[:n]...)
+
+		if n > 0 && json.Valid(messageBuffer) {
+			return messageBuffer, nil
+		}
+
+		if err == io.EOF {
+			return nil, fmt.Errorf("control stream closed mid-message")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// writeControlMessage writes msg to the control stream, framed if the peer reads frames. The first
+// message on a stream goes out unframed, since the peer's version isn't known until it answers.
+func writeControlMessage(w io.Writer, msg interface{}, framed bool) error {
+	if framed {
+		return WriteFramedMessage(w, msg)
+	}
+	data, err := SerializeMessage(msg)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// isGracefulClose reports whether err is the peer closing the connection without an error code
+func isGracefulClose(err error) bool {
+	var appErr *quic.ApplicationError
+	return errors.As(err, &appErr) && appErr.Remote && appErr.ErrorCode == 0
+}
+
+// waitForPeerClose blocks until the peer closes the connection or the timeout expires
+func waitForPeerClose(conn quic.Connection, timeout time.Duration) {
+	select {
+	case <-conn.Context().Done():
+	case <-time.After(timeout):
+	}
+}
+
+// drainControlStream waits until the peer closes its side of the control stream or timeout passes.
+// Closing the connection discards unsent data, so this lets a final rejection reach the peer first.
+func drainControlStream(controlStream quic.Stream, timeout time.Duration) {
+	controlStream.SetReadDeadline(time.Now().Add(timeout))
+	io.Copy(io.Discard, controlStream)
+}
+
+// handleRequest decides on a single transfer request and, if accepted, receives its chunks
+func (s *receiveSession) handleRequest(ctx context.Context, request *TransferRequest) error {
+	if request.IsDir {
+		logf("Received transfer request for directory '%s' (%.2f MB)\n",
+			request.TargetPath(),
+			float64(request.FileSize)/(1024*1024))
+	} else {
+		logf("Received transfer request for '%s' (%.2f MB)\n",
+			request.TargetPath(),
+			float64(request.FileSize)/(1024*1024))
+	}
+
+	// Answer in the framing the sender's version reads
+	s.framed = supportsFraming(request.ProtocolVersion)
+
+	// Refuse senders whose chunk protocol may differ from ours
+	if !IsCompatibleVersion(request.ProtocolVersion) {
+		rejectionMsg := fmt.Sprintf("Unsupported protocol version %s (receiver speaks %s)", request.ProtocolVersion, ProtocolVersion)
+		logf("Rejecting transfer: %s\n", rejectionMsg)
+		if err := s.sendResponse(NewRejectionResponse(RejectionUnsupportedVersion, rejectionMsg)); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %s", ErrUnsupportedVersion, request.ProtocolVersion)
+	}
+	if err := ValidateHashAlgorithm(request.HashAlgorithm); err != nil {
+		rejectionMsg := fmt.Sprintf("Unsupported hash algorithm '%s' (receiver supports sha256 and blake3)", request.HashAlgorithm)
+		logf("Rejecting transfer: %s\n", rejectionMsg)
+		if err := s.sendResponse(NewRejectionResponse(RejectionInvalidRequest, rejectionMsg)); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %w", ErrProtocolMismatch, err)
+	}
+	request.HashAlgorithm = normalizeHashAlgorithm(request.HashAlgorithm)
+
+	// Refuse files the receiver can't or won't store before prompting or touching the filesystem
+	if err := s.checkFileSize(request); err != nil {
+		return err
+	}
+
+	// Validate the peer-supplied path before anything touches the filesystem
+	var accepted bool
+	var rejectionMsg string
+	var rejectionCode RejectionCode
+	targetPath := request.TargetPath()
+	outputFilename, err := resolveChunkedOutputPath(s.config.OutputDir, targetPath)
+	if err != nil {
+		logf("Rejecting transfer: %v\n", err)
+		rejectionMsg, rejectionCode = "Invalid filename", RejectionInvalidRequest
+	} else if !senderAllowed(s.config.AllowedDevices, s.deviceID, defaultTrustStore()) {
+		logf("Rejecting transfer from %s: device '%s' is not on the allowlist\n", s.peerAddr, s.deviceID)
+		rejectionMsg, rejectionCode = "Sender is not on the receiver's allowlist", RejectionUntrusted
+	} else if s.config.OnConflict == ConflictSkip && !request.IsDir && !request.IsText() && s.config.Output == nil && outputExists(outputFilename) {
+		logf("Rejecting transfer: '%s' already exists\n", outputFilename)
+		rejectionMsg, rejectionCode = "File already exists on the receiver", RejectionFileExists
+	} else if ok, reason := s.beforeAccept(request); !ok {
+		logf("Rejecting transfer: %s\n", reason)
+		rejectionMsg, rejectionCode = reason, RejectionPolicy
+	} else if s.isWithinAcceptedDirectory(targetPath) {
+		// Part of a directory the user already approved
+		accepted = true
+	} else {
+		// Prompt user for confirmation, or ask the configured policy
+		accepted, rejectionMsg = s.confirmTransfer(request)
+		if !accepted {
+			rejectionCode = RejectionUserDeclined
+			if s.config.AcceptPolicy != nil {
+				rejectionCode = RejectionPolicy
+			}
+		}
+	}
+
+	if request.IsText() {
+		return s.handleTextRequest(ctx, request, accepted, rejectionCode, rejectionMsg)
+	}
+	if s.config.Output != nil {
+		_, err := s.handleStreamRequest(ctx, request, s.config.Output, accepted, rejectionCode, rejectionMsg)
+		return err
+	}
+	if request.IsDir {
+		return s.handleDirectoryRequest(request, outputFilename, accepted, rejectionCode, rejectionMsg)
+	}
+
+	var requiredChunks []int
+	var rejectionReason error
+	var writeFilename string
+	var verifiedChecksums map[int64]string
+	if accepted {
+		// Give this transfer its own file when the name is taken by an unrelated file
+		// or by another connection writing a different file under the same name right now
+		usable := func(path string) bool {
+			return canWriteChunkedOutput(path, request)
+		}
+		if s.config.OnConflict == ConflictOverwrite {
+			usable = canOverwriteOutput
+		}
+		if claimed, ok := s.outputs.claim(outputFilename, request.resumeKey(), usable); !ok {
+			// Writing the same file twice at once would interleave the two transfers' writes
+			logf("Rejecting transfer: '%s' is already being received by another transfer\n", outputFilename)
+			accepted = false
+			rejectionMsg = fmt.Sprintf("'%s' is already being received by another transfer", request.TargetPath())
+			rejectionCode = RejectionInProgress
+		} else {
+			defer s.outputs.release(claimed)
+			if claimed != outputFilename {
+				logf("'%s' already exists or is being received, writing to '%s'\n", outputFilename, claimed)
+				outputFilename = claimed
+			}
+		}
+	}
+	if accepted {
+		// Chunks go to the partial file, unless the final name already holds an identical copy. A file
+		// being overwritten stays in place until the new one is verified and renamed over it.
+		if _, err := os.Stat(outputFilename); os.IsNotExist(err) || (s.config.OnConflict == ConflictOverwrite && !canWriteChunkedOutput(outputFilename, request)) {
+			writeFilename = partialFilePath(outputFilename)
+		} else {
+			writeFilename = outputFilename
+		}
+		requiredChunks = getRequiredChunks(writeFilename, request.resumeKey(), request.FileSize, request.ChunkSize)
+		if s.config.VerifyExisting {
+			var failed []int
+			failed, verifiedChecksums = verifyExistingChunks(writeFilename, request)
+			if len(failed) > 0 {
+				logf("%d chunk(s) already in '%s' failed verification and will be received again\n", len(failed), writeFilename)
+				requiredChunks = mergeChunks(requiredChunks, failed)
+			}
+		}
+
+		// Only the chunks still missing need room, so a resumed transfer can finish on a nearly full disk
+		if msg := insufficientSpaceMessage(writeFilename, remainingBytes(request, requiredChunks)); msg != "" {
+			logf("Rejecting transfer: %s\n", msg)
+			accepted, rejectionMsg, rejectionReason = false, msg, ErrInsufficientSpace
+			rejectionCode = RejectionNoSpace
+			requiredChunks = nil
+		}
+	}
+	response := NewTransferResponse(accepted, requiredChunks, rejectionMsg)
+	response.RejectionCode = rejectionCode
+	if accepted && isCompressionEnabled(request.Compression) {
+		response.Compression = request.Compression
+	}
+	if accepted {
+		response.HashAlgorithm = request.HashAlgorithm
+		response.HashTrailer = request.HashTrailer
+		response.ChunkAcks = request.ChunkAcks
+	}
+
+	// Initialize transfer statistics
+	totalChunks := int((request.FileSize + request.ChunkSize - 1) / request.ChunkSize)
+	stats := NewTransferStats(request.Filename, request.FileSize, totalChunks, s.peerAddr, "received")
+	stats.Path = outputFilename
+	stats.OnProgress = s.config.OnProgress
+	stats.SetQuiet(s.config.Quiet)
+
+	if err := s.sendResponse(response); err != nil {
+		return err
+	}
+
+	if !accepted {
+		stats.MarkRejected(rejectionMsg)
+		stats.PrintSummary()
+		if rejectionReason != nil {
+			return fmt.Errorf("%w: %w: %s", ErrTransferRejected, rejectionReason, rejectionMsg)
+		}
+		return fmt.Errorf("%w: %s", ErrTransferRejected, rejectionMsg)
+	}
+
+	if request.DryRun {
+		logf("Dry run: '%s' would be written to '%s' (%d chunks needed)\n", targetPath, outputFilename, len(response.ResumeChunks))
+		return nil
+	}
+
+	logf("Accepting transfer with %d chunks to receive\n", len(response.ResumeChunks))
+	stats.TotalChunks = len(response.ResumeChunks) // Update to only required chunks
+
+	// Create output file (and any parent directories) under the output directory
+	if err := os.MkdirAll(filepath.Dir(outputFilename), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	outputFile, err := os.OpenFile(writeFilename, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer outputFile.Close()
+
+	// Record which chunks are on disk so an interrupted transfer can resume
+	progress := newChunkProgress(writeFilename, request.resumeKey(), request.FileSize, request.ChunkSize, response.ResumeChunks)
+	if s.config.VerifyExisting {
+		progress.trackChecksums(request.HashAlgorithm, verifiedChecksums)
+	}
+	if err := progress.save(); err != nil {
+		return err
+	}
+
+	// Receive chunks using the reliable chunk protocol
+	var checksums map[int64]string
+	if s.config.WriteManifest {
+		checksums = make(map[int64]string, len(response.ResumeChunks))
+	}
+	if err := s.receiveChunks(ctx, request, response, outputFile, progress, checksums, stats); err != nil {
+		stats.MarkFailed(err.Error())
+		stats.PrintSummary()
+		if ctx.Err() != nil || isConnectionLost(err) {
+			// Every chunk recorded in the progress file is on disk, so the next attempt picks up from here
+			received := progress.totalChunks() - int64(len(progress.missingChunks()))
+			logf("Transfer interrupted: keeping '%s' (%d of %d chunks) so it can be resumed\n", writeFilename, received, progress.totalChunks())
+		}
+		return err
+	}
+
+	// Chunks are placed with WriteAt, so bytes left past the end by an earlier, larger file would survive
+	if err := outputFile.Truncate(request.FileSize); err != nil {
+		stats.MarkFailed(err.Error())
+		stats.PrintSummary()
+		return fmt.Errorf("failed to truncate output file: %w", err)
+	}
+
+	// Every chunk is on disk and recorded, so a missing trailer leaves the transfer resumable
+	if err := s.readTrailer(request); err != nil {
+		stats.MarkFailed(err.Error())
+		stats.PrintSummary()
+		return err
+	}
+
+	// Clear the progress line and print completion message
+	clearProgressLine()
+	logf("File transfer completed: %s\n", writeFilename)
+
+	// Verify file integrity
+	logln("Verifying file integrity...")
+	outputFile.Close() // Close before reading for hash verification
+
+	verified := verifyFileIntegrity(writeFilename, request.HashAlgorithm, request.FileHash)
+	if verified && writeFilename != outputFilename {
+		// The sidecar stays until the rename succeeds, so a failed rename is retried with nothing left to send
+		if err := os.Rename(writeFilename, outputFilename); err != nil {
+			stats.MarkFailed(err.Error())
+			stats.PrintSummary()
+			return fmt.Errorf("failed to move verified file into place: %w", err)
+		}
+		logf("Saved as %s\n", outputFilename)
+	}
+	if verified && s.config.PreserveAttributes {
+		if err := applyFileAttributes(outputFilename, request); err != nil {
+			logf("Warning: %v\n", err)
+		}
+	}
+	if err := s.reportVerification(request, verified); err != nil {
+		logf("Warning: %v\n", err)
+	}
+	if verified {
 		// Mark transfer as completed and print final statistics
+		stats.FileHash = request.FileHash
 		stats.MarkCompleted()
-		fmt.Println() // New line after progress
+		logln() // New line after progress
 		stats.PrintSummary()
-		fmt.Println("✅ File integrity verified - transfer successful!")
+		logln("✅ File integrity verified - transfer successful!")
+		if checksums != nil {
+			if err := writeManifest(outputFilename, request, checksums); err != nil {
+				logf("Warning: %v\n", err)
+			}
+		}
+		if err := progress.remove(); err != nil {
+			logf("Warning: %v\n", err)
+		}
+		if s.config.AfterReceive != nil {
+			if err := s.config.AfterReceive(outputFilename, stats); err != nil {
+				logf("Warning: post-receive hook failed for '%s': %v\n", outputFilename, err)
+			}
+		}
 	} else {
+		// The bitmap can't be trusted any more, so the next attempt starts over
+		if err := progress.reset(); err != nil {
+			logf("Warning: %v\n", err)
+		}
 		stats.MarkFailed("file integrity verification failed")
 		stats.PrintSummary()
-		fmt.Printf("❌ File integrity check failed!\n")
+		logf("❌ File integrity check failed!\n")
 		return fmt.Errorf("file integrity verification failed")
 	}
 
 	return nil
 }
 
-// getRequiredChunks determines which chunks need to be received based on existing file
-func getRequiredChunks(filename string, fileSize int64, chunkSize int64) []int {
-	totalChunks := (fileSize + chunkSize - 1) / chunkSize
-	requiredChunks := make([]int, 0, totalChunks)
-
-	// Check if file exists and get its size (check for "received_" prefix version)
-	receivedFilename := "received_" + filename
-	if info, err := os.Stat(receivedFilename); err == nil {
-		existingSize := info.Size()
-		existingChunks := existingSize / chunkSize
-
-		// Only include chunks that are not already present
-		for i := int64(0); i < totalChunks; i++ {
-			if i >= existingChunks {
-				requiredChunks = append(requiredChunks, int(i))
+// chunkResult is the outcome of receiving a single chunk stream
+type chunkResult struct {
+	chunk *ChunkData
+	err   error
+	fatal bool // write failures abort the transfer instead of waiting for a retry
+}
+
+// receiveChunks accepts chunk streams until every required chunk has been written and recorded in progress and checksums (if set). Up to MaxConcurrentChunks
+// streams are read concurrently and chunks are placed by the index in their header, since the sender's
+// workers finish in any order. A chunk that fails verification isn't acknowledged, so the sender retries it.
+func (s *receiveSession) receiveChunks(ctx context.Context, request *TransferRequest, response *TransferResponse, output io.WriterAt, progress *chunkProgress, checksums map[int64]string, stats *TransferStats) error {
+	requiredChunks := response.ResumeChunks
+	var pendingMutex sync.Mutex
+	pending := make(map[int64]bool, len(requiredChunks))
+	for _, chunkIndex := range requiredChunks {
+		pending[int64(chunkIndex)] = true
+	}
+	expectedSize := func(chunkIndex int64) (int, error) {
+		size, err := chunkSizeAt(request.FileSize, request.ChunkSize, chunkIndex)
+		if err != nil {
+			return 0, err
+		}
+		pendingMutex.Lock()
+		defer pendingMutex.Unlock()
+		if !pending[chunkIndex] {
+			return 0, fmt.Errorf("received unexpected chunk index %d", chunkIndex)
+		}
+		return size, nil
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	// Accept streams in the background so completed chunks can be counted while others are in flight.
+	// The accept loop must have stopped before returning, or it would take the next file's chunk streams.
+	acceptCtx, stopAccepting := context.WithCancel(ctx)
+	acceptStopped := make(chan struct{})
+	defer func() {
+		stopAccepting()
+		<-acceptStopped
+	}()
+
+	streams := make(chan quic.Stream)
+	acceptErrs := make(chan error, 1)
+	go func() {
+		defer close(acceptStopped)
+		for {
+			streamCtx, streamCancel := createStreamContext(acceptCtx, s.config.StreamTimeout)
+			chunkStream, err := s.conn.AcceptStream(streamCtx)
+			streamCancel()
+			if err != nil {
+				acceptErrs <- err
+				return
+			}
+			select {
+			case streams <- chunkStream:
+			case <-acceptCtx.Done():
+				chunkStream.CancelRead(0)
+				return
 			}
 		}
-	} else {
+	}()
+
+	results := make(chan chunkResult)
+	semaphore := make(chan struct{}, MaxConcurrentChunks)
+	remaining := len(requiredChunks)
+
+	for remaining > 0 {
+		select {
+		case chunkStream := <-streams:
+			go func() {
+				semaphore <- struct{}{}
+				defer func() { <-semaphore }()
+
+				result := chunkResult{}
+				result.chunk, result.err = receiveChunkReliably(ctx, chunkStream, response.Compression, request.HashAlgorithm, expectedSize)
+				if result.err == nil {
+					// Write chunk to file; WriteAt is safe for concurrent use at distinct offsets
+					offset := result.chunk.ChunkIndex * request.ChunkSize
+					if _, err := output.WriteAt(result.chunk.Data, offset); err != nil {
+						result.err = fmt.Errorf("failed to write chunk %d: %w", result.chunk.ChunkIndex, err)
+						result.fatal = true
+					}
+				}
+				if result.chunk != nil {
+					// WriteAt doesn't keep the slice (orderedWriter copies what it buffers), so the
+					// buffer can be reused; only the index and ChunkSize are read from here on
+					result.chunk.release()
+				}
+				// A header that couldn't be read leaves no chunk to answer for
+				var failed *chunkReceiveError
+				switch {
+				case result.chunk != nil:
+					acknowledgeChunk(chunkStream, request.ChunkAcks, result.chunk.ChunkIndex, result.err, result.fatal)
+				case errors.As(result.err, &failed):
+					// Resending data that was out of range or didn't decode would fail the same way
+					acknowledgeChunk(chunkStream, request.ChunkAcks, failed.chunkIndex, result.err, errors.Is(result.err, ErrChunkCorrupted))
+				default:
+					chunkStream.Close()
+					chunkStream.CancelRead(0)
+				}
+
+				select {
+				case results <- result:
+				case <-done:
+				}
+			}()
+
+		case result := <-results:
+			if result.err != nil {
+				if result.fatal {
+					return result.err
+				}
+				// Not acknowledged, so the sender will retry this chunk on a new stream
+				logf("\nWarning: %v\n", result.err)
+				continue
+			}
+
+			pendingMutex.Lock()
+			isNew := pending[result.chunk.ChunkIndex]
+			delete(pending, result.chunk.ChunkIndex)
+			pendingMutex.Unlock()
+			if !isNew {
+				continue
+			}
+
+			remaining--
+
+			if progress != nil {
+				progress.recordChecksum(result.chunk.ChunkIndex, result.chunk.Checksum)
+				if err := progress.markReceived(result.chunk.ChunkIndex); err != nil {
+					return err
+				}
+			}
+			if checksums != nil {
+				checksums[result.chunk.ChunkIndex] = result.chunk.Checksum
+			}
+
+			// Increment received chunks and print progress
+			stats.AddBytesTransferred(int64(result.chunk.ChunkSize))
+			stats.IncrementReceivedChunks()
+			stats.PrintProgress()
+
+		case err := <-acceptErrs:
+			return fmt.Errorf("failed to accept chunk stream (%d chunks remaining): %w", remaining, err)
+
+		case <-ctx.Done():
+			return fmt.Errorf("transfer cancelled: %w", ctx.Err())
+		}
+	}
+
+	return nil
+}
+
+// checkFileSize rejects a file over the configured size limit. The sender is told why,
+// and the session continues with its next request.
+func (s *receiveSession) checkFileSize(request *TransferRequest) error {
+	limit := s.config.MaxFileSize
+	if request.IsDir || limit <= 0 || request.FileSize <= limit {
+		return nil
+	}
+
+	rejectionMsg := fmt.Sprintf("File is %s, larger than the receiver's %s limit", FormatByteSize(request.FileSize), FormatByteSize(limit))
+	logf("Rejecting transfer of '%s': %s\n", request.TargetPath(), rejectionMsg)
+	if err := s.sendResponse(NewRejectionResponse(RejectionTooLarge, rejectionMsg)); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %w: %s", ErrTransferRejected, ErrFileTooLarge, rejectionMsg)
+}
+
+// handleStreamRequest receives an accepted file into w instead of the output directory.
+// A stream can't be resumed, so every chunk is requested and the hash is computed as the data is written.
+func (s *receiveSession) handleStreamRequest(ctx context.Context, request *TransferRequest, w io.Writer, accepted bool, rejectionCode RejectionCode, rejectionMsg string) (*TransferStats, error) {
+	if accepted && request.IsDir {
+		logf("Rejecting directory '%s': receiver is writing to stdout\n", request.TargetPath())
+		accepted, rejectionMsg = false, "Receiver is writing to stdout and can't accept directories"
+		rejectionCode = RejectionInvalidRequest
+	}
+
+	var requiredChunks []int
+	if accepted {
+		requiredChunks = allChunks(request.FileSize, request.ChunkSize)
+	}
+	response := NewTransferResponse(accepted, requiredChunks, rejectionMsg)
+	response.RejectionCode = rejectionCode
+	if accepted && isCompressionEnabled(request.Compression) {
+		response.Compression = request.Compression
+	}
+	if accepted {
+		response.HashAlgorithm = request.HashAlgorithm
+		response.HashTrailer = request.HashTrailer
+		response.ChunkAcks = request.ChunkAcks
+	}
+
+	stats := NewTransferStats(request.Filename, request.FileSize, len(requiredChunks), s.peerAddr, "received")
+	stats.OnProgress = s.config.OnProgress
+	stats.SetQuiet(s.config.Quiet)
+
+	if err := s.sendResponse(response); err != nil {
+		return stats, err
+	}
+
+	if !accepted {
+		stats.MarkRejected(rejectionMsg)
+		stats.PrintSummary()
+		return stats, fmt.Errorf("%w: %s", ErrTransferRejected, rejectionMsg)
+	}
+
+	if request.DryRun {
+		logf("Dry run: '%s' would be streamed (%d chunks)\n", request.TargetPath(), len(requiredChunks))
+		return stats, nil
+	}
+
+	logf("Accepting transfer with %d chunks to stream\n", len(requiredChunks))
+	output := newOrderedWriter(w, request.HashAlgorithm, MaxConcurrentChunks*request.ChunkSize)
+	defer output.close()
+	if err := s.receiveChunks(ctx, request, response, output, nil, nil, stats); err != nil {
+		stats.MarkFailed(err.Error())
+		stats.PrintSummary()
+		return stats, err
+	}
+	if err := s.readTrailer(request); err != nil {
+		stats.MarkFailed(err.Error())
+		stats.PrintSummary()
+		return stats, err
+	}
+	clearProgressLine()
+
+	// The data has already been written, so a mismatch can only be reported
+	verified := output.written() == request.FileSize && output.sum() == request.FileHash
+	if err := s.reportVerification(request, verified); err != nil {
+		logf("Warning: %v\n", err)
+	}
+	if !verified {
+		stats.MarkFailed("stream integrity verification failed")
+		stats.PrintSummary()
+		logf("❌ Stream integrity check failed!\n")
+		return stats, fmt.Errorf("stream integrity verification failed")
+	}
+
+	stats.FileHash = request.FileHash
+	stats.MarkCompleted()
+	logln()
+	stats.PrintSummary()
+	logln("✅ Stream integrity verified - transfer successful!")
+	return stats, nil
+}
+
+// beforeAccept runs the configured BeforeAccept hook, which accepts everything when unset
+func (s *receiveSession) beforeAccept(request *TransferRequest) (bool, string) {
+	if s.config.BeforeAccept == nil {
+		return true, ""
+	}
+	accept, reason := s.config.BeforeAccept(request)
+	if !accept && reason == "" {
+		reason = "Rejected by the receiver's policy"
+	}
+	return accept, reason
+}
+
+// handleDirectoryRequest creates an announced directory and records top-level approvals for the session
+func (s *receiveSession) handleDirectoryRequest(request *TransferRequest, outputPath string, accepted bool, rejectionCode RejectionCode, rejectionMsg string) error {
+	if accepted && !request.DryRun {
+		if err := os.MkdirAll(outputPath, 0755); err != nil {
+			logf("Failed to create directory '%s': %v\n", outputPath, err)
+			accepted = false
+			rejectionMsg, rejectionCode = "Failed to create directory", RejectionReceiverError
+		} else if relPath, _ := sanitizeRelativePath(request.TargetPath()); relPath == topLevelComponent(relPath) {
+			// Approving a top-level directory approves everything sent inside it
+			s.acceptedRoots[relPath] = true
+		}
+	}
+
+	response := NewTransferResponse(accepted, nil, rejectionMsg)
+	response.RejectionCode = rejectionCode
+	if err := s.sendResponse(response); err != nil {
+		return err
+	}
+
+	if !accepted {
+		return fmt.Errorf("%w: %s", ErrTransferRejected, rejectionMsg)
+	}
+
+	if request.DryRun {
+		logf("Dry run: directory '%s' would be created\n", outputPath)
+		return nil
+	}
+
+	logf("Created directory: %s\n", outputPath)
+	return nil
+}
+
+// isWithinAcceptedDirectory reports whether a path lies inside a directory approved earlier in the session
+func (s *receiveSession) isWithinAcceptedDirectory(targetPath string) bool {
+	relPath, err := sanitizeRelativePath(targetPath)
+	if err != nil || relPath == topLevelComponent(relPath) {
+		return false
+	}
+	return s.acceptedRoots[topLevelComponent(relPath)]
+}
+
+// sendResponse writes a transfer response to the control stream
+func (s *receiveSession) sendResponse(response *TransferResponse) error {
+	// Send response with proper flushing
+	if err := writeControlMessage(s.controlStream, response, s.framed); err != nil {
+		return fmt.Errorf("failed to send transfer response: %w", err)
+	}
+
+	// Ensure the response is sent immediately
+	if flusher, ok := s.controlStream.(interface{ Flush() error }); ok {
+		if err := flusher.Flush(); err != nil {
+			return fmt.Errorf("failed to flush transfer response: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// readTrailer reads the file hash that follows the last chunk when the sender deferred it
+func (s *receiveSession) readTrailer(request *TransferRequest) error {
+	if !request.HashTrailer {
+		return nil
+	}
+	_, data, err := readControlMessage(s.controlStream)
+	if err != nil {
+		return fmt.Errorf("failed to read file trailer: %w", err)
+	}
+	trailer, err := DeserializeFileTrailer(data)
+	if err != nil {
+		return err
+	}
+	request.FileHash = trailer.FileHash
+	return nil
+}
+
+// reportVerification tells a sender that sent a trailer whether the file matched it; other
+// senders don't wait for a result
+func (s *receiveSession) reportVerification(request *TransferRequest, verified bool) error {
+	if !request.HashTrailer {
+		return nil
+	}
+	errorMsg := ""
+	if !verified {
+		errorMsg = "file integrity verification failed"
+	}
+	if err := writeControlMessage(s.controlStream, NewTransferComplete(verified, errorMsg), s.framed); err != nil {
+		return fmt.Errorf("failed to send transfer result: %w", err)
+	}
+	return nil
+}
+
+// getRequiredChunks determines which chunks need to be received based on the existing output file.
+// The .landrop-progress sidecar is authoritative when it matches the transfer, since chunks are
+// written out of order and the file size alone doesn't say which ones are present. Without one,
+// any chunk the file doesn't fully contain or that reads back as all zeros, as the holes left by
+// out-of-order writes do, is requested again.
+func getRequiredChunks(outputFilename string, fileHash string, fileSize int64, chunkSize int64) []int {
+	file, err := os.Open(outputFilename)
+	if err != nil {
 		// File doesn't exist, need all chunks
-		for i := int64(0); i < totalChunks; i++ {
-			requiredChunks = append(requiredChunks, int(i))
+		return allChunks(fileSize, chunkSize)
+	}
+	defer file.Close()
+
+	if progress, err := loadChunkProgress(outputFilename, fileHash, fileSize, chunkSize); err == nil {
+		return progress.missingChunks()
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return allChunks(fileSize, chunkSize)
+	}
+
+	requiredChunks := make([]int, 0)
+	for _, chunkIndex := range allChunks(fileSize, chunkSize) {
+		offset := int64(chunkIndex) * chunkSize
+		size := min(chunkSize, fileSize-offset)
+		if offset+size > info.Size() || !chunkHasData(file, offset, size) {
+			requiredChunks = append(requiredChunks, chunkIndex)
 		}
 	}
 
 	return requiredChunks
 }
 
-// verifyFileIntegrity calculates the SHA256 hash of a file and compares it with expected hash
-func verifyFileIntegrity(filename string, expectedHash string) bool {
+// chunkHasData reports whether the size bytes at offset can be read and aren't all zero
+func chunkHasData(file io.ReaderAt, offset, size int64) bool {
+	buf := make([]byte, min(size, 64*1024))
+	reader := io.NewSectionReader(file, offset, size)
+	for {
+		n, err := reader.Read(buf)
+		for _, b := range buf[:n] {
+			if b != 0 {
+				return true
+			}
+		}
+		if err != nil {
+			return false
+		}
+	}
+}
+
+// verifyFileIntegrity calculates the hash of a file with the negotiated algorithm and compares it with expected hash
+func verifyFileIntegrity(filename string, hashAlgorithm string, expectedHash string) bool {
 	file, err := os.Open(filename)
 	if err != nil {
 		return false
 	}
 	defer file.Close()
 
-	hash := sha256.New()
+	hash := newHash(hashAlgorithm)
 	if _, err := io.Copy(hash, file); err != nil {
 		return false
 	}
@@ -591,21 +2211,41 @@ func verifyFileIntegrity(filename string, expectedHash string) bool {
 	return actualHash == expectedHash
 }
 
+// confirmTransfer accepts the request outright when the receiver auto-accepts, and otherwise asks
+// the configured AcceptPolicy, or the user when there's none
+func (s *receiveSession) confirmTransfer(request *TransferRequest) (bool, string) {
+	if s.config.AutoAccept {
+		logf("Auto-accepting '%s'\n", request.TargetPath())
+		return true, ""
+	}
+	policy := s.config.AcceptPolicy
+	if policy == nil {
+		policy = PromptPolicy()
+	}
+	accept, reason := policy.Decide(request, s.peerInfo())
+	if !accept && reason == "" {
+		reason = "Rejected by the receiver's policy"
+	}
+	return accept, reason
+}
+
 // promptForTransferConfirmation asks the user to accept or reject a file transfer
-func promptForTransferConfirmation(request *TransferRequest) (bool, string) {
+func promptForTransferConfirmation(request *TransferRequest, peer PeerInfo) (bool, string) {
 	// Check if we're in test mode (environment variable)
-	if os.Getenv("LANDROP_TEST_MODE") == "1" {
-		fmt.Println("(Test mode: automatically accepting transfer)")
+	if envEnabled(TestModeEnvVar) {
+		logln("(Test mode: automatically accepting transfer)")
 		return true, ""
 	}
-	// Get sender's hostname (this is a simplified approach)
-	hostname := "Unknown"
-	if h, err := os.Hostname(); err == nil {
-		hostname = h
+	sender := peer.Address
+	if peer.Hostname != "" {
+		sender = fmt.Sprintf("%s (%s)", peer.Hostname, peer.Address)
+	}
+	if sender == "" {
+		sender = "Unknown"
 	}
 
 	fmt.Printf("\n--- Incoming Transfer Request ---\n")
-	fmt.Printf("From: %s\n", hostname)
+	fmt.Printf("From: %s\n", sender)
 	fmt.Printf("File: %s\n", request.Filename)
 	fmt.Printf("Size: %.2f MB\n", float64(request.FileSize)/(1024*1024))
 	fmt.Printf("Hash: %s\n", request.FileHash)
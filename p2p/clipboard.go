@@ -0,0 +1,43 @@
+package p2p
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// clipboardCommands lists the programs that can set the clipboard on this platform, in order of preference
+func clipboardCommands() [][]string {
+	switch runtime.GOOS {
+	case "darwin":
+		return [][]string{{"pbcopy"}}
+	case "windows":
+		return [][]string{{"clip"}}
+	default:
+		return [][]string{
+			{"wl-copy"},
+			{"xclip", "-selection", "clipboard"},
+			{"xsel", "--clipboard", "--input"},
+		}
+	}
+}
+
+// CopyToClipboard puts text on the system clipboard using the first clipboard program installed
+func CopyToClipboard(text string) error {
+	var tried []string
+	for _, command := range clipboardCommands() {
+		path, err := exec.LookPath(command[0])
+		if err != nil {
+			tried = append(tried, command[0])
+			continue
+		}
+		cmd := exec.Command(path, command[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to copy to the clipboard with %s: %v %s", command[0], err, strings.TrimSpace(string(output)))
+		}
+		return nil
+	}
+	return fmt.Errorf("no clipboard program found (tried %s)", strings.Join(tried, ", "))
+}
@@ -0,0 +1,121 @@
+package p2p
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression modes negotiated in TransferRequest
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// compressedExtensions lists formats that are already compressed and gain nothing from another pass
+var compressedExtensions = map[string]bool{
+	".zip": true, ".gz": true, ".tgz": true, ".bz2": true, ".xz": true, ".zst": true,
+	".7z": true, ".rar": true, ".jpg": true, ".jpeg": true, ".png": true, ".gif": true,
+	".webp": true, ".heic": true, ".mp3": true, ".aac": true, ".ogg": true, ".flac": true,
+	".mp4": true, ".mkv": true, ".mov": true, ".avi": true, ".webm": true,
+}
+
+var (
+	zstdEncoderOnce sync.Once
+	zstdEncoder     *zstd.Encoder
+	zstdDecoderOnce sync.Once
+	zstdDecoder     *zstd.Decoder
+)
+
+// ValidateCompression checks that mode is a supported compression mode
+func ValidateCompression(mode string) error {
+	switch mode {
+	case "", CompressionNone, CompressionGzip, CompressionZstd:
+		return nil
+	}
+	return fmt.Errorf("unsupported compression '%s' (use none, gzip or zstd)", mode)
+}
+
+// isCompressionEnabled reports whether mode actually compresses chunks
+func isCompressionEnabled(mode string) bool {
+	return mode == CompressionGzip || mode == CompressionZstd
+}
+
+// compressionForFile returns the mode to request for a file, skipping already-compressed formats
+func compressionForFile(mode string, filename string) string {
+	if !isCompressionEnabled(mode) || compressedExtensions[strings.ToLower(filepath.Ext(filename))] {
+		return CompressionNone
+	}
+	return mode
+}
+
+// chunkHeaderLength returns the size of the binary chunk header for a negotiated compression mode.
+// Compressed transfers append the on-the-wire length to the standard header.
+func chunkHeaderLength(mode string) int {
+	if isCompressionEnabled(mode) {
+		return CompressedChunkHeaderSize
+	}
+	return ChunkHeaderSize
+}
+
+// compressChunk compresses a chunk with the given mode
+func compressChunk(mode string, data []byte) ([]byte, error) {
+	switch mode {
+	case CompressionGzip:
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		if _, err := writer.Write(data); err != nil {
+			return nil, fmt.Errorf("failed to gzip chunk: %w", err)
+		}
+		if err := writer.Close(); err != nil {
+			return nil, fmt.Errorf("failed to gzip chunk: %w", err)
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		zstdEncoderOnce.Do(func() {
+			zstdEncoder, _ = zstd.NewWriter(nil)
+		})
+		return zstdEncoder.EncodeAll(data, nil), nil
+	}
+	return data, nil
+}
+
+// decompressChunk reverses compressChunk. size is the announced uncompressed size, which bounds
+// the output so a malicious peer can't exhaust memory with a compression bomb.
+func decompressChunk(mode string, data []byte, size int) ([]byte, error) {
+	var decompressed []byte
+	switch mode {
+	case CompressionGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid gzip data: %v", ErrChunkCorrupted, err)
+		}
+		decompressed, err = io.ReadAll(io.LimitReader(reader, int64(size)+1))
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to gunzip chunk: %v", ErrChunkCorrupted, err)
+		}
+	case CompressionZstd:
+		zstdDecoderOnce.Do(func() {
+			zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(uint64(MaxChunkSize)))
+		})
+		var err error
+		decompressed, err = zstdDecoder.DecodeAll(data, make([]byte, 0, size))
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid zstd data: %v", ErrChunkCorrupted, err)
+		}
+	default:
+		return data, nil
+	}
+
+	if len(decompressed) != size {
+		return nil, fmt.Errorf("%w: decompressed to %d bytes, expected %d", ErrChunkCorrupted, len(decompressed), size)
+	}
+	return decompressed, nil
+}
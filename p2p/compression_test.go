@@ -0,0 +1,49 @@
+package p2p
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCompressChunkRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("LanDrop compressible log line\n"), 1000)
+
+	for _, mode := range []string{CompressionGzip, CompressionZstd} {
+		compressed, err := compressChunk(mode, data)
+		if err != nil {
+			t.Fatalf("%s: failed to compress chunk: %v", mode, err)
+		}
+		if len(compressed) >= len(data) {
+			t.Errorf("%s: expected repetitive data to shrink, got %d bytes from %d", mode, len(compressed), len(data))
+		}
+
+		decompressed, err := decompressChunk(mode, compressed, len(data))
+		if err != nil {
+			t.Fatalf("%s: failed to decompress chunk: %v", mode, err)
+		}
+		if !bytes.Equal(decompressed, data) {
+			t.Errorf("%s: round trip changed the data", mode)
+		}
+
+		// A peer lying about the uncompressed size is caught
+		if _, err := decompressChunk(mode, compressed, len(data)/2); !errors.Is(err, ErrChunkCorrupted) {
+			t.Errorf("%s: expected ErrChunkCorrupted for wrong size, got %v", mode, err)
+		}
+	}
+}
+
+func TestCompressionForFile(t *testing.T) {
+	if mode := compressionForFile(CompressionZstd, "server.log"); mode != CompressionZstd {
+		t.Errorf("Expected zstd for a log file, got %s", mode)
+	}
+	if mode := compressionForFile(CompressionZstd, "holiday.JPG"); mode != CompressionNone {
+		t.Errorf("Expected already-compressed image to skip compression, got %s", mode)
+	}
+	if mode := compressionForFile(CompressionNone, "server.log"); mode != CompressionNone {
+		t.Errorf("Expected none when compression is disabled, got %s", mode)
+	}
+	if err := ValidateCompression("brotli"); err == nil {
+		t.Error("Expected unsupported compression to be rejected")
+	}
+}
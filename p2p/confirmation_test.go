@@ -13,3 +13,14 @@ func TestPromptForTransferConfirmation(t *testing.T) {
 	// For now, we'll just verify the function signature works
 	_ = req
 }
+
+func TestAutoAcceptSkipsPrompt(t *testing.T) {
+	// Without LANDROP_TEST_MODE the prompt would block reading stdin
+	t.Setenv("LANDROP_TEST_MODE", "")
+
+	session := &receiveSession{config: ReceiverConfig{AutoAccept: true}}
+	accepted, rejectionMsg := session.confirmTransfer(NewTransferRequest("test.txt", 1024, "abc123", 512))
+	if !accepted || rejectionMsg != "" {
+		t.Errorf("Expected auto-accept, got accepted=%v rejection=%q", accepted, rejectionMsg)
+	}
+}
@@ -0,0 +1,39 @@
+package p2p
+
+import (
+	"fmt"
+	"os"
+)
+
+// What a receiver does with a file whose name already exists in the output directory
+const (
+	// ConflictRename writes to the first free numbered name, such as "received_foo (1).txt"
+	ConflictRename = "rename"
+	// ConflictSkip rejects the transfer before prompting
+	ConflictSkip = "skip"
+	// ConflictOverwrite replaces the existing file once the new one has been verified
+	ConflictOverwrite = "overwrite"
+)
+
+// ValidateConflictPolicy checks a --on-conflict value; empty means ConflictRename
+func ValidateConflictPolicy(policy string) error {
+	switch policy {
+	case "", ConflictRename, ConflictSkip, ConflictOverwrite:
+		return nil
+	}
+	return fmt.Errorf("unsupported conflict policy '%s' (use skip, overwrite or rename)", policy)
+}
+
+// outputExists reports whether path already holds a file or directory, as opposed to only a
+// partial download that a transfer can resume into
+func outputExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// canOverwriteOutput reports whether path may be replaced under ConflictOverwrite. Directories are
+// never replaced by files.
+func canOverwriteOutput(path string) bool {
+	info, err := os.Stat(path)
+	return err != nil || !info.IsDir()
+}
@@ -0,0 +1,81 @@
+package p2p
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReceiverConflictPolicies(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	testFile := filepath.Join(t.TempDir(), "report.txt")
+	if err := os.WriteFile(testFile, []byte("the new report"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	tests := []struct {
+		policy   string
+		existing string // expected content of received_report.txt afterwards
+		renamed  bool   // whether received_report (1).txt holds the new file
+	}{
+		{ConflictSkip, "the old report", false},
+		{ConflictOverwrite, "the new report", false},
+		{ConflictRename, "the old report", true},
+	}
+	for _, test := range tests {
+		t.Run(test.policy, func(t *testing.T) {
+			receiverConfig := DefaultReceiverConfig()
+			receiverConfig.OutputDir = t.TempDir()
+			receiverConfig.OnConflict = test.policy
+			existingPath := filepath.Join(receiverConfig.OutputDir, "received_report.txt")
+			if err := os.WriteFile(existingPath, []byte("the old report"), 0644); err != nil {
+				t.Fatalf("Failed to create existing file: %v", err)
+			}
+
+			listener, err := net.Listen("tcp", ":0")
+			if err != nil {
+				t.Fatalf("Failed to find available port: %v", err)
+			}
+			port := listener.Addr().(*net.TCPAddr).Port
+			listener.Close()
+
+			receiverDone := make(chan error, 1)
+			go func() {
+				receiverDone <- ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), receiverConfig)
+			}()
+
+			// Give receiver time to start
+			time.Sleep(100 * time.Millisecond)
+
+			if err := SendFileChunkedWithConfig(testFile, fmt.Sprintf("127.0.0.1:%d", port), DefaultSenderConfig()); err != nil {
+				t.Fatalf("Sender failed: %v", err)
+			}
+			select {
+			case <-receiverDone:
+			case <-time.After(10 * time.Second):
+				t.Fatal("Test timed out")
+			}
+
+			if content, _ := os.ReadFile(existingPath); string(content) != test.existing {
+				t.Errorf("Expected received_report.txt to hold %q, got %q", test.existing, content)
+			}
+			renamed, err := os.ReadFile(filepath.Join(receiverConfig.OutputDir, "received_report (1).txt"))
+			if test.renamed && string(renamed) != "the new report" {
+				t.Errorf("Expected the new file under a numbered name, got %q (%v)", renamed, err)
+			}
+			if !test.renamed && err == nil {
+				t.Error("Expected no numbered copy")
+			}
+		})
+	}
+
+	if err := ValidateConflictPolicy("merge"); err == nil {
+		t.Error("Expected an unknown policy to be rejected")
+	}
+}
@@ -0,0 +1,74 @@
+package p2p
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/quic-go/quic-go"
+)
+
+// receiverBusyCode closes a connection a daemon turned away because it was serving as many as it may
+const receiverBusyCode quic.ApplicationErrorCode = 0x10
+
+// activeConnections counts the connections every daemon in this process is serving
+var activeConnections atomic.Int64
+
+// ActiveConnections returns how many sender connections the daemons in this process are serving
+func ActiveConnections() int {
+	return int(activeConnections.Load())
+}
+
+// connectionLimit caps the connections a daemon serves at once
+type connectionLimit struct {
+	max    int
+	active atomic.Int64
+}
+
+// newConnectionLimit returns a limit of max connections, or DefaultMaxConnections if max isn't positive
+func newConnectionLimit(max int) *connectionLimit {
+	if max <= 0 {
+		max = DefaultMaxConnections
+	}
+	return &connectionLimit{max: max}
+}
+
+// acquire takes a slot for a new connection, reporting false if every slot is taken
+func (l *connectionLimit) acquire() bool {
+	for {
+		active := l.active.Load()
+		if active >= int64(l.max) {
+			return false
+		}
+		if l.active.CompareAndSwap(active, active+1) {
+			activeConnections.Add(1)
+			return true
+		}
+	}
+}
+
+// release gives back a slot taken by acquire
+func (l *connectionLimit) release() {
+	l.active.Add(-1)
+	activeConnections.Add(-1)
+}
+
+// count returns how many slots are taken
+func (l *connectionLimit) count() int {
+	return int(l.active.Load())
+}
+
+// turnAway closes conn because every slot is taken, telling the sender why
+func (l *connectionLimit) turnAway(conn quic.Connection) {
+	conn.CloseWithError(receiverBusyCode, fmt.Sprintf("receiver busy: %d transfers already in progress, try again later", l.max))
+}
+
+// receiverBusyError returns ErrReceiverBusy with the receiver's message if err is a daemon turning
+// the connection away, or nil otherwise
+func receiverBusyError(err error) error {
+	var appErr *quic.ApplicationError
+	if errors.As(err, &appErr) && appErr.Remote && appErr.ErrorCode == receiverBusyCode {
+		return fmt.Errorf("%w: %s", ErrReceiverBusy, appErr.ErrorMessage)
+	}
+	return nil
+}
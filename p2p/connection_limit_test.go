@@ -0,0 +1,89 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+func TestDaemonTurnsAwayConnectionsOverTheLimit(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	receiverConfig := DefaultReceiverConfig()
+	receiverConfig.OutputDir = t.TempDir()
+	receiverConfig.Daemon = true
+	receiverConfig.MaxConnections = 1
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileChunkedContext(ctx, fmt.Sprintf("%d", port), receiverConfig)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	waitForActive := func(want int) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if ActiveConnections() == want {
+				return
+			}
+		}
+		t.Fatalf("Expected %d active connections, got %d", want, ActiveConnections())
+	}
+
+	// A connection that never sends a request holds the only slot
+	peerAddr := fmt.Sprintf("127.0.0.1:%d", port)
+	idle, err := quic.DialAddr(context.Background(), peerAddr, GetClientTLSConfig(), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial receiver: %v", err)
+	}
+	waitForActive(1)
+
+	testFile := filepath.Join(t.TempDir(), "queued.txt")
+	if err := os.WriteFile(testFile, []byte("sent once a slot is free"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	senderConfig := DefaultSenderConfig()
+	senderConfig.DialAttempts = 1
+	senderConfig.TCPFallback = false
+	if err := SendFileChunkedWithConfig(testFile, peerAddr, senderConfig); !errors.Is(err, ErrReceiverBusy) {
+		t.Fatalf("Expected ErrReceiverBusy while the slot is taken, got %v", err)
+	}
+
+	// Once the slot is free the next sender is served
+	idle.CloseWithError(0, "")
+	waitForActive(0)
+	if err := SendFileChunkedWithConfig(testFile, peerAddr, senderConfig); err != nil {
+		t.Fatalf("Expected the send to succeed once the slot was free, got %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(receiverConfig.OutputDir, "received_queued.txt")); err != nil || string(data) != "sent once a slot is free" {
+		t.Errorf("Expected the file to arrive, got %q (%v)", data, err)
+	}
+
+	cancel()
+	select {
+	case err := <-receiverDone:
+		if err != nil {
+			t.Fatalf("Daemon receiver returned error: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Daemon receiver did not stop after cancellation")
+	}
+}
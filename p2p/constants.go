@@ -8,32 +8,83 @@ const (
 	DefaultPort = "8080"
 	// DiscoveryPort is the UDP port for peer discovery
 	DiscoveryPort = 8888
+	// DiscoveryMulticastIPv6 is the link-local all-nodes group discovery is sent to on IPv6 networks
+	DiscoveryMulticastIPv6 = "ff02::1"
 	// DiscoveryMsg is the broadcast message for peer discovery
 	DiscoveryMsg = "LANDROP_DISCOVERY"
+	// AnnouncePort is the UDP port receivers broadcast unsolicited announcements to
+	AnnouncePort = 8889
+	// AnnounceMsg prefixes an announcement, so it can't be mistaken for a request or a reply
+	AnnounceMsg = "LANDROP_ANNOUNCE"
+	// AnnounceInterval is how often a receiver announces itself
+	AnnounceInterval = 30 * time.Second
+	// MinAnnounceInterval is the least time between two announcements for the same port
+	MinAnnounceInterval = 5 * time.Second
+	// DiscoveryReplyCooldown is the least time between two discovery replies to the same requester
+	DiscoveryReplyCooldown = 500 * time.Millisecond
 	// ReplyTimeout is the timeout for discovery responses
 	ReplyTimeout = 2 * time.Second
+	// DefaultDialAttempts is how many times a sender dials a receiver before giving up
+	DefaultDialAttempts = 4
+	// DefaultDialTimeout bounds each dial attempt, including the QUIC handshake
+	DefaultDialTimeout = 5 * time.Second
+	// DialInitialBackoff is the pause after the first failed dial; it doubles after each attempt
+	DialInitialBackoff = 250 * time.Millisecond
+	// DialMaxBackoff caps the pause between dial attempts
+	DialMaxBackoff = 4 * time.Second
+	// DefaultReconnects is how many times a sender reconnects to resume after losing the connection
+	DefaultReconnects = 3
+	// ReconnectWindow is how long a receiver that isn't a daemon waits for a sender to reconnect
+	ReconnectWindow = 2 * time.Minute
+	// PingTimeout bounds a whole PingPeer exchange, including the QUIC handshake
+	PingTimeout = 3 * time.Second
+	// NotifyTimeout bounds delivering one transfer event to the notify socket
+	NotifyTimeout = 2 * time.Second
+	// DefaultMaxConnections is how many sender connections a daemon serves at once
+	DefaultMaxConnections = 16
 )
 
 // Chunked transfer constants
 const (
 	// DefaultChunkSize is the default size for file chunks (32MB)
 	DefaultChunkSize = int64(32 * 1024 * 1024)
-	// MaxRetries is the maximum number of retry attempts for failed chunks
+	// MinChunkSize is the smallest chunk size a sender may choose (64KB)
+	MinChunkSize = int64(64 * 1024)
+	// MaxChunkSize is the largest chunk size a sender may choose (64MB)
+	MaxChunkSize = int64(64 * 1024 * 1024)
+	// MaxRetries is the default number of attempts for each chunk
 	MaxRetries = 3
+	// DefaultChunkRetryDelay is the default pause before a chunk is resent; it doubles after each attempt
+	DefaultChunkRetryDelay = 200 * time.Millisecond
+	// ChunkRetryMaxDelay caps the pause between attempts to send a chunk
+	ChunkRetryMaxDelay = 5 * time.Second
 	// MaxConcurrentChunks is the maximum number of concurrent chunk transfers
 	MaxConcurrentChunks = 3
-	// StreamTimeout is the timeout for individual stream operations
+	// StreamTimeout is the default timeout for individual stream operations
 	StreamTimeout = 30 * time.Second
+	// DefaultTransferTimeout is the default deadline for a whole sending or receiving run
+	DefaultTransferTimeout = 60 * time.Minute
 	// ConnectionKeepalive is the keepalive interval for QUIC connections
 	ConnectionKeepalive = 15 * time.Second
+	// ConnectionIdleTimeout closes a QUIC connection after this long without any packets from the peer
+	ConnectionIdleTimeout = 60 * time.Second
 	// ChunkBufferSize is the size of the buffer for chunk transfers
 	ChunkBufferSize = 32 * 1024 // 32KB
+	// ChunkHeaderSize is the binary chunk header: index (8 bytes), size (4) and SHA-256 (32)
+	ChunkHeaderSize = 44
+	// CompressedChunkHeaderSize adds the on-the-wire length (4 bytes) when compression is negotiated
+	CompressedChunkHeaderSize = ChunkHeaderSize + 4
+	// MaxChunkAckSize bounds a ChunkAck read from a chunk stream
+	MaxChunkAckSize = 4096
+	// DuplicateTransferGrace is how long a request for a file already being received waits for the
+	// earlier transfer to end before it's rejected
+	DuplicateTransferGrace = 3 * time.Second
 )
 
 // Protocol constants
 const (
 	// ProtocolVersion is the current version of the LanDrop protocol
-	ProtocolVersion = "1.0"
+	ProtocolVersion = "1.2"
 	// TLSServerName is the server name used for TLS connections
 	TLSServerName = "landrop"
 )
@@ -44,4 +95,6 @@ const (
 	CertificateValidityDays = 365
 	// CertificateOrganization is the organization name for certificates
 	CertificateOrganization = "LanDrop"
+	// CertificateRenewalWindow is how long before expiry the device certificate is re-issued
+	CertificateRenewalWindow = 30 * 24 * time.Hour
 )
@@ -0,0 +1,115 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// Path MTU checks. QUIC starts with 1280-byte packets and path MTU discovery raises them towards
+// maxPathPacketSize; staying at the start suggests a tunnel or VPN path that drops larger packets.
+const (
+	LowPathPacketSize = 1280
+	PathMTUProbeTime  = 2 * time.Second
+
+	// maxPathPacketSize is the largest packet quic-go's path MTU discovery tries
+	maxPathPacketSize = 1452
+	// pathMTUSettleTime without a change ends waiting for path MTU discovery early
+	pathMTUSettleTime = 500 * time.Millisecond
+	// datagramOverhead is what quic-go reserves in each packet around a datagram's payload
+	datagramOverhead = 1 + 20 + 16
+)
+
+// LinkDiagnosis is what DiagnoseLink found out about the path to a chunked receiver
+type LinkDiagnosis struct {
+	Device    DeviceInfo
+	Handshake time.Duration // Dialing and the TLS handshake
+	// RTT and Throughput (in bytes per second) stay zero when the receiver predates calibration
+	RTT        time.Duration
+	Throughput float64
+	// PacketSize is the largest QUIC packet path MTU discovery found, zero if it couldn't be read
+	PacketSize int64
+}
+
+// PathMTUWarning explains what to do when the path looked unable to carry packets larger than
+// QUIC's minimum, and is empty otherwise
+func (d LinkDiagnosis) PathMTUWarning() string {
+	if d.PacketSize == 0 || d.PacketSize > LowPathPacketSize {
+		return ""
+	}
+	return lowPathMTUWarning(d.PacketSize)
+}
+
+// DiagnoseLink connects to the chunked receiver at addr, measures the link with the calibration
+// probes --auto-chunk uses while path MTU discovery runs, and ends with a ping, so a waiting
+// receiver still serves the next sender. A failed dial or handshake is returned as the error.
+func DiagnoseLink(ctx context.Context, addr string) (LinkDiagnosis, error) {
+	var diagnosis LinkDiagnosis
+
+	config := DefaultSenderConfig()
+	config.DialAttempts = 1
+	start := time.Now()
+	session, err := openSendSession(ctx, addr, config)
+	if err != nil {
+		return diagnosis, err
+	}
+	defer session.Close()
+	diagnosis.Handshake = time.Since(start)
+
+	rtt, throughput, err := session.measureLink(ctx)
+	if err != nil {
+		// The receiver dropped the session, so check it's still answering on a new one
+		logf("Link measurement skipped: %v\n", err)
+		diagnosis.Device, err = PingPeerContext(ctx, addr)
+		return diagnosis, err
+	}
+	diagnosis.RTT, diagnosis.Throughput = rtt, throughput
+	diagnosis.PacketSize = waitForPathPacketSize(ctx, session.conn)
+
+	diagnosis.Device, err = exchangePing(session.conn, session.controlStream, session.framed, addr)
+	return diagnosis, err
+}
+
+// pathPacketSize returns the largest packet conn currently sends, as raised by path MTU
+// discovery, or zero when the peer doesn't accept datagrams and the size can't be read
+func pathPacketSize(conn quic.Connection) int64 {
+	// Nothing this large fits, so it's refused without being sent
+	err := conn.SendDatagram(make([]byte, 2*maxPathPacketSize))
+	var tooLarge *quic.DatagramTooLargeError
+	if !errors.As(err, &tooLarge) {
+		return 0
+	}
+	return tooLarge.MaxDatagramPayloadSize + datagramOverhead
+}
+
+// waitForPathPacketSize gives path MTU discovery on conn up to PathMTUProbeTime to settle and
+// returns the packet size it got to
+func waitForPathPacketSize(ctx context.Context, conn quic.Connection) int64 {
+	ctx, cancel := context.WithTimeout(ctx, PathMTUProbeTime)
+	defer cancel()
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	size := pathPacketSize(conn)
+	changed := time.Now()
+	for size != 0 && time.Since(changed) < pathMTUSettleTime {
+		select {
+		case <-ctx.Done():
+			return size
+		case <-ticker.C:
+		}
+		if current := pathPacketSize(conn); current != size {
+			size, changed = current, time.Now()
+		}
+	}
+	return size
+}
+
+// lowPathMTUWarning explains a packet size that path MTU discovery couldn't raise
+func lowPathMTUWarning(packetSize int64) string {
+	return fmt.Sprintf("QUIC packets to this peer stayed at %d bytes: the path may drop larger packets (a VPN, tunnel or PPPoE link), "+
+		"which can stall transfers. If a transfer hangs, try a smaller --chunk-size such as 1M", packetSize)
+}
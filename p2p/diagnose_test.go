@@ -0,0 +1,48 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDiagnoseLink(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	config := DefaultReceiverConfig()
+	config.OutputDir = t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ReceiveFileChunkedContext(ctx, fmt.Sprintf("%d", port), config)
+
+	// Give receiver time to start
+	time.Sleep(100 * time.Millisecond)
+
+	diagnosis, err := DiagnoseLink(context.Background(), fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatalf("Diagnosis failed: %v", err)
+	}
+	if diagnosis.Device.Fingerprint == "" || diagnosis.Throughput <= 0 {
+		t.Errorf("Expected the receiver's identity and a link measurement, got %+v", diagnosis)
+	}
+	// Loopback carries full-size packets
+	if diagnosis.PacketSize <= LowPathPacketSize || diagnosis.PathMTUWarning() != "" {
+		t.Errorf("Expected path MTU discovery to raise the packet size, got %d", diagnosis.PacketSize)
+	}
+}
+
+func TestPathMTUWarning(t *testing.T) {
+	if (LinkDiagnosis{}).PathMTUWarning() != "" {
+		t.Error("Expected no warning when the packet size wasn't measured")
+	}
+	if (LinkDiagnosis{PacketSize: LowPathPacketSize}).PathMTUWarning() == "" {
+		t.Error("Expected a warning when packets stayed at QUIC's minimum")
+	}
+}
@@ -1,171 +1,689 @@
 package p2p
 
 import (
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
+// Transfer modes a peer can advertise in its discovery reply
+const (
+	// CapabilityTCP means the peer accepts the legacy single-stream TCP protocol
+	CapabilityTCP = "tcp"
+	// CapabilityQUICChunked means the peer accepts the QUIC chunked protocol
+	CapabilityQUICChunked = "quic-chunked"
+)
+
 // Peer represents a discovered peer on the network.
+// Older peers only send Hostname and IP; the other fields are filled in where possible.
 type Peer struct {
-	Hostname string `json:"hostname"`
-	IP       string `json:"ip"`
+	Hostname        string   `json:"hostname"`
+	IP              string   `json:"ip"` // host:port, kept for older peers
+	Port            int      `json:"port,omitempty"`
+	Ports           []int    `json:"ports,omitempty"` // Every port the peer receives on, when it has more than one
+	ProtocolVersion string   `json:"protocol_version,omitempty"`
+	Capabilities    []string `json:"capabilities,omitempty"`
+	DeviceID        string   `json:"device_id,omitempty"`
+	Fingerprint     string   `json:"fingerprint,omitempty"`
+
+	// DisplayName is the hostname, with a suffix when several discovered peers share it
+	DisplayName string `json:"-"`
+}
+
+// Key returns the stable identifier peers are deduplicated by. Older peers don't send
+// a device ID, so their address is used instead.
+func (p Peer) Key() string {
+	if p.DeviceID != "" {
+		return p.DeviceID
+	}
+	return p.IP
+}
+
+// ShortFingerprint returns the first 8 hex digits of the peer's certificate fingerprint, enough to
+// send to it by, or "" if it didn't advertise one
+func (p Peer) ShortFingerprint() string {
+	if len(p.Fingerprint) >= 8 {
+		if _, err := hex.DecodeString(p.Fingerprint[:8]); err == nil {
+			return p.Fingerprint[:8]
+		}
+	}
+	return ""
+}
+
+// disambiguator returns a short suffix that tells apart peers sharing a hostname
+func (p Peer) disambiguator() string {
+	if fingerprint := p.ShortFingerprint(); fingerprint != "" {
+		return fingerprint
+	}
+	return p.IP
+}
+
+// assignDisplayNames sets each peer's DisplayName, suffixing hostnames that appear more than once
+func assignDisplayNames(peers map[string]Peer) {
+	hostnameCounts := make(map[string]int)
+	for _, peer := range peers {
+		hostnameCounts[peer.Hostname]++
+	}
+
+	for key, peer := range peers {
+		peer.DisplayName = peer.Hostname
+		if hostnameCounts[peer.Hostname] > 1 {
+			peer.DisplayName = fmt.Sprintf("%s-%s", peer.Hostname, peer.disambiguator())
+		}
+		peers[key] = peer
+	}
+}
+
+// MinFingerprintPrefix is the fewest hex digits of a certificate fingerprint a target may give
+const MinFingerprintPrefix = 4
+
+// FindPeer looks up a target given on the command line like ResolvePeer, reporting only whether
+// a single peer matched
+func FindPeer(peers map[string]Peer, target string) (Peer, bool) {
+	peer, err := ResolvePeer(peers, target)
+	return peer, err == nil
+}
+
+// ResolvePeer looks up a target given on the command line by display name, device ID or hostname,
+// or else by a prefix of the peer's certificate fingerprint, like a short git hash. A hostname or
+// prefix that matches several peers is an ErrAmbiguousPeer listing them.
+func ResolvePeer(peers map[string]Peer, target string) (Peer, error) {
+	if peer, exists := peers[target]; exists {
+		return peer, nil
+	}
+
+	var hostnameMatches []Peer
+	for _, peer := range peers {
+		if peer.DisplayName == target {
+			return peer, nil
+		}
+		if peer.Hostname == target {
+			hostnameMatches = append(hostnameMatches, peer)
+		}
+	}
+	switch {
+	case len(hostnameMatches) == 1:
+		return hostnameMatches[0], nil
+	case len(hostnameMatches) > 1:
+		return Peer{}, ambiguousPeerError(target, "hostname", hostnameMatches)
+	}
+
+	if !isFingerprintPrefix(target) {
+		return Peer{}, fmt.Errorf("%w: '%s'", ErrPeerNotFound, target)
+	}
+	prefix := strings.ToLower(target)
+	var fingerprintMatches []Peer
+	for _, peer := range peers {
+		if strings.HasPrefix(strings.ToLower(peer.Fingerprint), prefix) {
+			fingerprintMatches = append(fingerprintMatches, peer)
+		}
+	}
+	switch len(fingerprintMatches) {
+	case 0:
+		return Peer{}, fmt.Errorf("%w: no peer's name or fingerprint matches '%s'", ErrPeerNotFound, target)
+	case 1:
+		return fingerprintMatches[0], nil
+	default:
+		return Peer{}, ambiguousPeerError(target, "fingerprint prefix", fingerprintMatches)
+	}
 }
 
-// DiscoverPeers broadcasts a discovery message and collects responses.
-func DiscoverPeers() map[string]Peer {
-	fmt.Println("Discovering peers on the network...")
+// isFingerprintPrefix reports whether target could be the start of a hex fingerprint
+func isFingerprintPrefix(target string) bool {
+	if len(target) < MinFingerprintPrefix {
+		return false
+	}
+	for _, r := range target {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// ambiguousPeerError lists the peers a target matched, so a longer prefix or a display name can be picked
+func ambiguousPeerError(target, kind string, matches []Peer) error {
+	slices.SortFunc(matches, func(a, b Peer) int { return strings.Compare(a.DisplayName, b.DisplayName) })
+	descriptions := make([]string, 0, len(matches))
+	for _, peer := range matches {
+		description := fmt.Sprintf("%s at %s", peer.DisplayName, peer.IP)
+		if len(peer.Fingerprint) >= 12 {
+			description += ", fingerprint " + peer.Fingerprint[:12]
+		}
+		descriptions = append(descriptions, description)
+	}
+	return fmt.Errorf("%w: %s '%s' matches %d peers (%s); use a longer fingerprint prefix or a display name",
+		ErrAmbiguousPeer, kind, target, len(matches), strings.Join(descriptions, "; "))
+}
+
+// normalize fills in the port from IP for replies from older peers
+func (p *Peer) normalize() {
+	if p.Port == 0 {
+		if _, portStr, err := net.SplitHostPort(p.IP); err == nil {
+			p.Port, _ = strconv.Atoi(portStr)
+		}
+	}
+}
+
+// Supports reports whether the peer advertised the given capability
+func (p Peer) Supports(capability string) bool {
+	for _, c := range p.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// CapabilitiesString describes the peer's transfer modes for display
+func (p Peer) CapabilitiesString() string {
+	if len(p.Capabilities) == 0 {
+		return "unknown"
+	}
+	return strings.Join(p.Capabilities, ", ")
+}
+
+// DiscoverPeers broadcasts a discovery message and collects responses for ReplyTimeout.
+// It fails with ErrDiscoveryFailed when discovery couldn't run at all, as opposed to finding no peers.
+func DiscoverPeers() (map[string]Peer, error) {
+	return DiscoverPeersWithTimeout(ReplyTimeout)
+}
+
+// DiscoverPeersWithTimeout is DiscoverPeers with a custom listen window. A longer window finds
+// peers that are slow to answer on large or busy networks, at the cost of that much extra latency
+// for every command that discovers; replies are collected until the window closes.
+func DiscoverPeersWithTimeout(timeout time.Duration) (map[string]Peer, error) {
+	logln("Discovering peers on the network...")
 
 	// Listen for replies on a random UDP port
 	localAddr, err := net.ResolveUDPAddr("udp", ":0")
 	if err != nil {
-		fmt.Printf("Error resolving local UDP address: %s\n", err)
-		return nil
+		return nil, fmt.Errorf("%w: failed to resolve local UDP address: %v", ErrDiscoveryFailed, err)
 	}
 	conn, err := net.ListenUDP("udp", localAddr)
 	if err != nil {
-		fmt.Printf("Error listening for UDP replies: %s\n", err)
-		return nil
+		return nil, fmt.Errorf("%w: failed to listen for UDP replies: %v", ErrDiscoveryFailed, err)
 	}
 	defer conn.Close()
 
+	// With mDNS enabled peers can still be found when no broadcast gets out
+	if err := broadcastDiscovery(conn, discoveryBroadcastAddresses()); err != nil && !mdnsEnabled() {
+		return nil, err
+	}
+	peers := collectDiscoveryReplies(conn, timeout)
+
+	// Merge peers found via mDNS for networks that block broadcast traffic
+	if mdnsEnabled() {
+		mergePeers(peers, discoverPeersMDNS(timeout))
+	}
+
+	dropSelf(peers)
+	assignDisplayNames(peers)
+	return peers, nil
+}
+
+// includeSelf is set by SetIncludeSelf
+var includeSelf atomic.Bool
+
+// SetIncludeSelf makes discovery list this host's own receivers, which it leaves out by default
+// since sending to yourself is rarely wanted outside testing
+func SetIncludeSelf(include bool) {
+	includeSelf.Store(include)
+}
+
+// isSelf reports whether peer is this host: one of localIPs with this host's hostname
+func isSelf(peer Peer, localIPs []net.IP, hostname string) bool {
+	host, _, err := net.SplitHostPort(peer.IP)
+	if err != nil {
+		host = peer.IP
+	}
+	host, _, _ = strings.Cut(host, "%")
+	ip := net.ParseIP(host)
+	return ip != nil && strings.EqualFold(peer.Hostname, hostname) && slices.ContainsFunc(localIPs, ip.Equal)
+}
+
+// dropSelf removes this host from peers unless SetIncludeSelf is in effect
+func dropSelf(peers map[string]Peer) {
+	if includeSelf.Load() || len(peers) == 0 {
+		return
+	}
+	localIPs := getAllLocalIPs()
+	hostname, _ := os.Hostname()
+	for key, peer := range peers {
+		if isSelf(peer, localIPs, hostname) {
+			logf("Discovery: Leaving out this host at %s\n", peer.IP)
+			delete(peers, key)
+		}
+	}
+}
+
+// discoveryBroadcastAddresses lists the global broadcast address, each IPv4 subnet's broadcast
+// address and, on IPv6 interfaces, the link-local multicast group. With SetIncludeSelf in effect it
+// also asks over loopback, since this host's listener ignores its own broadcasts.
+func discoveryBroadcastAddresses() []string {
+	addresses := broadcastAddresses(DiscoveryPort)
+	if includeSelf.Load() {
+		addresses = append(addresses, fmt.Sprintf("127.0.0.1:%d", DiscoveryPort))
+	}
+	return addresses
+}
+
+// broadcastAddresses is discoveryBroadcastAddresses for any UDP port
+func broadcastAddresses(udpPort int) []string {
 	// Try multiple broadcast addresses for different network scenarios
 	broadcastAddresses := []string{
-		fmt.Sprintf("255.255.255.255:%d", DiscoveryPort), // Global broadcast
+		fmt.Sprintf("255.255.255.255:%d", udpPort), // Global broadcast
 	}
-	
-	// Add network-specific broadcast addresses (IPv4 only)
+
+	// Add network-specific broadcast addresses, plus IPv6 multicast since IPv6 has no broadcast
 	interfaces, err := net.Interfaces()
 	if err == nil {
 		for _, iface := range interfaces {
 			if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
 				continue
 			}
-			
+
 			addrs, err := iface.Addrs()
 			if err != nil {
 				continue
 			}
-			
+
+			hasIPv6 := false
 			for _, addr := range addrs {
+				if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() == nil {
+					hasIPv6 = true
+				}
 				if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
 					// Calculate broadcast address for this IPv4 subnet
 					broadcast := make(net.IP, len(ipNet.IP))
 					copy(broadcast, ipNet.IP)
-					
+
 					for i := 0; i < len(ipNet.Mask); i++ {
 						broadcast[i] |= ^ipNet.Mask[i]
 					}
-					
+
 					// Only add if it's a valid IPv4 broadcast address
 					if broadcast.To4() != nil {
-						broadcastAddr := fmt.Sprintf("%s:%d", broadcast.To4().String(), DiscoveryPort)
+						broadcastAddr := fmt.Sprintf("%s:%d", broadcast.To4().String(), udpPort)
 						broadcastAddresses = append(broadcastAddresses, broadcastAddr)
 					}
 				}
 			}
+
+			// The multicast group is link-local, so it needs the interface as its zone
+			if hasIPv6 && iface.Flags&net.FlagMulticast != 0 {
+				multicastAddr := net.JoinHostPort(DiscoveryMulticastIPv6+"%"+iface.Name, strconv.Itoa(udpPort))
+				broadcastAddresses = append(broadcastAddresses, multicastAddr)
+			}
 		}
 	}
-	
-	fmt.Printf("Trying %d broadcast addresses for discovery...\n", len(broadcastAddresses))
 
+	return broadcastAddresses
+}
+
+// broadcastDiscovery sends the discovery message from conn to every address. It fails with
+// ErrDiscoveryFailed and the last error if the message couldn't be sent anywhere.
+func broadcastDiscovery(conn *net.UDPConn, broadcastAddresses []string) error {
+	logf("Trying %d broadcast addresses for discovery...\n", len(broadcastAddresses))
+
+	var lastErr error
+	sent := 0
 	// Send broadcast messages to all addresses
 	for i, broadcastAddrStr := range broadcastAddresses {
 		broadcastAddr, err := net.ResolveUDPAddr("udp", broadcastAddrStr)
 		if err != nil {
-			fmt.Printf("Error resolving broadcast address %s: %s\n", broadcastAddrStr, err)
+			logf("Error resolving broadcast address %s: %s\n", broadcastAddrStr, err)
+			lastErr = err
 			continue
 		}
-		
+
 		_, err = conn.WriteToUDP([]byte(DiscoveryMsg), broadcastAddr)
 		if err != nil {
-			fmt.Printf("Error sending discovery broadcast to %s: %s\n", broadcastAddrStr, err)
+			logf("Error sending discovery broadcast to %s: %s\n", broadcastAddrStr, err)
+			lastErr = err
 		} else {
-			fmt.Printf("Sent discovery broadcast to %s\n", broadcastAddrStr)
+			logf("Sent discovery broadcast to %s\n", broadcastAddrStr)
+			sent++
 		}
-		
+
 		// Small delay between broadcasts to avoid network congestion
 		if i < len(broadcastAddresses)-1 {
 			time.Sleep(10 * time.Millisecond)
 		}
 	}
 
+	if sent == 0 {
+		return fmt.Errorf("%w: no discovery broadcast could be sent: %v", ErrDiscoveryFailed, lastErr)
+	}
+	return nil
+}
+
+// collectDiscoveryReplies reads replies on conn until timeout passes, keyed by Peer.Key
+func collectDiscoveryReplies(conn *net.UDPConn, timeout time.Duration) map[string]Peer {
 	peers := make(map[string]Peer)
 	buffer := DiscoveryBufferPool.Get()
 	defer DiscoveryBufferPool.Put(buffer)
 
 	// Set a deadline to stop listening for replies
-	conn.SetReadDeadline(time.Now().Add(ReplyTimeout))
+	deadline := time.Now().Add(timeout)
+	conn.SetReadDeadline(deadline)
 
 	for {
-		n, _, err := conn.ReadFromUDP(buffer)
+		n, from, err := conn.ReadFromUDP(buffer)
 		if err != nil {
 			// If it's a timeout error, that's expected. We're done listening.
 			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
 				break
 			}
-			fmt.Printf("Error reading UDP reply: %s\n", err)
-			break
+			if errors.Is(err, net.ErrClosed) {
+				break
+			}
+			// Errors such as ICMP unreachable replies to one broadcast don't stop other peers answering
+			logf("Error reading UDP reply: %s\n", err)
+			if time.Now().After(deadline) {
+				break
+			}
+			continue
 		}
 
-		var peer Peer
-		if err := json.Unmarshal(buffer[:n], &peer); err == nil {
-			// Use hostname as the key to avoid duplicates
-			fmt.Printf("Discovery: Found peer %s at %s\n", peer.Hostname, peer.IP)
-			peers[peer.Hostname] = peer
+		if peer, err := parseDiscoveryReply(buffer[:n]); err == nil {
+			peer.IP = replyAddress(peer, from)
+			// Key by device ID so peers sharing a hostname don't collide
+			logf("Discovery: Found peer %s at %s\n", peer.Hostname, peer.IP)
+			peers[peer.Key()] = peer
 		} else {
-			fmt.Printf("Discovery: Failed to parse peer response: %v\n", err)
+			logf("Discovery: Failed to parse peer response: %v\n", err)
 		}
 	}
-
 	return peers
 }
 
-// ListenForDiscovery runs in the background to reply to discovery broadcasts.
-func ListenForDiscovery(tcpPort string) {
-	fmt.Printf("Discovery: ListenForDiscovery called with port: '%s'\n", tcpPort)
-	
-	addr, err := net.ResolveUDPAddr("udp", fmt.Sprintf(":%d", DiscoveryPort))
+// parseDiscoveryReply decodes a discovery reply from either current or older peers
+func parseDiscoveryReply(data []byte) (Peer, error) {
+	var peer Peer
+	if err := json.Unmarshal(data, &peer); err != nil {
+		return Peer{}, err
+	}
+	peer.normalize()
+	return peer, nil
+}
+
+// replyAddress returns the address to reach a peer at. A link-local IPv6 address is only
+// usable with the zone of the interface it was seen on, which the peer can't know, so the
+// reply's source address is used instead.
+func replyAddress(peer Peer, from *net.UDPAddr) string {
+	host, port, err := net.SplitHostPort(peer.IP)
+	if err != nil || from == nil || from.Zone == "" {
+		return peer.IP
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || ip.To4() != nil || !ip.IsLinkLocalUnicast() || !from.IP.IsLinkLocalUnicast() {
+		return peer.IP
+	}
+	return net.JoinHostPort(from.IP.String()+"%"+from.Zone, port)
+}
+
+// ListenForDiscovery replies to discovery broadcasts until the process exits.
+// capabilities lists the transfer modes served on tcpPort and is included in each reply.
+// It returns an error wrapping ErrDiscoveryFailed if the discovery port can't be bound.
+func ListenForDiscovery(tcpPort string, capabilities ...string) error {
+	logf("Discovery: ListenForDiscovery called with port: '%s'\n", tcpPort)
+
+	conn, err := listenDiscoveryPort()
 	if err != nil {
-		fmt.Printf("Error resolving discovery UDP address: %s\n", err)
-		return
+		return err
 	}
-	conn, err := net.ListenUDP("udp", addr)
+	serveDiscovery(conn, tcpPort, capabilities)
+	return nil
+}
+
+// discoveryEndpoint is a TCP port this process serves, with the transfer modes it accepts
+type discoveryEndpoint struct {
+	port         string
+	capabilities []string
+}
+
+// advertised holds the ports discovery replies and announcements list, in the order they were
+// started. Only one listener per machine can hold the discovery port, so it answers for all of them.
+var advertised = struct {
+	mutex     sync.Mutex
+	listening bool
+	endpoints []discoveryEndpoint
+}{}
+
+// StartDiscoveryListener binds the discovery port and replies to broadcasts in the background.
+// Binding happens before it returns, so a port conflict is reported to the caller. Once this
+// process is listening, further calls add tcpPort to the ports its replies advertise; the first
+// stays the one older peers connect to.
+func StartDiscoveryListener(tcpPort string, capabilities ...string) error {
+	advertised.mutex.Lock()
+	defer advertised.mutex.Unlock()
+	if !advertised.listening {
+		conn, err := listenDiscoveryPort()
+		if err != nil {
+			return err
+		}
+		advertised.listening = true
+		go serveDiscovery(conn, tcpPort, capabilities)
+	}
+	advertised.endpoints = append(advertised.endpoints, discoveryEndpoint{port: tcpPort, capabilities: capabilities})
+	return nil
+}
+
+// stopAdvertising removes tcpPort from discovery replies once nothing receives on it any more
+func stopAdvertising(tcpPort string) {
+	advertised.mutex.Lock()
+	defer advertised.mutex.Unlock()
+	for i, endpoint := range advertised.endpoints {
+		if endpoint.port == tcpPort {
+			advertised.endpoints = append(advertised.endpoints[:i], advertised.endpoints[i+1:]...)
+			return
+		}
+	}
+}
+
+// advertisedReply describes this device as served on localIP, listing every advertised port. It
+// reports false when no port is being served.
+func advertisedReply(localIP string) (Peer, bool) {
+	advertised.mutex.Lock()
+	defer advertised.mutex.Unlock()
+	if len(advertised.endpoints) == 0 {
+		return Peer{}, false
+	}
+
+	primary := advertised.endpoints[0]
+	reply := discoveryReply(localIP, primary.port, primary.capabilities)
+	if len(advertised.endpoints) > 1 {
+		for _, endpoint := range advertised.endpoints {
+			if port, err := strconv.Atoi(endpoint.port); err == nil {
+				reply.Ports = append(reply.Ports, port)
+			}
+		}
+	}
+	return reply, true
+}
+
+// CheckDiscoveryPort reports whether this process could bind the discovery port. An error usually
+// means another LanDrop command on this machine is already answering discovery requests.
+func CheckDiscoveryPort() error {
+	conn, err := listenDiscoveryPort()
 	if err != nil {
-		// Silently ignore port conflicts - discovery is optional
-		fmt.Printf("Discovery: UDP port %d already in use (another discovery listener may be running)\n", DiscoveryPort)
-		return
+		return err
+	}
+	return conn.Close()
+}
+
+// listenDiscoveryPort binds DiscoveryPort on all interfaces
+func listenDiscoveryPort() (*net.UDPConn, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: DiscoveryPort})
+	if err != nil {
+		if errors.Is(err, syscall.EADDRINUSE) {
+			return nil, fmt.Errorf("%w: UDP port %d is already in use (another LanDrop command may be running)", ErrDiscoveryFailed, DiscoveryPort)
+		}
+		return nil, fmt.Errorf("%w: failed to listen on UDP port %d: %v", ErrDiscoveryFailed, DiscoveryPort, err)
 	}
+	return conn, nil
+}
+
+// serveDiscovery answers discovery broadcasts received on conn. mDNS only advertises tcpPort, the
+// first port served.
+func serveDiscovery(conn *net.UDPConn, tcpPort string, capabilities []string) {
 	defer conn.Close()
 
-	hostname, _ := os.Hostname()
+	if mdnsEnabled() {
+		server, err := AdvertiseMDNS(tcpPort, capabilities...)
+		if err != nil {
+			logf("Discovery: %s\n", err)
+		} else {
+			defer server.Shutdown()
+		}
+	}
+
 	buffer := DiscoveryBufferPool.Get()
 	defer DiscoveryBufferPool.Put(buffer)
 
-	fmt.Printf("Discovery: Started listener for TCP port %s\n", tcpPort)
+	logf("Discovery: Started listener for TCP port %s\n", tcpPort)
+	go announcePresence(conn)
 
+	ownAddresses := getAllLocalIPs()
+	limiter := newReplyLimiter()
 	for {
 		n, remoteAddr, err := conn.ReadFromUDP(buffer)
 		if err != nil {
 			continue
 		}
 
-		if string(buffer[:n]) == DiscoveryMsg {
-			// Got a discovery message, prepare and send a reply
-			localIP := getLocalIP()
-			fmt.Printf("Discovery: Replying with IP %s:%s from interface\n", localIP, tcpPort)
-			reply := Peer{
-				Hostname: hostname,
-				IP:       localIP + ":" + tcpPort,
+		if string(buffer[:n]) == DiscoveryMsg && acceptsDiscoveryFrom(remoteAddr.IP) {
+			if fromThisHost(remoteAddr.IP, ownAddresses) || !limiter.allow(remoteAddr.IP.String(), time.Now()) {
+				continue
+			}
+			// Got a discovery message, prepare and send a reply in the requester's address family
+			localIP := getLocalIPFor(remoteAddr.IP)
+			if ip := BindAddress(); ip != nil {
+				localIP = ip.String()
 			}
+			reply, ok := advertisedReply(localIP)
+			if !ok {
+				continue
+			}
+			logf("Discovery: Replying with IP %s from interface\n", reply.IP)
 			replyBytes, _ := json.Marshal(reply)
 			conn.WriteToUDP(replyBytes, remoteAddr)
 		}
 	}
 }
 
+// fromThisHost reports whether a discovery request from remote was sent by this host, as its own
+// broadcasts are when they come back on a LAN address. Loopback requests are still answered, since
+// they can only be sent to this host on purpose.
+func fromThisHost(remote net.IP, ownAddresses []net.IP) bool {
+	return !remote.IsLoopback() && slices.ContainsFunc(ownAddresses, remote.Equal)
+}
+
+// replyLimiter remembers when each requester was last answered, so one that repeats or loops its
+// requests, or whose broadcast arrives on several addresses, gets one reply per DiscoveryReplyCooldown
+type replyLimiter struct {
+	last map[string]time.Time
+}
+
+// maxTrackedRequesters is how many requesters a replyLimiter holds before forgetting the expired ones
+const maxTrackedRequesters = 256
+
+// newReplyLimiter creates a replyLimiter that hasn't answered anyone yet
+func newReplyLimiter() *replyLimiter {
+	return &replyLimiter{last: make(map[string]time.Time)}
+}
+
+// allow reports whether a reply to requester may go out at now, and if so records it
+func (l *replyLimiter) allow(requester string, now time.Time) bool {
+	if last, ok := l.last[requester]; ok && now.Sub(last) < DiscoveryReplyCooldown {
+		return false
+	}
+	if len(l.last) >= maxTrackedRequesters {
+		for key, last := range l.last {
+			if now.Sub(last) >= DiscoveryReplyCooldown {
+				delete(l.last, key)
+			}
+		}
+	}
+	l.last[requester] = now
+	return true
+}
+
+// discoveryReply describes this device as served on localIP and tcpPort, as sent in discovery
+// replies and announcements
+func discoveryReply(localIP, tcpPort string, capabilities []string) Peer {
+	hostname, _ := os.Hostname()
+	port, _ := strconv.Atoi(tcpPort)
+	reply := Peer{
+		Hostname:        hostname,
+		IP:              net.JoinHostPort(localIP, tcpPort),
+		Port:            port,
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    capabilities,
+	}
+	if deviceInfo := GetDeviceInfo(); deviceInfo != nil {
+		reply.DeviceID = deviceInfo.DeviceID
+		reply.Fingerprint = deviceInfo.Fingerprint
+	}
+	return reply
+}
+
+// getLocalIPFor returns a local address in the same family as remote, so IPv6-only peers get an IPv6 reply
+func getLocalIPFor(remote net.IP) string {
+	if remote != nil && remote.To4() == nil {
+		if ip := getLocalIPv6(); ip != "" {
+			return ip
+		}
+	}
+	return getLocalIP()
+}
+
+// getLocalIPv6 returns this machine's first global IPv6 address, falling back to a link-local one
+func getLocalIPv6() string {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+
+	linkLocal := ""
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.To4() != nil || ipNet.IP.IsLoopback() {
+				continue
+			}
+			if ipNet.IP.IsGlobalUnicast() {
+				return ipNet.IP.String()
+			}
+			if ipNet.IP.IsLinkLocalUnicast() && linkLocal == "" {
+				linkLocal = ipNet.IP.String()
+			}
+		}
+	}
+	return linkLocal
+}
+
 // getLocalIP finds the preferred outbound IP address of this machine.
 func getLocalIP() string {
 	// Try multiple methods to get a suitable local IP
@@ -198,7 +716,7 @@ func getLocalIP() string {
 					continue
 				}
 				
-				fmt.Printf("Found local IP: %s (interface: %s)\n", ip.String(), iface.Name)
+				logf("Found local IP: %s (interface: %s)\n", ip.String(), iface.Name)
 				return ip.String()
 			}
 		}
@@ -210,7 +728,7 @@ func getLocalIP() string {
 		defer conn.Close()
 		localAddr := conn.LocalAddr().(*net.UDPAddr)
 		if !localAddr.IP.IsLoopback() && localAddr.IP.To4() != nil {
-			fmt.Printf("Found local IP via Google DNS: %s\n", localAddr.IP.String())
+			logf("Found local IP via Google DNS: %s\n", localAddr.IP.String())
 			return localAddr.IP.String()
 		}
 	}
@@ -221,17 +739,17 @@ func getLocalIP() string {
 		defer conn.Close()
 		localAddr := conn.LocalAddr().(*net.UDPAddr)
 		if !localAddr.IP.IsLoopback() && localAddr.IP.To4() != nil {
-			fmt.Printf("Found local IP via router: %s\n", localAddr.IP.String())
+			logf("Found local IP via router: %s\n", localAddr.IP.String())
 			return localAddr.IP.String()
 		}
 	}
 	
 	// Last resort: use localhost but warn the user
-	fmt.Println("Warning: Could not find a suitable non-loopback IP address.")
-	fmt.Println("Falling back to localhost (127.0.0.1) - this will only work for same-device transfers.")
-	fmt.Println("For cross-device transfers, please check:")
-	fmt.Println("  - Network connection is active")
-	fmt.Println("  - Firewall allows UDP port 8888 and TCP port 8080")
-	fmt.Println("  - Devices are on the same network subnet")
+	logln("Warning: Could not find a suitable non-loopback IP address.")
+	logln("Falling back to localhost (127.0.0.1) - this will only work for same-device transfers.")
+	logln("For cross-device transfers, please check:")
+	logln("  - Network connection is active")
+	logln("  - Firewall allows UDP port 8888 and TCP port 8080")
+	logln("  - Devices are on the same network subnet")
 	return "127.0.0.1"
 }
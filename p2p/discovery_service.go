@@ -0,0 +1,159 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// DiscoveryService keeps a live registry of the peers on the network for programs embedding
+// LanDrop. It broadcasts a discovery request every interval, records every reply that arrives on
+// its socket in between along with receivers' announcements, and forgets peers that haven't been
+// heard from for the TTL.
+type DiscoveryService struct {
+	interval time.Duration
+	tracker  *PeerTracker
+
+	mutex  sync.Mutex
+	conn   *net.UDPConn
+	cancel context.CancelFunc
+	done   sync.WaitGroup
+}
+
+// NewDiscoveryService creates a service that broadcasts every interval and expires peers not seen
+// for ttl. A ttl of a few intervals keeps a peer whose reply to one round was lost.
+func NewDiscoveryService(interval, ttl time.Duration) *DiscoveryService {
+	return &DiscoveryService{
+		interval: interval,
+		tracker:  NewPeerTracker(ttl),
+	}
+}
+
+// Start opens the service's socket and begins discovering in the background until ctx is done or
+// Stop is called. It fails with ErrDiscoveryFailed if the socket can't be opened.
+func (d *DiscoveryService) Start(ctx context.Context) error {
+	if d.interval <= 0 {
+		return fmt.Errorf("%w: discovery interval must be positive", ErrDiscoveryFailed)
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.conn != nil {
+		return fmt.Errorf("%w: discovery service is already running", ErrDiscoveryFailed)
+	}
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{})
+	if err != nil {
+		return fmt.Errorf("%w: failed to listen for UDP replies: %v", ErrDiscoveryFailed, err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	d.conn = conn
+	d.cancel = cancel
+
+	// Announcements only add to the broadcasts, so the service still works if another one holds the port
+	announce := func(peer Peer) {
+		d.record(map[string]Peer{peer.Key(): peer})
+	}
+	if err := StartAnnouncementListener(ctx, announce); err != nil {
+		logf("Discovery: %v\n", err)
+	}
+
+	d.done.Add(2)
+	go func() {
+		defer d.done.Done()
+		d.readReplies(conn)
+	}()
+	go func() {
+		defer d.done.Done()
+		d.broadcastRounds(ctx, conn)
+	}()
+	return nil
+}
+
+// Stop ends discovery and waits for the background work to finish. The peers found so far stay
+// available from Peers, and the service can be started again.
+func (d *DiscoveryService) Stop() {
+	d.mutex.Lock()
+	conn, cancel := d.conn, d.cancel
+	d.conn, d.cancel = nil, nil
+	d.mutex.Unlock()
+	if conn == nil {
+		return
+	}
+
+	cancel()
+	conn.Close()
+	d.done.Wait()
+}
+
+// Peers returns the peers seen within the TTL, keyed by Peer.Key, with display names assigned
+func (d *DiscoveryService) Peers() map[string]Peer {
+	d.mutex.Lock()
+	d.tracker.Update(nil, time.Now())
+	current := d.tracker.Peers()
+	d.mutex.Unlock()
+
+	peers := make(map[string]Peer, len(current))
+	for _, peer := range current {
+		peers[peer.Key()] = peer
+	}
+	assignDisplayNames(peers)
+	return peers
+}
+
+// record adds or refreshes peers in the registry
+func (d *DiscoveryService) record(peers map[string]Peer) {
+	dropSelf(peers)
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.tracker.Update(peers, time.Now())
+}
+
+// broadcastRounds sends a discovery request every interval until ctx is done
+func (d *DiscoveryService) broadcastRounds(ctx context.Context, conn *net.UDPConn) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		if err := broadcastDiscovery(conn, discoveryBroadcastAddresses()); err != nil {
+			// The network may come back; known peers age out meanwhile
+			logf("Discovery: %v\n", err)
+		}
+		if mdnsEnabled() {
+			d.record(discoverPeersMDNS(min(ReplyTimeout, d.interval)))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// readReplies records every peer that answers on conn until it's closed
+func (d *DiscoveryService) readReplies(conn *net.UDPConn) {
+	buffer := DiscoveryBufferPool.Get()
+	defer DiscoveryBufferPool.Put(buffer)
+
+	for {
+		n, from, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			// Errors such as ICMP unreachable replies to one broadcast don't stop other peers answering
+			continue
+		}
+
+		peer, err := parseDiscoveryReply(buffer[:n])
+		if err != nil {
+			logf("Discovery: Failed to parse peer response: %v\n", err)
+			continue
+		}
+		peer.IP = replyAddress(peer, from)
+		d.record(map[string]Peer{peer.Key(): peer})
+	}
+}
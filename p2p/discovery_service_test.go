@@ -0,0 +1,56 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDiscoveryServiceTracksReplies(t *testing.T) {
+	service := NewDiscoveryService(time.Hour, 300*time.Millisecond)
+	if err := service.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start discovery service: %v", err)
+	}
+	defer service.Stop()
+	if err := service.Start(context.Background()); !errors.Is(err, ErrDiscoveryFailed) {
+		t.Errorf("Expected starting twice to fail with ErrDiscoveryFailed, got %v", err)
+	}
+
+	// Answer the service as a peer would
+	peerConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Failed to open UDP socket: %v", err)
+	}
+	defer peerConn.Close()
+	serviceAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: service.conn.LocalAddr().(*net.UDPAddr).Port}
+	reply := []byte(`{"hostname":"nas","ip":"127.0.0.1:8080","device_id":"nas (aaaa1111)","fingerprint":"aaaa1111bbbb"}`)
+	if _, err := peerConn.WriteToUDP(reply, serviceAddr); err != nil {
+		t.Fatalf("Failed to send reply: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(service.Peers()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	peer, ok := service.Peers()["nas (aaaa1111)"]
+	if !ok {
+		t.Fatalf("Expected the reply to be recorded, got %v", service.Peers())
+	}
+	if peer.DisplayName != "nas" || peer.Port != 8080 {
+		t.Errorf("Expected a normalized peer with a display name, got %+v", peer)
+	}
+
+	// Without another reply the peer expires after the TTL
+	time.Sleep(400 * time.Millisecond)
+	if peers := service.Peers(); len(peers) != 0 {
+		t.Errorf("Expected the peer to expire, got %v", peers)
+	}
+
+	service.Stop()
+	service.Stop()
+	if err := service.Start(context.Background()); err != nil {
+		t.Errorf("Expected a stopped service to start again, got %v", err)
+	}
+}
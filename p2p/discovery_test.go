@@ -0,0 +1,276 @@
+package p2p
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDiscoveryReply(t *testing.T) {
+	// Replies from older peers only carry hostname and ip
+	peer, err := parseDiscoveryReply([]byte(`{"hostname":"old-laptop","ip":"192.168.1.20:8080"}`))
+	if err != nil {
+		t.Fatalf("Failed to parse legacy reply: %v", err)
+	}
+	if peer.Port != 8080 {
+		t.Errorf("Expected port 8080 derived from ip, got %d", peer.Port)
+	}
+	if peer.CapabilitiesString() != "unknown" {
+		t.Errorf("Expected unknown capabilities for legacy reply, got %s", peer.CapabilitiesString())
+	}
+
+	peer, err = parseDiscoveryReply([]byte(`{"hostname":"desktop","ip":"192.168.1.30:8080","port":8080,"protocol_version":"1.0","capabilities":["quic-chunked"]}`))
+	if err != nil {
+		t.Fatalf("Failed to parse reply: %v", err)
+	}
+	if peer.ProtocolVersion != "1.0" {
+		t.Errorf("Expected protocol version 1.0, got %s", peer.ProtocolVersion)
+	}
+	if !peer.Supports(CapabilityQUICChunked) || peer.Supports(CapabilityTCP) {
+		t.Errorf("Expected only quic-chunked capability, got %v", peer.Capabilities)
+	}
+
+	if _, err := parseDiscoveryReply([]byte("not json")); err == nil {
+		t.Error("Expected invalid reply to fail parsing")
+	}
+}
+
+func TestDuplicateHostnamesAreDisambiguated(t *testing.T) {
+	first := Peer{Hostname: "raspberrypi", IP: "192.168.1.20:8080", DeviceID: "raspberrypi (aaaa1111)", Fingerprint: "aaaa1111bbbb"}
+	second := Peer{Hostname: "raspberrypi", IP: "192.168.1.21:8080", DeviceID: "raspberrypi (cccc2222)", Fingerprint: "cccc2222dddd"}
+	laptop := Peer{Hostname: "laptop", IP: "192.168.1.30:8080"}
+
+	peers := map[string]Peer{}
+	for _, peer := range []Peer{first, second, laptop} {
+		peers[peer.Key()] = peer
+	}
+	assignDisplayNames(peers)
+
+	if len(peers) != 3 {
+		t.Fatalf("Expected peers sharing a hostname to be kept separately, got %d peers", len(peers))
+	}
+	if name := peers[first.Key()].DisplayName; name != "raspberrypi-aaaa1111" {
+		t.Errorf("Expected raspberrypi-aaaa1111, got %s", name)
+	}
+	if name := peers[laptop.Key()].DisplayName; name != "laptop" {
+		t.Errorf("Expected unique hostname to be shown as-is, got %s", name)
+	}
+
+	if peer, ok := FindPeer(peers, "raspberrypi-cccc2222"); !ok || peer.IP != second.IP {
+		t.Errorf("Expected display name lookup to find %s, got %v (found=%v)", second.IP, peer.IP, ok)
+	}
+	if _, ok := FindPeer(peers, "raspberrypi"); ok {
+		t.Error("Expected ambiguous hostname lookup to fail")
+	}
+	if _, ok := FindPeer(peers, "laptop"); !ok {
+		t.Error("Expected unique hostname lookup to succeed")
+	}
+}
+
+func TestResolvePeerByFingerprintPrefix(t *testing.T) {
+	first := Peer{Hostname: "raspberrypi", IP: "192.168.1.20:8080", DeviceID: "raspberrypi (ab12cd34)", Fingerprint: "ab12cd34ef56aa"}
+	second := Peer{Hostname: "raspberrypi", IP: "192.168.1.21:8080", DeviceID: "raspberrypi (ab12ff00)", Fingerprint: "ab12ff0011aabb"}
+	peers := map[string]Peer{}
+	for _, peer := range []Peer{first, second} {
+		peers[peer.Key()] = peer
+	}
+	assignDisplayNames(peers)
+
+	if peer, err := ResolvePeer(peers, "AB12C"); err != nil || peer.IP != first.IP {
+		t.Errorf("Expected the prefix to find %s, got %v (%v)", first.IP, peer.IP, err)
+	}
+
+	// An ambiguous prefix or hostname lists every match
+	for _, target := range []string{"ab12", "raspberrypi"} {
+		_, err := ResolvePeer(peers, target)
+		if !errors.Is(err, ErrAmbiguousPeer) {
+			t.Errorf("%s: expected ErrAmbiguousPeer, got %v", target, err)
+			continue
+		}
+		for _, peer := range []Peer{first, second} {
+			if !strings.Contains(err.Error(), peers[peer.Key()].DisplayName) {
+				t.Errorf("%s: expected the error to list %s, got %v", target, peers[peer.Key()].DisplayName, err)
+			}
+		}
+	}
+
+	// Prefixes too short to be useful, and ones nothing matches, aren't found
+	for _, target := range []string{"ab1", "ffff", "laptop"} {
+		if _, err := ResolvePeer(peers, target); !errors.Is(err, ErrPeerNotFound) {
+			t.Errorf("%s: expected ErrPeerNotFound, got %v", target, err)
+		}
+	}
+}
+
+func TestReplyAddressIPv6(t *testing.T) {
+	peer, err := parseDiscoveryReply([]byte(`{"hostname":"v6-laptop","ip":"[fe80::20]:8080"}`))
+	if err != nil {
+		t.Fatalf("Failed to parse IPv6 reply: %v", err)
+	}
+	if peer.Port != 8080 {
+		t.Errorf("Expected port 8080 derived from bracketed ip, got %d", peer.Port)
+	}
+
+	// Link-local replies take the zone of the interface they arrived on
+	from := &net.UDPAddr{IP: net.ParseIP("fe80::20"), Port: DiscoveryPort, Zone: "eth0"}
+	if addr := replyAddress(peer, from); addr != "[fe80::20%eth0]:8080" {
+		t.Errorf("Expected [fe80::20%%eth0]:8080, got %s", addr)
+	}
+
+	global := Peer{IP: "[2001:db8::20]:8080"}
+	if addr := replyAddress(global, from); addr != global.IP {
+		t.Errorf("Expected global address to be kept, got %s", addr)
+	}
+
+	v4 := Peer{IP: "192.168.1.20:8080"}
+	if addr := replyAddress(v4, &net.UDPAddr{IP: net.ParseIP("192.168.1.20")}); addr != v4.IP {
+		t.Errorf("Expected IPv4 address to be kept, got %s", addr)
+	}
+}
+
+func TestDiscoveryPortConflict(t *testing.T) {
+	// Either this test or a receiver started by an earlier test now holds the port
+	if conn, err := listenDiscoveryPort(); err == nil {
+		defer conn.Close()
+	}
+	// Receivers in this process share the bound port, so pretend none has bound it yet
+	advertised.mutex.Lock()
+	listening := advertised.listening
+	advertised.listening = false
+	advertised.mutex.Unlock()
+	defer func() {
+		advertised.mutex.Lock()
+		advertised.listening = listening
+		advertised.mutex.Unlock()
+	}()
+
+	if err := StartDiscoveryListener("8080"); !errors.Is(err, ErrDiscoveryFailed) {
+		t.Errorf("Expected ErrDiscoveryFailed while the port is held, got %v", err)
+	}
+	if err := CheckDiscoveryPort(); !errors.Is(err, ErrDiscoveryFailed) {
+		t.Errorf("Expected CheckDiscoveryPort to report the conflict, got %v", err)
+	}
+}
+
+func TestBroadcastDiscoveryReportsSendFailure(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Failed to open UDP socket: %v", err)
+	}
+	defer conn.Close()
+
+	// No address can be resolved, so nothing goes out
+	if err := broadcastDiscovery(conn, []string{"not a valid address"}); !errors.Is(err, ErrDiscoveryFailed) {
+		t.Errorf("Expected ErrDiscoveryFailed when no broadcast is sent, got %v", err)
+	}
+	if err := broadcastDiscovery(conn, []string{conn.LocalAddr().String()}); err != nil {
+		t.Errorf("Expected a reachable address to succeed, got %v", err)
+	}
+}
+
+func TestAdvertisedReplyListsEveryPort(t *testing.T) {
+	advertised.mutex.Lock()
+	saved := advertised.endpoints
+	advertised.endpoints = nil
+	advertised.mutex.Unlock()
+	defer func() {
+		advertised.mutex.Lock()
+		advertised.endpoints = saved
+		advertised.mutex.Unlock()
+	}()
+
+	if _, ok := advertisedReply("192.168.1.20"); ok {
+		t.Error("Expected no reply while nothing is being served")
+	}
+
+	advertised.mutex.Lock()
+	advertised.endpoints = []discoveryEndpoint{
+		{port: "9000", capabilities: []string{CapabilityQUICChunked}},
+		{port: "9001", capabilities: []string{CapabilityQUICChunked}},
+	}
+	advertised.mutex.Unlock()
+	reply, ok := advertisedReply("192.168.1.20")
+	if !ok || reply.IP != "192.168.1.20:9000" || !slices.Equal(reply.Ports, []int{9000, 9001}) {
+		t.Errorf("Expected the first port in the address and both listed, got %+v", reply)
+	}
+
+	stopAdvertising("9000")
+	reply, _ = advertisedReply("192.168.1.20")
+	if reply.IP != "192.168.1.20:9001" || reply.Ports != nil {
+		t.Errorf("Expected the remaining port alone, got %+v", reply)
+	}
+}
+
+func TestReplyLimiterCoolsDownPerRequester(t *testing.T) {
+	limiter := newReplyLimiter()
+	now := time.Now()
+	if !limiter.allow("192.168.1.20", now) {
+		t.Fatal("Expected the first request to be answered")
+	}
+	if limiter.allow("192.168.1.20", now.Add(DiscoveryReplyCooldown/2)) {
+		t.Error("Expected a repeated request within the cooldown to be ignored")
+	}
+	if !limiter.allow("192.168.1.21", now.Add(DiscoveryReplyCooldown/2)) {
+		t.Error("Expected another requester to be answered")
+	}
+	if !limiter.allow("192.168.1.20", now.Add(DiscoveryReplyCooldown)) {
+		t.Error("Expected the requester to be answered again after the cooldown")
+	}
+
+	// Expired requesters are forgotten once many have been seen
+	for i := 0; i < maxTrackedRequesters; i++ {
+		limiter.allow(net.IPv4(10, 0, byte(i/256), byte(i%256)).String(), now)
+	}
+	limiter.allow("192.168.1.22", now.Add(2*DiscoveryReplyCooldown))
+	if len(limiter.last) > 2 {
+		t.Errorf("Expected expired requesters to be dropped, still tracking %d", len(limiter.last))
+	}
+}
+
+func TestFromThisHost(t *testing.T) {
+	own := []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("192.168.1.5"), net.ParseIP("fe80::1")}
+	if !fromThisHost(net.ParseIP("192.168.1.5"), own) || !fromThisHost(net.ParseIP("fe80::1"), own) {
+		t.Error("Expected requests from this host's own addresses to be recognized")
+	}
+	if fromThisHost(net.ParseIP("192.168.1.6"), own) {
+		t.Error("Expected a request from another host to be answered")
+	}
+	if fromThisHost(net.ParseIP("127.0.0.1"), own) {
+		t.Error("Expected loopback requests to be answered")
+	}
+}
+
+func TestDropSelf(t *testing.T) {
+	defer SetIncludeSelf(false)
+
+	hostname, _ := os.Hostname()
+	localIP := getAllLocalIPs()[0]
+	self := Peer{Hostname: hostname, IP: net.JoinHostPort(localIP.String(), "8080")}
+	peers := map[string]Peer{
+		"self":      self,
+		"other":     {Hostname: "other-laptop", IP: "192.0.2.50:8080"},
+		"same-name": {Hostname: hostname, IP: "192.0.2.51:8080"},
+	}
+	dropSelf(peers)
+	if _, ok := peers["self"]; ok {
+		t.Error("Expected this host to be left out")
+	}
+	if len(peers) != 2 {
+		t.Errorf("Expected other hosts to stay, even one sharing the hostname, got %v", peers)
+	}
+
+	SetIncludeSelf(true)
+	peers["self"] = self
+	dropSelf(peers)
+	if _, ok := peers["self"]; !ok {
+		t.Error("Expected this host to be kept with SetIncludeSelf")
+	}
+	if !slices.Contains(discoveryBroadcastAddresses(), fmt.Sprintf("127.0.0.1:%d", DiscoveryPort)) {
+		t.Error("Expected discovery to ask over loopback with SetIncludeSelf")
+	}
+}
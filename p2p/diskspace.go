@@ -0,0 +1,53 @@
+package p2p
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// remainingBytes returns how many bytes the required chunks of a transfer add up to
+func remainingBytes(request *TransferRequest, requiredChunks []int) int64 {
+	var total int64
+	for _, chunkIndex := range requiredChunks {
+		offset := int64(chunkIndex) * request.ChunkSize
+		size := request.FileSize - offset
+		if size > request.ChunkSize {
+			size = request.ChunkSize
+		}
+		if size > 0 {
+			total += size
+		}
+	}
+	return total
+}
+
+// insufficientSpaceMessage returns a rejection message if the filesystem that will hold outputPath has
+// less than needed bytes free, or an empty string if it fits. Platforms without a free space query always fit.
+func insufficientSpaceMessage(outputPath string, needed int64) string {
+	if needed <= 0 {
+		return ""
+	}
+
+	free, err := freeDiskSpace(nearestExistingDir(filepath.Dir(outputPath)))
+	if err != nil || uint64(needed) <= free {
+		return ""
+	}
+	return fmt.Sprintf("Not enough disk space: %s needed but only %s free on the receiver",
+		FormatByteSize(needed), FormatByteSize(int64(free)))
+}
+
+// nearestExistingDir walks up from dir to the first directory that exists, since the
+// output directory for a nested file may not have been created yet
+func nearestExistingDir(dir string) string {
+	for {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package p2p
+
+import "errors"
+
+// freeDiskSpace isn't implemented on this platform, so the free space check is skipped
+func freeDiskSpace(path string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,36 @@
+package p2p
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRemainingBytes(t *testing.T) {
+	request := NewTransferRequest("file.bin", 2500, "hash", 1000)
+
+	if got := remainingBytes(request, []int{0, 1, 2}); got != 2500 {
+		t.Errorf("Expected all 2500 bytes for every chunk, got %d", got)
+	}
+	// The last chunk is short
+	if got := remainingBytes(request, []int{2}); got != 500 {
+		t.Errorf("Expected 500 bytes for the last chunk, got %d", got)
+	}
+	if got := remainingBytes(request, nil); got != 0 {
+		t.Errorf("Expected 0 bytes when nothing is missing, got %d", got)
+	}
+}
+
+func TestInsufficientSpaceMessage(t *testing.T) {
+	// The parent directories don't exist yet, as in a directory transfer
+	outputPath := filepath.Join(t.TempDir(), "a", "b", "received_file.bin")
+
+	if msg := insufficientSpaceMessage(outputPath, 1); msg != "" {
+		t.Errorf("Expected a single byte to fit, got %q", msg)
+	}
+	if _, err := freeDiskSpace("."); err != nil {
+		t.Skipf("free space query not available: %v", err)
+	}
+	if msg := insufficientSpaceMessage(outputPath, 1<<62); msg == "" {
+		t.Error("Expected 4 EB not to fit")
+	}
+}
@@ -0,0 +1,14 @@
+//go:build unix
+
+package p2p
+
+import "syscall"
+
+// freeDiskSpace returns the bytes available to this user on the filesystem holding path
+func freeDiskSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
@@ -1,6 +1,9 @@
 package p2p
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
 // Error types for better error handling and debugging
 var (
@@ -25,6 +28,7 @@ var (
 	ErrChunkMissing        = fmt.Errorf("chunk missing")
 	ErrChunkCorrupted      = fmt.Errorf("chunk corrupted")
 	ErrTransferRejected    = fmt.Errorf("transfer rejected")
+	ErrReceiverBusy        = fmt.Errorf("receiver busy")
 	
 	// Protocol errors
 	ErrInvalidMessage      = fmt.Errorf("invalid message")
@@ -36,10 +40,13 @@ var (
 	ErrDiscoveryFailed     = fmt.Errorf("peer discovery failed")
 	ErrNoPeersFound        = fmt.Errorf("no peers found")
 	ErrPeerUnavailable     = fmt.Errorf("peer unavailable")
+	ErrPeerNotFound        = fmt.Errorf("peer not found")
+	ErrAmbiguousPeer       = fmt.Errorf("ambiguous peer")
 	
 	// TLS/Security errors
 	ErrTLSConfiguration    = fmt.Errorf("TLS configuration error")
 	ErrCertificateInvalid  = fmt.Errorf("certificate invalid")
+	ErrFingerprintMismatch = fmt.Errorf("receiver fingerprint mismatch")
 	ErrEncryptionFailed    = fmt.Errorf("encryption failed")
 )
 
@@ -67,6 +74,54 @@ func (te *TransferError) Unwrap() error {
 	return te.Type
 }
 
+// RejectionError is returned to a sender whose request the receiver refused. Code is empty for
+// receivers that predate rejection codes.
+type RejectionError struct {
+	Code    RejectionCode
+	Message string
+}
+
+// Error implements the error interface
+func (re *RejectionError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrTransferRejected, re.Message)
+}
+
+// Unwrap matches ErrTransferRejected, and the error matching the code where there is one, so
+// errors.Is(err, ErrInsufficientSpace) works for a receiver with a full disk
+func (re *RejectionError) Unwrap() []error {
+	errs := []error{ErrTransferRejected}
+	switch re.Code {
+	case RejectionTooLarge:
+		errs = append(errs, ErrFileTooLarge)
+	case RejectionNoSpace:
+		errs = append(errs, ErrInsufficientSpace)
+	case RejectionUntrusted:
+		errs = append(errs, ErrFileAccessDenied)
+	case RejectionUnsupportedVersion:
+		errs = append(errs, ErrUnsupportedVersion)
+	case RejectionNotFound:
+		errs = append(errs, ErrFileNotFound)
+	}
+	return errs
+}
+
+// rejectionCodeFor returns the rejection code for an error a receiver refuses a request with
+func rejectionCodeFor(reason error) RejectionCode {
+	switch {
+	case errors.Is(reason, ErrUnsupportedVersion):
+		return RejectionUnsupportedVersion
+	case errors.Is(reason, ErrFileNotFound):
+		return RejectionNotFound
+	case errors.Is(reason, ErrFileAccessDenied):
+		return RejectionUntrusted
+	case errors.Is(reason, ErrFileTooLarge):
+		return RejectionTooLarge
+	case errors.Is(reason, ErrInsufficientSpace):
+		return RejectionNoSpace
+	}
+	return RejectionInvalidRequest
+}
+
 // NewTransferError creates a new transfer error with context
 func NewTransferError(errType error, filename, peerAddress string, chunkIndex int, reason string) *TransferError {
 	return &TransferError{
@@ -0,0 +1,49 @@
+package p2p
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/quic-go/quic-go"
+)
+
+// MinExpectedFingerprint is the fewest hex digits SenderConfig.ExpectFingerprint may give. Shorter
+// prefixes, like the 8 digits 'landrop discover' shows, are cheap for an impostor to match.
+const MinExpectedFingerprint = 16
+
+// fingerprintMismatchCode closes a connection whose receiver presented an unexpected certificate
+const fingerprintMismatchCode quic.ApplicationErrorCode = 0x11
+
+// normalizeFingerprint lowercases fingerprint and drops the colons and spaces other tools print
+func normalizeFingerprint(fingerprint string) string {
+	return strings.ToLower(strings.NewReplacer(":", "", " ", "").Replace(fingerprint))
+}
+
+// ValidateExpectedFingerprint checks that fingerprint could be all or the start of a certificate fingerprint
+func ValidateExpectedFingerprint(fingerprint string) error {
+	normalized := normalizeFingerprint(fingerprint)
+	if len(normalized) < MinExpectedFingerprint || len(normalized) > 64 {
+		return fmt.Errorf("fingerprint must be %d to 64 hex digits, got %d", MinExpectedFingerprint, len(normalized))
+	}
+	if !isFingerprintPrefix(normalized) {
+		return fmt.Errorf("fingerprint must be hex digits, got '%s'", fingerprint)
+	}
+	return nil
+}
+
+// verifyReceiverFingerprint checks that the receiver on conn authenticated with a certificate whose
+// fingerprint starts with expected, closing conn and returning ErrFingerprintMismatch if it didn't
+func verifyReceiverFingerprint(conn quic.Connection, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	actual := certificateDeviceInfo(conn).Fingerprint
+	if actual != "" && strings.HasPrefix(actual, normalizeFingerprint(expected)) {
+		return nil
+	}
+	conn.CloseWithError(fingerprintMismatchCode, "unexpected certificate fingerprint")
+	if actual == "" {
+		return fmt.Errorf("%w: %s presented no certificate", ErrFingerprintMismatch, conn.RemoteAddr())
+	}
+	return fmt.Errorf("%w: %s presented %s, expected %s", ErrFingerprintMismatch, conn.RemoteAddr(), actual, normalizeFingerprint(expected))
+}
@@ -0,0 +1,107 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+func TestValidateExpectedFingerprint(t *testing.T) {
+	tests := []struct {
+		fingerprint string
+		valid       bool
+	}{
+		{strings.Repeat("ab", 32), true},
+		{"AB12CD34EF567890", true},
+		{"ab:12:cd:34:ef:56:78:90", true},
+		{"ab12cd34", false},               // a short prefix is too easy to match
+		{"zz12cd34ef567890", false},       // not hex
+		{strings.Repeat("ab", 33), false}, // longer than a SHA-256 fingerprint
+	}
+	for _, tt := range tests {
+		if err := ValidateExpectedFingerprint(tt.fingerprint); (err == nil) != tt.valid {
+			t.Errorf("%q: expected valid=%v, got %v", tt.fingerprint, tt.valid, err)
+		}
+	}
+}
+
+func TestSenderVerifiesReceiverFingerprint(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	receiverConfig := DefaultReceiverConfig()
+	receiverConfig.OutputDir = t.TempDir()
+	receiverConfig.Daemon = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileChunkedContext(ctx, fmt.Sprintf("%d", port), receiverConfig)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// Learn the receiver's real fingerprint the way a user would from its device info
+	peerAddr := fmt.Sprintf("127.0.0.1:%d", port)
+	probe, err := quic.DialAddr(context.Background(), peerAddr, GetClientTLSConfig(), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial receiver: %v", err)
+	}
+	fingerprint := certificateDeviceInfo(probe).Fingerprint
+	probe.CloseWithError(0, "")
+	if fingerprint == "" {
+		t.Fatal("Expected the receiver to present a certificate")
+	}
+
+	testFile := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(testFile, []byte("for the right device only"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	received := filepath.Join(receiverConfig.OutputDir, "received_secret.txt")
+
+	senderConfig := DefaultSenderConfig()
+	senderConfig.ExpectFingerprint = strings.Repeat("0", 64)
+	if fingerprint[0] == '0' {
+		senderConfig.ExpectFingerprint = strings.Repeat("1", 64)
+	}
+	if err := SendFileChunkedWithConfig(testFile, peerAddr, senderConfig); !errors.Is(err, ErrFingerprintMismatch) {
+		t.Fatalf("Expected ErrFingerprintMismatch for another fingerprint, got %v", err)
+	}
+	if _, err := os.Stat(received); !os.IsNotExist(err) {
+		t.Fatalf("Expected nothing to be sent to an unexpected receiver, got %v", err)
+	}
+
+	senderConfig.ExpectFingerprint = strings.ToUpper(fingerprint[:MinExpectedFingerprint])
+	if err := SendFileChunkedWithConfig(testFile, peerAddr, senderConfig); err != nil {
+		t.Fatalf("Expected the send to succeed with the receiver's fingerprint, got %v", err)
+	}
+	if data, err := os.ReadFile(received); err != nil || string(data) != "for the right device only" {
+		t.Errorf("Expected the file to arrive, got %q (%v)", data, err)
+	}
+
+	cancel()
+	select {
+	case err := <-receiverDone:
+		if err != nil {
+			t.Fatalf("Daemon receiver returned error: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Daemon receiver did not stop after cancellation")
+	}
+}
@@ -0,0 +1,168 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultFollowInterval is how often send-chunked --follow scans the directory
+const DefaultFollowInterval = 2 * time.Second
+
+// followedFile is the size and modification time a followed file had when it was scanned
+type followedFile struct {
+	size    int64
+	modTime time.Time
+}
+
+// followScanner finds the files in a directory that are new or modified since they were last sent.
+// A file is only reported once it looks the same in two scans in a row, so one still being written
+// isn't sent half finished.
+type followScanner struct {
+	dir  string
+	seen map[string]followedFile // every file as of the previous scan
+	sent map[string]followedFile // each file as it was when last sent
+}
+
+// newFollowScanner scans dir once, counting the files already there as sent
+func newFollowScanner(dir string) (*followScanner, error) {
+	files, err := listFollowedFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	sent := make(map[string]followedFile, len(files))
+	for name, file := range files {
+		sent[name] = file
+	}
+	return &followScanner{dir: dir, seen: files, sent: sent}, nil
+}
+
+// scan returns the names of the files that changed since they were last sent and have settled
+// since the previous scan, in name order
+func (f *followScanner) scan() ([]string, error) {
+	files, err := listFollowedFiles(f.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	for name, file := range files {
+		if sent, ok := f.sent[name]; ok && sent == file {
+			continue
+		}
+		if previous, ok := f.seen[name]; ok && previous == file {
+			changed = append(changed, name)
+		}
+	}
+	// A deleted file that comes back is new again
+	for name := range f.sent {
+		if _, ok := files[name]; !ok {
+			delete(f.sent, name)
+		}
+	}
+	f.seen = files
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// markSent records a file reported by the last scan as sent in the state that scan saw
+func (f *followScanner) markSent(name string) {
+	if file, ok := f.seen[name]; ok {
+		f.sent[name] = file
+	}
+}
+
+// listFollowedFiles lists the regular files directly in dir. Hidden files are left out, since
+// programs often write to a hidden temporary name before renaming the finished file.
+func listFollowedFiles(dir string) (map[string]followedFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory '%s': %w", dir, err)
+	}
+	files := make(map[string]followedFile, len(entries))
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// Removed since the directory was read
+			continue
+		}
+		files[entry.Name()] = followedFile{size: info.Size(), modTime: info.ModTime()}
+	}
+	return files, nil
+}
+
+// FollowDirectoryChunked sends every file that appears in dir, or changes, to a chunked receiver
+// until ctx is done, checking every interval. Files already in dir when it starts aren't sent, and
+// subdirectories aren't followed. One connection is kept open between files and dialed again if it
+// drops, so the receiver should be a daemon. A rejected file is only offered again once it changes,
+// and a failed one on the next scan. config.TransferTimeout doesn't apply.
+func FollowDirectoryChunked(ctx context.Context, dir string, peerAddr string, config SenderConfig, interval time.Duration) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+	if interval <= 0 {
+		return fmt.Errorf("follow interval must be positive")
+	}
+	scanner, err := newFollowScanner(dir)
+	if err != nil {
+		return err
+	}
+
+	session, err := openSendSession(ctx, peerAddr, config)
+	if err != nil {
+		return err
+	}
+	defer func() { session.Close() }()
+	logf("Following '%s': sending new and modified files to %s\n", dir, peerAddr)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		changed, err := scanner.scan()
+		if err != nil {
+			// The directory may be back by the next scan
+			logf("Warning: %v\n", err)
+			continue
+		}
+		for _, name := range changed {
+			path := filepath.Join(dir, name)
+			err := session.sendFile(ctx, path, "")
+			if err != nil && ctx.Err() == nil && session.conn.Context().Err() != nil {
+				// The connection went away between files, so there was nothing to resume
+				logf("Connection to %s lost, reconnecting...\n", peerAddr)
+				if reopened, dialErr := openSendSession(ctx, peerAddr, config); dialErr == nil {
+					session.conn.CloseWithError(0, "")
+					session = reopened
+					err = session.sendFile(ctx, path, "")
+				} else {
+					logf("Reconnecting to %s failed: %v\n", peerAddr, dialErr)
+				}
+			}
+			// Nothing summarizes the results while following, so they mustn't pile up
+			session.results = nil
+
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err == nil || errors.Is(err, ErrTransferRejected) {
+				scanner.markSent(name)
+			} else {
+				logf("Failed to send '%s', will retry: %v\n", path, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFollowScannerWaitsForFilesToSettle(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "old.log"), []byte("already here"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	scanner, err := newFollowScanner(dir)
+	if err != nil {
+		t.Fatalf("Failed to scan directory: %v", err)
+	}
+
+	scan := func() []string {
+		t.Helper()
+		changed, err := scanner.scan()
+		if err != nil {
+			t.Fatalf("Failed to scan directory: %v", err)
+		}
+		for _, name := range changed {
+			scanner.markSent(name)
+		}
+		return changed
+	}
+
+	os.WriteFile(filepath.Join(dir, "new.log"), []byte("first line\n"), 0644)
+	os.WriteFile(filepath.Join(dir, ".new.log.tmp"), []byte("not finished"), 0644)
+	if changed := scan(); len(changed) != 0 {
+		t.Errorf("Expected a file seen once to wait, got %v", changed)
+	}
+	if changed := scan(); !slices.Equal(changed, []string{"new.log"}) {
+		t.Errorf("Expected only the settled new file, got %v", changed)
+	}
+	if changed := scan(); len(changed) != 0 {
+		t.Errorf("Expected an unchanged file not to be sent again, got %v", changed)
+	}
+
+	// A modification is sent again once it settles
+	os.WriteFile(filepath.Join(dir, "new.log"), []byte("first line\nsecond line\n"), 0644)
+	scan()
+	if changed := scan(); !slices.Equal(changed, []string{"new.log"}) {
+		t.Errorf("Expected the modified file to be sent again, got %v", changed)
+	}
+}
+
+func TestFollowDirectorySendsNewFiles(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	receiverConfig := DefaultReceiverConfig()
+	receiverConfig.OutputDir = t.TempDir()
+	receiverConfig.Daemon = true
+	receiverConfig.OnConflict = ConflictOverwrite
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileChunkedContext(ctx, fmt.Sprintf("%d", port), receiverConfig)
+	}()
+
+	// Give receiver time to start
+	time.Sleep(100 * time.Millisecond)
+
+	dir := t.TempDir()
+	followCtx, stopFollowing := context.WithCancel(ctx)
+	followDone := make(chan error, 1)
+	go func() {
+		followDone <- FollowDirectoryChunked(followCtx, dir, fmt.Sprintf("127.0.0.1:%d", port), DefaultSenderConfig(), 50*time.Millisecond)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	received := filepath.Join(receiverConfig.OutputDir, "received_app.log")
+	waitFor := func(content string) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+			if data, err := os.ReadFile(received); err == nil && string(data) == content {
+				return
+			}
+		}
+		t.Fatalf("Expected the receiver to end up with %q", content)
+	}
+
+	os.WriteFile(filepath.Join(dir, "app.log"), []byte("started\n"), 0644)
+	waitFor("started\n")
+	os.WriteFile(filepath.Join(dir, "app.log"), []byte("started\nstopped\n"), 0644)
+	waitFor("started\nstopped\n")
+
+	stopFollowing()
+	select {
+	case err := <-followDone:
+		if err != nil {
+			t.Fatalf("Following failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Following did not stop after cancellation")
+	}
+	cancel()
+	<-receiverDone
+}
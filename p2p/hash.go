@@ -0,0 +1,62 @@
+package p2p
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+
+	"github.com/zeebo/blake3"
+)
+
+// Hash algorithms negotiated in TransferRequest for the file hash and the per-chunk checksums
+const (
+	HashSHA256 = "sha256"
+	HashBLAKE3 = "blake3"
+)
+
+// ValidateHashAlgorithm checks that algorithm is a supported hash algorithm
+func ValidateHashAlgorithm(algorithm string) error {
+	switch algorithm {
+	case "", HashSHA256, HashBLAKE3:
+		return nil
+	}
+	return fmt.Errorf("unsupported hash algorithm '%s' (use sha256 or blake3)", algorithm)
+}
+
+// normalizeHashAlgorithm maps the empty algorithm of older peers to SHA-256, which is all they spoke
+func normalizeHashAlgorithm(algorithm string) string {
+	if algorithm == "" {
+		return HashSHA256
+	}
+	return algorithm
+}
+
+// newHash returns a hash for algorithm; unknown algorithms fall back to SHA-256, so callers
+// validate peer-supplied names first
+func newHash(algorithm string) hash.Hash {
+	if algorithm == HashBLAKE3 {
+		return blake3.New()
+	}
+	return sha256.New()
+}
+
+// fileSourceID derives a TransferRequest.SourceID from the file's path, size and modification time,
+// which stay the same across retries of a transfer and change when the file does
+func fileSourceID(filename string, info os.FileInfo) string {
+	if absPath, err := filepath.Abs(filename); err == nil {
+		filename = absPath
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%d", filename, info.Size(), info.ModTime().UnixNano())))
+	return hex.EncodeToString(sum[:])
+}
+
+// sumChunk returns the 32-byte checksum carried in a chunk header
+func sumChunk(algorithm string, data []byte) [32]byte {
+	if algorithm == HashBLAKE3 {
+		return blake3.Sum256(data)
+	}
+	return sha256.Sum256(data)
+}
@@ -0,0 +1,109 @@
+package p2p
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// HistoryFileName is the append-only transfer log kept in ~/.landrop
+const HistoryFileName = "history.jsonl"
+
+// HistoryEntry is one finished transfer in the history log
+type HistoryEntry struct {
+	Timestamp       time.Time `json:"timestamp"`
+	Direction       string    `json:"direction"`
+	Peer            string    `json:"peer"`
+	Filename        string    `json:"filename"`
+	Size            int64     `json:"size"`
+	Status          string    `json:"status"`
+	Reason          string    `json:"reason,omitempty"`
+	DurationSeconds float64   `json:"duration_seconds"`
+}
+
+var (
+	historyMutex sync.Mutex
+	historyPath  string
+)
+
+// DefaultHistoryPath returns ~/.landrop/history.jsonl
+func DefaultHistoryPath() (string, error) {
+	dir, err := landropConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, HistoryFileName), nil
+}
+
+// SetHistoryPath makes every completed, failed or rejected transfer append an entry to path.
+// An empty path, the default for library use, disables the history log.
+func SetHistoryPath(path string) {
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+	historyPath = path
+}
+
+// appendHistory writes entry as one JSON line to the history log, if one is set
+func appendHistory(entry HistoryEntry) {
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+	if historyPath == "" {
+		return
+	}
+
+	if err := writeHistoryEntry(historyPath, entry); err != nil {
+		logf("Warning: failed to record transfer history: %v\n", err)
+	}
+}
+
+// writeHistoryEntry appends a single line so concurrent writers never interleave within an entry
+func writeHistoryEntry(path string, entry HistoryEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// ReadHistory returns the last limit entries of the history log at path, oldest first
+// (all of them when limit is zero). A missing log is empty, and unreadable lines are skipped.
+func ReadHistory(path string, limit int) ([]HistoryEntry, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	defer file.Close()
+
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+		if limit > 0 && len(entries) > limit {
+			entries = entries[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,82 @@
+package p2p
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTransferOutcomesAreRecordedInHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), HistoryFileName)
+	SetHistoryPath(path)
+	defer SetHistoryPath("")
+
+	outcomes := []func(*TransferStats){
+		func(ts *TransferStats) { ts.MarkCompleted() },
+		func(ts *TransferStats) { ts.MarkFailed("connection lost") },
+		func(ts *TransferStats) { ts.MarkRejected("declined") },
+	}
+	for i, mark := range outcomes {
+		stats := NewTransferStats("file.bin", int64(1000*(i+1)), 1, "127.0.0.1:8080", "sent")
+		stats.SetQuiet(true)
+		mark(stats)
+	}
+
+	entries, err := ReadHistory(path, 0)
+	if err != nil {
+		t.Fatalf("Failed to read history: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 history entries, got %d", len(entries))
+	}
+	expectedStatus := []string{"completed", "failed", "rejected"}
+	for i, entry := range entries {
+		if entry.Status != expectedStatus[i] {
+			t.Errorf("Entry %d: expected status %s, got %s", i, expectedStatus[i], entry.Status)
+		}
+		if entry.Size != int64(1000*(i+1)) || entry.Peer != "127.0.0.1:8080" || entry.Direction != "sent" {
+			t.Errorf("Entry %d: unexpected fields %+v", i, entry)
+		}
+		if entry.Timestamp.IsZero() {
+			t.Errorf("Entry %d: expected a timestamp", i)
+		}
+	}
+	if entries[1].Reason != "connection lost" {
+		t.Errorf("Expected failure reason to be recorded, got %q", entries[1].Reason)
+	}
+
+	recent, err := ReadHistory(path, 2)
+	if err != nil {
+		t.Fatalf("Failed to read history: %v", err)
+	}
+	if len(recent) != 2 || recent[0].Status != "failed" || recent[1].Status != "rejected" {
+		t.Errorf("Expected the 2 most recent entries, got %+v", recent)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat history: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected history permissions 0600, got %o", info.Mode().Perm())
+	}
+}
+
+func TestReadHistorySkipsMalformedLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), HistoryFileName)
+	if entries, err := ReadHistory(path, 0); err != nil || len(entries) != 0 {
+		t.Fatalf("Expected a missing history to be empty, got %v (err=%v)", entries, err)
+	}
+
+	content := `{"filename":"good","status":"completed"}` + "\n" + `{"filename":"trunc` + "\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write history: %v", err)
+	}
+	entries, err := ReadHistory(path, 0)
+	if err != nil {
+		t.Fatalf("Failed to read history: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Filename != "good" {
+		t.Errorf("Expected only the well-formed entry, got %+v", entries)
+	}
+}
@@ -0,0 +1,92 @@
+package p2p
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// receiveOnce runs a single-shot receiver with config, sends testFile to it and returns the
+// receiver's result
+func receiveOnce(t *testing.T, testFile string, config ReceiverConfig) error {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), config)
+	}()
+
+	// Give receiver time to start
+	time.Sleep(100 * time.Millisecond)
+
+	if err := SendFileChunkedWithConfig(testFile, fmt.Sprintf("127.0.0.1:%d", port), DefaultSenderConfig()); err != nil {
+		t.Fatalf("Sender failed: %v", err)
+	}
+	select {
+	case err := <-receiverDone:
+		return err
+	case <-time.After(10 * time.Second):
+		t.Fatal("Test timed out")
+	}
+	return nil
+}
+
+func TestReceiverHooks(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	testFile := filepath.Join(t.TempDir(), "hooked.txt")
+	if err := os.WriteFile(testFile, []byte("hook me"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// A quota that's already used up
+	config := DefaultReceiverConfig()
+	config.OutputDir = t.TempDir()
+	var requested string
+	config.BeforeAccept = func(request *TransferRequest) (bool, string) {
+		requested = request.Filename
+		return false, "Quota exceeded"
+	}
+	config.AfterReceive = func(path string, stats *TransferStats) error {
+		t.Errorf("Expected no post-receive call for a rejected file, got %s", path)
+		return nil
+	}
+	if err := receiveOnce(t, testFile, config); !errors.Is(err, ErrTransferRejected) {
+		t.Fatalf("Expected the hook to reject the transfer, got %v", err)
+	}
+	if requested != "hooked.txt" {
+		t.Errorf("Expected the hook to see the request, got %q", requested)
+	}
+	if _, err := os.Stat(filepath.Join(config.OutputDir, "received_hooked.txt")); !os.IsNotExist(err) {
+		t.Error("Expected nothing to be written for a rejected transfer")
+	}
+
+	config.BeforeAccept = func(request *TransferRequest) (bool, string) {
+		return true, ""
+	}
+	var receivedPath string
+	var receivedStatus string
+	config.AfterReceive = func(path string, stats *TransferStats) error {
+		receivedPath, receivedStatus = path, stats.Status
+		return errors.New("indexer unavailable")
+	}
+	if err := receiveOnce(t, testFile, config); err != nil {
+		t.Fatalf("Expected a failing post-receive hook not to fail the transfer, got %v", err)
+	}
+	if receivedPath != filepath.Join(config.OutputDir, "received_hooked.txt") || receivedStatus != "completed" {
+		t.Errorf("Expected the hook to get the saved file once completed, got %s (%s)", receivedPath, receivedStatus)
+	}
+}
@@ -0,0 +1,153 @@
+package p2p
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Identity files kept in ~/.landrop so the device ID and fingerprint survive restarts
+const (
+	caCertFile     = "ca_cert.pem"
+	caKeyFile      = "ca_key.pem"
+	deviceCertFile = "device_cert.pem"
+	deviceKeyFile  = "device_key.pem"
+)
+
+// deviceIdentity is this device's CA and the device certificate it signed
+type deviceIdentity struct {
+	caCert     *x509.Certificate
+	caKey      *ecdsa.PrivateKey
+	deviceCert *x509.Certificate
+	deviceKey  *ecdsa.PrivateKey
+}
+
+// landropConfigDir returns ~/.landrop, creating it if needed
+func landropConfigDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+
+	dir := filepath.Join(homeDir, ".landrop")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create .landrop directory: %w", err)
+	}
+	return dir, nil
+}
+
+// loadOrCreateIdentity loads the persisted CA and device certificate from dir,
+// regenerating whichever is missing or expired and renewing a device certificate close to expiry
+func loadOrCreateIdentity(dir string) (*deviceIdentity, error) {
+	now := time.Now()
+	identity := &deviceIdentity{}
+
+	caCert, caKey, err := loadCertificateAndKey(filepath.Join(dir, caCertFile), filepath.Join(dir, caKeyFile))
+	caRegenerated := false
+	if err != nil || now.After(caCert.NotAfter) {
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			logf("⚠️  Failed to load CA certificate: %v (generating a new one)\n", err)
+		}
+		caCert, caKey, err = generateCertificateAuthority()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate CA: %w", err)
+		}
+		if err := saveCertificateAndKey(filepath.Join(dir, caCertFile), filepath.Join(dir, caKeyFile), caCert, caKey); err != nil {
+			return nil, fmt.Errorf("failed to save CA: %w", err)
+		}
+		caRegenerated = true
+	}
+	identity.caCert, identity.caKey = caCert, caKey
+
+	deviceCert, deviceKey, err := loadCertificateAndKey(filepath.Join(dir, deviceCertFile), filepath.Join(dir, deviceKeyFile))
+	if err == nil && !caRegenerated && deviceCert.CheckSignatureFrom(caCert) == nil {
+		// Re-issue the certificate before it expires, keeping the key and device ID so peers still recognize us
+		if now.Add(CertificateRenewalWindow).After(deviceCert.NotAfter) {
+			logf("🔄 Device certificate expires %s, renewing\n", deviceCert.NotAfter.Format("2006-01-02"))
+			deviceCert, err = signDeviceCertificate(caCert, caKey, deviceKey, deviceCert.Subject.CommonName, CertificateValidityDays*24*time.Hour)
+			if err != nil {
+				return nil, fmt.Errorf("failed to renew device certificate: %w", err)
+			}
+			if err := saveCertificateAndKey(filepath.Join(dir, deviceCertFile), filepath.Join(dir, deviceKeyFile), deviceCert, deviceKey); err != nil {
+				return nil, fmt.Errorf("failed to save device certificate: %w", err)
+			}
+		}
+		identity.deviceCert, identity.deviceKey = deviceCert, deviceKey
+		return identity, nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		logf("⚠️  Failed to load device certificate: %v (generating a new one)\n", err)
+	}
+
+	deviceCert, deviceKey, err = generateDeviceCertificate(caCert, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate device certificate: %w", err)
+	}
+	if err := saveCertificateAndKey(filepath.Join(dir, deviceCertFile), filepath.Join(dir, deviceKeyFile), deviceCert, deviceKey); err != nil {
+		return nil, fmt.Errorf("failed to save device certificate: %w", err)
+	}
+	identity.deviceCert, identity.deviceKey = deviceCert, deviceKey
+	return identity, nil
+}
+
+// loadCertificateAndKey reads a PEM certificate and its PKCS#8 ECDSA private key
+func loadCertificateAndKey(certPath, keyPath string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := parsePEMCertificate(certPEM)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid certificate %s: %w", certPath, err)
+	}
+
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, nil, fmt.Errorf("invalid private key %s: failed to decode PEM block", keyPath)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid private key %s: %w", keyPath, err)
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok || !key.PublicKey.Equal(cert.PublicKey) {
+		return nil, nil, fmt.Errorf("private key %s does not match certificate %s", keyPath, certPath)
+	}
+
+	return cert, key, nil
+}
+
+// saveCertificateAndKey writes a certificate and its private key as PEM files readable only by the owner
+func saveCertificateAndKey(certPath, keyPath string, cert *x509.Certificate, key *ecdsa.PrivateKey) error {
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal private key: %w", err)
+	}
+
+	if err := writePEMFile(keyPath, "PRIVATE KEY", keyBytes); err != nil {
+		return err
+	}
+	return writePEMFile(certPath, "CERTIFICATE", cert.Raw)
+}
+
+// writePEMFile atomically replaces path with a single PEM block using 0600 permissions
+func writePEMFile(path, blockType string, data []byte) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: data}), 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package p2p
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadOrCreateIdentityPersists(t *testing.T) {
+	dir := t.TempDir()
+
+	first, err := loadOrCreateIdentity(dir)
+	if err != nil {
+		t.Fatalf("Failed to create identity: %v", err)
+	}
+	second, err := loadOrCreateIdentity(dir)
+	if err != nil {
+		t.Fatalf("Failed to reload identity: %v", err)
+	}
+
+	if generateCertificateFingerprint(first.deviceCert) != generateCertificateFingerprint(second.deviceCert) {
+		t.Error("Expected device fingerprint to be stable across loads")
+	}
+	if first.deviceCert.Subject.CommonName != second.deviceCert.Subject.CommonName {
+		t.Error("Expected device ID to be stable across loads")
+	}
+	if generateCertificateFingerprint(first.caCert) != generateCertificateFingerprint(second.caCert) {
+		t.Error("Expected CA fingerprint to be stable across loads")
+	}
+
+	for _, name := range []string{caCertFile, caKeyFile, deviceCertFile, deviceKeyFile} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Expected %s to be written: %v", name, err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("Expected %s to have 0600 permissions, got %v", name, info.Mode().Perm())
+		}
+	}
+}
+
+func TestLoadOrCreateIdentityReplacesCorruptFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	first, err := loadOrCreateIdentity(dir)
+	if err != nil {
+		t.Fatalf("Failed to create identity: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, deviceKeyFile), []byte("garbage"), 0600); err != nil {
+		t.Fatalf("Failed to corrupt key: %v", err)
+	}
+
+	second, err := loadOrCreateIdentity(dir)
+	if err != nil {
+		t.Fatalf("Failed to reload identity: %v", err)
+	}
+	if generateCertificateFingerprint(first.caCert) != generateCertificateFingerprint(second.caCert) {
+		t.Error("Expected the CA to be kept when only the device key is corrupt")
+	}
+	if generateCertificateFingerprint(first.deviceCert) == generateCertificateFingerprint(second.deviceCert) {
+		t.Error("Expected a new device certificate after the key was corrupted")
+	}
+}
+
+func TestLoadOrCreateIdentityRotatesExpiringCertificate(t *testing.T) {
+	dir := t.TempDir()
+
+	identity, err := loadOrCreateIdentity(dir)
+	if err != nil {
+		t.Fatalf("Failed to create identity: %v", err)
+	}
+	deviceID := identity.deviceCert.Subject.CommonName
+
+	// Replace the device certificate with one that expires tomorrow
+	expiring, err := signDeviceCertificate(identity.caCert, identity.caKey, identity.deviceKey, deviceID, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to sign expiring certificate: %v", err)
+	}
+	if err := saveCertificateAndKey(filepath.Join(dir, deviceCertFile), filepath.Join(dir, deviceKeyFile), expiring, identity.deviceKey); err != nil {
+		t.Fatalf("Failed to save expiring certificate: %v", err)
+	}
+
+	rotated, err := loadOrCreateIdentity(dir)
+	if err != nil {
+		t.Fatalf("Failed to reload identity: %v", err)
+	}
+	if rotated.deviceCert.Subject.CommonName != deviceID {
+		t.Errorf("Expected device ID %q to be preserved, got %q", deviceID, rotated.deviceCert.Subject.CommonName)
+	}
+	if !rotated.deviceCert.NotAfter.After(time.Now().Add(CertificateRenewalWindow)) {
+		t.Errorf("Expected renewed certificate, still expires %v", rotated.deviceCert.NotAfter)
+	}
+	if err := rotated.deviceCert.CheckSignatureFrom(identity.caCert); err != nil {
+		t.Errorf("Expected renewed certificate to be signed by the persisted CA: %v", err)
+	}
+
+	// The renewed certificate is persisted, not re-issued on every start
+	reloaded, err := loadOrCreateIdentity(dir)
+	if err != nil {
+		t.Fatalf("Failed to reload identity: %v", err)
+	}
+	if generateCertificateFingerprint(reloaded.deviceCert) != generateCertificateFingerprint(rotated.deviceCert) {
+		t.Error("Expected the renewed certificate to be saved")
+	}
+}
@@ -0,0 +1,74 @@
+package p2p
+
+import (
+	"fmt"
+	"net"
+	"sync"
+)
+
+// bindAddress is the interface IP receivers listen on, set by SetBindAddress; nil means all interfaces
+var bindAddress struct {
+	mutex sync.RWMutex
+	ip    net.IP
+}
+
+// SetBindAddress makes receivers listen on ip only instead of on all interfaces. The IP must be
+// assigned to one of this machine's interfaces; an empty ip restores the default.
+func SetBindAddress(ip string) error {
+	var parsed net.IP
+	if ip != "" {
+		parsed = net.ParseIP(ip)
+		if parsed == nil {
+			return fmt.Errorf("'%s' is not an IP address", ip)
+		}
+		if interfaceNetwork(parsed) == nil {
+			return fmt.Errorf("%w: %s isn't assigned to any interface on this machine", ErrNetworkUnreachable, ip)
+		}
+	}
+
+	bindAddress.mutex.Lock()
+	defer bindAddress.mutex.Unlock()
+	bindAddress.ip = parsed
+	return nil
+}
+
+// BindAddress returns the IP set by SetBindAddress, or nil when receivers listen on all interfaces
+func BindAddress() net.IP {
+	bindAddress.mutex.RLock()
+	defer bindAddress.mutex.RUnlock()
+	return bindAddress.ip
+}
+
+// listenAddress returns the host:port receivers listen on for port
+func listenAddress(port string) string {
+	if ip := BindAddress(); ip != nil {
+		return net.JoinHostPort(ip.String(), port)
+	}
+	return ":" + port
+}
+
+// interfaceNetwork returns the network of the local interface that ip is assigned to, or nil
+func interfaceNetwork(ip net.IP) *net.IPNet {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return ipNet
+		}
+	}
+	return nil
+}
+
+// acceptsDiscoveryFrom reports whether a discovery request from remote reached the bound
+// interface. Broadcasts only arrive on a socket bound to all interfaces, so the discovery
+// listener filters by the sender's network instead of binding to the IP.
+func acceptsDiscoveryFrom(remote net.IP) bool {
+	ip := BindAddress()
+	if ip == nil || remote.IsLoopback() || remote.Equal(ip) {
+		return true
+	}
+	network := interfaceNetwork(ip)
+	return network != nil && network.Contains(remote)
+}
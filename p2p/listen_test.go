@@ -0,0 +1,41 @@
+package p2p
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestSetBindAddress(t *testing.T) {
+	defer SetBindAddress("")
+
+	if listenAddress("8080") != ":8080" {
+		t.Errorf("Expected all interfaces by default, got %s", listenAddress("8080"))
+	}
+	if err := SetBindAddress("not-an-ip"); err == nil {
+		t.Error("Expected an error for a malformed IP")
+	}
+	if err := SetBindAddress("203.0.113.9"); !errors.Is(err, ErrNetworkUnreachable) {
+		t.Errorf("Expected ErrNetworkUnreachable for an IP this machine doesn't have, got %v", err)
+	}
+
+	if err := SetBindAddress("127.0.0.1"); err != nil {
+		t.Fatalf("Failed to bind to loopback: %v", err)
+	}
+	if listenAddress("8080") != "127.0.0.1:8080" {
+		t.Errorf("Expected the bound IP, got %s", listenAddress("8080"))
+	}
+	if !acceptsDiscoveryFrom(net.ParseIP("127.0.0.5")) {
+		t.Error("Expected discovery from the bound network to be answered")
+	}
+	if acceptsDiscoveryFrom(net.ParseIP("10.1.2.3")) {
+		t.Error("Expected discovery from another network to be ignored")
+	}
+
+	// A receiver bound to the IP still accepts connections there
+	listener, err := net.Listen("tcp", listenAddress("0"))
+	if err != nil {
+		t.Fatalf("Failed to listen on the bound address: %v", err)
+	}
+	listener.Close()
+}
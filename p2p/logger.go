@@ -0,0 +1,54 @@
+package p2p
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Logger receives the package's informational output: discovery logs, TLS status and progress.
+// Errors are still returned to the caller; interactive prompts always use the terminal.
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// StdoutLogger writes informational output to standard output, as the landrop CLI does
+type StdoutLogger struct{}
+
+// Printf implements Logger
+func (StdoutLogger) Printf(format string, args ...interface{}) {
+	fmt.Printf(format, args...)
+}
+
+// noopLogger discards everything and is the default for library use
+type noopLogger struct{}
+
+// Printf implements Logger
+func (noopLogger) Printf(format string, args ...interface{}) {}
+
+var (
+	loggerMutex sync.RWMutex
+	logger      Logger = noopLogger{}
+)
+
+// SetLogger routes the package's informational output to l; nil silences it
+func SetLogger(l Logger) {
+	if l == nil {
+		l = noopLogger{}
+	}
+	loggerMutex.Lock()
+	defer loggerMutex.Unlock()
+	logger = l
+}
+
+// logf formats a message like fmt.Printf and sends it to the current logger
+func logf(format string, args ...interface{}) {
+	loggerMutex.RLock()
+	l := logger
+	loggerMutex.RUnlock()
+	l.Printf(format, args...)
+}
+
+// logln formats a message like fmt.Println and sends it to the current logger
+func logln(args ...interface{}) {
+	logf("%s", fmt.Sprintln(args...))
+}
@@ -0,0 +1,38 @@
+package p2p
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type recordingLogger struct {
+	lines []string
+}
+
+func (l *recordingLogger) Printf(format string, args ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func TestSetLogger(t *testing.T) {
+	recorder := &recordingLogger{}
+	SetLogger(recorder)
+	defer SetLogger(nil)
+
+	logf("Found peer %s\n", "laptop")
+	logln("Transfer", "complete")
+
+	if len(recorder.lines) != 2 {
+		t.Fatalf("Expected 2 log lines, got %d", len(recorder.lines))
+	}
+	if recorder.lines[0] != "Found peer laptop\n" || recorder.lines[1] != "Transfer complete\n" {
+		t.Errorf("Unexpected log output: %q", strings.Join(recorder.lines, ""))
+	}
+
+	// A nil logger silences output rather than panicking
+	SetLogger(nil)
+	logf("ignored\n")
+	if len(recorder.lines) != 2 {
+		t.Error("Expected output to stop after SetLogger(nil)")
+	}
+}
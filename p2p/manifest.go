@@ -0,0 +1,129 @@
+package p2p
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ManifestFileSuffix is appended to a received file's name for its chunk manifest
+const ManifestFileSuffix = ".manifest.json"
+
+// ChunkManifest records the checksum of every chunk of a received file, so chunks can be
+// re-verified against the file later without transferring it again
+type ChunkManifest struct {
+	Filename      string          `json:"filename"`
+	FileSize      int64           `json:"filesize"`
+	FileHash      string          `json:"filehash"`
+	HashAlgorithm string          `json:"hash_algorithm"`
+	ChunkSize     int64           `json:"chunk_size"`
+	Chunks        []ManifestChunk `json:"chunks"`
+}
+
+// ManifestChunk is one chunk's entry in a ChunkManifest
+type ManifestChunk struct {
+	Index    int64  `json:"index"`
+	Checksum string `json:"checksum"` // hex hash of the chunk's uncompressed data
+}
+
+// manifestFilePath returns the manifest path for an output file
+func manifestFilePath(outputFilename string) string {
+	return outputFilename + ManifestFileSuffix
+}
+
+// writeManifest writes the manifest for a verified output file. checksums holds the ones received
+// in this session; chunks kept from an earlier, resumed session are hashed from the file instead.
+func writeManifest(outputFilename string, request *TransferRequest, checksums map[int64]string) error {
+	file, err := os.Open(outputFilename)
+	if err != nil {
+		return fmt.Errorf("failed to open file for manifest: %w", err)
+	}
+	defer file.Close()
+
+	manifest := ChunkManifest{
+		Filename:      request.TargetPath(),
+		FileSize:      request.FileSize,
+		FileHash:      request.FileHash,
+		HashAlgorithm: normalizeHashAlgorithm(request.HashAlgorithm),
+		ChunkSize:     request.ChunkSize,
+	}
+	for _, chunkIndex := range allChunks(request.FileSize, request.ChunkSize) {
+		checksum, ok := checksums[int64(chunkIndex)]
+		if !ok {
+			checksum, err = hashChunk(file, manifest.HashAlgorithm, int64(chunkIndex), request.ChunkSize, request.FileSize)
+			if err != nil {
+				return err
+			}
+		}
+		manifest.Chunks = append(manifest.Chunks, ManifestChunk{Index: int64(chunkIndex), Checksum: checksum})
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize manifest: %w", err)
+	}
+	if err := os.WriteFile(manifestFilePath(outputFilename), data, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// ReadManifest loads a chunk manifest written next to a received file
+func ReadManifest(path string) (*ChunkManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var manifest ChunkManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("%w: invalid manifest: %v", ErrFileCorrupted, err)
+	}
+	return &manifest, nil
+}
+
+// Verify re-hashes each chunk of the file at path and returns the indices of those that no
+// longer match the manifest
+func (m *ChunkManifest) Verify(path string) ([]int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+	if info.Size() != m.FileSize {
+		return nil, fmt.Errorf("%w: file is %d bytes, manifest expects %d", ErrFileCorrupted, info.Size(), m.FileSize)
+	}
+
+	var mismatched []int64
+	for _, chunk := range m.Chunks {
+		checksum, err := hashChunk(file, normalizeHashAlgorithm(m.HashAlgorithm), chunk.Index, m.ChunkSize, m.FileSize)
+		if err != nil {
+			return nil, err
+		}
+		if checksum != chunk.Checksum {
+			mismatched = append(mismatched, chunk.Index)
+		}
+	}
+	return mismatched, nil
+}
+
+// hashChunk returns the hex hash of one chunk of file
+func hashChunk(file *os.File, hashAlgorithm string, chunkIndex, chunkSize, fileSize int64) (string, error) {
+	offset := chunkIndex * chunkSize
+	size := min(chunkSize, fileSize-offset)
+	if offset < 0 || size < 0 {
+		return "", fmt.Errorf("%w: chunk %d is outside the file", ErrChunkMissing, chunkIndex)
+	}
+
+	hash := newHash(hashAlgorithm)
+	if _, err := io.Copy(hash, io.NewSectionReader(file, offset, size)); err != nil {
+		return "", fmt.Errorf("failed to read chunk %d: %w", chunkIndex, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
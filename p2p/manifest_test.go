@@ -0,0 +1,119 @@
+package p2p
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReceiverWritesChunkManifest(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	testContent := make([]byte, 3*MinChunkSize+100)
+	for i := range testContent {
+		testContent[i] = byte(i * 31 % 251)
+	}
+	testFile := filepath.Join(t.TempDir(), "audited.bin")
+	if err := os.WriteFile(testFile, testContent, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// Find an available port
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	receiverConfig := DefaultReceiverConfig()
+	receiverConfig.OutputDir = t.TempDir()
+	receiverConfig.WriteManifest = true
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), receiverConfig)
+	}()
+
+	// Give receiver time to start
+	time.Sleep(100 * time.Millisecond)
+
+	senderConfig := DefaultSenderConfig()
+	senderConfig.ChunkSize = MinChunkSize
+	if err := SendFileChunkedWithConfig(testFile, fmt.Sprintf("127.0.0.1:%d", port), senderConfig); err != nil {
+		t.Fatalf("Sender failed: %v", err)
+	}
+	if err := <-receiverDone; err != nil {
+		t.Fatalf("Receiver failed: %v", err)
+	}
+
+	outputFile := filepath.Join(receiverConfig.OutputDir, "received_audited.bin")
+	manifest, err := ReadManifest(outputFile + ManifestFileSuffix)
+	if err != nil {
+		t.Fatalf("Expected a manifest next to the received file: %v", err)
+	}
+	if len(manifest.Chunks) != 4 || manifest.FileHash != calculateTestHash(t, testContent) {
+		t.Fatalf("Expected 4 chunks and the file hash in the manifest, got %d chunks and hash %s", len(manifest.Chunks), manifest.FileHash)
+	}
+	if mismatched, err := manifest.Verify(outputFile); err != nil || len(mismatched) != 0 {
+		t.Fatalf("Expected the received file to match its manifest, got %v (%v)", mismatched, err)
+	}
+
+	// Damage chunk 2 and check that only it is reported
+	file, err := os.OpenFile(outputFile, os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open received file: %v", err)
+	}
+	if _, err := file.WriteAt([]byte{0xff, 0xff}, 2*MinChunkSize+10); err != nil {
+		t.Fatalf("Failed to modify received file: %v", err)
+	}
+	file.Close()
+	mismatched, err := manifest.Verify(outputFile)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if len(mismatched) != 1 || mismatched[0] != 2 {
+		t.Errorf("Expected only chunk 2 to mismatch, got %v", mismatched)
+	}
+}
+
+func TestWriteManifestHashesResumedChunks(t *testing.T) {
+	content := make([]byte, 2*MinChunkSize+5)
+	for i := range content {
+		content[i] = byte(i * 31 % 251)
+	}
+	outputFile := filepath.Join(t.TempDir(), "received_resumed.bin")
+	if err := os.WriteFile(outputFile, content, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	// Only the last chunk arrived in this session; the first two were kept from an earlier one
+	request := NewTransferRequest("resumed.bin", int64(len(content)), calculateTestHash(t, content), MinChunkSize)
+	file, err := os.Open(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	lastChecksum, err := hashChunk(file, HashSHA256, 2, MinChunkSize, int64(len(content)))
+	file.Close()
+	if err != nil {
+		t.Fatalf("Failed to hash chunk: %v", err)
+	}
+	if err := writeManifest(outputFile, request, map[int64]string{2: lastChecksum}); err != nil {
+		t.Fatalf("writeManifest failed: %v", err)
+	}
+
+	manifest, err := ReadManifest(outputFile + ManifestFileSuffix)
+	if err != nil {
+		t.Fatalf("ReadManifest failed: %v", err)
+	}
+	if len(manifest.Chunks) != 3 {
+		t.Fatalf("Expected 3 chunks, got %d", len(manifest.Chunks))
+	}
+	if mismatched, err := manifest.Verify(outputFile); err != nil || len(mismatched) != 0 {
+		t.Errorf("Expected every chunk to verify, got %v (%v)", mismatched, err)
+	}
+}
@@ -0,0 +1,162 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grandcat/zeroconf"
+)
+
+// mDNS/DNS-SD constants
+const (
+	// MDNSServiceType is the DNS-SD service type LanDrop peers register under
+	MDNSServiceType = "_landrop._udp"
+	// MDNSDomain is the mDNS domain used for registration and browsing
+	MDNSDomain = "local."
+	// MDNSEnvVar enables mDNS advertising and merges mDNS results into DiscoverPeers when set to "1"
+	MDNSEnvVar = "LANDROP_MDNS"
+)
+
+// mdnsEnabled reports whether the mDNS backend should be used alongside UDP broadcast
+func mdnsEnabled() bool {
+	return os.Getenv(MDNSEnvVar) == "1"
+}
+
+// AdvertiseMDNS registers this host as a LanDrop peer via mDNS.
+// The TCP port is included in the TXT record so browsers can build the same IP:port as the broadcast path.
+func AdvertiseMDNS(tcpPort string, capabilities ...string) (*zeroconf.Server, error) {
+	port, err := strconv.Atoi(tcpPort)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid port '%s'", ErrDiscoveryFailed, tcpPort)
+	}
+
+	hostname, _ := os.Hostname()
+	instance := fmt.Sprintf("%s-%s", hostname, tcpPort)
+	text := []string{
+		"hostname=" + hostname,
+		"port=" + tcpPort,
+		"version=" + ProtocolVersion,
+	}
+	if len(capabilities) > 0 {
+		text = append(text, "caps="+strings.Join(capabilities, ","))
+	}
+	if deviceInfo := GetDeviceInfo(); deviceInfo != nil {
+		text = append(text, "id="+deviceInfo.DeviceID, "fp="+deviceInfo.Fingerprint)
+	}
+
+	server, err := zeroconf.Register(instance, MDNSServiceType, MDNSDomain, port, text, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: mDNS registration failed: %v", ErrDiscoveryFailed, err)
+	}
+	return server, nil
+}
+
+// DiscoverPeersMDNS browses for LanDrop peers via mDNS for ReplyTimeout.
+// Like DiscoverPeers, the returned map is keyed by Peer.Key.
+func DiscoverPeersMDNS() map[string]Peer {
+	return discoverPeersMDNS(ReplyTimeout)
+}
+
+// discoverPeersMDNS browses for LanDrop peers via mDNS for timeout
+func discoverPeersMDNS(timeout time.Duration) map[string]Peer {
+	peers := make(map[string]Peer)
+
+	resolver, err := zeroconf.NewResolver(nil)
+	if err != nil {
+		logf("Error creating mDNS resolver: %s\n", err)
+		return peers
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	entries := make(chan *zeroconf.ServiceEntry)
+	if err := resolver.Browse(ctx, MDNSServiceType, MDNSDomain, entries); err != nil {
+		logf("Error browsing for mDNS peers: %s\n", err)
+		return peers
+	}
+
+	for {
+		select {
+		case entry, ok := <-entries:
+			if !ok {
+				assignDisplayNames(peers)
+				return peers
+			}
+			if peer, ok := peerFromServiceEntry(entry); ok {
+				logf("Discovery (mDNS): Found peer %s at %s\n", peer.Hostname, peer.IP)
+				peers[peer.Key()] = peer
+			}
+		case <-ctx.Done():
+			assignDisplayNames(peers)
+			return peers
+		}
+	}
+}
+
+// peerFromServiceEntry converts a DNS-SD entry into a Peer, preferring the TXT record fields
+func peerFromServiceEntry(entry *zeroconf.ServiceEntry) (Peer, bool) {
+	if entry == nil {
+		return Peer{}, false
+	}
+
+	var ip net.IP
+	switch {
+	case len(entry.AddrIPv4) > 0:
+		ip = entry.AddrIPv4[0]
+	case len(entry.AddrIPv6) > 0:
+		ip = entry.AddrIPv6[0]
+	default:
+		return Peer{}, false
+	}
+
+	hostname := strings.TrimSuffix(entry.HostName, ".")
+	port := strconv.Itoa(entry.Port)
+	var version, deviceID, fingerprint string
+	var capabilities []string
+	for _, record := range entry.Text {
+		key, value, found := strings.Cut(record, "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "hostname":
+			hostname = value
+		case "port":
+			port = value
+		case "version":
+			version = value
+		case "caps":
+			capabilities = strings.Split(value, ",")
+		case "id":
+			deviceID = value
+		case "fp":
+			fingerprint = value
+		}
+	}
+
+	peer := Peer{
+		Hostname:        hostname,
+		IP:              net.JoinHostPort(ip.String(), port),
+		ProtocolVersion: version,
+		Capabilities:    capabilities,
+		DeviceID:        deviceID,
+		Fingerprint:     fingerprint,
+	}
+	peer.normalize()
+	return peer, true
+}
+
+// mergePeers adds peers found by another discovery backend, keeping existing entries
+func mergePeers(peers map[string]Peer, others map[string]Peer) {
+	for key, peer := range others {
+		if _, exists := peers[key]; !exists {
+			peers[key] = peer
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package p2p
+
+import (
+	"net"
+	"testing"
+
+	"github.com/grandcat/zeroconf"
+)
+
+func TestPeerFromServiceEntry(t *testing.T) {
+	entry := &zeroconf.ServiceEntry{
+		HostName: "laptop.local.",
+		Port:     9000,
+		Text:     []string{"hostname=laptop", "port=8080"},
+		AddrIPv4: []net.IP{net.ParseIP("192.168.1.20")},
+	}
+
+	peer, ok := peerFromServiceEntry(entry)
+	if !ok {
+		t.Fatal("Expected entry with an IPv4 address to produce a peer")
+	}
+	if peer.Hostname != "laptop" || peer.IP != "192.168.1.20:8080" {
+		t.Errorf("Expected laptop at 192.168.1.20:8080, got %s at %s", peer.Hostname, peer.IP)
+	}
+
+	peer, ok = peerFromServiceEntry(&zeroconf.ServiceEntry{
+		HostName: "v6only.local.",
+		Port:     8080,
+		AddrIPv6: []net.IP{net.ParseIP("2001:db8::20")},
+	})
+	if !ok || peer.IP != "[2001:db8::20]:8080" || peer.Port != 8080 {
+		t.Errorf("Expected IPv6-only entry at [2001:db8::20]:8080, got %q (port %d, ok=%v)", peer.IP, peer.Port, ok)
+	}
+
+	if _, ok := peerFromServiceEntry(&zeroconf.ServiceEntry{HostName: "noaddr.local."}); ok {
+		t.Error("Expected entry without any address to be skipped")
+	}
+}
+
+func TestMergePeers(t *testing.T) {
+	peers := map[string]Peer{"laptop": {Hostname: "laptop", IP: "192.168.1.20:8080"}}
+	mergePeers(peers, map[string]Peer{
+		"laptop":  {Hostname: "laptop", IP: "10.0.0.5:8080"},
+		"desktop": {Hostname: "desktop", IP: "192.168.1.30:8080"},
+	})
+
+	if len(peers) != 2 {
+		t.Fatalf("Expected 2 peers after merge, got %d", len(peers))
+	}
+	if peers["laptop"].IP != "192.168.1.20:8080" {
+		t.Errorf("Expected broadcast result to win for laptop, got %s", peers["laptop"].IP)
+	}
+}
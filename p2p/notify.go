@@ -0,0 +1,90 @@
+package p2p
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// TransferEvent is written to the notify socket when a transfer finishes
+type TransferEvent struct {
+	Timestamp time.Time `json:"timestamp"`
+	Direction string    `json:"direction"`
+	Peer      string    `json:"peer"`
+	Filename  string    `json:"filename"`
+	Size      int64     `json:"size"`
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason,omitempty"`
+	// Path is where a received file was saved, or the file that was sent
+	Path string `json:"path,omitempty"`
+	// Hash is the verified file hash, when one was computed
+	Hash string `json:"hash,omitempty"`
+}
+
+var (
+	notifyMutex sync.Mutex
+	notifyPath  string
+)
+
+// SetNotifySocket makes every completed, failed or rejected transfer write a TransferEvent as one
+// line of JSON to the Unix domain socket or named pipe at path. Nothing listening there only
+// produces a warning. An empty path, the default, disables events.
+func SetNotifySocket(path string) {
+	notifyMutex.Lock()
+	defer notifyMutex.Unlock()
+	notifyPath = path
+}
+
+// notifyTransfer sends event to the notify socket, if one is set
+func notifyTransfer(event TransferEvent) {
+	notifyMutex.Lock()
+	defer notifyMutex.Unlock()
+	if notifyPath == "" {
+		return
+	}
+
+	data, err := json.Marshal(event)
+	if err == nil {
+		err = writeNotifyEvent(notifyPath, append(data, '\n'))
+	}
+	if err != nil {
+		logf("Warning: failed to send transfer event: %v\n", err)
+	}
+}
+
+// writeNotifyEvent delivers one event to a socket, stream or datagram, or a named pipe. A pipe is
+// opened without blocking, so a transfer never waits for a reader that isn't there.
+func writeNotifyEvent(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSocket != 0 {
+		conn, err := net.DialTimeout("unix", path, NotifyTimeout)
+		if err != nil {
+			conn, err = net.DialTimeout("unixgram", path, NotifyTimeout)
+		}
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		conn.SetWriteDeadline(time.Now().Add(NotifyTimeout))
+		_, err = conn.Write(data)
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open %s (is anything reading it?): %w", path, err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,100 @@
+package p2p
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNotifySocketReceivesTransferEvents(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	socketPath := filepath.Join(t.TempDir(), "events.sock")
+	socket, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Skipf("Unix sockets unavailable: %v", err)
+	}
+	defer socket.Close()
+	events := make(chan TransferEvent, 4)
+	go func() {
+		for {
+			conn, err := socket.Accept()
+			if err != nil {
+				return
+			}
+			var event TransferEvent
+			if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&event); err == nil {
+				events <- event
+			}
+			conn.Close()
+		}
+	}()
+	SetNotifySocket(socketPath)
+	defer SetNotifySocket("")
+
+	testContent := []byte("notify me when this arrives")
+	testFile := filepath.Join(t.TempDir(), "notify.txt")
+	if err := os.WriteFile(testFile, testContent, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	receiverConfig := DefaultReceiverConfig()
+	receiverConfig.OutputDir = t.TempDir()
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), receiverConfig)
+	}()
+
+	// Give receiver time to start
+	time.Sleep(100 * time.Millisecond)
+
+	if err := SendFileChunkedWithConfig(testFile, fmt.Sprintf("127.0.0.1:%d", port), DefaultSenderConfig()); err != nil {
+		t.Fatalf("Sender failed: %v", err)
+	}
+	if err := <-receiverDone; err != nil {
+		t.Fatalf("Receiver failed: %v", err)
+	}
+
+	// Both ends of the transfer run in this process
+	byDirection := make(map[string]TransferEvent)
+	for len(byDirection) < 2 {
+		select {
+		case event := <-events:
+			byDirection[event.Direction] = event
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected an event from each end, got %v", byDirection)
+		}
+	}
+
+	received := byDirection["received"]
+	expectedHash := calculateTestHash(t, testContent)
+	if received.Status != "completed" || received.Filename != "notify.txt" || received.Hash != expectedHash {
+		t.Errorf("Unexpected receive event: %+v", received)
+	}
+	if received.Path != filepath.Join(receiverConfig.OutputDir, "received_notify.txt") {
+		t.Errorf("Expected the saved path, got %s", received.Path)
+	}
+	if sent := byDirection["sent"]; sent.Path != testFile || sent.Hash != expectedHash {
+		t.Errorf("Unexpected send event: %+v", sent)
+	}
+}
+
+func TestWriteNotifyEventWithoutListener(t *testing.T) {
+	if err := writeNotifyEvent(filepath.Join(t.TempDir(), "missing.sock"), []byte("{}\n")); err == nil {
+		t.Error("Expected an error when nothing is at the path")
+	}
+}
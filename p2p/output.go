@@ -0,0 +1,191 @@
+package p2p
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReceivedFilePrefix is prepended to chunked transfers to avoid clobbering local files
+const ReceivedFilePrefix = "received_"
+
+// sanitizeRelativePath validates a peer-supplied path and returns it in OS-native form.
+// Absolute paths and ".." components are rejected so a malicious peer can't escape the output directory.
+func sanitizeRelativePath(name string) (string, error) {
+	if strings.TrimSpace(name) == "" {
+		return "", fmt.Errorf("%w: empty filename", ErrFileAccessDenied)
+	}
+
+	// Treat both separators as path separators so "..\\" is caught on every platform
+	normalized := strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(normalized, "/") || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("%w: absolute path '%s' not allowed", ErrFileAccessDenied, name)
+	}
+
+	parts := strings.Split(normalized, "/")
+	cleaned := make([]string, 0, len(parts))
+	for _, part := range parts {
+		switch part {
+		case "..":
+			return "", fmt.Errorf("%w: path '%s' contains '..'", ErrFileAccessDenied, name)
+		case "", ".":
+			continue
+		}
+		cleaned = append(cleaned, part)
+	}
+
+	if len(cleaned) == 0 {
+		return "", fmt.Errorf("%w: invalid filename '%s'", ErrFileAccessDenied, name)
+	}
+
+	return filepath.Join(cleaned...), nil
+}
+
+// resolveOutputPath joins the base name of a peer-supplied filename onto the output directory.
+// The TCP protocol only sends single files, so any directory components are dropped.
+func resolveOutputPath(outputDir, name string) (string, error) {
+	relPath, err := sanitizeRelativePath(name)
+	if err != nil {
+		return "", err
+	}
+
+	if outputDir == "" {
+		outputDir = "."
+	}
+	return filepath.Join(outputDir, filepath.Base(relPath)), nil
+}
+
+// resolveChunkedOutputPath returns the output path for a chunked transfer. The received_ prefix is added
+// to the top-level component, so directory transfers land intact under received_<dir>/.
+func resolveChunkedOutputPath(outputDir, name string) (string, error) {
+	relPath, err := sanitizeRelativePath(name)
+	if err != nil {
+		return "", err
+	}
+
+	if outputDir == "" {
+		outputDir = "."
+	}
+
+	parts := strings.Split(relPath, string(filepath.Separator))
+	parts[0] = ReceivedFilePrefix + parts[0]
+	return filepath.Join(append([]string{outputDir}, parts...)...), nil
+}
+
+// topLevelComponent returns the first element of a sanitized relative path
+func topLevelComponent(relPath string) string {
+	return strings.SplitN(relPath, string(filepath.Separator), 2)[0]
+}
+
+// ensureOutputDir creates the output directory if it doesn't exist yet
+func ensureOutputDir(outputDir string) error {
+	if outputDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	return nil
+}
+
+// activeOutputs tracks the output files currently being written, so concurrent transfers
+// of the same name get distinct files instead of interleaving their writes
+type activeOutputs struct {
+	mutex sync.Mutex
+	paths map[string]*activeOutput
+}
+
+// activeOutput is an output file being written
+type activeOutput struct {
+	key      string        // resume key of the transfer writing it
+	released chan struct{} // closed once it's no longer being written
+}
+
+// duplicateTransferGrace is DuplicateTransferGrace, shortened by tests
+var duplicateTransferGrace = DuplicateTransferGrace
+
+// receivingOutputs are the files being written by every receiver in this process, so receivers on
+// different ports sharing an output directory don't write the same file
+var receivingOutputs = newActiveOutputs()
+
+// newActiveOutputs creates an empty set of in-flight output files
+func newActiveOutputs() *activeOutputs {
+	return &activeOutputs{paths: make(map[string]*activeOutput)}
+}
+
+// claim reserves path, or the first numbered variant of it that isn't already being written and
+// that usable accepts, and returns it. If path or a numbered variant is already being written for
+// the same key, the same file is being received twice: claim waits up to duplicateTransferGrace
+// for that transfer to end, since a sender resuming after a drop may be back before the receiver
+// noticed, and otherwise reports false. An empty key is never a duplicate.
+func (a *activeOutputs) claim(path, key string, usable func(path string) bool) (string, bool) {
+	timer := time.NewTimer(duplicateTransferGrace)
+	defer timer.Stop()
+	for {
+		a.mutex.Lock()
+		duplicate := a.duplicateOf(path, key)
+		if duplicate == nil {
+			claimed := path
+			for n := 1; a.paths[claimed] != nil || !usable(claimed); n++ {
+				claimed = numberedPath(path, n)
+			}
+			a.paths[claimed] = &activeOutput{key: key, released: make(chan struct{})}
+			a.mutex.Unlock()
+			return claimed, true
+		}
+		a.mutex.Unlock()
+
+		select {
+		case <-duplicate.released:
+		case <-timer.C:
+			return "", false
+		}
+	}
+}
+
+// duplicateOf returns the transfer writing path, or a numbered variant of it, for key. a.mutex
+// must be held.
+func (a *activeOutputs) duplicateOf(path, key string) *activeOutput {
+	if key == "" {
+		return nil
+	}
+	ext := filepath.Ext(path)
+	variantPrefix := strings.TrimSuffix(path, ext) + " ("
+	for claimed, output := range a.paths {
+		if output.key != key {
+			continue
+		}
+		if claimed == path || (strings.HasPrefix(claimed, variantPrefix) && strings.HasSuffix(claimed, ")"+ext)) {
+			return output
+		}
+	}
+	return nil
+}
+
+// release marks a claimed output file as no longer being written
+func (a *activeOutputs) release(path string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if output, ok := a.paths[path]; ok {
+		close(output.released)
+		delete(a.paths, path)
+	}
+}
+
+// numberedPath inserts " (n)" before the extension: received_foo.txt becomes received_foo (1).txt
+func numberedPath(path string, n int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(path, ext), n, ext)
+}
+
+// availableOutputPath returns path, or the first numbered variant of it that usable accepts
+func availableOutputPath(path string, usable func(path string) bool) string {
+	candidate := path
+	for n := 1; !usable(candidate); n++ {
+		candidate = numberedPath(path, n)
+	}
+	return candidate
+}
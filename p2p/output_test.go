@@ -0,0 +1,198 @@
+package p2p
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResolveOutputPath(t *testing.T) {
+	outputDir := filepath.Join("downloads", "landrop")
+
+	valid := map[string]string{
+		"report.pdf":     filepath.Join(outputDir, "report.pdf"),
+		"./notes.txt":    filepath.Join(outputDir, "notes.txt"),
+		"photos/cat.jpg": filepath.Join(outputDir, "cat.jpg"),
+		"a\\b\\c.txt":    filepath.Join(outputDir, "c.txt"),
+	}
+	for name, expected := range valid {
+		path, err := resolveOutputPath(outputDir, name)
+		if err != nil {
+			t.Errorf("Expected '%s' to be accepted, got error: %v", name, err)
+			continue
+		}
+		if path != expected {
+			t.Errorf("Expected '%s' to resolve to %s, got %s", name, expected, path)
+		}
+	}
+
+	invalid := []string{
+		"",
+		".",
+		"../../etc/passwd",
+		"photos/../../secret",
+		"..\\..\\windows\\system32",
+		"/etc/passwd",
+	}
+	for _, name := range invalid {
+		if path, err := resolveOutputPath(outputDir, name); err == nil {
+			t.Errorf("Expected '%s' to be rejected, got path %s", name, path)
+		}
+	}
+}
+
+func TestResolveChunkedOutputPath(t *testing.T) {
+	path, err := resolveChunkedOutputPath("", "report.pdf")
+	if err != nil {
+		t.Fatalf("Failed to resolve chunked output path: %v", err)
+	}
+	if path != "received_report.pdf" {
+		t.Errorf("Expected received_report.pdf, got %s", path)
+	}
+
+	// Directory transfers keep their structure under the prefixed top-level directory
+	path, err = resolveChunkedOutputPath("out", "photos/cat.jpg")
+	if err != nil {
+		t.Fatalf("Failed to resolve chunked output path: %v", err)
+	}
+
+	expected := filepath.Join("out", "received_photos", "cat.jpg")
+	if path != expected {
+		t.Errorf("Expected %s, got %s", expected, path)
+	}
+}
+
+func TestActiveOutputsClaim(t *testing.T) {
+	outputs := newActiveOutputs()
+	path := filepath.Join("downloads", "received_foo.txt")
+	free := func(string) bool { return true }
+
+	first, _ := outputs.claim(path, "first", free)
+	second, _ := outputs.claim(path, "second", free)
+	if first != path {
+		t.Errorf("Expected first claim to get %s, got %s", path, first)
+	}
+	if expected := filepath.Join("downloads", "received_foo (1).txt"); second != expected {
+		t.Errorf("Expected concurrent claim to get %s, got %s", expected, second)
+	}
+
+	outputs.release(first)
+	if again, _ := outputs.claim(path, "first", free); again != path {
+		t.Errorf("Expected released path to be reusable, got %s", again)
+	}
+}
+
+func TestActiveOutputsRejectsDuplicateTransfers(t *testing.T) {
+	duplicateTransferGrace = 100 * time.Millisecond
+	defer func() { duplicateTransferGrace = DuplicateTransferGrace }()
+
+	outputs := newActiveOutputs()
+	path := filepath.Join("downloads", "received_foo.txt")
+	free := func(string) bool { return true }
+
+	first, _ := outputs.claim(path, "same-file", free)
+	if _, ok := outputs.claim(path, "same-file", free); ok {
+		t.Error("Expected the same file to be refused while it's being received")
+	}
+	// A numbered copy written for the same file counts too
+	numbered, _ := outputs.claim(path, "other-file", free)
+	outputs.release(first)
+	if claimed, ok := outputs.claim(numbered, "other-file", free); ok {
+		t.Errorf("Expected the file being written to %s to be refused, got %s", numbered, claimed)
+	}
+	outputs.release(numbered)
+
+	// A transfer that ends within the grace period makes way for the next one
+	held, _ := outputs.claim(path, "same-file", free)
+	time.AfterFunc(20*time.Millisecond, func() { outputs.release(held) })
+	if claimed, ok := outputs.claim(path, "same-file", free); !ok || claimed != path {
+		t.Errorf("Expected the claim to wait for the earlier transfer, got %s (%v)", claimed, ok)
+	}
+}
+
+func TestCanWriteChunkedOutput(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte("the incoming file")
+	request := NewTransferRequest("foo.txt", int64(len(content)), calculateTestHash(t, content), 4)
+
+	path := filepath.Join(dir, "received_foo.txt")
+	if !canWriteChunkedOutput(path, request) {
+		t.Error("Expected a missing file to be writable")
+	}
+
+	// An unrelated file with the same name is kept
+	if err := os.WriteFile(path, []byte("something else entirely"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if canWriteChunkedOutput(path, request) {
+		t.Error("Expected an unrelated file not to be overwritten")
+	}
+	if next := availableOutputPath(path, func(p string) bool { return canWriteChunkedOutput(p, request) }); next != filepath.Join(dir, "received_foo (1).txt") {
+		t.Errorf("Expected numbered output path, got %s", next)
+	}
+
+	os.Remove(path)
+
+	// A partial download of the same file, recorded by its sidecar, is resumed
+	partialPath := partialFilePath(path)
+	if err := os.WriteFile(partialPath, make([]byte, len(content)), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	progress := newChunkProgress(partialPath, request.FileHash, request.FileSize, request.ChunkSize, []int{0, 1, 2, 3, 4})
+	if err := progress.save(); err != nil {
+		t.Fatalf("Failed to save progress: %v", err)
+	}
+	if !canWriteChunkedOutput(path, request) {
+		t.Error("Expected a partial download of the same file to be resumable")
+	}
+
+	// A partial download of another file is kept so it can still resume
+	other := NewTransferRequest("foo.txt", int64(len(content)), calculateTestHash(t, []byte("other")), 4)
+	if canWriteChunkedOutput(path, other) {
+		t.Error("Expected another transfer's partial download not to be overwritten")
+	}
+	progress.remove()
+	os.Remove(partialPath)
+
+	// An identical complete copy is reused
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if !canWriteChunkedOutput(path, request) {
+		t.Error("Expected an identical copy to be reusable")
+	}
+
+	// Without an upfront hash the copy can't be recognized, but a partial download still resumes
+	deferred := NewTransferRequest("foo.txt", int64(len(content)), "", 4)
+	deferred.HashTrailer = true
+	deferred.SourceID = "source-1"
+	if canWriteChunkedOutput(path, deferred) {
+		t.Error("Expected a complete file not to be reused without a hash")
+	}
+	os.Remove(path)
+	if err := os.WriteFile(partialPath, content[:4], 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	progress = newChunkProgress(partialPath, deferred.resumeKey(), deferred.FileSize, deferred.ChunkSize, []int{4})
+	if err := progress.save(); err != nil {
+		t.Fatalf("Failed to save progress: %v", err)
+	}
+	if !canWriteChunkedOutput(path, deferred) {
+		t.Error("Expected a partial download with the same source ID to be resumable")
+	}
+}
+
+// calculateTestHash returns the SHA-256 hex digest transfer requests carry
+func calculateTestHash(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hash-input")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	hash, err := calculateFileHash(path)
+	if err != nil {
+		t.Fatalf("Failed to hash file: %v", err)
+	}
+	return hash
+}
@@ -0,0 +1,241 @@
+package p2p
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Pairing PIN parameters. A PIN works once, for PairingPINLifetime, and only pairingMaxAttempts
+// wrong ones are accepted before it's revoked. The PBKDF2 stretching is only a speed bump: a 6-digit
+// PIN has a million values, so anyone who obtains a proof, say by posing as the receiver, can still
+// brute-force it offline, with a GPU well within the PIN's lifetime.
+const (
+	PairingPINDigits    = 6
+	PairingPINLifetime  = 5 * time.Minute
+	pairingMaxAttempts  = 5
+	pairingIterations   = 200000
+	pairingProofPrefix  = "LanDrop Pairing "
+	pairingProofContext = "landrop-pairing-v1"
+)
+
+// pairingState is the PIN a receiver expects from new devices, set by EnablePairingPIN
+type pairingState struct {
+	mutex     sync.Mutex
+	pin       string
+	expiresAt time.Time
+	failures  int
+	active    bool
+}
+
+var receiverPairing pairingState
+
+// senderPairingPIN is the PIN a sender proves to receivers, set by SetSenderPairingPIN
+var senderPairingPIN struct {
+	mutex sync.Mutex
+	pin   string
+}
+
+// EnablePairingPIN generates a random PIN and requires it from every device that isn't trusted
+// yet. It replaces auto-trust and the strict mode prompt until the PIN is used, expires or has
+// been guessed wrongly too often, after which new devices are rejected.
+func EnablePairingPIN() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < PairingPINDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate pairing PIN: %w", err)
+	}
+	pin := fmt.Sprintf("%0*d", PairingPINDigits, n)
+
+	receiverPairing.mutex.Lock()
+	defer receiverPairing.mutex.Unlock()
+	receiverPairing.pin = pin
+	receiverPairing.expiresAt = time.Now().Add(PairingPINLifetime)
+	receiverPairing.failures = 0
+	receiverPairing.active = true
+	return pin, nil
+}
+
+// disablePairingPIN turns pairing mode off again, restoring the default trust behavior
+func disablePairingPIN() {
+	receiverPairing.mutex.Lock()
+	defer receiverPairing.mutex.Unlock()
+	receiverPairing.pin = ""
+	receiverPairing.failures = 0
+	receiverPairing.active = false
+}
+
+// pairingPINEnabled reports whether EnablePairingPIN has put this receiver in pairing mode
+func pairingPINEnabled() bool {
+	receiverPairing.mutex.Lock()
+	defer receiverPairing.mutex.Unlock()
+	return receiverPairing.active
+}
+
+// SetSenderPairingPIN makes outgoing connections prove pin to the receiver, or stop proving one when pin is empty
+func SetSenderPairingPIN(pin string) error {
+	if pin != "" {
+		if err := ValidatePairingPIN(pin); err != nil {
+			return err
+		}
+	}
+	senderPairingPIN.mutex.Lock()
+	defer senderPairingPIN.mutex.Unlock()
+	senderPairingPIN.pin = pin
+	return nil
+}
+
+// currentSenderPairingPIN returns the PIN set by SetSenderPairingPIN
+func currentSenderPairingPIN() string {
+	senderPairingPIN.mutex.Lock()
+	defer senderPairingPIN.mutex.Unlock()
+	return senderPairingPIN.pin
+}
+
+// ValidatePairingPIN checks that pin looks like a PIN shown by EnablePairingPIN
+func ValidatePairingPIN(pin string) error {
+	if len(pin) != PairingPINDigits {
+		return fmt.Errorf("pairing PIN must be %d digits", PairingPINDigits)
+	}
+	for _, c := range pin {
+		if c < '0' || c > '9' {
+			return fmt.Errorf("pairing PIN must be %d digits", PairingPINDigits)
+		}
+	}
+	return nil
+}
+
+// pairingProof derives the value a certificate for publicKeyDER carries to prove the PIN. It's
+// bound to the key, so a proof copied into another certificate is useless without that key.
+func pairingProof(pin string, publicKeyDER []byte) (string, error) {
+	salt := append([]byte(pairingProofContext), publicKeyDER...)
+	key, err := pbkdf2.Key(sha256.New, pin, salt, pairingIterations, sha256.Size)
+	if err != nil {
+		return "", fmt.Errorf("failed to derive pairing proof: %w", err)
+	}
+	return hex.EncodeToString(key), nil
+}
+
+// certificatePairingProof returns the pairing proof carried in cert, if any
+func certificatePairingProof(cert *x509.Certificate) string {
+	for _, unit := range cert.Subject.OrganizationalUnit {
+		if proof, ok := strings.CutPrefix(unit, pairingProofPrefix); ok {
+			return proof
+		}
+	}
+	return ""
+}
+
+// checkPairingProof reports whether pairing mode is on and, if so, whether cert proves the
+// receiver's PIN. A successful pairing uses the PIN up.
+func checkPairingProof(cert *x509.Certificate) (bool, error) {
+	receiverPairing.mutex.Lock()
+	defer receiverPairing.mutex.Unlock()
+
+	if !receiverPairing.active {
+		return false, nil
+	}
+	if receiverPairing.pin == "" {
+		return true, fmt.Errorf("%w: pairing PIN has already been used; restart with --pin to pair another device", ErrCertificateInvalid)
+	}
+	if time.Now().After(receiverPairing.expiresAt) {
+		return true, fmt.Errorf("%w: pairing PIN has expired; restart with --pin for a new one", ErrCertificateInvalid)
+	}
+
+	presented := certificatePairingProof(cert)
+	if presented == "" {
+		return true, fmt.Errorf("%w: %s didn't provide a pairing PIN (send with --pin)", ErrCertificateInvalid, cert.Subject.CommonName)
+	}
+	expected, err := pairingProof(receiverPairing.pin, cert.RawSubjectPublicKeyInfo)
+	if err != nil {
+		return true, err
+	}
+	if subtle.ConstantTimeCompare([]byte(presented), []byte(expected)) != 1 {
+		receiverPairing.failures++
+		if receiverPairing.failures >= pairingMaxAttempts {
+			receiverPairing.pin = ""
+			return true, fmt.Errorf("%w: wrong pairing PIN from %s; too many attempts, PIN revoked", ErrCertificateInvalid, cert.Subject.CommonName)
+		}
+		return true, fmt.Errorf("%w: wrong pairing PIN from %s", ErrCertificateInvalid, cert.Subject.CommonName)
+	}
+
+	receiverPairing.pin = ""
+	return true, nil
+}
+
+// signPairingCertificate re-issues the device certificate with a proof of pin, keeping the device
+// ID and key so the receiver's trust store entry stays valid once the PIN is gone
+func signPairingCertificate(identity *deviceIdentity, pin string) (*x509.Certificate, error) {
+	proof, err := pairingProof(pin, identity.deviceCert.RawSubjectPublicKeyInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate pairing serial number: %w", err)
+	}
+
+	deviceCert := identity.deviceCert
+	subject := deviceCert.Subject
+	subject.OrganizationalUnit = []string{pairingProofPrefix + proof}
+	subject.Names = nil
+	template := x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               subject,
+		NotBefore:             deviceCert.NotBefore,
+		NotAfter:              deviceCert.NotAfter,
+		KeyUsage:              deviceCert.KeyUsage,
+		ExtKeyUsage:           deviceCert.ExtKeyUsage,
+		BasicConstraintsValid: true,
+		IPAddresses:           deviceCert.IPAddresses,
+		DNSNames:              deviceCert.DNSNames,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, identity.caCert, &identity.deviceKey.PublicKey, identity.caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate pairing certificate: %w", err)
+	}
+	return x509.ParseCertificate(der)
+}
+
+// pairingClientConfig returns the client config presenting a pairing certificate for pin
+func (tm *TLSManager) pairingClientConfig(pin string) (*tls.Config, error) {
+	if tm.caKey == nil || tm.deviceCert == nil {
+		return nil, fmt.Errorf("pairing requires a device certificate")
+	}
+
+	tm.pairingMutex.Lock()
+	defer tm.pairingMutex.Unlock()
+	if tm.pairingConfig != nil && tm.pairingPIN == pin {
+		return tm.pairingConfig, nil
+	}
+
+	identity := &deviceIdentity{caCert: tm.caCert, caKey: tm.caKey, deviceCert: tm.deviceCert, deviceKey: tm.deviceKey}
+	cert, err := signPairingCertificate(identity, pin)
+	if err != nil {
+		return nil, err
+	}
+
+	config := tm.clientConfig.Clone()
+	config.Certificates = []tls.Certificate{{
+		Certificate: [][]byte{cert.Raw},
+		PrivateKey:  tm.deviceKey,
+		Leaf:        cert,
+	}}
+	tm.pairingConfig = config
+	tm.pairingPIN = pin
+	return config, nil
+}
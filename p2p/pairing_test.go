@@ -0,0 +1,182 @@
+package p2p
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newForeignIdentity creates a device identity for another host with its own CA
+func newForeignIdentity(t *testing.T, hostname string) *deviceIdentity {
+	t.Helper()
+
+	caCert, caKey, err := generateCertificateAuthority()
+	if err != nil {
+		t.Fatalf("Failed to generate CA: %v", err)
+	}
+	deviceKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	deviceCert, err := signDeviceCertificate(caCert, caKey, deviceKey, hostname+" (abcd1234)", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to sign certificate: %v", err)
+	}
+	return &deviceIdentity{caCert: caCert, caKey: caKey, deviceCert: deviceCert, deviceKey: deviceKey}
+}
+
+func TestPairingPINGatesNewDevices(t *testing.T) {
+	ourCA, _, err := generateCertificateAuthority()
+	if err != nil {
+		t.Fatalf("Failed to generate CA: %v", err)
+	}
+	store := NewFileTrustStore(filepath.Join(t.TempDir(), "trusted_peers.json"))
+	verify := verifyPeerCertificateWithTrustStore(ourCA, store)
+
+	pin, err := EnablePairingPIN()
+	if err != nil {
+		t.Fatalf("Failed to enable pairing: %v", err)
+	}
+	defer disablePairingPIN()
+	if err := ValidatePairingPIN(pin); err != nil {
+		t.Fatalf("Generated PIN %q is invalid: %v", pin, err)
+	}
+
+	// Without a proof, a new device is no longer auto-trusted
+	peer := newForeignIdentity(t, "pairing-peer-host")
+	if err := verify([][]byte{peer.deviceCert.Raw}, nil); !errors.Is(err, ErrCertificateInvalid) {
+		t.Fatalf("Expected ErrCertificateInvalid without a PIN, got %v", err)
+	}
+
+	wrongPIN := "000000"
+	if pin == wrongPIN {
+		wrongPIN = "111111"
+	}
+	wrong, err := signPairingCertificate(peer, wrongPIN)
+	if err != nil {
+		t.Fatalf("Failed to sign pairing certificate: %v", err)
+	}
+	if err := verify([][]byte{wrong.Raw}, nil); !errors.Is(err, ErrCertificateInvalid) {
+		t.Fatalf("Expected ErrCertificateInvalid for a wrong PIN, got %v", err)
+	}
+	if store.IsTrusted(peer.deviceCert.Subject.CommonName) {
+		t.Fatal("Expected a device with the wrong PIN to stay untrusted")
+	}
+
+	paired, err := signPairingCertificate(peer, pin)
+	if err != nil {
+		t.Fatalf("Failed to sign pairing certificate: %v", err)
+	}
+	if err := verify([][]byte{paired.Raw}, nil); err != nil {
+		t.Fatalf("Expected the right PIN to pair, got %v", err)
+	}
+	if !store.IsTrusted(peer.deviceCert.Subject.CommonName) {
+		t.Fatal("Expected the paired device to be trusted")
+	}
+
+	// The trusted device reconnects with its regular certificate, and the PIN can't pair another
+	if err := verify([][]byte{peer.deviceCert.Raw}, nil); err != nil {
+		t.Errorf("Expected the paired device's own certificate to verify, got %v", err)
+	}
+	other := newForeignIdentity(t, "second-peer-host")
+	reused, err := signPairingCertificate(other, pin)
+	if err != nil {
+		t.Fatalf("Failed to sign pairing certificate: %v", err)
+	}
+	if err := verify([][]byte{reused.Raw}, nil); !errors.Is(err, ErrCertificateInvalid) {
+		t.Errorf("Expected a used PIN to be rejected, got %v", err)
+	}
+}
+
+func TestPairingProofIsBoundToKey(t *testing.T) {
+	first := newForeignIdentity(t, "first-host")
+	second := newForeignIdentity(t, "second-host")
+
+	cert, err := signPairingCertificate(first, "123456")
+	if err != nil {
+		t.Fatalf("Failed to sign pairing certificate: %v", err)
+	}
+	proof := certificatePairingProof(cert)
+	if proof == "" || cert.Subject.CommonName != first.deviceCert.Subject.CommonName {
+		t.Fatalf("Expected a proof under the original device ID, got %q for %s", proof, cert.Subject.CommonName)
+	}
+
+	other, err := pairingProof("123456", second.deviceCert.RawSubjectPublicKeyInfo)
+	if err != nil {
+		t.Fatalf("Failed to derive proof: %v", err)
+	}
+	if other == proof {
+		t.Error("Expected different keys to get different proofs for the same PIN")
+	}
+
+	for _, pin := range []string{"12345", "1234567", "12a456"} {
+		if err := ValidatePairingPIN(pin); err == nil {
+			t.Errorf("Expected %q to be rejected", pin)
+		}
+	}
+}
+
+func TestPairingTLSHandshake(t *testing.T) {
+	t.Setenv("LANDROP_TESTING_MODE", "")
+
+	t.Setenv("HOME", t.TempDir())
+	serverManager, err := NewTLSManager(NewFileTrustStore(filepath.Join(t.TempDir(), "server.json")))
+	if err != nil {
+		t.Fatalf("Failed to create server TLS manager: %v", err)
+	}
+	t.Setenv("HOME", t.TempDir())
+	clientStore := NewFileTrustStore(filepath.Join(t.TempDir(), "client.json"))
+	clientManager, err := NewTLSManager(clientStore)
+	if err != nil {
+		t.Fatalf("Failed to create client TLS manager: %v", err)
+	}
+	// Only the receiver enables a PIN, but here that's the whole process, so the client would
+	// demand one from the server too unless it already trusts it
+	if err := clientStore.AddTrustedPeer(&TrustedPeer{
+		DeviceID:    serverManager.deviceCert.Subject.CommonName,
+		Fingerprint: generateCertificateFingerprint(serverManager.deviceCert),
+	}); err != nil {
+		t.Fatalf("Failed to add trusted peer: %v", err)
+	}
+
+	pin, err := EnablePairingPIN()
+	if err != nil {
+		t.Fatalf("Failed to enable pairing: %v", err)
+	}
+	defer disablePairingPIN()
+	clientConfig, err := clientManager.pairingClientConfig(pin)
+	if err != nil {
+		t.Fatalf("Failed to create pairing config: %v", err)
+	}
+
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	server := tls.Server(serverConn, serverManager.GetServerConfig())
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.Handshake()
+	}()
+	if err := tls.Client(clientConn, clientConfig).Handshake(); err != nil {
+		t.Fatalf("Client handshake failed: %v", err)
+	}
+	if err := <-serverErr; err != nil {
+		t.Fatalf("Server handshake failed: %v", err)
+	}
+
+	// What matters here is that the pairing certificate is what went over the wire
+	peerCerts := server.ConnectionState().PeerCertificates
+	if len(peerCerts) == 0 || certificatePairingProof(peerCerts[0]) == "" {
+		t.Fatal("Expected the sender to present its pairing certificate")
+	}
+	if peerCerts[0].Subject.CommonName != clientManager.deviceCert.Subject.CommonName {
+		t.Errorf("Expected the pairing certificate to keep device ID %s, got %s", clientManager.deviceCert.Subject.CommonName, peerCerts[0].Subject.CommonName)
+	}
+}
@@ -0,0 +1,71 @@
+package p2p
+
+import (
+	"sort"
+	"time"
+)
+
+// DefaultWatchInterval is how often discover --watch broadcasts
+const DefaultWatchInterval = 5 * time.Second
+
+// PeerTracker keeps the peers seen across repeated discovery rounds. A peer that misses a round
+// isn't dropped until it hasn't answered for the staleness threshold, since single UDP replies
+// can be lost.
+type PeerTracker struct {
+	staleAfter time.Duration
+	peers      map[string]Peer
+	lastSeen   map[string]time.Time
+}
+
+// NewPeerTracker creates a tracker that forgets peers not seen for staleAfter
+func NewPeerTracker(staleAfter time.Duration) *PeerTracker {
+	return &PeerTracker{
+		staleAfter: staleAfter,
+		peers:      make(map[string]Peer),
+		lastSeen:   make(map[string]time.Time),
+	}
+}
+
+// Update records the peers found by a discovery round at now and returns those that appeared
+// and those that went stale, each sorted by display name
+func (t *PeerTracker) Update(found map[string]Peer, now time.Time) (added, removed []Peer) {
+	for key, peer := range found {
+		if _, known := t.peers[key]; !known {
+			added = append(added, peer)
+		}
+		t.peers[key] = peer
+		t.lastSeen[key] = now
+	}
+
+	for key, peer := range t.peers {
+		if now.Sub(t.lastSeen[key]) > t.staleAfter {
+			removed = append(removed, peer)
+			delete(t.peers, key)
+			delete(t.lastSeen, key)
+		}
+	}
+
+	sortPeersByName(added)
+	sortPeersByName(removed)
+	return added, removed
+}
+
+// Peers returns the peers currently considered present, sorted by display name
+func (t *PeerTracker) Peers() []Peer {
+	peers := make([]Peer, 0, len(t.peers))
+	for _, peer := range t.peers {
+		peers = append(peers, peer)
+	}
+	sortPeersByName(peers)
+	return peers
+}
+
+// sortPeersByName orders peers by display name, then address
+func sortPeersByName(peers []Peer) {
+	sort.Slice(peers, func(i, j int) bool {
+		if peers[i].DisplayName != peers[j].DisplayName {
+			return peers[i].DisplayName < peers[j].DisplayName
+		}
+		return peers[i].IP < peers[j].IP
+	})
+}
@@ -0,0 +1,39 @@
+package p2p
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeerTrackerReportsChanges(t *testing.T) {
+	tracker := NewPeerTracker(10 * time.Second)
+	start := time.Now()
+	alpha := Peer{Hostname: "alpha", DisplayName: "alpha", IP: "192.168.1.10:8080", DeviceID: "a"}
+	beta := Peer{Hostname: "beta", DisplayName: "beta", IP: "192.168.1.11:8080", DeviceID: "b"}
+
+	added, removed := tracker.Update(map[string]Peer{"a": alpha, "b": beta}, start)
+	if len(added) != 2 || added[0].Hostname != "alpha" || added[1].Hostname != "beta" || len(removed) != 0 {
+		t.Fatalf("Expected both peers to appear, got added %v removed %v", added, removed)
+	}
+
+	// Missing one round within the threshold isn't a departure
+	added, removed = tracker.Update(map[string]Peer{"a": alpha}, start.Add(5*time.Second))
+	if len(added) != 0 || len(removed) != 0 {
+		t.Fatalf("Expected no changes, got added %v removed %v", added, removed)
+	}
+
+	// Beta was last seen 12s ago, past the threshold
+	added, removed = tracker.Update(map[string]Peer{"a": alpha}, start.Add(12*time.Second))
+	if len(added) != 0 || len(removed) != 1 || removed[0].Hostname != "beta" {
+		t.Fatalf("Expected beta to go stale, got added %v removed %v", added, removed)
+	}
+	if peers := tracker.Peers(); len(peers) != 1 || peers[0].Hostname != "alpha" {
+		t.Errorf("Expected only alpha to remain, got %v", peers)
+	}
+
+	// A returning peer is reported again
+	added, _ = tracker.Update(map[string]Peer{"a": alpha, "b": beta}, start.Add(15*time.Second))
+	if len(added) != 1 || added[0].Hostname != "beta" {
+		t.Errorf("Expected beta to reappear, got %v", added)
+	}
+}
@@ -0,0 +1,113 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// PingPeer opens a short-lived QUIC connection to a chunked receiver at addr and exchanges device
+// info with it, confirming that its listener is up and that the TLS handshake (and with it the
+// trust relationship) succeeds before any transfer is attempted
+func PingPeer(addr string) (DeviceInfo, error) {
+	return PingPeerContext(context.Background(), addr)
+}
+
+// PingPeerContext is PingPeer with a context. The exchange is bounded by PingTimeout.
+func PingPeerContext(ctx context.Context, addr string) (DeviceInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, PingTimeout)
+	defer cancel()
+
+	conn, err := dialWithRetry(ctx, addr, GetClientTLSConfig(), 1, PingTimeout)
+	if err != nil {
+		return DeviceInfo{}, err
+	}
+	defer conn.CloseWithError(0, "")
+
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return DeviceInfo{}, fmt.Errorf("failed to open control stream: %w", err)
+	}
+	// Reads on the stream don't take a context
+	if deadline, ok := ctx.Deadline(); ok {
+		stream.SetDeadline(deadline)
+	}
+
+	return exchangePing(conn, stream, false, addr)
+}
+
+// exchangePing sends a PING as the last message on stream and reads the PONG. The receiver then
+// treats the connection as a check rather than a transfer.
+func exchangePing(conn quic.Connection, stream quic.Stream, framed bool, addr string) (DeviceInfo, error) {
+	if err := writeControlMessage(stream, NewPeerPing(MessagePing, localDeviceInfo()), framed); err != nil {
+		return DeviceInfo{}, fmt.Errorf("failed to send ping: %w", err)
+	}
+	stream.Close()
+
+	// The certificate is what the handshake verified, so it wins over what the peer claims
+	certInfo := certificateDeviceInfo(conn)
+	messageType, data, err := readControlMessage(stream)
+	if err == nil && messageType != MessagePong {
+		err = fmt.Errorf("unexpected %s", messageType)
+	}
+	if err != nil {
+		return certInfo, fmt.Errorf("%w: %s accepted the connection but didn't answer the ping, it may predate ping support: %v", ErrProtocolMismatch, addr, err)
+	}
+	pong, err := DeserializePeerPing(data, MessagePong)
+	if err != nil {
+		return certInfo, err
+	}
+
+	device := pong.Device
+	if certInfo.Fingerprint != "" {
+		device.DeviceID = certInfo.DeviceID
+		device.Fingerprint = certInfo.Fingerprint
+	}
+	return device, nil
+}
+
+// answerPing replies to a PingPeer check with this device's info, ending the session
+func (s *receiveSession) answerPing(data []byte) error {
+	ping, err := DeserializePeerPing(data, MessagePing)
+	if err != nil {
+		return err
+	}
+	logf("Ping from %s (%s)\n", ping.Device.Hostname, s.peerAddr)
+	s.pinged = true
+	s.framed = supportsFraming(ping.ProtocolVersion)
+
+	if err := writeControlMessage(s.controlStream, NewPeerPing(MessagePong, localDeviceInfo()), s.framed); err != nil {
+		return fmt.Errorf("failed to answer ping: %w", err)
+	}
+	// Let the pong reach the peer before the connection is closed
+	s.controlStream.Close()
+	waitForPeerClose(s.conn, 2*time.Second)
+	return nil
+}
+
+// localDeviceInfo returns this device's info, with just the hostname before InitializeTLS
+func localDeviceInfo() DeviceInfo {
+	if deviceInfo := GetDeviceInfo(); deviceInfo != nil {
+		return *deviceInfo
+	}
+	hostname, _ := os.Hostname()
+	return DeviceInfo{Hostname: hostname}
+}
+
+// certificateDeviceInfo returns the device ID and fingerprint of the certificate the peer
+// authenticated with, or an empty DeviceInfo if it presented none
+func certificateDeviceInfo(conn quic.Connection) DeviceInfo {
+	certs := conn.ConnectionState().TLS.PeerCertificates
+	if len(certs) == 0 {
+		return DeviceInfo{}
+	}
+	return DeviceInfo{
+		DeviceID:    certs[0].Subject.CommonName,
+		Hostname:    extractHostnameFromCN(certs[0].Subject.CommonName),
+		Fingerprint: generateCertificateFingerprint(certs[0]),
+		CreatedAt:   certs[0].NotBefore.Unix(),
+	}
+}
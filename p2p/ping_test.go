@@ -0,0 +1,82 @@
+package p2p
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPingPeerBeforeTransfer(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	testContent := []byte("sent after a ping")
+	testFile := filepath.Join(t.TempDir(), "pinged.txt")
+	if err := os.WriteFile(testFile, testContent, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// Find an available port
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	receiverConfig := DefaultReceiverConfig()
+	receiverConfig.OutputDir = t.TempDir()
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), receiverConfig)
+	}()
+
+	// Give receiver time to start
+	time.Sleep(100 * time.Millisecond)
+
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	info, err := PingPeer(addr)
+	if err != nil {
+		t.Fatalf("Ping failed: %v", err)
+	}
+	if hostname, _ := os.Hostname(); info.Hostname != hostname {
+		t.Errorf("Expected the receiver's hostname %s, got %s", hostname, info.Hostname)
+	}
+	if info.Fingerprint == "" {
+		t.Error("Expected the fingerprint of the receiver's certificate")
+	}
+
+	// The ping doesn't use up a receiver waiting for a single sender
+	if err := SendFileChunkedWithConfig(testFile, addr, DefaultSenderConfig()); err != nil {
+		t.Fatalf("Sender failed after ping: %v", err)
+	}
+	if err := <-receiverDone; err != nil {
+		t.Fatalf("Receiver failed: %v", err)
+	}
+	received, err := os.ReadFile(filepath.Join(receiverConfig.OutputDir, "received_pinged.txt"))
+	if err != nil || !bytes.Equal(received, testContent) {
+		t.Errorf("Expected the file to arrive intact after the ping, got %q (%v)", received, err)
+	}
+}
+
+func TestPingPeerUnreachable(t *testing.T) {
+	// Nothing listens on a freshly closed UDP port
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	addr := conn.LocalAddr().String()
+	conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if _, err := PingPeerContext(ctx, addr); err == nil {
+		t.Error("Expected pinging a closed port to fail")
+	}
+}
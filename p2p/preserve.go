@@ -0,0 +1,30 @@
+package p2p
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// safeFileMode limits a mode sent by a peer to permission bits, so a received file can't be made
+// setuid, setgid or sticky, and drops group and world write access
+func safeFileMode(mode uint32) os.FileMode {
+	return os.FileMode(mode).Perm() &^ 0o022
+}
+
+// applyFileAttributes gives a received file the mode and modification time the sender reported.
+// Senders that predate attribute transfer send neither, and the file keeps its defaults.
+func applyFileAttributes(path string, request *TransferRequest) error {
+	if request.FileMode != 0 {
+		if err := os.Chmod(path, safeFileMode(request.FileMode)); err != nil {
+			return fmt.Errorf("failed to set file mode: %w", err)
+		}
+	}
+	if request.ModTime != 0 {
+		modTime := time.Unix(0, request.ModTime)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			return fmt.Errorf("failed to set modification time: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package p2p
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestSafeFileMode(t *testing.T) {
+	tests := []struct {
+		mode     uint32
+		expected os.FileMode
+	}{
+		{0o644, 0o644},
+		{0o755, 0o755},
+		{0o777, 0o755},
+		{0o600, 0o600},
+		{uint32(os.ModeSetuid | os.ModeSetgid | os.ModeSticky | 0o4755), 0o755},
+	}
+	for _, test := range tests {
+		if mode := safeFileMode(test.mode); mode != test.expected {
+			t.Errorf("safeFileMode(%o) = %o, expected %o", test.mode, mode, test.expected)
+		}
+	}
+}
+
+func TestPreserveAttributesTransfer(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	testFile := filepath.Join(t.TempDir(), "script.sh")
+	if err := os.WriteFile(testFile, []byte("#!/bin/sh\necho hello\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := os.Chmod(testFile, 0o775); err != nil {
+		t.Fatalf("Failed to set test file mode: %v", err)
+	}
+	modTime := time.Date(2020, 3, 14, 15, 9, 26, 0, time.UTC)
+	if err := os.Chtimes(testFile, modTime, modTime); err != nil {
+		t.Fatalf("Failed to set test file time: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	receiverConfig := DefaultReceiverConfig()
+	receiverConfig.OutputDir = t.TempDir()
+	receiverConfig.PreserveAttributes = true
+
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), receiverConfig)
+	}()
+
+	// Give receiver time to start
+	time.Sleep(100 * time.Millisecond)
+
+	if err := SendFileChunkedWithConfig(testFile, fmt.Sprintf("127.0.0.1:%d", port), DefaultSenderConfig()); err != nil {
+		t.Fatalf("Sender failed: %v", err)
+	}
+	select {
+	case err := <-receiverDone:
+		if err != nil {
+			t.Fatalf("Receiver failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Test timed out")
+	}
+
+	info, err := os.Stat(filepath.Join(receiverConfig.OutputDir, "received_script.sh"))
+	if err != nil {
+		t.Fatalf("Failed to stat received file: %v", err)
+	}
+	if !info.ModTime().Equal(modTime) {
+		t.Errorf("Expected modification time %v, got %v", modTime, info.ModTime())
+	}
+	// Windows only tracks a read-only bit
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0o755 {
+		t.Errorf("Expected mode 755 without group write, got %o", info.Mode().Perm())
+	}
+}
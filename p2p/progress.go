@@ -2,7 +2,9 @@ package p2p
 
 import (
 	"fmt"
+	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -43,6 +45,44 @@ var Colors = ProgressColors{
 	Bold:    "\033[1m",
 }
 
+// PlainProgressInterval is how often progress is printed as a line of its own when output isn't a terminal
+const PlainProgressInterval = 5 * time.Second
+
+// plainProgress is set by SetPlainProgress
+var plainProgress atomic.Bool
+
+// SetPlainProgress switches progress output to periodic newline-delimited lines without ANSI
+// colors or carriage returns, for logs and pipes. It disables colors, so enabling it is permanent
+// for the process.
+func SetPlainProgress(plain bool) {
+	plainProgress.Store(plain)
+	if plain {
+		DisableColors()
+	}
+}
+
+// NoColorEnvVar disables colored output when set to any value, per https://no-color.org
+const NoColorEnvVar = "NO_COLOR"
+
+// DisableColors blanks every field of Colors so output has no ANSI escape codes. Call it at
+// startup, before any transfer is running.
+func DisableColors() {
+	Colors = ProgressColors{}
+}
+
+// IsTerminal reports whether f is a terminal rather than a file or pipe
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// clearProgressLine erases the progress bar drawn on the current terminal line
+func clearProgressLine() {
+	if !plainProgress.Load() {
+		logf("\r%s\r", strings.Repeat(" ", 120))
+	}
+}
+
 // ProgressTracker manages real-time progress tracking for file transfers
 type ProgressTracker struct {
 	filename      string
@@ -82,35 +122,84 @@ func (pt *ProgressTracker) SetUpdateInterval(interval time.Duration) {
 	pt.updateInterval = interval
 }
 
-// PrintProgress displays the current progress with different styles
+// PrintProgress displays the current progress with different styles, showing the average speed so far
 func (pt *ProgressTracker) PrintProgress(completedChunks int, bytesTransferred int64) {
+	pt.PrintProgressWithSpeed(completedChunks, bytesTransferred, -1)
+}
+
+// PrintProgressWithSpeed is PrintProgress with the displayed speed in MB/s supplied by the caller,
+// such as a windowed rate from TransferStats.CurrentSpeed. A negative speed means the average so far.
+// The ETA is always based on the average.
+func (pt *ProgressTracker) PrintProgressWithSpeed(completedChunks int, bytesTransferred int64, speed float64) {
 	if pt.quiet {
 		return
 	}
 
-	// Throttle updates to avoid flickering
+	// Throttle updates to avoid flickering, or to a line every few seconds in logs
 	now := time.Now()
-	if now.Sub(pt.lastUpdate) < pt.updateInterval && completedChunks < pt.totalChunks {
+	interval := pt.updateInterval
+	plain := plainProgress.Load()
+	if plain && interval < PlainProgressInterval {
+		interval = PlainProgressInterval
+	}
+	if now.Sub(pt.lastUpdate) < interval && completedChunks < pt.totalChunks {
 		return
 	}
 	pt.lastUpdate = now
 
-	percentage := float64(completedChunks) / float64(pt.totalChunks) * 100
+	// An empty file has no chunks to wait for
+	percentage := 100.0
+	if pt.totalChunks > 0 {
+		percentage = float64(completedChunks) / float64(pt.totalChunks) * 100
+	}
 	elapsed := now.Sub(pt.startTime)
 
-	var speed float64
-	if elapsed > 0 {
-		speed = float64(bytesTransferred) / elapsed.Seconds() / (1024 * 1024) // MB/s
+	if speed < 0 {
+		speed = 0
+		if elapsed > 0 {
+			speed = float64(bytesTransferred) / elapsed.Seconds() / (1024 * 1024) // MB/s
+		}
 	}
-
-	switch pt.style {
-	case ProgressStyleDetailed:
-		pt.printDetailedProgress(completedChunks, percentage, speed, "")
-	case ProgressStyleMinimal:
+	eta := formatETA(pt.estimateRemaining(completedChunks, bytesTransferred, elapsed))
+
+	switch {
+	case pt.style == ProgressStyleDetailed:
+		pt.printDetailedProgress(completedChunks, percentage, speed, eta)
+	case plain:
+		pt.printPlainProgress(completedChunks, percentage, speed, eta)
+	case pt.style == ProgressStyleMinimal:
 		pt.printMinimalProgress(completedChunks, percentage)
 	default:
-		pt.printSimpleProgress(completedChunks, percentage, speed, "")
+		pt.printSimpleProgress(completedChunks, percentage, speed, eta)
+	}
+}
+
+// etaWarmup is how long a transfer runs before its speed is trusted for an ETA
+const etaWarmup = time.Second
+
+// estimateRemaining projects the time left from the average speed so far and the bytes still to go,
+// estimated from the remaining chunks. It returns a negative duration until an estimate is stable:
+// before etaWarmup has passed or while nothing has been transferred.
+func (pt *ProgressTracker) estimateRemaining(completedChunks int, bytesTransferred int64, elapsed time.Duration) time.Duration {
+	if elapsed < etaWarmup || bytesTransferred <= 0 || pt.totalChunks <= 0 {
+		return -1
+	}
+	if completedChunks >= pt.totalChunks {
+		return 0
+	}
+
+	bytesPerSecond := float64(bytesTransferred) / elapsed.Seconds()
+	remainingBytes := float64(pt.totalSize) * float64(pt.totalChunks-completedChunks) / float64(pt.totalChunks)
+	return time.Duration(remainingBytes / bytesPerSecond * float64(time.Second))
+}
+
+// formatETA formats a remaining duration as mm:ss, or "--:--" when there's no estimate yet
+func formatETA(remaining time.Duration) string {
+	if remaining < 0 {
+		return "--:--"
 	}
+	seconds := int(remaining.Round(time.Second).Seconds())
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
 }
 
 // printSimpleProgress shows a clean, informative progress bar
@@ -126,27 +215,9 @@ func (pt *ProgressTracker) printSimpleProgress(completedChunks int, percentage f
 		speedColor = Colors.Cyan
 	}
 
-	// Limit progress bar width to prevent overflow
-	maxBarWidth := 50
-	barWidth := maxBarWidth
-	if pt.totalChunks < maxBarWidth {
-		barWidth = pt.totalChunks
-	}
-	
-	// Build progress bar: * for completed, spin char for current
-	var progressBar strings.Builder
-	for i := 0; i < barWidth; i++ {
-		chunkIndex := i * pt.totalChunks / barWidth
-		if chunkIndex < completedChunks {
-			progressBar.WriteString("*")
-		} else if chunkIndex == completedChunks && completedChunks < pt.totalChunks {
-			spinChars := []string{"|", "/", "-", "\\"}
-			progressBar.WriteString(spinChars[pt.spinIndex])
-			pt.spinIndex = (pt.spinIndex + 1) % len(spinChars)
-		} else {
-			progressBar.WriteString(".")
-		}
-	}
+	spinChars := []string{"|", "/", "-", "\\"}
+	progressBar := renderSimpleBar(completedChunks, pt.totalChunks, spinChars[pt.spinIndex])
+	pt.spinIndex = (pt.spinIndex + 1) % len(spinChars)
 
 	// Format time as mm:ss
 	timeStr := fmt.Sprintf("%02d:%02d",
@@ -160,10 +231,10 @@ func (pt *ProgressTracker) printSimpleProgress(completedChunks int, percentage f
 	}
 
 	// Use carriage return to update the same line
-	fmt.Printf("\r%s[%s%s%s] %s %.1f%% | %s%d/%d | 🚀 %s%.2fMB/s | ⏱️ %s%s%s",
+	logf("\r%s[%s%s%s] %s %.1f%% | %s%d/%d | 🚀 %s%.2fMB/s | ⏱️ %s%s | ⏳ %s%s",
 		Colors.Bold,
 		Colors.Cyan,
-		progressBar.String(),
+		progressBar,
 		Colors.Reset,
 		direction,
 		percentage,
@@ -174,9 +245,58 @@ func (pt *ProgressTracker) printSimpleProgress(completedChunks int, percentage f
 		speed,
 		Colors.Yellow,
 		timeStr,
+		eta,
 		Colors.Reset)
 }
 
+// printPlainProgress prints progress as one line of plain text
+func (pt *ProgressTracker) printPlainProgress(completedChunks int, percentage float64, speed float64, eta string) {
+	direction := "SEND"
+	if pt.direction == "received" {
+		direction = "RECV"
+	}
+	elapsed := time.Since(pt.startTime)
+	logf("%s %s %.1f%% | %d/%d chunks | %.2fMB/s | elapsed %02d:%02d | ETA %s\n",
+		direction,
+		pt.filename,
+		percentage,
+		completedChunks,
+		pt.totalChunks,
+		speed,
+		int(elapsed.Minutes()),
+		int(elapsed.Seconds())%60,
+		eta)
+}
+
+// SimpleProgressBarWidth is the most cells the simple progress bar uses, however many chunks there are
+const SimpleProgressBarWidth = 40
+
+// renderSimpleBar draws * for completed cells, spin for the cell being worked on and . for the rest.
+// Files with more chunks than SimpleProgressBarWidth are scaled so each cell covers several chunks.
+func renderSimpleBar(completedChunks, totalChunks int, spin string) string {
+	barWidth := SimpleProgressBarWidth
+	if totalChunks < barWidth {
+		barWidth = totalChunks
+	}
+	if barWidth <= 0 {
+		return ""
+	}
+	if completedChunks > totalChunks {
+		completedChunks = totalChunks
+	}
+
+	// Scale in 64 bits: chunk counts times the width can overflow int on 32-bit platforms
+	filled := int(int64(completedChunks) * int64(barWidth) / int64(totalChunks))
+
+	var bar strings.Builder
+	bar.WriteString(strings.Repeat("*", filled))
+	if filled < barWidth {
+		bar.WriteString(spin)
+		bar.WriteString(strings.Repeat(".", barWidth-filled-1))
+	}
+	return bar.String()
+}
+
 // printDetailedProgress shows comprehensive transfer information
 func (pt *ProgressTracker) printDetailedProgress(completedChunks int, percentage float64, speed float64, eta string) {
 	width := 60
@@ -185,18 +305,18 @@ func (pt *ProgressTracker) printDetailedProgress(completedChunks int, percentage
 
 	elapsed := time.Since(pt.startTime)
 
-	fmt.Printf("\n%s%s Transfer Progress - %s%s\n", Colors.Bold, Colors.Cyan, pt.filename, Colors.Reset)
-	fmt.Printf("%s\n", strings.Repeat("═", 80))
-	fmt.Printf("  📁 File:      %s%s\n", Colors.Yellow, pt.filename, Colors.Reset)
-	fmt.Printf("  📦 Size:      %s%.2f MB%s\n", Colors.Yellow, float64(pt.totalSize)/(1024*1024), Colors.Reset)
-	fmt.Printf("  📊 Progress:  [%s] %s%.1f%%%s\n", bar, Colors.Bold, percentage, Colors.Reset)
-	fmt.Printf("  📈 Speed:     %s%.2f MB/s%s\n", Colors.Green, speed, Colors.Reset)
-	fmt.Printf("  ⏱️  Duration:  %s%v%s\n", Colors.Blue, elapsed.Round(time.Second), Colors.Reset)
+	logf("\n%s%s Transfer Progress - %s%s\n", Colors.Bold, Colors.Cyan, pt.filename, Colors.Reset)
+	logf("%s\n", strings.Repeat("═", 80))
+	logf("  📁 File:      %s%s%s\n", Colors.Yellow, pt.filename, Colors.Reset)
+	logf("  📦 Size:      %s%.2f MB%s\n", Colors.Yellow, float64(pt.totalSize)/(1024*1024), Colors.Reset)
+	logf("  📊 Progress:  [%s] %s%.1f%%%s\n", bar, Colors.Bold, percentage, Colors.Reset)
+	logf("  📈 Speed:     %s%.2f MB/s%s\n", Colors.Green, speed, Colors.Reset)
+	logf("  ⏱️  Duration:  %s%v%s\n", Colors.Blue, elapsed.Round(time.Second), Colors.Reset)
 	if eta != "" {
-		fmt.Printf("  ⏳ ETA:       %s%s%s\n", Colors.Magenta, eta, Colors.Reset)
+		logf("  ⏳ ETA:       %s%s%s\n", Colors.Magenta, eta, Colors.Reset)
 	}
-	fmt.Printf("  📦 Chunks:    %s%d/%d%s\n", Colors.Cyan, completedChunks, pt.totalChunks, Colors.Reset)
-	fmt.Printf("%s\n", strings.Repeat("═", 80))
+	logf("  📦 Chunks:    %s%d/%d%s\n", Colors.Cyan, completedChunks, pt.totalChunks, Colors.Reset)
+	logf("%s\n", strings.Repeat("═", 80))
 }
 
 // printMinimalProgress shows a compact progress indicator
@@ -205,7 +325,7 @@ func (pt *ProgressTracker) printMinimalProgress(completedChunks int, percentage
 	filled := int(percentage / 100 * float64(width))
 	bar := strings.Repeat("●", filled) + strings.Repeat("○", width-filled)
 
-	fmt.Printf("\r%s%s %s %s%.1f%%%s",
+	logf("\r%s%s %s %s%.1f%%%s",
 		Colors.Bold,
 		pt.filename,
 		bar,
@@ -233,22 +353,22 @@ func (pt *ProgressTracker) PrintSummary(status string, errorMessage string) {
 		statusIcon = "❌"
 	}
 
-	fmt.Printf("\n\n%s============================================================%s\n", Colors.Bold, Colors.Reset)
-	fmt.Printf("%s📊 TRANSFER SUMMARY - 📤 %s %s%s\n", Colors.Bold, direction, Colors.Reset)
-	fmt.Printf("%s============================================================%s\n", Colors.Bold, Colors.Reset)
-	fmt.Printf("📁 File:           %s%s\n", Colors.Yellow, pt.filename, Colors.Reset)
-	fmt.Printf("📦 Size:           %s%.2f MB%s\n", Colors.Yellow, float64(pt.totalSize)/(1024*1024), Colors.Reset)
-	fmt.Printf("🔢 Chunks:         %s%d total%s\n", Colors.Cyan, pt.totalChunks, Colors.Reset)
-	fmt.Printf("⏱️  Duration:       %s%v%s\n", Colors.Blue, elapsed.Round(time.Millisecond*100), Colors.Reset)
+	logf("\n\n%s============================================================%s\n", Colors.Bold, Colors.Reset)
+	logf("%s📊 TRANSFER SUMMARY - 📤 %s%s\n", Colors.Bold, direction, Colors.Reset)
+	logf("%s============================================================%s\n", Colors.Bold, Colors.Reset)
+	logf("📁 File:           %s%s%s\n", Colors.Yellow, pt.filename, Colors.Reset)
+	logf("📦 Size:           %s%.2f MB%s\n", Colors.Yellow, float64(pt.totalSize)/(1024*1024), Colors.Reset)
+	logf("🔢 Chunks:         %s%d total%s\n", Colors.Cyan, pt.totalChunks, Colors.Reset)
+	logf("⏱️  Duration:       %s%v%s\n", Colors.Blue, elapsed.Round(time.Millisecond*100), Colors.Reset)
 	if status == "completed" {
 		speed := float64(pt.totalSize) / elapsed.Seconds() / (1024 * 1024)
-		fmt.Printf("🚀 Average Speed:  %s%.2f MB/s%s\n", Colors.Green, speed, Colors.Reset)
+		logf("🚀 Average Speed:  %s%.2f MB/s%s\n", Colors.Green, speed, Colors.Reset)
 	}
-	fmt.Printf("✅ Status:         %s%s %s%s\n", statusColor, statusIcon, status, Colors.Reset)
-	fmt.Printf("%s============================================================%s\n", Colors.Bold, Colors.Reset)
+	logf("✅ Status:         %s%s %s%s\n", statusColor, statusIcon, status, Colors.Reset)
+	logf("%s============================================================%s\n", Colors.Bold, Colors.Reset)
 
 	if errorMessage != "" {
-		fmt.Printf("❌ Error: %s%s%s\n", Colors.Red, errorMessage, Colors.Reset)
+		logf("❌ Error: %s%s%s\n", Colors.Red, errorMessage, Colors.Reset)
 	}
 }
 
@@ -0,0 +1,111 @@
+package p2p
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressTrackerETA(t *testing.T) {
+	tracker := NewProgressTracker("file.bin", 100*1024*1024, 100, "sent", ProgressStyleSimple)
+
+	// Early in the transfer the speed isn't stable yet
+	if eta := formatETA(tracker.estimateRemaining(1, 1024*1024, 200*time.Millisecond)); eta != "--:--" {
+		t.Errorf("Expected --:-- during warmup, got %s", eta)
+	}
+	if eta := formatETA(tracker.estimateRemaining(0, 0, 5*time.Second)); eta != "--:--" {
+		t.Errorf("Expected --:-- before any data, got %s", eta)
+	}
+
+	// 25 MB in 10s is 2.5 MB/s, leaving 75 MB for 30s
+	if eta := formatETA(tracker.estimateRemaining(25, 25*1024*1024, 10*time.Second)); eta != "00:30" {
+		t.Errorf("Expected ETA 00:30, got %s", eta)
+	}
+
+	// 1 MB in 10s leaves 99 MB at 0.1 MB/s: 990s
+	if eta := formatETA(tracker.estimateRemaining(1, 1024*1024, 10*time.Second)); eta != "16:30" {
+		t.Errorf("Expected ETA 16:30, got %s", eta)
+	}
+
+	if eta := formatETA(tracker.estimateRemaining(100, 100*1024*1024, 10*time.Second)); eta != "00:00" {
+		t.Errorf("Expected ETA 00:00 when complete, got %s", eta)
+	}
+}
+
+func TestRenderSimpleBarIsCapped(t *testing.T) {
+	bar := renderSimpleBar(5000, 20000, "|")
+	if len(bar) != SimpleProgressBarWidth {
+		t.Fatalf("Expected a %d-cell bar for 20000 chunks, got %d cells", SimpleProgressBarWidth, len(bar))
+	}
+	if bar != strings.Repeat("*", 10)+"|"+strings.Repeat(".", 29) {
+		t.Errorf("Expected a quarter-filled bar with the spinner after it, got %q", bar)
+	}
+
+	// Small files keep one cell per chunk
+	if bar := renderSimpleBar(2, 5, "/"); bar != "**/.." {
+		t.Errorf("Expected '**/..', got %q", bar)
+	}
+	if bar := renderSimpleBar(5, 5, "/"); bar != "*****" {
+		t.Errorf("Expected a full bar without a spinner, got %q", bar)
+	}
+}
+
+func TestPlainProgressForPipes(t *testing.T) {
+	savedColors := Colors
+	defer func() {
+		plainProgress.Store(false)
+		Colors = savedColors
+	}()
+	SetPlainProgress(true)
+	if Colors != (ProgressColors{}) {
+		t.Fatalf("Expected plain mode to zero the colors, got %+v", Colors)
+	}
+
+	recorder := &recordingLogger{}
+	SetLogger(recorder)
+	defer SetLogger(nil)
+
+	tracker := NewProgressTracker("file.bin", 4*1024*1024, 4, "sent", ProgressStyleSimple)
+	tracker.SetUpdateInterval(time.Millisecond)
+	tracker.PrintProgress(1, 1024*1024)
+	tracker.PrintProgress(2, 2*1024*1024)
+	tracker.PrintProgress(4, 4*1024*1024)
+	clearProgressLine()
+
+	// Updates are throttled to PlainProgressInterval, but completion always prints
+	if len(recorder.lines) != 1 {
+		t.Fatalf("Expected only the final progress line, got %q", recorder.lines)
+	}
+	line := recorder.lines[0]
+	if !strings.HasPrefix(line, "SEND file.bin 100.0% | 4/4 chunks") || !strings.HasSuffix(line, "\n") {
+		t.Errorf("Unexpected plain progress line %q", line)
+	}
+	if strings.ContainsAny(line, "\r\033") {
+		t.Errorf("Expected no carriage returns or escape codes, got %q", line)
+	}
+
+	// An empty file is complete without any chunks
+	recorder.lines = nil
+	NewProgressTracker("empty.txt", 0, 0, "sent", ProgressStyleSimple).PrintProgress(0, 0)
+	clearProgressLine()
+	if len(recorder.lines) != 1 || !strings.HasPrefix(recorder.lines[0], "SEND empty.txt 100.0% | 0/0 chunks") {
+		t.Errorf("Expected an empty file to show as complete, got %q", recorder.lines)
+	}
+
+	if path := filepath.Join(t.TempDir(), "log"); IsTerminal(mustCreate(t, path)) {
+		t.Error("Expected a regular file not to be a terminal")
+	}
+}
+
+// mustCreate creates the file at path, closing it when the test ends
+func mustCreate(t *testing.T, path string) *os.File {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
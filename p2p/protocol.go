@@ -2,9 +2,13 @@ package p2p
 
 import (
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
+	"strconv"
+	"strings"
 )
 
 // MessageType represents the type of protocol message
@@ -15,6 +19,130 @@ const (
 	MessageTransferResponse MessageType = "TRANSFER_RESPONSE"
 	MessageChunkData        MessageType = "CHUNK_DATA"
 	MessageChunkAck         MessageType = "CHUNK_ACK"
+	MessageFileRequest      MessageType = "FILE_REQUEST"
+	MessageFileTrailer      MessageType = "FILE_TRAILER"
+	MessageTransferComplete MessageType = "TRANSFER_COMPLETE"
+	MessagePing             MessageType = "PING"
+	MessagePong             MessageType = "PONG"
+	MessageCalibrate        MessageType = "CALIBRATE"
+	MessageCalibrateAck     MessageType = "CALIBRATE_ACK"
+)
+
+// legacyProtocolVersion is assumed for peers that predate version negotiation
+const legacyProtocolVersion = "1.0"
+
+// IsCompatibleVersion reports whether a peer speaking version can talk to this build.
+// Versions are "major.minor": peers are compatible when the major versions match, since minor
+// versions only add optional fields that older peers ignore. An empty version means a peer
+// from before negotiation existed, which spoke 1.0.
+func IsCompatibleVersion(version string) bool {
+	if version == "" {
+		version = legacyProtocolVersion
+	}
+
+	peerMajor, err := protocolMajorVersion(version)
+	if err != nil {
+		return false
+	}
+	localMajor, err := protocolMajorVersion(ProtocolVersion)
+	if err != nil {
+		return false
+	}
+	return peerMajor == localMajor
+}
+
+// protocolMajorVersion extracts the major number from a "major.minor" version string
+func protocolMajorVersion(version string) (int, error) {
+	major, _, _ := strings.Cut(version, ".")
+	n, err := strconv.Atoi(major)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid protocol version '%s'", ErrProtocolMismatch, version)
+	}
+	return n, nil
+}
+
+// supportsFraming reports whether a peer speaking version reads length-prefixed control messages,
+// which were introduced in 1.2
+func supportsFraming(version string) bool {
+	majorText, minorText, _ := strings.Cut(version, ".")
+	major, err := strconv.Atoi(majorText)
+	if err != nil {
+		return false
+	}
+	minor, err := strconv.Atoi(minorText)
+	if err != nil {
+		return false
+	}
+	return major > 1 || (major == 1 && minor >= 2)
+}
+
+// MaxControlMessageSize bounds a framed control message, so a corrupt length can't exhaust memory
+const MaxControlMessageSize = 16 * 1024 * 1024
+
+// WriteFramedMessage serializes msg and writes it as a 4-byte big-endian length followed by the JSON payload
+func WriteFramedMessage(w io.Writer, msg interface{}) error {
+	data, err := SerializeMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	// One write, so the length and payload can't be split by another writer
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame[:4], uint32(len(data)))
+	copy(frame[4:], data)
+	if _, err := w.Write(frame); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	return nil
+}
+
+// ReadFramedMessage reads one message written by WriteFramedMessage and returns its JSON payload.
+// It returns io.EOF if the stream ends before a frame starts.
+func ReadFramedMessage(r io.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("%w: message length cut short", ErrInvalidMessage)
+		}
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if size == 0 || size > MaxControlMessageSize {
+		return nil, fmt.Errorf("%w: message length %d out of range", ErrInvalidMessage, size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("%w: message cut short", ErrInvalidMessage)
+		}
+		return nil, fmt.Errorf("failed to read message: %w", err)
+	}
+	return data, nil
+}
+
+// RejectionCode tells a sender why its request was refused, alongside the human-readable RejectionMsg
+type RejectionCode string
+
+// Rejection codes carried in TransferResponse. Older receivers leave the code empty.
+const (
+	RejectionUserDeclined       RejectionCode = "user-declined"
+	RejectionTooLarge           RejectionCode = "too-large"
+	RejectionNoSpace            RejectionCode = "no-space"
+	RejectionUntrusted          RejectionCode = "untrusted"
+	RejectionUnsupportedVersion RejectionCode = "unsupported-version"
+	// RejectionInvalidRequest covers requests the receiver can't act on, such as an unsafe path
+	RejectionInvalidRequest RejectionCode = "invalid-request"
+	// RejectionNotFound answers a file request for something the peer doesn't share
+	RejectionNotFound RejectionCode = "not-found"
+	// RejectionReceiverError means the receiver failed to prepare for the transfer
+	RejectionReceiverError RejectionCode = "receiver-error"
+	// RejectionFileExists means the file already exists and the receiver skips existing files
+	RejectionFileExists RejectionCode = "file-exists"
+	// RejectionPolicy means the receiver's BeforeAccept hook refused the request
+	RejectionPolicy RejectionCode = "policy"
+	// RejectionInProgress means the same file is already being received by another transfer
+	RejectionInProgress RejectionCode = "in-progress"
 )
 
 // TransferRequest is sent from client to server to initiate a file transfer
@@ -24,6 +152,33 @@ type TransferRequest struct {
 	FileSize  int64       `json:"filesize"`
 	FileHash  string      `json:"filehash"`
 	ChunkSize int64       `json:"chunk_size"`
+	// RelativePath is the slash-separated path within a directory transfer (empty for single files)
+	RelativePath string `json:"relative_path,omitempty"`
+	// IsDir marks a directory entry; FileSize then holds the total size of the tree for the top-level directory
+	IsDir bool `json:"is_dir,omitempty"`
+	// ProtocolVersion is the sender's protocol version (empty for peers that predate negotiation)
+	ProtocolVersion string `json:"protocol_version,omitempty"`
+	// Compression is the chunk compression the sender would like to use ("none", "gzip" or "zstd")
+	Compression string `json:"compression,omitempty"`
+	// DryRun asks the receiver to answer the request without expecting any chunk data
+	DryRun bool `json:"dry_run,omitempty"`
+	// HashAlgorithm is the algorithm of FileHash and the chunk checksums ("sha256" or "blake3");
+	// empty for peers that predate negotiation, which always use SHA-256
+	HashAlgorithm string `json:"hash_algorithm,omitempty"`
+	// HashTrailer means FileHash is left empty and follows in a FileTrailer after the last chunk,
+	// so the sender hashes the file while reading it for sending instead of in a separate pass
+	HashTrailer bool `json:"hash_trailer,omitempty"`
+	// SourceID identifies the sender's file while its hash is deferred, so an interrupted transfer can resume
+	SourceID string `json:"source_id,omitempty"`
+	// FileMode and ModTime are the file's permission bits and modification time in Unix
+	// nanoseconds, applied by receivers that preserve attributes; older senders leave them zero
+	FileMode uint32 `json:"file_mode,omitempty"`
+	ModTime  int64  `json:"mod_time,omitempty"`
+	// ChunkAcks means the sender reads a ChunkAck on each chunk stream instead of a single status byte
+	ChunkAcks bool `json:"chunk_acks,omitempty"`
+	// ContentType is ContentTypeText for a text snippet the receiver shows instead of saving;
+	// empty for files
+	ContentType string `json:"content_type,omitempty"`
 }
 
 // TransferResponse is sent from server to client to acknowledge a transfer request
@@ -32,6 +187,126 @@ type TransferResponse struct {
 	Accepted     bool        `json:"accepted"`
 	ResumeChunks []int       `json:"resume_chunks,omitempty"`
 	RejectionMsg string      `json:"rejection_msg,omitempty"`
+	// RejectionCode is the machine-readable reason for a rejection; older receivers leave it empty
+	RejectionCode RejectionCode `json:"rejection_code,omitempty"`
+	// ProtocolVersion is the receiver's protocol version, so the sender can explain a version rejection
+	ProtocolVersion string `json:"protocol_version,omitempty"`
+	// Compression echoes the compression the receiver agreed to; older receivers leave it empty
+	Compression string `json:"compression,omitempty"`
+	// HashAlgorithm echoes the hash algorithm the receiver verifies with; older receivers leave it empty
+	HashAlgorithm string `json:"hash_algorithm,omitempty"`
+	// HashTrailer echoes that the receiver will wait for a FileTrailer; older receivers leave it false
+	HashTrailer bool `json:"hash_trailer,omitempty"`
+	// ChunkAcks echoes that the receiver answers each chunk with a ChunkAck; older receivers leave it false
+	ChunkAcks bool `json:"chunk_acks,omitempty"`
+}
+
+// FileTrailer carries the file hash after the last chunk of a transfer that requested HashTrailer
+type FileTrailer struct {
+	Type     MessageType `json:"type"`
+	FileHash string      `json:"filehash"`
+}
+
+// TransferComplete answers a FileTrailer once the receiver has verified the file against it
+type TransferComplete struct {
+	Type     MessageType `json:"type"`
+	Verified bool        `json:"verified"`
+	ErrorMsg string      `json:"error_msg,omitempty"`
+}
+
+// FileRequest is sent by a peer pulling a file. The serving peer answers with a TransferRequest
+// for the file and sends it as usual, or with a rejected TransferResponse.
+type FileRequest struct {
+	Type MessageType `json:"type"`
+	// Filename is the slash-separated path of the file within one of the server's shared directories
+	Filename        string `json:"filename"`
+	ProtocolVersion string `json:"protocol_version,omitempty"`
+}
+
+// NewFileRequest creates a new file request message
+func NewFileRequest(filename string) *FileRequest {
+	return &FileRequest{
+		Type:            MessageFileRequest,
+		ProtocolVersion: ProtocolVersion,
+		Filename:        filename,
+	}
+}
+
+// DeserializeFileRequest deserializes a FILE_REQUEST message
+func DeserializeFileRequest(data []byte) (*FileRequest, error) {
+	var req FileRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("failed to deserialize file request: %w", err)
+	}
+
+	if req.Type != MessageFileRequest {
+		return nil, fmt.Errorf("invalid message type: expected %s, got %s", MessageFileRequest, req.Type)
+	}
+
+	return &req, nil
+}
+
+// PeerPing is exchanged by PingPeer to check that a peer's QUIC listener is up: the pinging peer
+// sends its device info as PING and the receiver answers with its own as PONG
+type PeerPing struct {
+	Type            MessageType `json:"type"`
+	ProtocolVersion string      `json:"protocol_version,omitempty"`
+	Device          DeviceInfo  `json:"device"`
+}
+
+// NewPeerPing creates a PING or PONG message carrying device
+func NewPeerPing(messageType MessageType, device DeviceInfo) *PeerPing {
+	return &PeerPing{
+		Type:            messageType,
+		ProtocolVersion: ProtocolVersion,
+		Device:          device,
+	}
+}
+
+// DeserializePeerPing deserializes a PING or PONG message, expecting messageType
+func DeserializePeerPing(data []byte, messageType MessageType) (*PeerPing, error) {
+	var ping PeerPing
+	if err := json.Unmarshal(data, &ping); err != nil {
+		return nil, fmt.Errorf("failed to deserialize ping: %w", err)
+	}
+
+	if ping.Type != messageType {
+		return nil, fmt.Errorf("invalid message type: expected %s, got %s", messageType, ping.Type)
+	}
+
+	return &ping, nil
+}
+
+// Calibration announces the probes a sender with SenderConfig.AutoChunkSize sends before its first
+// request, each on its own stream, as CALIBRATE; the receiver answers CALIBRATE_ACK once it's ready
+// to accept them
+type Calibration struct {
+	Type            MessageType `json:"type"`
+	ProtocolVersion string      `json:"protocol_version,omitempty"`
+	Probes          []int64     `json:"probes,omitempty"`
+}
+
+// NewCalibration creates a CALIBRATE or CALIBRATE_ACK message for probes of the given sizes
+func NewCalibration(messageType MessageType, probes []int64) *Calibration {
+	return &Calibration{
+		Type:            messageType,
+		ProtocolVersion: ProtocolVersion,
+		Probes:          probes,
+	}
+}
+
+// DeserializeCalibration deserializes a CALIBRATE or CALIBRATE_ACK message, expecting messageType
+func DeserializeCalibration(data []byte, messageType MessageType) (*Calibration, error) {
+	var calibration Calibration
+	if err := json.Unmarshal(data, &calibration); err != nil {
+		return nil, fmt.Errorf("failed to deserialize calibration: %w", err)
+	}
+
+	if calibration.Type != messageType {
+		return nil, fmt.Errorf("invalid message type: expected %s, got %s", messageType, calibration.Type)
+	}
+
+	return &calibration, nil
 }
 
 // ProtocolMessage represents any protocol message
@@ -80,24 +355,95 @@ func DeserializeTransferResponse(data []byte) (*TransferResponse, error) {
 // NewTransferRequest creates a new transfer request message
 func NewTransferRequest(filename string, fileSize int64, fileHash string, chunkSize int64) *TransferRequest {
 	return &TransferRequest{
-		Type:      MessageTransferRequest,
-		Filename:  filename,
-		FileSize:  fileSize,
-		FileHash:  fileHash,
-		ChunkSize: chunkSize,
+		Type:            MessageTransferRequest,
+		ProtocolVersion: ProtocolVersion,
+		Filename:        filename,
+		FileSize:        fileSize,
+		FileHash:        fileHash,
+		ChunkSize:       chunkSize,
+	}
+}
+
+// resumeKey identifies the file in the receiver's progress sidecar: its hash, or the sender's
+// source ID when the hash only arrives in the trailer
+func (r *TransferRequest) resumeKey() string {
+	if r.HashTrailer {
+		return "source:" + r.SourceID
 	}
+	return r.FileHash
+}
+
+// TargetPath returns the path the receiver should create, relative to its output directory
+func (r *TransferRequest) TargetPath() string {
+	if r.RelativePath != "" {
+		return r.RelativePath
+	}
+	return r.Filename
 }
 
 // NewTransferResponse creates a new transfer response message
 func NewTransferResponse(accepted bool, resumeChunks []int, rejectionMsg string) *TransferResponse {
 	return &TransferResponse{
-		Type:         MessageTransferResponse,
-		Accepted:     accepted,
-		ResumeChunks: resumeChunks,
-		RejectionMsg: rejectionMsg,
+		Type:            MessageTransferResponse,
+		ProtocolVersion: ProtocolVersion,
+		Accepted:        accepted,
+		ResumeChunks:    resumeChunks,
+		RejectionMsg:    rejectionMsg,
+	}
+}
+
+// NewRejectionResponse creates a transfer response that refuses the request for code
+func NewRejectionResponse(code RejectionCode, rejectionMsg string) *TransferResponse {
+	response := NewTransferResponse(false, nil, rejectionMsg)
+	response.RejectionCode = code
+	return response
+}
+
+// NewFileTrailer creates a new file trailer message
+func NewFileTrailer(fileHash string) *FileTrailer {
+	return &FileTrailer{
+		Type:     MessageFileTrailer,
+		FileHash: fileHash,
+	}
+}
+
+// DeserializeFileTrailer deserializes a FILE_TRAILER message
+func DeserializeFileTrailer(data []byte) (*FileTrailer, error) {
+	var trailer FileTrailer
+	if err := json.Unmarshal(data, &trailer); err != nil {
+		return nil, fmt.Errorf("failed to deserialize file trailer: %w", err)
+	}
+
+	if trailer.Type != MessageFileTrailer {
+		return nil, fmt.Errorf("invalid message type: expected %s, got %s", MessageFileTrailer, trailer.Type)
+	}
+
+	return &trailer, nil
+}
+
+// NewTransferComplete creates a new transfer complete message
+func NewTransferComplete(verified bool, errorMsg string) *TransferComplete {
+	return &TransferComplete{
+		Type:     MessageTransferComplete,
+		Verified: verified,
+		ErrorMsg: errorMsg,
 	}
 }
 
+// DeserializeTransferComplete deserializes a TRANSFER_COMPLETE message
+func DeserializeTransferComplete(data []byte) (*TransferComplete, error) {
+	var complete TransferComplete
+	if err := json.Unmarshal(data, &complete); err != nil {
+		return nil, fmt.Errorf("failed to deserialize transfer complete: %w", err)
+	}
+
+	if complete.Type != MessageTransferComplete {
+		return nil, fmt.Errorf("invalid message type: expected %s, got %s", MessageTransferComplete, complete.Type)
+	}
+
+	return &complete, nil
+}
+
 // ChunkData represents a chunk of file data with metadata
 type ChunkData struct {
 	Type       MessageType `json:"type"`
@@ -105,6 +451,17 @@ type ChunkData struct {
 	ChunkSize  int         `json:"chunk_size"`
 	Data       []byte      `json:"data"`
 	Checksum   string      `json:"checksum"`
+
+	pooled bool // Data came from ChunkBufferPool and goes back via release
+}
+
+// release returns a pooled Data buffer to ChunkBufferPool. Data must not be used afterwards.
+func (c *ChunkData) release() {
+	if c.pooled {
+		ChunkBufferPool.Put(c.Data[:cap(c.Data)])
+		c.pooled = false
+	}
+	c.Data = nil
 }
 
 // ChunkAck represents acknowledgment of a received chunk
@@ -113,6 +470,8 @@ type ChunkAck struct {
 	ChunkIndex int64       `json:"chunk_index"`
 	Received   bool        `json:"received"`
 	ErrorMsg   string      `json:"error_msg,omitempty"`
+	// Permanent means resending the same chunk would fail the same way, so the sender shouldn't retry
+	Permanent bool `json:"permanent,omitempty"`
 }
 
 // NewChunkData creates a new chunk data message
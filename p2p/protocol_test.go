@@ -1,6 +1,11 @@
 package p2p
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
 	"testing"
 )
 
@@ -108,3 +113,199 @@ func TestTransferResponseRejection(t *testing.T) {
 		t.Errorf("Expected 0 resume chunks for rejection, got %d", len(deserializedResp.ResumeChunks))
 	}
 }
+
+func TestFileTrailerSerialization(t *testing.T) {
+	data, err := SerializeMessage(NewFileTrailer("abc123"))
+	if err != nil {
+		t.Fatalf("Failed to serialize file trailer: %v", err)
+	}
+	trailer, err := DeserializeFileTrailer(data)
+	if err != nil {
+		t.Fatalf("Failed to deserialize file trailer: %v", err)
+	}
+	if trailer.FileHash != "abc123" {
+		t.Errorf("Expected file hash abc123, got %s", trailer.FileHash)
+	}
+
+	// A transfer result isn't mistaken for a trailer
+	data, err = SerializeMessage(NewTransferComplete(false, "file integrity verification failed"))
+	if err != nil {
+		t.Fatalf("Failed to serialize transfer complete: %v", err)
+	}
+	if _, err := DeserializeFileTrailer(data); err == nil {
+		t.Error("Expected a TRANSFER_COMPLETE message to be refused as a trailer")
+	}
+	complete, err := DeserializeTransferComplete(data)
+	if err != nil {
+		t.Fatalf("Failed to deserialize transfer complete: %v", err)
+	}
+	if complete.Verified || complete.ErrorMsg == "" {
+		t.Errorf("Expected an unverified result with a message, got %+v", complete)
+	}
+}
+
+func TestFramedControlMessages(t *testing.T) {
+	// Two messages written back to back come out separately
+	var stream bytes.Buffer
+	if err := WriteFramedMessage(&stream, NewTransferResponse(true, []int{0, 1}, "")); err != nil {
+		t.Fatalf("Failed to write framed message: %v", err)
+	}
+	if err := WriteFramedMessage(&stream, NewFileTrailer("abc123")); err != nil {
+		t.Fatalf("Failed to write framed message: %v", err)
+	}
+
+	messageType, _, err := readControlMessage(&stream)
+	if err != nil || messageType != MessageTransferResponse {
+		t.Fatalf("Expected the response first, got %s (%v)", messageType, err)
+	}
+	messageType, data, err := readControlMessage(&stream)
+	if err != nil || messageType != MessageFileTrailer {
+		t.Fatalf("Expected the trailer second, got %s (%v)", messageType, err)
+	}
+	if trailer, err := DeserializeFileTrailer(data); err != nil || trailer.FileHash != "abc123" {
+		t.Errorf("Expected the trailer payload intact, got %+v (%v)", trailer, err)
+	}
+	if _, _, err := readControlMessage(&stream); err != io.EOF {
+		t.Errorf("Expected io.EOF after the last message, got %v", err)
+	}
+
+	// Older peers send bare JSON, which is still understood
+	legacy, err := SerializeMessage(NewTransferRequest("old.txt", 10, "abc123", 1024))
+	if err != nil {
+		t.Fatalf("Failed to serialize request: %v", err)
+	}
+	messageType, _, err = readControlMessage(bytes.NewReader(legacy))
+	if err != nil || messageType != MessageTransferRequest {
+		t.Errorf("Expected an unframed request to be read, got %s (%v)", messageType, err)
+	}
+
+	// Lengths beyond the limit and truncated frames are refused
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], MaxControlMessageSize+1)
+	if _, err := ReadFramedMessage(bytes.NewReader(header[:])); !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("Expected an oversized length to be refused, got %v", err)
+	}
+	binary.BigEndian.PutUint32(header[:], 100)
+	if _, err := ReadFramedMessage(bytes.NewReader(append(header[:], '{'))); !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("Expected a truncated frame to be refused, got %v", err)
+	}
+}
+
+func TestSupportsFraming(t *testing.T) {
+	for version, want := range map[string]bool{"1.2": true, "1.10": true, "2.0": true, "1.1": false, "1.0": false, "": false} {
+		if got := supportsFraming(version); got != want {
+			t.Errorf("supportsFraming(%q) = %v, want %v", version, got, want)
+		}
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	cases := map[string]int64{
+		"512K":  512 * 1024,
+		"1M":    1024 * 1024,
+		"1mb":   1024 * 1024,
+		"1.5M":  1536 * 1024,
+		"65536": 65536,
+		"2GiB":  2 * 1024 * 1024 * 1024,
+	}
+	for input, expected := range cases {
+		size, err := ParseByteSize(input)
+		if err != nil {
+			t.Errorf("Failed to parse %s: %v", input, err)
+			continue
+		}
+		if size != expected {
+			t.Errorf("Expected %s to parse as %d, got %d", input, expected, size)
+		}
+	}
+
+	for _, input := range []string{"", "M", "12X", "-1M", "8589934592G", "9223372036854775808", strings.Repeat("9", 400)} {
+		if _, err := ParseByteSize(input); err == nil {
+			t.Errorf("Expected %q to be rejected", input)
+		}
+	}
+}
+
+func TestFormatByteSize(t *testing.T) {
+	cases := map[int64]string{
+		512:                    "512 B",
+		1536:                   "1.50 KB",
+		32 * 1024 * 1024:       "32.00 MB",
+		3 * 1024 * 1024 * 1024: "3.00 GB",
+	}
+	for input, expected := range cases {
+		if got := FormatByteSize(input); got != expected {
+			t.Errorf("Expected %d to format as %s, got %s", input, expected, got)
+		}
+	}
+}
+
+func TestValidateChunkSize(t *testing.T) {
+	if err := ValidateChunkSize(DefaultChunkSize); err != nil {
+		t.Errorf("Expected default chunk size to be valid: %v", err)
+	}
+	if err := ValidateChunkSize(32 * 1024); err == nil {
+		t.Error("Expected 32KB chunk size to be rejected")
+	}
+	if err := ValidateChunkSize(128 * 1024 * 1024); err == nil {
+		t.Error("Expected 128MB chunk size to be rejected")
+	}
+}
+
+func TestIsCompatibleVersion(t *testing.T) {
+	compatible := []string{ProtocolVersion, "", "1.0", "1.7"}
+	for _, version := range compatible {
+		if !IsCompatibleVersion(version) {
+			t.Errorf("Expected version '%s' to be compatible with %s", version, ProtocolVersion)
+		}
+	}
+
+	incompatible := []string{"2.0", "0.9", "garbage"}
+	for _, version := range incompatible {
+		if IsCompatibleVersion(version) {
+			t.Errorf("Expected version '%s' to be incompatible with %s", version, ProtocolVersion)
+		}
+	}
+}
+
+func TestRejectionErrorForVersionMismatch(t *testing.T) {
+	response := NewTransferResponse(false, nil, "Unsupported protocol version")
+	response.ProtocolVersion = "2.0"
+	if err := rejectionError(response); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("Expected ErrUnsupportedVersion, got %v", err)
+	}
+
+	response = NewTransferResponse(false, nil, "User declined")
+	if err := rejectionError(response); !errors.Is(err, ErrTransferRejected) {
+		t.Errorf("Expected ErrTransferRejected, got %v", err)
+	}
+}
+
+func TestRejectionCodeRoundTrip(t *testing.T) {
+	data, err := SerializeMessage(NewRejectionResponse(RejectionNoSpace, "Not enough disk space"))
+	if err != nil {
+		t.Fatalf("Failed to serialize response: %v", err)
+	}
+	response, err := DeserializeTransferResponse(data)
+	if err != nil {
+		t.Fatalf("Failed to deserialize response: %v", err)
+	}
+	if response.Accepted || response.RejectionCode != RejectionNoSpace {
+		t.Fatalf("Expected a no-space rejection, got accepted=%v code=%q", response.Accepted, response.RejectionCode)
+	}
+
+	err = rejectionError(response)
+	var rejection *RejectionError
+	if !errors.As(err, &rejection) || rejection.Code != RejectionNoSpace || rejection.Message != "Not enough disk space" {
+		t.Fatalf("Expected a RejectionError carrying the code, got %v", err)
+	}
+	if !errors.Is(err, ErrTransferRejected) || !errors.Is(err, ErrInsufficientSpace) {
+		t.Errorf("Expected the rejection to match ErrTransferRejected and ErrInsufficientSpace, got %v", err)
+	}
+
+	// Older receivers send no code, which still reads as a plain rejection
+	legacy := NewTransferResponse(false, nil, "User rejected the transfer")
+	if err := rejectionError(legacy); !errors.Is(err, ErrTransferRejected) || errors.Is(err, ErrInsufficientSpace) {
+		t.Errorf("Expected only ErrTransferRejected for a rejection without a code, got %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GetFileChunked pulls a file from a peer sharing it with ReceiverConfig.SharedDirs. remoteName is the
+// file's slash-separated path within one of the peer's shared directories.
+func GetFileChunked(peerAddr, remoteName string, config ReceiverConfig) error {
+	return GetFileChunkedContext(context.Background(), peerAddr, remoteName, config)
+}
+
+// GetFileChunkedContext is GetFileChunked with a context. The file is received exactly as a pushed
+// one would be, including resume, but without a confirmation prompt since this side asked for it.
+func GetFileChunkedContext(ctx context.Context, peerAddr, remoteName string, config ReceiverConfig) error {
+	if config.Daemon {
+		return fmt.Errorf("daemon mode doesn't apply to pulling a file")
+	}
+	if err := config.validate(); err != nil {
+		return err
+	}
+	if err := ensureOutputDir(config.OutputDir); err != nil {
+		return err
+	}
+	config.AutoAccept = true
+	ctx, cancel := transferContext(ctx, config.TransferTimeout)
+	defer cancel()
+
+	conn, err := dialWithRetry(ctx, peerAddr, GetClientTLSConfig(), DefaultDialAttempts, DefaultDialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.CloseWithError(0, "")
+
+	controlStream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open control stream: %w", err)
+	}
+
+	if err := writeControlMessage(controlStream, NewFileRequest(remoteName), false); err != nil {
+		return fmt.Errorf("failed to send file request: %w", err)
+	}
+	logf("Requested '%s' from %s, waiting for response...\n", remoteName, peerAddr)
+
+	// The peer either offers the file like a sender would, or refuses the request
+	messageType, data, err := readControlMessage(controlStream)
+	if err != nil {
+		return fmt.Errorf("failed to read file request response: %w", err)
+	}
+	switch messageType {
+	case MessageTransferResponse:
+		response, err := DeserializeTransferResponse(data)
+		if err != nil {
+			return err
+		}
+		logf("File request refused: %s\n", response.RejectionMsg)
+		return rejectionError(response)
+	case MessageTransferRequest:
+		request, err := DeserializeTransferRequest(data)
+		if err != nil {
+			return err
+		}
+		session := &receiveSession{
+			conn:          conn,
+			controlStream: controlStream,
+			config:        config,
+			peerAddr:      conn.RemoteAddr().String(),
+			deviceID:      peerDeviceID(conn),
+			acceptedRoots: make(map[string]bool),
+			outputs:       newActiveOutputs(),
+		}
+		return session.handleRequest(ctx, request)
+	default:
+		return fmt.Errorf("%w: unexpected %s in reply to a file request", ErrInvalidMessage, messageType)
+	}
+}
+
+// serveFileRequest answers a peer pulling a file: the file is sent over this connection with the
+// normal sender logic if it lies within a shared directory, and the request is refused otherwise
+func (s *receiveSession) serveFileRequest(ctx context.Context, data []byte) error {
+	request, err := DeserializeFileRequest(data)
+	if err != nil {
+		return err
+	}
+	logf("%s requested '%s'\n", s.peerAddr, request.Filename)
+	s.framed = supportsFraming(request.ProtocolVersion)
+
+	refuse := func(reason error, rejectionMsg string) error {
+		logf("Refusing file request: %s\n", rejectionMsg)
+		if err := s.sendResponse(NewRejectionResponse(rejectionCodeFor(reason), rejectionMsg)); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %w: %s", ErrTransferRejected, reason, rejectionMsg)
+	}
+
+	if !IsCompatibleVersion(request.ProtocolVersion) {
+		return refuse(ErrUnsupportedVersion, fmt.Sprintf("Unsupported protocol version %s (peer speaks %s)", request.ProtocolVersion, ProtocolVersion))
+	}
+	if len(s.config.SharedDirs) == 0 {
+		return refuse(ErrFileAccessDenied, "This peer doesn't share any files")
+	}
+	if !senderAllowed(s.config.AllowedDevices, s.deviceID, defaultTrustStore()) {
+		return refuse(ErrFileAccessDenied, "Requester is not on the peer's allowlist")
+	}
+	path, err := resolveSharedFile(s.config.SharedDirs, request.Filename)
+	if errors.Is(err, ErrFileNotFound) {
+		return refuse(err, fmt.Sprintf("'%s' not found in the shared directories", request.Filename))
+	}
+	if err != nil {
+		logf("Refusing '%s': %v\n", request.Filename, err)
+		return refuse(err, fmt.Sprintf("'%s' is not shared", request.Filename))
+	}
+
+	config := DefaultSenderConfig()
+	config.Quiet = s.config.Quiet
+	sender := &sendSession{
+		conn:          s.conn,
+		controlStream: s.controlStream,
+		peerAddr:      s.peerAddr,
+		config:        config,
+		framed:        s.framed,
+	}
+	err = sender.sendFile(ctx, path, "")
+	// Wait for the requester to finish verifying before the connection goes away
+	sender.Close()
+	return err
+}
+
+// resolveSharedFile finds name in the first shared directory that contains it. Paths that would
+// leave the directory, including through symlinks, are refused, so only files below a shared
+// directory can be read.
+func resolveSharedFile(sharedDirs []string, name string) (string, error) {
+	relPath, err := sanitizeRelativePath(name)
+	if err != nil {
+		return "", err
+	}
+
+	for _, dir := range sharedDirs {
+		root, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			continue
+		}
+		candidate := filepath.Join(dir, relPath)
+		resolved, err := filepath.EvalSymlinks(candidate)
+		if err != nil {
+			continue
+		}
+		if !isWithinDir(root, resolved) {
+			return "", fmt.Errorf("%w: '%s' resolves outside the shared directory", ErrFileAccessDenied, name)
+		}
+
+		info, err := os.Stat(resolved)
+		if err != nil {
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			return "", fmt.Errorf("%w: '%s' is not a regular file", ErrFileAccessDenied, name)
+		}
+		return candidate, nil
+	}
+	return "", fmt.Errorf("%w: '%s'", ErrFileNotFound, name)
+}
+
+// isWithinDir reports whether path is dir or lies below it; both must be cleaned absolute or
+// relative paths of the same kind
+func isWithinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
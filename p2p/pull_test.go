@@ -0,0 +1,107 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResolveSharedFile(t *testing.T) {
+	shared := t.TempDir()
+	outside := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(shared, "docs"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(shared, "docs", "report.txt"), []byte("report"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	path, err := resolveSharedFile([]string{shared}, "docs/report.txt")
+	if err != nil {
+		t.Fatalf("Expected a shared file to resolve: %v", err)
+	}
+	if path != filepath.Join(shared, "docs", "report.txt") {
+		t.Errorf("Expected the file inside the shared directory, got %s", path)
+	}
+
+	if _, err := resolveSharedFile([]string{shared}, "docs/missing.txt"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound for a missing file, got %v", err)
+	}
+	if _, err := resolveSharedFile([]string{shared}, "../"+filepath.Base(outside)+"/secret.txt"); !errors.Is(err, ErrFileAccessDenied) {
+		t.Errorf("Expected '..' to be refused, got %v", err)
+	}
+	if _, err := resolveSharedFile([]string{shared}, "docs"); !errors.Is(err, ErrFileAccessDenied) {
+		t.Errorf("Expected a directory to be refused, got %v", err)
+	}
+
+	// A symlink out of the shared directory doesn't make the target readable
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(shared, "link.txt")); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+	if _, err := resolveSharedFile([]string{shared}, "link.txt"); !errors.Is(err, ErrFileAccessDenied) {
+		t.Errorf("Expected a symlink leaving the shared directory to be refused, got %v", err)
+	}
+}
+
+func TestGetFileChunkedPullsSharedFile(t *testing.T) {
+	shared := t.TempDir()
+	testContent := make([]byte, 3*MinChunkSize+100)
+	for i := range testContent {
+		testContent[i] = byte(i * 31 % 251)
+	}
+	if err := os.WriteFile(filepath.Join(shared, "shared.bin"), testContent, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// Find an available port
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	serverConfig := DefaultReceiverConfig()
+	serverConfig.SharedDirs = []string{shared}
+	serverConfig.Daemon = true
+	ctx, cancel := context.WithCancel(context.Background())
+	serverDone := make(chan error, 1)
+	go func() {
+		serverDone <- ReceiveFileChunkedContext(ctx, fmt.Sprintf("%d", port), serverConfig)
+	}()
+	defer func() {
+		cancel()
+		<-serverDone
+	}()
+
+	// Give the server time to start
+	time.Sleep(100 * time.Millisecond)
+
+	clientConfig := DefaultReceiverConfig()
+	clientConfig.OutputDir = t.TempDir()
+	peerAddr := fmt.Sprintf("127.0.0.1:%d", port)
+	if err := GetFileChunked(peerAddr, "shared.bin", clientConfig); err != nil {
+		t.Fatalf("Pull failed: %v", err)
+	}
+	received, err := os.ReadFile(filepath.Join(clientConfig.OutputDir, "received_shared.bin"))
+	if err != nil {
+		t.Fatalf("Failed to read pulled file: %v", err)
+	}
+	if string(received) != string(testContent) {
+		t.Fatal("File content mismatch")
+	}
+
+	// Files outside the shared directory can't be requested
+	err = GetFileChunked(peerAddr, "../outside.bin", clientConfig)
+	if !errors.Is(err, ErrTransferRejected) {
+		t.Errorf("Expected a request outside the shared directory to be refused, got %v", err)
+	}
+}
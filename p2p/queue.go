@@ -0,0 +1,199 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// QueueState is where a path in a TransferQueue is
+type QueueState string
+
+// States of a queued transfer
+const (
+	QueuePending  QueueState = "pending"
+	QueueActive   QueueState = "active"
+	QueueDone     QueueState = "done"
+	QueueRejected QueueState = "rejected"
+	QueueFailed   QueueState = "failed"
+)
+
+// QueuedTransfer is a file or directory in a TransferQueue
+type QueuedTransfer struct {
+	ID       int
+	Path     string
+	Priority int   // higher priorities are sent first
+	Size     int64 // bytes to send, the whole tree for a directory
+	State    QueueState
+	Err      error // why the transfer was rejected or failed
+}
+
+// TransferQueue sends files and directories to one receiver over a single connection, the highest
+// priority first and, among equal priorities, in the order they were added. Paths may be added
+// while it runs, and Snapshot shows which are pending, active and done, e.g. for a UI.
+type TransferQueue struct {
+	// LargeLast sends smaller paths before larger ones of the same priority. Set it before Run.
+	LargeLast bool
+
+	mutex sync.Mutex
+	items []*queueItem
+}
+
+// queueItem is a queued path with what's needed to send it
+type queueItem struct {
+	QueuedTransfer
+	isDir   bool
+	entries []directoryEntry // a directory's contents, collected when it was added
+}
+
+// NewTransferQueue creates an empty queue
+func NewTransferQueue() *TransferQueue {
+	return &TransferQueue{}
+}
+
+// Add queues path with priority and returns its ID. A directory is walked straight away, so an
+// unreadable path fails here rather than partway through the queue.
+func (q *TransferQueue) Add(path string, priority int) (int, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open '%s': %w", path, err)
+	}
+	item := &queueItem{
+		QueuedTransfer: QueuedTransfer{Path: path, Priority: priority, Size: info.Size(), State: QueuePending},
+		isDir:          info.IsDir(),
+	}
+	if item.isDir {
+		if item.entries, item.Size, err = collectDirectoryTransfer(path); err != nil {
+			return 0, err
+		}
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	item.ID = len(q.items) + 1
+	q.items = append(q.items, item)
+	return item.ID, nil
+}
+
+// Snapshot returns every queued transfer, in the order they were added
+func (q *TransferQueue) Snapshot() []QueuedTransfer {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	snapshot := make([]QueuedTransfer, len(q.items))
+	for i, item := range q.items {
+		snapshot[i] = item.QueuedTransfer
+	}
+	return snapshot
+}
+
+// next marks the pending path to send next as active and returns it, or nil when none is pending
+func (q *TransferQueue) next() *queueItem {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	var best *queueItem
+	for _, item := range q.items {
+		if item.State == QueuePending && (best == nil || q.before(item, best)) {
+			best = item
+		}
+	}
+	if best != nil {
+		best.State = QueueActive
+	}
+	return best
+}
+
+// before reports whether a is sent before b
+func (q *TransferQueue) before(a, b *queueItem) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if q.LargeLast && a.Size != b.Size {
+		return a.Size < b.Size
+	}
+	return a.ID < b.ID
+}
+
+// finish records how an active path's transfer ended
+func (q *TransferQueue) finish(item *queueItem, err error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	switch {
+	case err == nil:
+		item.State = QueueDone
+	case errors.Is(err, ErrTransferRejected):
+		item.State = QueueRejected
+	default:
+		item.State = QueueFailed
+	}
+	item.Err = err
+}
+
+// Run sends the queued paths to peerAddr over one connection until none is pending, including any
+// added meanwhile, then prints a combined summary. A rejected or failed path doesn't stop the rest,
+// and a connection that drops between paths is dialed again once. It returns the first failure.
+func (q *TransferQueue) Run(ctx context.Context, peerAddr string, config SenderConfig) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+	ctx, cancel := transferContext(ctx, config.TransferTimeout)
+	defer cancel()
+
+	session, err := openSendSession(ctx, peerAddr, config)
+	if err != nil {
+		return err
+	}
+	defer func() { session.Close() }()
+
+	startTime := time.Now()
+	var results []*TransferStats
+	var firstErr error
+	for item := q.next(); item != nil; item = q.next() {
+		err := session.sendQueued(ctx, item)
+		if err != nil && ctx.Err() == nil && session.conn.Context().Err() != nil {
+			// The connection went away between paths, so there was nothing to resume
+			logf("Connection to %s lost, reconnecting...\n", peerAddr)
+			reopened, dialErr := openSendSession(ctx, peerAddr, config)
+			if dialErr != nil {
+				q.finish(item, err)
+				if firstErr == nil {
+					firstErr = fmt.Errorf("failed to send '%s': %w (reconnecting failed: %v)", item.Path, err, dialErr)
+				}
+				break
+			}
+			results = append(results, session.results...)
+			session.conn.CloseWithError(0, "")
+			session = reopened
+			err = session.sendQueued(ctx, item)
+		}
+		q.finish(item, err)
+
+		if err != nil && !errors.Is(err, ErrTransferRejected) {
+			err = fmt.Errorf("failed to send '%s': %w", item.Path, err)
+			logf("%v\n", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+	}
+
+	results = append(results, session.results...)
+	// A dry run hasn't transferred anything to summarize
+	if !config.DryRun && !config.Quiet {
+		printBatchSummary(results, time.Since(startTime))
+	}
+	return firstErr
+}
+
+// sendQueued sends a queued file or directory over the session
+func (s *sendSession) sendQueued(ctx context.Context, item *queueItem) error {
+	if item.isDir {
+		return s.sendDirectory(ctx, item.Path, item.entries, item.Size)
+	}
+	return s.sendFile(ctx, item.Path, "")
+}
@@ -0,0 +1,119 @@
+package p2p
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTransferQueueOrder(t *testing.T) {
+	dir := t.TempDir()
+	sizes := map[string]int{"big.iso": 3000, "notes.txt": 10, "photo.jpg": 500, "urgent.pdf": 2000}
+	for name, size := range sizes {
+		if err := os.WriteFile(filepath.Join(dir, name), make([]byte, size), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	order := func(queue *TransferQueue) []string {
+		var names []string
+		for item := queue.next(); item != nil; item = queue.next() {
+			names = append(names, filepath.Base(item.Path))
+			queue.finish(item, nil)
+		}
+		return names
+	}
+	fill := func(queue *TransferQueue) {
+		for _, name := range []string{"big.iso", "notes.txt", "urgent.pdf", "photo.jpg"} {
+			priority := 0
+			if name == "urgent.pdf" {
+				priority = 10
+			}
+			if _, err := queue.Add(filepath.Join(dir, name), priority); err != nil {
+				t.Fatalf("Failed to queue %s: %v", name, err)
+			}
+		}
+	}
+
+	queue := NewTransferQueue()
+	fill(queue)
+	if got, want := order(queue), []string{"urgent.pdf", "big.iso", "notes.txt", "photo.jpg"}; !slices.Equal(got, want) {
+		t.Errorf("Expected priority, then the order added: %v, got %v", want, got)
+	}
+
+	queue = NewTransferQueue()
+	queue.LargeLast = true
+	fill(queue)
+	if got, want := order(queue), []string{"urgent.pdf", "notes.txt", "photo.jpg", "big.iso"}; !slices.Equal(got, want) {
+		t.Errorf("Expected priority, then the smallest first: %v, got %v", want, got)
+	}
+
+	if _, err := queue.Add(filepath.Join(dir, "missing.txt"), 0); err == nil {
+		t.Error("Expected a missing path to be refused when it's added")
+	}
+}
+
+func TestTransferQueueRun(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	dir := t.TempDir()
+	for _, name := range []string{"first.txt", "second.txt", "third.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("contents of "+name), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	// A receiver that isn't a daemon serves a single connection, so every file must share it
+	var received []string
+	receiverConfig := DefaultReceiverConfig()
+	receiverConfig.OutputDir = t.TempDir()
+	receiverConfig.AfterReceive = func(path string, stats *TransferStats) error {
+		received = append(received, filepath.Base(path))
+		return nil
+	}
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), receiverConfig)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	queue := NewTransferQueue()
+	for priority, name := range []string{"third.txt", "second.txt", "first.txt"} {
+		if _, err := queue.Add(filepath.Join(dir, name), priority); err != nil {
+			t.Fatalf("Failed to queue %s: %v", name, err)
+		}
+	}
+	if err := queue.Run(t.Context(), fmt.Sprintf("127.0.0.1:%d", port), DefaultSenderConfig()); err != nil {
+		t.Fatalf("Queue failed: %v", err)
+	}
+	select {
+	case err := <-receiverDone:
+		if err != nil {
+			t.Fatalf("Receiver failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Test timed out")
+	}
+
+	if want := []string{"received_first.txt", "received_second.txt", "received_third.txt"}; !slices.Equal(received, want) {
+		t.Errorf("Expected the highest priority first: %v, got %v", want, received)
+	}
+	for _, item := range queue.Snapshot() {
+		if item.State != QueueDone || item.Err != nil {
+			t.Errorf("Expected %s to be done, got %s (%v)", item.Path, item.State, item.Err)
+		}
+	}
+}
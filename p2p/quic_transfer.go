@@ -10,6 +10,20 @@ import (
 	"github.com/quic-go/quic-go"
 )
 
+// newQUICConfig returns the connection settings shared by every dialer and listener. Keepalives
+// stop idle-looking connections, such as one waiting for the user to accept, from timing out.
+func newQUICConfig() *quic.Config {
+	return &quic.Config{
+		KeepAlivePeriod: ConnectionKeepalive,
+		MaxIdleTimeout:  connectionIdleTimeout,
+		// No datagrams are sent; the limit on their size exposes what path MTU discovery found
+		EnableDatagrams: true,
+	}
+}
+
+// connectionIdleTimeout is ConnectionIdleTimeout, shortened by tests that drop a connection
+var connectionIdleTimeout = ConnectionIdleTimeout
+
 
 
 // SendQUICMessage sends a simple message over QUIC for testing the protocol foundation
@@ -21,7 +35,7 @@ func SendQUICMessage(peerAddr, message string) error {
 	tlsConfig := GetClientTLSConfig()
 
 	// Dial QUIC connection
-	conn, err := quic.DialAddr(ctx, peerAddr, tlsConfig, nil)
+	conn, err := quic.DialAddr(ctx, peerAddr, tlsConfig, newQUICConfig())
 	if err != nil {
 		return fmt.Errorf("failed to dial QUIC: %w", err)
 	}
@@ -40,7 +54,14 @@ func SendQUICMessage(peerAddr, message string) error {
 		return fmt.Errorf("failed to write message: %w", err)
 	}
 
-	fmt.Printf("Sent QUIC message: %s\n", message)
+	// Close our side of the stream and let the receiver close the connection once it has read the message
+	stream.Close()
+	select {
+	case <-conn.Context().Done():
+	case <-ctx.Done():
+	}
+
+	logf("Sent QUIC message: %s\n", message)
 	return nil
 }
 
@@ -53,7 +74,7 @@ func ReceiveQUICMessage(port string) error {
 	}
 
 	// Create UDP listener
-	addr, err := net.ResolveUDPAddr("udp", ":"+port)
+	addr, err := net.ResolveUDPAddr("udp", listenAddress(port))
 	if err != nil {
 		return fmt.Errorf("failed to resolve UDP address: %w", err)
 	}
@@ -64,10 +85,10 @@ func ReceiveQUICMessage(port string) error {
 	}
 	defer conn.Close()
 
-	fmt.Printf("Listening for QUIC connections on port %s...\n", port)
+	logf("Listening for QUIC connections on port %s...\n", port)
 
 	// Create QUIC listener
-	listener, err := quic.Listen(conn, tlsConfig, nil)
+	listener, err := quic.Listen(conn, tlsConfig, newQUICConfig())
 	if err != nil {
 		return fmt.Errorf("failed to create QUIC listener: %w", err)
 	}
@@ -83,7 +104,7 @@ func ReceiveQUICMessage(port string) error {
 	}
 	defer quicConn.CloseWithError(0, "")
 
-	fmt.Println("Accepted QUIC connection")
+	logln("Accepted QUIC connection")
 
 	// Accept stream
 	stream, err := quicConn.AcceptStream(ctx)
@@ -101,9 +122,9 @@ func ReceiveQUICMessage(port string) error {
 
 	if n > 0 {
 		receivedMessage := string(buffer[:n])
-		fmt.Printf("Received QUIC message: %s\n", receivedMessage)
+		logf("Received QUIC message: %s\n", receivedMessage)
 	} else {
-		fmt.Printf("Received empty QUIC message\n")
+		logf("Received empty QUIC message\n")
 	}
 
 	return nil
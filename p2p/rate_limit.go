@@ -0,0 +1,111 @@
+package p2p
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket shared by every chunk stream of a session, so the
+// aggregate send rate stays bounded however many chunks are in flight.
+type rateLimiter struct {
+	mutex  sync.Mutex
+	rate   float64 // bytes per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter creates a limiter for bytesPerSecond; zero or negative means unlimited (nil)
+func newRateLimiter(bytesPerSecond int64) *rateLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+
+	// Allow roughly 100ms of traffic as a burst, but never less than one write
+	burst := float64(bytesPerSecond) / 10
+	if burst < ChunkBufferSize {
+		burst = ChunkBufferSize
+	}
+
+	return &rateLimiter{
+		rate:   float64(bytesPerSecond),
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// WaitN blocks until n bytes may be sent. Tokens are reserved up front, so concurrent
+// callers queue up behind each other instead of all waking at once.
+func (l *rateLimiter) WaitN(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mutex.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mutex.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rateLimitedWriter paces writes through a shared rateLimiter in small pieces
+type rateLimitedWriter struct {
+	ctx     context.Context
+	writer  io.Writer
+	limiter *rateLimiter
+}
+
+// newRateLimitedWriter wraps writer; with a nil limiter the writer is returned unchanged
+func newRateLimitedWriter(ctx context.Context, writer io.Writer, limiter *rateLimiter) io.Writer {
+	if limiter == nil {
+		return writer
+	}
+	return &rateLimitedWriter{ctx: ctx, writer: writer, limiter: limiter}
+}
+
+// Write sends p in ChunkBufferSize pieces, waiting for tokens before each one
+func (w *rateLimitedWriter) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		end := written + ChunkBufferSize
+		if end > len(p) {
+			end = len(p)
+		}
+
+		if err := w.limiter.WaitN(w.ctx, end-written); err != nil {
+			return written, err
+		}
+
+		n, err := w.writer.Write(p[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,50 @@
+package p2p
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBoundsAggregateRate(t *testing.T) {
+	limiter := newRateLimiter(1024 * 1024) // 1 MiB/s
+
+	// Three concurrent writers share the bucket, 256 KiB each
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var buf bytes.Buffer
+			writer := newRateLimitedWriter(context.Background(), &buf, limiter)
+			if _, err := writer.Write(make([]byte, 256*1024)); err != nil {
+				t.Errorf("Write failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	// 768 KiB minus the ~100 KiB burst at 1 MiB/s takes about 650ms
+	if elapsed < 500*time.Millisecond {
+		t.Errorf("Expected aggregate rate to be limited, finished in %v", elapsed)
+	}
+	if elapsed > 3*time.Second {
+		t.Errorf("Rate limiting took too long: %v", elapsed)
+	}
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	if limiter := newRateLimiter(0); limiter != nil {
+		t.Fatal("Expected zero rate to mean unlimited")
+	}
+
+	var buf bytes.Buffer
+	writer := newRateLimitedWriter(context.Background(), &buf, nil)
+	if writer != &buf {
+		t.Error("Expected unlimited writer to be returned unchanged")
+	}
+}
@@ -0,0 +1,189 @@
+package p2p
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// flakyProxy forwards UDP between clients and a target, and once dropAfter bytes from clients
+// have gone through it drops everything for outage, so both ends see the connection go idle
+type flakyProxy struct {
+	conn      *net.UDPConn
+	target    *net.UDPAddr
+	dropAfter int64
+	outage    time.Duration
+
+	mutex       sync.Mutex
+	upstreams   map[string]*net.UDPConn
+	forwarded   int64
+	outageUntil time.Time
+}
+
+func newFlakyProxy(t *testing.T, target string, dropAfter int64, outage time.Duration) *flakyProxy {
+	t.Helper()
+
+	targetAddr, err := net.ResolveUDPAddr("udp", target)
+	if err != nil {
+		t.Fatalf("Failed to resolve target: %v", err)
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Failed to open proxy socket: %v", err)
+	}
+	proxy := &flakyProxy{conn: conn, target: targetAddr, dropAfter: dropAfter, outage: outage, upstreams: make(map[string]*net.UDPConn)}
+	t.Cleanup(proxy.close)
+	go proxy.serve()
+	return proxy
+}
+
+func (p *flakyProxy) addr() string {
+	return p.conn.LocalAddr().String()
+}
+
+// dropping reports whether packets are being dropped, starting the outage once enough has been
+// forwarded
+func (p *flakyProxy) dropping(clientBytes int) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	now := time.Now()
+	if p.outageUntil.IsZero() {
+		p.forwarded += int64(clientBytes)
+		if p.forwarded >= p.dropAfter {
+			p.outageUntil = now.Add(p.outage)
+		}
+		return false
+	}
+	return now.Before(p.outageUntil)
+}
+
+func (p *flakyProxy) serve() {
+	buffer := make([]byte, 65536)
+	for {
+		n, client, err := p.conn.ReadFromUDP(buffer)
+		if err != nil {
+			return
+		}
+		if p.dropping(n) {
+			continue
+		}
+
+		p.mutex.Lock()
+		upstream, ok := p.upstreams[client.String()]
+		if !ok {
+			upstream, err = net.DialUDP("udp", nil, p.target)
+			if err != nil {
+				p.mutex.Unlock()
+				continue
+			}
+			p.upstreams[client.String()] = upstream
+			go p.serveReplies(upstream, client)
+		}
+		p.mutex.Unlock()
+		upstream.Write(buffer[:n])
+	}
+}
+
+func (p *flakyProxy) serveReplies(upstream *net.UDPConn, client *net.UDPAddr) {
+	buffer := make([]byte, 65536)
+	for {
+		n, err := upstream.Read(buffer)
+		if err != nil {
+			return
+		}
+		if p.dropping(0) {
+			continue
+		}
+		p.conn.WriteToUDP(buffer[:n], client)
+	}
+}
+
+func (p *flakyProxy) close() {
+	p.conn.Close()
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, upstream := range p.upstreams {
+		upstream.Close()
+	}
+}
+
+func TestSenderReconnectsAfterConnectionLoss(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	// Make both ends notice the outage quickly
+	connectionIdleTimeout = 500 * time.Millisecond
+	defer func() { connectionIdleTimeout = ConnectionIdleTimeout }()
+
+	testContent := make([]byte, 40*MinChunkSize+321)
+	for i := range testContent {
+		testContent[i] = byte(i * 31 % 251)
+	}
+	testFile := filepath.Join(t.TempDir(), "flaky.bin")
+	if err := os.WriteFile(testFile, testContent, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	receiverConfig := DefaultReceiverConfig()
+	receiverConfig.OutputDir = t.TempDir()
+
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), receiverConfig)
+	}()
+
+	// Give receiver time to start
+	time.Sleep(100 * time.Millisecond)
+
+	proxy := newFlakyProxy(t, fmt.Sprintf("127.0.0.1:%d", port), int64(len(testContent)/2), 1500*time.Millisecond)
+
+	senderConfig := DefaultSenderConfig()
+	senderConfig.ChunkSize = MinChunkSize
+	if err := SendFileChunkedWithConfig(testFile, proxy.addr(), senderConfig); err != nil {
+		t.Fatalf("Sender failed: %v", err)
+	}
+
+	select {
+	case err := <-receiverDone:
+		if err != nil {
+			t.Fatalf("Receiver failed: %v", err)
+		}
+	case <-time.After(20 * time.Second):
+		t.Fatal("Test timed out")
+	}
+
+	receivedContent, err := os.ReadFile(filepath.Join(receiverConfig.OutputDir, "received_flaky.bin"))
+	if err != nil {
+		t.Fatalf("Failed to read received file: %v", err)
+	}
+	if string(receivedContent) != string(testContent) {
+		t.Fatal("File content mismatch")
+	}
+}
+
+func TestIsConnectionLost(t *testing.T) {
+	if !isConnectionLost(fmt.Errorf("failed to send chunk 3: %w", &quic.IdleTimeoutError{})) {
+		t.Error("Expected an idle timeout to count as a lost connection")
+	}
+	if isConnectionLost(fmt.Errorf("failed: %w", &quic.ApplicationError{Remote: true})) {
+		t.Error("Expected the receiver closing the connection not to count as lost")
+	}
+	if isConnectionLost(errors.New("chunk 3 was not received successfully")) {
+		t.Error("Expected a transfer error not to count as a lost connection")
+	}
+}
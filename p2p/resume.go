@@ -0,0 +1,259 @@
+package p2p
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// ProgressFileSuffix is appended to a partial output file to name its resume sidecar
+const ProgressFileSuffix = ".landrop-progress"
+
+// PartialFileSuffix is appended to an output file's name while it's being received. The file only
+// gets its final name once it has been verified, so an interrupted or corrupted transfer never
+// leaves something under that name that looks complete.
+const PartialFileSuffix = ".part"
+
+// chunkProgress records which chunks of a partial output file have been written and verified.
+// It's persisted next to the output file so an interrupted transfer can resume with only the missing chunks.
+type chunkProgress struct {
+	FileHash  string `json:"file_hash"`
+	FileSize  int64  `json:"file_size"`
+	ChunkSize int64  `json:"chunk_size"`
+	Bitmap    []byte `json:"bitmap"` // bit i set means chunk i is on disk
+
+	// HashAlgorithm and Checksums record each received chunk's checksum, so a receiver with
+	// ReceiverConfig.VerifyExisting can check the chunks on disk before resuming. Unset otherwise.
+	HashAlgorithm string           `json:"hash_algorithm,omitempty"`
+	Checksums     map[int64]string `json:"checksums,omitempty"`
+
+	path string
+}
+
+// partialFilePath returns the path an output file is written to until it has been verified
+func partialFilePath(outputFilename string) string {
+	return outputFilename + PartialFileSuffix
+}
+
+// progressFilePath returns the sidecar path for an output file
+func progressFilePath(outputFilename string) string {
+	return outputFilename + ProgressFileSuffix
+}
+
+// newChunkProgress creates a bitmap where every chunk except the required ones is marked as received
+func newChunkProgress(outputFilename, fileHash string, fileSize, chunkSize int64, requiredChunks []int) *chunkProgress {
+	progress := &chunkProgress{
+		FileHash:  fileHash,
+		FileSize:  fileSize,
+		ChunkSize: chunkSize,
+		path:      progressFilePath(outputFilename),
+	}
+
+	totalChunks := progress.totalChunks()
+	progress.Bitmap = make([]byte, (totalChunks+7)/8)
+	for i := int64(0); i < totalChunks; i++ {
+		progress.set(i)
+	}
+	for _, chunkIndex := range requiredChunks {
+		progress.clear(int64(chunkIndex))
+	}
+
+	return progress
+}
+
+// loadChunkProgress reads the sidecar for an output file. It fails if the sidecar is missing
+// or was written for a different file, size or chunk size, since its bitmap can't be trusted then.
+func loadChunkProgress(outputFilename, fileHash string, fileSize, chunkSize int64) (*chunkProgress, error) {
+	data, err := os.ReadFile(progressFilePath(outputFilename))
+	if err != nil {
+		return nil, err
+	}
+
+	var progress chunkProgress
+	if err := json.Unmarshal(data, &progress); err != nil {
+		return nil, fmt.Errorf("%w: invalid progress file: %v", ErrFileCorrupted, err)
+	}
+
+	if progress.FileHash != fileHash || progress.FileSize != fileSize || progress.ChunkSize != chunkSize {
+		return nil, fmt.Errorf("progress file belongs to a different transfer")
+	}
+	if int64(len(progress.Bitmap)) != (progress.totalChunks()+7)/8 {
+		return nil, fmt.Errorf("%w: progress bitmap has the wrong length", ErrFileCorrupted)
+	}
+
+	progress.path = progressFilePath(outputFilename)
+	return &progress, nil
+}
+
+// totalChunks returns the number of chunks the file is split into
+func (p *chunkProgress) totalChunks() int64 {
+	if p.ChunkSize <= 0 {
+		return 0
+	}
+	return (p.FileSize + p.ChunkSize - 1) / p.ChunkSize
+}
+
+// has reports whether a chunk has already been received
+func (p *chunkProgress) has(chunkIndex int64) bool {
+	if chunkIndex < 0 || chunkIndex >= p.totalChunks() {
+		return false
+	}
+	return p.Bitmap[chunkIndex/8]&(1<<(chunkIndex%8)) != 0
+}
+
+// set marks a chunk as received
+func (p *chunkProgress) set(chunkIndex int64) {
+	if chunkIndex >= 0 && chunkIndex < p.totalChunks() {
+		p.Bitmap[chunkIndex/8] |= 1 << (chunkIndex % 8)
+	}
+}
+
+// clear marks a chunk as missing
+func (p *chunkProgress) clear(chunkIndex int64) {
+	if chunkIndex >= 0 && chunkIndex < p.totalChunks() {
+		p.Bitmap[chunkIndex/8] &^= 1 << (chunkIndex % 8)
+	}
+}
+
+// missingChunks returns the indices of chunks that haven't been received yet
+func (p *chunkProgress) missingChunks() []int {
+	missing := make([]int, 0)
+	for i := int64(0); i < p.totalChunks(); i++ {
+		if !p.has(i) {
+			missing = append(missing, int(i))
+		}
+	}
+	return missing
+}
+
+// markReceived records a written and verified chunk and persists the bitmap
+func (p *chunkProgress) markReceived(chunkIndex int64) error {
+	p.set(chunkIndex)
+	return p.save()
+}
+
+// trackChecksums makes the sidecar record chunk checksums computed with hashAlgorithm, starting
+// from those of chunks already on disk
+func (p *chunkProgress) trackChecksums(hashAlgorithm string, existing map[int64]string) {
+	p.HashAlgorithm = hashAlgorithm
+	p.Checksums = make(map[int64]string, len(existing))
+	for chunkIndex, checksum := range existing {
+		if p.has(chunkIndex) {
+			p.Checksums[chunkIndex] = checksum
+		}
+	}
+}
+
+// recordChecksum stores a received chunk's checksum if the sidecar tracks them; markReceived
+// persists it
+func (p *chunkProgress) recordChecksum(chunkIndex int64, checksum string) {
+	if p.Checksums != nil {
+		p.Checksums[chunkIndex] = checksum
+	}
+}
+
+// verifyExistingChunks re-hashes the chunks of a partial output file that its sidecar records as
+// received. It returns those that no longer match their stored checksum, or that were recorded
+// without one, along with the checksums of the chunks that passed. Without a usable sidecar it
+// returns nothing, since getRequiredChunks then decides from the file's contents.
+func verifyExistingChunks(outputFilename string, request *TransferRequest) ([]int, map[int64]string) {
+	progress, err := loadChunkProgress(outputFilename, request.resumeKey(), request.FileSize, request.ChunkSize)
+	if err != nil {
+		return nil, nil
+	}
+	file, err := os.Open(outputFilename)
+	if err != nil {
+		return nil, nil
+	}
+	defer file.Close()
+
+	var failed []int
+	verified := make(map[int64]string)
+	for chunkIndex := int64(0); chunkIndex < progress.totalChunks(); chunkIndex++ {
+		if !progress.has(chunkIndex) {
+			continue
+		}
+		stored, ok := progress.Checksums[chunkIndex]
+		if ok && progress.HashAlgorithm == normalizeHashAlgorithm(request.HashAlgorithm) {
+			checksum, err := hashChunk(file, progress.HashAlgorithm, chunkIndex, progress.ChunkSize, progress.FileSize)
+			if err == nil && checksum == stored {
+				verified[chunkIndex] = checksum
+				continue
+			}
+		}
+		failed = append(failed, int(chunkIndex))
+	}
+	return failed, verified
+}
+
+// mergeChunks returns the sorted union of two lists of chunk indices
+func mergeChunks(chunks, more []int) []int {
+	merged := slices.Concat(chunks, more)
+	slices.Sort(merged)
+	return slices.Compact(merged)
+}
+
+// reset marks every chunk as missing, used when the assembled file fails verification
+func (p *chunkProgress) reset() error {
+	for i := range p.Bitmap {
+		p.Bitmap[i] = 0
+	}
+	return p.save()
+}
+
+// save writes the sidecar atomically so a crash never leaves a half-written bitmap behind
+func (p *chunkProgress) save() error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to serialize transfer progress: %w", err)
+	}
+
+	tmpPath := p.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write transfer progress: %w", err)
+	}
+	if err := os.Rename(tmpPath, p.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write transfer progress: %w", err)
+	}
+	return nil
+}
+
+// remove deletes the sidecar once the file is complete
+func (p *chunkProgress) remove() error {
+	if err := os.Remove(p.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove transfer progress: %w", err)
+	}
+	return nil
+}
+
+// canWriteChunkedOutput reports whether the final output path is free or already holds an identical
+// complete copy, and its partial file is free or holds this transfer's data. Any other file under
+// the final name is unrelated and must not be overwritten, and a partial file recorded for another
+// transfer is kept so that one can still resume. Without an upfront hash a complete copy can't be
+// recognized, so it's treated as unrelated.
+func canWriteChunkedOutput(path string, request *TransferRequest) bool {
+	info, err := os.Stat(path)
+	if err == nil {
+		return !info.IsDir() && !request.HashTrailer && info.Size() == request.FileSize && verifyFileIntegrity(path, request.HashAlgorithm, request.FileHash)
+	}
+	if !os.IsNotExist(err) {
+		return false
+	}
+
+	partialPath := partialFilePath(path)
+	info, err = os.Stat(partialPath)
+	if os.IsNotExist(err) {
+		return true
+	}
+	if err != nil || info.IsDir() {
+		return false
+	}
+	if _, err := os.Stat(progressFilePath(partialPath)); os.IsNotExist(err) {
+		// Nothing records what the partial file belongs to, so the holes check decides what to keep
+		return true
+	}
+	_, err = loadChunkProgress(partialPath, request.resumeKey(), request.FileSize, request.ChunkSize)
+	return err == nil
+}
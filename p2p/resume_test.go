@@ -0,0 +1,126 @@
+package p2p
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGetRequiredChunksFromProgress(t *testing.T) {
+	outputFile := filepath.Join(t.TempDir(), "received_partial.bin")
+	if err := os.WriteFile(outputFile, make([]byte, 3072), 0644); err != nil {
+		t.Fatalf("Failed to create partial file: %v", err)
+	}
+
+	// Chunks 0 and 2 were received out of order, 1 and 3 are still missing
+	progress := newChunkProgress(outputFile, "abc123", 4000, 1024, []int{0, 1, 2, 3})
+	if err := progress.markReceived(2); err != nil {
+		t.Fatalf("Failed to record chunk: %v", err)
+	}
+	if err := progress.markReceived(0); err != nil {
+		t.Fatalf("Failed to record chunk: %v", err)
+	}
+
+	chunks := getRequiredChunks(outputFile, "abc123", 4000, 1024)
+	if len(chunks) != 2 || chunks[0] != 1 || chunks[1] != 3 {
+		t.Errorf("Expected chunks [1 3], got %v", chunks)
+	}
+
+	// A sidecar written for a different file is ignored, and the zero-filled file holds no chunks
+	chunks = getRequiredChunks(outputFile, "other", 4000, 1024)
+	if len(chunks) != 4 {
+		t.Errorf("Expected every chunk for mismatched progress, got %v", chunks)
+	}
+
+	if err := progress.remove(); err != nil {
+		t.Fatalf("Failed to remove progress file: %v", err)
+	}
+	if _, err := os.Stat(progressFilePath(outputFile)); !os.IsNotExist(err) {
+		t.Errorf("Expected progress file to be removed, got %v", err)
+	}
+}
+
+func TestVerifyExistingReceivesCorruptedChunksAgain(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	chunkSize := MinChunkSize
+	testContent := make([]byte, 4*chunkSize)
+	for i := range testContent {
+		testContent[i] = byte(i * 31 % 251)
+	}
+	testFile := filepath.Join(t.TempDir(), "verified.bin")
+	if err := os.WriteFile(testFile, testContent, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	info, err := os.Stat(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An earlier attempt stored chunks 0-2 with their checksums, but chunk 1 was damaged since
+	receiverConfig := DefaultReceiverConfig()
+	receiverConfig.OutputDir = t.TempDir()
+	receiverConfig.VerifyExisting = true
+	partial := partialFilePath(filepath.Join(receiverConfig.OutputDir, "received_verified.bin"))
+	request := &TransferRequest{FileSize: int64(len(testContent)), ChunkSize: chunkSize, HashTrailer: true, SourceID: fileSourceID(testFile, info), HashAlgorithm: HashSHA256}
+	progress := newChunkProgress(partial, request.resumeKey(), request.FileSize, chunkSize, []int{3})
+	checksums := make(map[int64]string)
+	for chunkIndex := int64(0); chunkIndex < 3; chunkIndex++ {
+		checksums[chunkIndex] = calculateTestHash(t, testContent[chunkIndex*chunkSize:(chunkIndex+1)*chunkSize])
+	}
+	progress.trackChecksums(HashSHA256, checksums)
+	if err := progress.save(); err != nil {
+		t.Fatalf("Failed to save progress: %v", err)
+	}
+	damaged := append([]byte(nil), testContent[:3*chunkSize]...)
+	damaged[chunkSize+10] ^= 0xff
+	if err := os.WriteFile(partial, damaged, 0644); err != nil {
+		t.Fatalf("Failed to create partial file: %v", err)
+	}
+
+	if failed, verified := verifyExistingChunks(partial, request); len(failed) != 1 || failed[0] != 1 || len(verified) != 2 {
+		t.Fatalf("Expected chunk 1 to fail and chunks 0 and 2 to pass, got %v and %v", failed, verified)
+	}
+
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), receiverConfig)
+	}()
+
+	// Give receiver time to start
+	time.Sleep(100 * time.Millisecond)
+
+	senderConfig := DefaultSenderConfig()
+	senderConfig.ChunkSize = chunkSize
+	if err := SendFileChunkedWithConfig(testFile, fmt.Sprintf("127.0.0.1:%d", port), senderConfig); err != nil {
+		t.Fatalf("Sender failed: %v", err)
+	}
+	select {
+	case err := <-receiverDone:
+		if err != nil {
+			t.Fatalf("Receiver failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Test timed out")
+	}
+
+	receivedContent, err := os.ReadFile(filepath.Join(receiverConfig.OutputDir, "received_verified.bin"))
+	if err != nil {
+		t.Fatalf("Failed to read received file: %v", err)
+	}
+	if string(receivedContent) != string(testContent) {
+		t.Fatal("File content mismatch")
+	}
+}
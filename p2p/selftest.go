@@ -0,0 +1,129 @@
+package p2p
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// DefaultSelfTestSize is the size of the file SelfTest transfers when none is given
+const DefaultSelfTestSize = 64 * 1024 * 1024
+
+// SelfTestResult reports a loopback transfer run by SelfTest
+type SelfTestResult struct {
+	Size     int64
+	Duration time.Duration
+	Speed    float64 // in MB/s
+}
+
+// SelfTest sends a generated file of size bytes to a receiver in this process over loopback and
+// checks it arrives intact, exercising TLS, the QUIC listener and the chunked protocol without a
+// second device. The receiver doesn't answer discovery, so other peers never see it.
+func SelfTest(ctx context.Context, size int64) (SelfTestResult, error) {
+	if size <= 0 {
+		return SelfTestResult{}, fmt.Errorf("self-test size must be positive")
+	}
+	tlsConfig := GetServerTLSConfig()
+	if tlsConfig == nil {
+		return SelfTestResult{}, fmt.Errorf("failed to get server TLS config")
+	}
+
+	dir, err := os.MkdirTemp("", "landrop-self-test-")
+	if err != nil {
+		return SelfTestResult{}, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "self-test.bin")
+	if err := writeRandomFile(source, size); err != nil {
+		return SelfTestResult{}, err
+	}
+	sourceHash, err := calculateFileHash(source)
+	if err != nil {
+		return SelfTestResult{}, err
+	}
+
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return SelfTestResult{}, fmt.Errorf("failed to listen on UDP: %w", err)
+	}
+	defer udpConn.Close()
+	listener, err := quic.Listen(udpConn, tlsConfig, newQUICConfig())
+	if err != nil {
+		return SelfTestResult{}, fmt.Errorf("failed to create QUIC listener: %w", err)
+	}
+	defer listener.Close()
+
+	receiverConfig := DefaultReceiverConfig()
+	receiverConfig.OutputDir = filepath.Join(dir, "received")
+	receiverConfig.AutoAccept = true
+	receiverConfig.Quiet = true
+	if err := ensureOutputDir(receiverConfig.OutputDir); err != nil {
+		return SelfTestResult{}, err
+	}
+
+	receiveCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	receiverDone := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept(receiveCtx)
+		if err != nil {
+			receiverDone <- fmt.Errorf("failed to accept QUIC connection: %w", err)
+			return
+		}
+		_, err = serveChunkedConnection(receiveCtx, conn, receiverConfig, newActiveOutputs())
+		receiverDone <- err
+	}()
+
+	senderConfig := DefaultSenderConfig()
+	senderConfig.Quiet = true
+	senderConfig.DialAttempts = 1
+	start := time.Now()
+	sendErr := SendFileChunkedWithConfig(source, udpConn.LocalAddr().String(), senderConfig)
+	duration := time.Since(start)
+	if sendErr != nil {
+		cancel()
+	}
+	receiveErr := <-receiverDone
+	if sendErr != nil {
+		return SelfTestResult{}, fmt.Errorf("sending failed: %w", sendErr)
+	}
+	if receiveErr != nil {
+		return SelfTestResult{}, fmt.Errorf("receiving failed: %w", receiveErr)
+	}
+
+	// A rejected transfer isn't an error for the sender, so check what actually arrived
+	receivedHash, err := calculateFileHash(filepath.Join(receiverConfig.OutputDir, "received_self-test.bin"))
+	if err != nil {
+		return SelfTestResult{}, fmt.Errorf("received file is missing: %w", err)
+	}
+	if receivedHash != sourceHash {
+		return SelfTestResult{}, fmt.Errorf("received file doesn't match the one sent")
+	}
+
+	result := SelfTestResult{Size: size, Duration: duration}
+	if duration > 0 {
+		result.Speed = float64(size) / duration.Seconds() / (1024 * 1024)
+	}
+	return result, nil
+}
+
+// writeRandomFile fills a new file at path with size random bytes, so compression can't flatter
+// the result
+func writeRandomFile(path string, size int64) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create test file: %w", err)
+	}
+	if _, err := io.CopyN(file, rand.Reader, size); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write test file: %w", err)
+	}
+	return file.Close()
+}
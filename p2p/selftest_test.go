@@ -0,0 +1,20 @@
+package p2p
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	result, err := SelfTest(context.Background(), 3*MinChunkSize+17)
+	if err != nil {
+		t.Fatalf("Self-test failed: %v", err)
+	}
+	if result.Size != 3*MinChunkSize+17 || result.Duration <= 0 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	if _, err := SelfTest(context.Background(), 0); err == nil {
+		t.Error("Expected an empty self-test to be rejected")
+	}
+}
@@ -0,0 +1,299 @@
+package p2p
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SettingsFileName is the CLI's configuration file kept in ~/.landrop
+const SettingsFileName = "config.toml"
+
+// Settings keys, as written in the configuration file
+const (
+	SettingPort       = "port"
+	SettingOutputDir  = "output_dir"
+	SettingChunkSize  = "chunk_size"
+	SettingAutoAccept = "auto_accept"
+	SettingMaxSize    = "max_size"
+	SettingColor      = "color"
+)
+
+// settingKeys lists every key in the order the configuration is printed
+var settingKeys = []string{SettingPort, SettingOutputDir, SettingChunkSize, SettingAutoAccept, SettingMaxSize, SettingColor}
+
+// Environment variables for test runs, which aren't settings the configuration file can hold
+const (
+	// TestModeEnvVar accepts every transfer without prompting when set to "1" or "true"
+	TestModeEnvVar = "LANDROP_TEST_MODE"
+	// TestingModeEnvVar skips certificate verification when set to "1" or "true"
+	TestingModeEnvVar = "LANDROP_TESTING_MODE"
+)
+
+// SettingEnvVar returns the environment variable that overrides the setting key, e.g. LANDROP_PORT
+func SettingEnvVar(key string) string {
+	return "LANDROP_" + strings.ToUpper(key)
+}
+
+// envEnabled reports whether the environment variable name is set to "1" or "true"
+func envEnabled(name string) bool {
+	value := strings.ToLower(os.Getenv(name))
+	return value == "1" || value == "true"
+}
+
+// Settings are the defaults the CLI starts from, read from ~/.landrop/config.toml and then from
+// LANDROP_* environment variables, which win over the file. Command-line flags take precedence
+// over both.
+type Settings struct {
+	Port       string // port receivers listen on
+	OutputDir  string // directory received files are written to (empty means the current directory)
+	ChunkSize  int64  // chunk size senders use
+	AutoAccept bool   // accept incoming transfers without prompting
+	MaxSize    int64  // largest file receivers accept (zero means unlimited)
+	Color      bool   // colored output
+
+	origins map[string]string // where each key not left at its default was set: a file or a variable
+}
+
+// DefaultSettings returns the settings used for keys the configuration file doesn't set
+func DefaultSettings() Settings {
+	return Settings{
+		Port:      DefaultPort,
+		ChunkSize: DefaultChunkSize,
+		Color:     true,
+	}
+}
+
+// DefaultSettingsPath returns ~/.landrop/config.toml
+func DefaultSettingsPath() (string, error) {
+	dir, err := landropConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, SettingsFileName), nil
+}
+
+// LoadSettings reads the configuration file at path over the defaults, then the environment
+// variables over both. A missing file isn't an error, since every key has a default.
+func LoadSettings(path string) (Settings, error) {
+	return loadSettings(path, os.LookupEnv)
+}
+
+// loadSettings is LoadSettings with the environment read through lookupEnv
+func loadSettings(path string, lookupEnv func(string) (string, bool)) (Settings, error) {
+	settings := DefaultSettings()
+	file, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return settings, fmt.Errorf("failed to open configuration file: %w", err)
+	}
+	if err == nil {
+		defer file.Close()
+		if err := settings.parse(file, path); err != nil {
+			return DefaultSettings(), err
+		}
+	}
+
+	if err := settings.applyEnv(lookupEnv); err != nil {
+		return DefaultSettings(), err
+	}
+	return settings, nil
+}
+
+// applyEnv applies every setting whose environment variable is set to a non-empty value
+func (s *Settings) applyEnv(lookupEnv func(string) (string, bool)) error {
+	for _, key := range settingKeys {
+		name := SettingEnvVar(key)
+		value, ok := lookupEnv(name)
+		if !ok || value == "" {
+			continue
+		}
+		// Environment values are never quoted, so each is taken as the type its setting expects
+		if err := s.set(key, strings.TrimSpace(value), key == SettingOutputDir); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		s.setOrigin(key, name)
+	}
+	return nil
+}
+
+// setOrigin records where key was set
+func (s *Settings) setOrigin(key, origin string) {
+	if s.origins == nil {
+		s.origins = make(map[string]string)
+	}
+	s.origins[key] = origin
+}
+
+// Origin returns where key was set: the configuration file's path, its environment variable, or
+// "default"
+func (s Settings) Origin(key string) string {
+	if origin, ok := s.origins[key]; ok {
+		return origin
+	}
+	return "default"
+}
+
+// parse applies the key = value lines read from r, the file at path. Only the flat subset of TOML
+// these settings need is understood: comments, strings, integers and booleans.
+func (s *Settings) parse(r io.Reader, path string) error {
+	scanner := bufio.NewScanner(r)
+	seen := make(map[string]bool)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if strings.HasPrefix(text, "[") {
+			return fmt.Errorf("%s:%d: tables aren't supported; set keys at the top level", path, line)
+		}
+
+		key, raw, ok := strings.Cut(text, "=")
+		if !ok {
+			return fmt.Errorf("%s:%d: expected key = value", path, line)
+		}
+		key = strings.TrimSpace(key)
+		if seen[key] {
+			return fmt.Errorf("%s:%d: %s is set more than once", path, line, key)
+		}
+		seen[key] = true
+
+		value, quoted, err := parseTOMLValue(raw)
+		if err == nil {
+			err = s.set(key, value, quoted)
+		}
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		s.setOrigin(key, path)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read configuration file: %w", err)
+	}
+	return nil
+}
+
+// set parses value as the setting key. quoted tells strings apart from bare integers and booleans.
+func (s *Settings) set(key, value string, quoted bool) error {
+	switch key {
+	case SettingPort:
+		if port, err := strconv.Atoi(value); err != nil || port <= 0 || port > 65535 {
+			return fmt.Errorf("invalid %s '%s'", key, value)
+		}
+		s.Port = value
+	case SettingOutputDir:
+		if !quoted {
+			return fmt.Errorf("%s must be a quoted string", key)
+		}
+		s.OutputDir = expandHome(value)
+	case SettingChunkSize:
+		size, err := ParseByteSize(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+		if err := ValidateChunkSize(size); err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+		s.ChunkSize = size
+	case SettingMaxSize:
+		size, err := ParseByteSize(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+		s.MaxSize = size
+	case SettingAutoAccept, SettingColor:
+		enabled, err := strconv.ParseBool(value)
+		if err != nil || quoted {
+			return fmt.Errorf("%s must be true or false", key)
+		}
+		if key == SettingAutoAccept {
+			s.AutoAccept = enabled
+		} else {
+			s.Color = enabled
+		}
+	default:
+		return fmt.Errorf("unknown setting '%s'", key)
+	}
+	return nil
+}
+
+// parseTOMLValue parses the right-hand side of a key = value line, which may end in a comment, and
+// reports whether it was a quoted string
+func parseTOMLValue(raw string) (string, bool, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", false, fmt.Errorf("missing value")
+	}
+
+	var value, rest string
+	quoted := raw[0] == '"' || raw[0] == '\''
+	switch raw[0] {
+	case '"':
+		// Basic strings use backslash escapes, which Go's string literal syntax covers
+		end := 1
+		for ; end < len(raw); end++ {
+			if raw[end] == '\\' {
+				end++
+			} else if raw[end] == '"' {
+				break
+			}
+		}
+		if end >= len(raw) {
+			return "", false, fmt.Errorf("unterminated string")
+		}
+		unquoted, err := strconv.Unquote(raw[:end+1])
+		if err != nil {
+			return "", false, fmt.Errorf("invalid string %s", raw[:end+1])
+		}
+		value, rest = unquoted, raw[end+1:]
+	case '\'':
+		// Literal strings have no escapes
+		end := strings.IndexByte(raw[1:], '\'')
+		if end < 0 {
+			return "", false, fmt.Errorf("unterminated string")
+		}
+		value, rest = raw[1:end+1], raw[end+2:]
+	default:
+		value, rest, _ = strings.Cut(raw, "#")
+		value, rest = strings.TrimSpace(value), ""
+	}
+
+	if rest = strings.TrimSpace(rest); rest != "" && !strings.HasPrefix(rest, "#") {
+		return "", false, fmt.Errorf("unexpected '%s' after the value", rest)
+	}
+	return value, quoted, nil
+}
+
+// expandHome replaces a leading ~/ with the user's home directory
+func expandHome(path string) string {
+	rest, ok := strings.CutPrefix(path, "~/")
+	if !ok {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, rest)
+}
+
+// WriteTOML writes the settings in the configuration file's format, noting where each was set
+func (s Settings) WriteTOML(w io.Writer) error {
+	values := map[string]string{
+		SettingPort:       s.Port,
+		SettingOutputDir:  strconv.Quote(s.OutputDir),
+		SettingChunkSize:  strconv.FormatInt(s.ChunkSize, 10),
+		SettingAutoAccept: strconv.FormatBool(s.AutoAccept),
+		SettingMaxSize:    strconv.FormatInt(s.MaxSize, 10),
+		SettingColor:      strconv.FormatBool(s.Color),
+	}
+	for _, key := range settingKeys {
+		if _, err := fmt.Fprintf(w, "%s = %s # %s\n", key, values[key], s.Origin(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package p2p
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), SettingsFileName)
+
+	// Without a file every key has its default
+	settings, err := LoadSettings(path)
+	if err != nil {
+		t.Fatalf("Expected a missing file to be fine, got %v", err)
+	}
+	if !reflect.DeepEqual(settings, DefaultSettings()) {
+		t.Errorf("Expected the defaults, got %+v", settings)
+	}
+
+	config := `# LanDrop settings
+port = 9090
+output_dir = "/srv/incoming"  # where files land
+chunk_size = "1M"
+auto_accept = true
+max_size = 2147483648
+color = false
+`
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatalf("Failed to write configuration file: %v", err)
+	}
+	settings, err = LoadSettings(path)
+	if err != nil {
+		t.Fatalf("Failed to load settings: %v", err)
+	}
+	if settings.Port != "9090" || settings.OutputDir != "/srv/incoming" || settings.ChunkSize != 1024*1024 ||
+		!settings.AutoAccept || settings.MaxSize != 2*1024*1024*1024 || settings.Color {
+		t.Errorf("Settings weren't read from the file: %+v", settings)
+	}
+	if settings.Origin(SettingPort) != path {
+		t.Errorf("Expected the port's origin to be the file, got %q", settings.Origin(SettingPort))
+	}
+
+	// What config prints can be loaded back as the same settings
+	var printed bytes.Buffer
+	if err := settings.WriteTOML(&printed); err != nil {
+		t.Fatalf("Failed to write settings: %v", err)
+	}
+	os.WriteFile(path, printed.Bytes(), 0600)
+	if reloaded, err := LoadSettings(path); err != nil || reloaded.Port != settings.Port || reloaded.ChunkSize != settings.ChunkSize || reloaded.OutputDir != settings.OutputDir {
+		t.Errorf("Expected the printed settings to load back, got %+v (%v)\n%s", reloaded, err, printed.String())
+	}
+}
+
+func TestLoadSettingsRejectsMistakes(t *testing.T) {
+	tests := []struct {
+		config string
+		want   string
+	}{
+		{"prot = 9090", "unknown setting"},
+		{"port = 70000", "invalid port"},
+		{"chunk_size = \"1K\"", "invalid chunk_size"},
+		{"auto_accept = yes", "true or false"},
+		{"output_dir = /tmp", "quoted string"},
+		{"output_dir = \"/tmp", "unterminated"},
+		{"port = 9090 9091", "invalid port"},
+		{"[receiver]", "tables"},
+		{"port = 1\nport = 2", "more than once"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), SettingsFileName)
+		os.WriteFile(path, []byte(tt.config), 0600)
+		settings, err := LoadSettings(path)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: expected an error about %q, got %v", tt.config, tt.want, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), path+":") {
+			t.Errorf("%q: expected the error to point at the file and line, got %v", tt.config, err)
+		}
+		if !reflect.DeepEqual(settings, DefaultSettings()) {
+			t.Errorf("%q: expected the defaults after an error, got %+v", tt.config, settings)
+		}
+	}
+}
+
+func TestEnvironmentOverridesSettingsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), SettingsFileName)
+	os.WriteFile(path, []byte("port = 9090\nchunk_size = \"1M\"\nauto_accept = false\n"), 0600)
+
+	env := map[string]string{
+		"LANDROP_PORT":        "7070",
+		"LANDROP_OUTPUT_DIR":  "/data",
+		"LANDROP_AUTO_ACCEPT": "1",
+		"LANDROP_COLOR":       "", // empty is the same as unset
+	}
+	lookupEnv := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	settings, err := loadSettings(path, lookupEnv)
+	if err != nil {
+		t.Fatalf("Failed to load settings: %v", err)
+	}
+	if settings.Port != "7070" || settings.OutputDir != "/data" || !settings.AutoAccept || !settings.Color {
+		t.Errorf("Expected the environment to win over the file, got %+v", settings)
+	}
+	if settings.ChunkSize != 1024*1024 || settings.Origin(SettingChunkSize) != path {
+		t.Errorf("Expected the file's chunk size to be kept, got %d from %q", settings.ChunkSize, settings.Origin(SettingChunkSize))
+	}
+	if settings.Origin(SettingPort) != "LANDROP_PORT" || settings.Origin(SettingMaxSize) != "default" {
+		t.Errorf("Unexpected origins: port from %q, max_size from %q", settings.Origin(SettingPort), settings.Origin(SettingMaxSize))
+	}
+
+	// A bad value names the variable it came from
+	env["LANDROP_CHUNK_SIZE"] = "huge"
+	if _, err := loadSettings(path, lookupEnv); err == nil || !strings.Contains(err.Error(), "LANDROP_CHUNK_SIZE") {
+		t.Errorf("Expected an error naming LANDROP_CHUNK_SIZE, got %v", err)
+	}
+}
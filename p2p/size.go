@@ -0,0 +1,81 @@
+package p2p
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits maps human-readable suffixes to their multipliers (binary units, matching DefaultChunkSize)
+var sizeUnits = map[string]int64{
+	"":    1,
+	"B":   1,
+	"K":   1024,
+	"KB":  1024,
+	"KIB": 1024,
+	"M":   1024 * 1024,
+	"MB":  1024 * 1024,
+	"MIB": 1024 * 1024,
+	"G":   1024 * 1024 * 1024,
+	"GB":  1024 * 1024 * 1024,
+	"GIB": 1024 * 1024 * 1024,
+}
+
+// ParseByteSize parses human-readable sizes like "512K", "1M" or "1.5GB" into bytes
+func ParseByteSize(value string) (int64, error) {
+	trimmed := strings.TrimSpace(value)
+	if trimmed == "" {
+		return 0, fmt.Errorf("empty size")
+	}
+
+	// Split the numeric prefix from the unit suffix
+	split := len(trimmed)
+	for i, r := range trimmed {
+		if (r < '0' || r > '9') && r != '.' {
+			split = i
+			break
+		}
+	}
+
+	number, unit := trimmed[:split], strings.ToUpper(strings.TrimSpace(trimmed[split:]))
+	multiplier, ok := sizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid size unit '%s' in '%s'", unit, value)
+	}
+
+	amount, err := strconv.ParseFloat(number, 64)
+	if err != nil || amount < 0 || math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return 0, fmt.Errorf("invalid size '%s'", value)
+	}
+
+	// float64(math.MaxInt64) rounds up to 2^63, so anything at or above it doesn't fit
+	bytes := amount * float64(multiplier)
+	if bytes >= float64(math.MaxInt64) {
+		return 0, fmt.Errorf("size '%s' is too large", value)
+	}
+	return int64(bytes), nil
+}
+
+// FormatByteSize formats a byte count with the largest binary unit that keeps it at or above 1, e.g. "1.50 GB"
+func FormatByteSize(bytes int64) string {
+	switch {
+	case bytes >= sizeUnits["G"]:
+		return fmt.Sprintf("%.2f GB", float64(bytes)/float64(sizeUnits["G"]))
+	case bytes >= sizeUnits["M"]:
+		return fmt.Sprintf("%.2f MB", float64(bytes)/float64(sizeUnits["M"]))
+	case bytes >= sizeUnits["K"]:
+		return fmt.Sprintf("%.2f KB", float64(bytes)/float64(sizeUnits["K"]))
+	default:
+		return fmt.Sprintf("%d B", bytes)
+	}
+}
+
+// ValidateChunkSize checks that a chunk size is within the supported range
+func ValidateChunkSize(chunkSize int64) error {
+	if chunkSize < MinChunkSize || chunkSize > MaxChunkSize {
+		return fmt.Errorf("chunk size %d must be between %d KB and %d MB",
+			chunkSize, MinChunkSize/1024, MaxChunkSize/(1024*1024))
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package p2p
+
+import "time"
+
+// SpeedWindow is how far back CurrentSpeed looks when measuring throughput
+const SpeedWindow = 5 * time.Second
+
+// speedSampleCapacity bounds the ring buffer; samples closer together than
+// SpeedWindow/speedSampleCapacity are merged so the buffer always spans the window
+const speedSampleCapacity = 50
+
+// speedSample is the byte count of a transfer at one moment
+type speedSample struct {
+	at    time.Time
+	bytes int64
+}
+
+// speedSamples is a fixed-size ring buffer of recent speedSamples, oldest overwritten first
+type speedSamples struct {
+	samples [speedSampleCapacity]speedSample
+	next    int // where the next sample goes
+	count   int
+}
+
+// add records bytes transferred so far at time at
+func (r *speedSamples) add(at time.Time, bytes int64) {
+	if r.count > 0 {
+		last := &r.samples[(r.next+speedSampleCapacity-1)%speedSampleCapacity]
+		if at.Sub(last.at) < SpeedWindow/speedSampleCapacity {
+			last.bytes = bytes
+			return
+		}
+	}
+
+	r.samples[r.next] = speedSample{at: at, bytes: bytes}
+	r.next = (r.next + 1) % speedSampleCapacity
+	if r.count < speedSampleCapacity {
+		r.count++
+	}
+}
+
+// rate returns the throughput in bytes per second between the newest sample at or before
+// now-window (or the oldest one kept) and now. A stalled transfer decays towards zero.
+func (r *speedSamples) rate(now time.Time, window time.Duration) float64 {
+	if r.count == 0 {
+		return 0
+	}
+
+	newest := r.samples[(r.next+speedSampleCapacity-1)%speedSampleCapacity]
+	base := newest
+	for i := 1; i <= r.count; i++ {
+		base = r.samples[(r.next+speedSampleCapacity-i)%speedSampleCapacity]
+		if now.Sub(base.at) >= window {
+			break
+		}
+	}
+
+	elapsed := now.Sub(base.at).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(newest.bytes-base.bytes) / elapsed
+}
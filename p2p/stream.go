@@ -0,0 +1,288 @@
+package p2p
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DefaultStreamName is the filename announced for data read from stdin
+const DefaultStreamName = "stdin"
+
+// SpoolToTempFile copies r into a temporary file called name so it can be hashed and sent
+// like any other file. The protocol needs the size and hash before the first chunk, so a
+// pipe has to be read to the end first. The returned cleanup removes the temporary file.
+func SpoolToTempFile(r io.Reader, name string) (string, func(), error) {
+	if name == "" {
+		name = DefaultStreamName
+	}
+	if filepath.Base(name) != name {
+		return "", nil, fmt.Errorf("invalid stream name '%s'", name)
+	}
+
+	dir, err := os.MkdirTemp("", "landrop-stream-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	path := filepath.Join(dir, name)
+	file, err := os.Create(path)
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		cleanup()
+		return "", nil, fmt.Errorf("failed to read input stream: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	return path, cleanup, nil
+}
+
+// SendStream sends size bytes read from r to a chunked receiver as a file called name, without
+// touching the filesystem. hash is the data's SHA-256 in hex, or empty to hash it while sending.
+func SendStream(r io.Reader, size int64, name, hash string, peerAddr string) error {
+	return SendStreamWithConfig(r, size, name, hash, peerAddr, DefaultSenderConfig())
+}
+
+// SendStreamWithConfig is SendStream with custom sender options; hash uses config.HashAlgorithm.
+// r is read once, in order, so a transfer whose connection drops isn't resumed. Like
+// SendFileChunkedWithConfig, a rejection isn't an error.
+func SendStreamWithConfig(r io.Reader, size int64, name, hash string, peerAddr string, config SenderConfig) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+	if name == "" || filepath.Base(name) != name {
+		return fmt.Errorf("invalid stream name '%s'", name)
+	}
+	if size < 0 {
+		return fmt.Errorf("invalid stream size %d", size)
+	}
+	config.Reconnects = 0
+
+	ctx, cancel := transferContext(context.Background(), config.TransferTimeout)
+	defer cancel()
+
+	session, err := openSendSession(ctx, peerAddr, config)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	err = session.sendStream(ctx, r, size, name, hash)
+	if errors.Is(err, ErrTransferRejected) {
+		return nil // Return nil instead of error since rejection is a normal outcome
+	}
+	return err
+}
+
+// sendStream sends size bytes from r as a file called name, announcing hash upfront if it's known
+func (s *sendSession) sendStream(ctx context.Context, r io.Reader, size int64, name, hash string) error {
+	hashAlgorithm := normalizeHashAlgorithm(s.config.HashAlgorithm)
+	chunkSize := s.config.ChunkSize
+	totalChunks := (size + chunkSize - 1) / chunkSize
+	logf("Preparing to send '%s' (%.2f MB, %d chunks) to %s\n", name, float64(size)/(1024*1024), totalChunks, s.peerAddr)
+
+	stats := NewTransferStats(name, size, int(totalChunks), s.peerAddr, "sent")
+	stats.FileHash = hash
+	stats.OnProgress = s.config.OnProgress
+	stats.SetQuiet(s.config.Quiet)
+	s.results = append(s.results, stats)
+	if s.config.OnResult != nil {
+		defer s.config.OnResult(stats)
+	}
+
+	request := NewTransferRequest(name, size, hash, chunkSize)
+	request.Compression = compressionForFile(s.config.Compression, name)
+	request.DryRun = s.config.DryRun
+	request.HashAlgorithm = hashAlgorithm
+	request.ChunkAcks = true
+	request.ContentType = s.config.ContentType
+	if hash == "" {
+		// Nothing identifies a stream across transfers, so the receiver mustn't resume another one
+		sourceID, err := randomSourceID()
+		if err != nil {
+			return err
+		}
+		request.HashTrailer = true
+		request.SourceID = sourceID
+	}
+
+	return s.sendData(ctx, request, &streamReaderAt{r: r}, name, stats)
+}
+
+// randomSourceID returns a TransferRequest.SourceID no other transfer has
+func randomSourceID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate source ID: %w", err)
+	}
+	return "stream-" + hex.EncodeToString(id), nil
+}
+
+// streamReaderAt serves the sender's in-order ReadAt calls from a plain reader, discarding the
+// data of chunks the receiver doesn't need. It can't go back to data it has already passed.
+type streamReaderAt struct {
+	mutex  sync.Mutex
+	r      io.Reader
+	offset int64
+}
+
+// ReadAt reads len(p) bytes at off, which mustn't be before the end of the previous read
+func (s *streamReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if off < s.offset {
+		return 0, fmt.Errorf("stream can't be read again from offset %d", off)
+	}
+	if off > s.offset {
+		skipped, err := io.CopyN(io.Discard, s.r, off-s.offset)
+		s.offset += skipped
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := io.ReadFull(s.r, p)
+	s.offset += int64(n)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// ReceiveStream receives a single file from a chunked sender into w instead of the filesystem.
+// Chunks arriving out of order are held in memory until the data before them has been written,
+// up to MaxConcurrentChunks chunks; beyond that they aren't acknowledged until there's room.
+func ReceiveStream(port string, w io.Writer) error {
+	config := DefaultReceiverConfig()
+	config.Output = w
+	return ReceiveFileChunkedWithConfig(port, config)
+}
+
+// orderedWriter turns the receiver's out-of-order WriteAt calls into a sequential stream.
+// Data at the next expected offset is written through immediately, along with any buffered
+// chunks that follow it; everything else is held until the gap before it is filled.
+// The written bytes are hashed on the way so the stream can be verified without rereading it.
+type orderedWriter struct {
+	mutex        sync.Mutex
+	room         *sync.Cond // signalled when the stream advances or the writer is closed
+	w            io.Writer
+	hash         hash.Hash
+	next         int64
+	pending      map[int64][]byte
+	pendingBytes int64
+	window       int64 // most bytes held in pending before WriteAt waits
+	closed       bool
+}
+
+// newOrderedWriter creates an orderedWriter that writes to w starting at offset zero, hashing
+// with hashAlgorithm and buffering up to window bytes of out-of-order data
+func newOrderedWriter(w io.Writer, hashAlgorithm string, window int64) *orderedWriter {
+	o := &orderedWriter{
+		w:       w,
+		hash:    newHash(hashAlgorithm),
+		pending: make(map[int64][]byte),
+		window:  window,
+	}
+	o.room = sync.NewCond(&o.mutex)
+	return o
+}
+
+// WriteAt accepts data for any offset at or past the stream position. Data that was already
+// written, such as a chunk the sender retried, is ignored. Out-of-order data that won't fit in
+// the window waits for the stream to catch up, holding back the chunk's acknowledgement so the
+// sender can't run further ahead; the chunk at the stream position never waits, so it always
+// gets through. At least one chunk is buffered whatever its size.
+func (o *orderedWriter) WriteAt(p []byte, off int64) (int, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	for off > o.next && o.pending[off] == nil && o.pendingBytes > 0 && o.pendingBytes+int64(len(p)) > o.window {
+		if o.closed {
+			return 0, fmt.Errorf("stream closed with the chunk at offset %d still waiting", off)
+		}
+		o.room.Wait()
+	}
+	if off < o.next {
+		return len(p), nil
+	}
+	if off > o.next {
+		if _, ok := o.pending[off]; !ok {
+			o.pending[off] = append([]byte(nil), p...)
+			o.pendingBytes += int64(len(p))
+		}
+		return len(p), nil
+	}
+	defer o.room.Broadcast()
+
+	if err := o.write(p); err != nil {
+		return 0, err
+	}
+	for {
+		data, ok := o.pending[o.next]
+		if !ok {
+			return len(p), nil
+		}
+		delete(o.pending, o.next)
+		o.pendingBytes -= int64(len(data))
+		if err := o.write(data); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// write appends data to the stream and the running hash
+func (o *orderedWriter) write(data []byte) error {
+	if _, err := o.w.Write(data); err != nil {
+		return err
+	}
+	o.hash.Write(data)
+	o.next += int64(len(data))
+	return nil
+}
+
+// close wakes every WriteAt still waiting for room, which then fails, once no more chunks will be received
+func (o *orderedWriter) close() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.closed = true
+	o.room.Broadcast()
+}
+
+// written returns the number of bytes written to the stream so far
+func (o *orderedWriter) written() int64 {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.next
+}
+
+// sum returns the hex hash of the bytes written so far
+func (o *orderedWriter) sum() string {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return hex.EncodeToString(o.hash.Sum(nil))
+}
+
+// allChunks returns the index of every chunk in a file, for transfers that can't resume
+func allChunks(fileSize, chunkSize int64) []int {
+	totalChunks := (fileSize + chunkSize - 1) / chunkSize
+	chunks := make([]int, 0, totalChunks)
+	for i := int64(0); i < totalChunks; i++ {
+		chunks = append(chunks, int(i))
+	}
+	return chunks
+}
@@ -0,0 +1,204 @@
+package p2p
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOrderedWriterReordersChunks(t *testing.T) {
+	var out bytes.Buffer
+	w := newOrderedWriter(&out, HashSHA256, 16)
+
+	// Chunks arrive out of order, with chunk 1 retried after it was written
+	writes := []struct {
+		data   string
+		offset int64
+	}{
+		{"cc", 4},
+		{"bb", 2},
+		{"dd", 6},
+		{"aa", 0},
+		{"bb", 2},
+	}
+	for _, write := range writes {
+		if _, err := w.WriteAt([]byte(write.data), write.offset); err != nil {
+			t.Fatalf("WriteAt(%q, %d) failed: %v", write.data, write.offset, err)
+		}
+		if write.offset == 0 && out.Len() != 8 {
+			t.Errorf("Expected buffered chunks to be flushed once the gap was filled, got %q", out.String())
+		}
+	}
+
+	if out.String() != "aabbccdd" {
+		t.Errorf("Expected ordered output 'aabbccdd', got %q", out.String())
+	}
+	sum := sha256.Sum256([]byte("aabbccdd"))
+	if w.sum() != hex.EncodeToString(sum[:]) {
+		t.Error("Expected hash of the ordered output")
+	}
+}
+
+func TestOrderedWriterBoundsBufferedChunks(t *testing.T) {
+	var out bytes.Buffer
+	w := newOrderedWriter(&out, HashSHA256, 4)
+	for _, write := range []struct {
+		data   string
+		offset int64
+	}{{"cc", 4}, {"dd", 6}} {
+		if _, err := w.WriteAt([]byte(write.data), write.offset); err != nil {
+			t.Fatalf("WriteAt(%q, %d) failed: %v", write.data, write.offset, err)
+		}
+	}
+
+	// The window is full, so a chunk further ahead isn't accepted until the gap is filled
+	waiting := make(chan error, 1)
+	go func() {
+		_, err := w.WriteAt([]byte("ee"), 8)
+		waiting <- err
+	}()
+	select {
+	case err := <-waiting:
+		t.Fatalf("Expected the write past the window to wait, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The chunk at the stream position always gets through, even with the window full
+	for _, write := range []struct {
+		data   string
+		offset int64
+	}{{"aa", 0}, {"bb", 2}} {
+		if _, err := w.WriteAt([]byte(write.data), write.offset); err != nil {
+			t.Fatalf("WriteAt(%q, %d) failed: %v", write.data, write.offset, err)
+		}
+	}
+	select {
+	case err := <-waiting:
+		if err != nil {
+			t.Fatalf("Expected the waiting write to succeed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Write stayed blocked after the stream caught up")
+	}
+	if out.String() != "aabbccddee" {
+		t.Errorf("Expected ordered output 'aabbccddee', got %q", out.String())
+	}
+
+	// Closing the writer releases a write that would otherwise wait forever
+	for _, offset := range []int64{12, 14} {
+		if _, err := w.WriteAt([]byte("ff"), offset); err != nil {
+			t.Fatalf("WriteAt at %d failed: %v", offset, err)
+		}
+	}
+	go func() {
+		_, err := w.WriteAt([]byte("gg"), 16)
+		waiting <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	w.close()
+	select {
+	case err := <-waiting:
+		if err == nil {
+			t.Error("Expected the waiting write to fail once the writer was closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Write stayed blocked after the writer was closed")
+	}
+}
+
+func TestSpoolToTempFile(t *testing.T) {
+	path, cleanup, err := SpoolToTempFile(strings.NewReader("piped data"), "")
+	if err != nil {
+		t.Fatalf("Failed to spool input: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read spooled file: %v", err)
+	}
+	if string(content) != "piped data" {
+		t.Errorf("Expected spooled contents, got %q", content)
+	}
+	if !strings.HasSuffix(path, DefaultStreamName) {
+		t.Errorf("Expected spooled file to be named %s, got %s", DefaultStreamName, path)
+	}
+
+	cleanup()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected cleanup to remove the spooled file")
+	}
+
+	if _, _, err := SpoolToTempFile(strings.NewReader(""), "../escape"); err == nil {
+		t.Error("Expected error for a name with a path component")
+	}
+}
+
+func TestSendStreamToWriter(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	content := bytes.Repeat([]byte("in-memory data "), int(3*MinChunkSize/15+7))
+	sum := sha256.Sum256(content)
+	config := DefaultSenderConfig()
+	config.ChunkSize = MinChunkSize
+
+	// Both with the hash known upfront and with it computed while sending
+	for _, hash := range []string{hex.EncodeToString(sum[:]), ""} {
+		listener, err := net.Listen("tcp", ":0")
+		if err != nil {
+			t.Fatalf("Failed to find available port: %v", err)
+		}
+		port := listener.Addr().(*net.TCPAddr).Port
+		listener.Close()
+
+		var out bytes.Buffer
+		receiverDone := make(chan error, 1)
+		go func() {
+			receiverDone <- ReceiveStream(fmt.Sprintf("%d", port), &out)
+		}()
+		time.Sleep(100 * time.Millisecond)
+
+		if err := SendStreamWithConfig(bytes.NewReader(content), int64(len(content)), "memory.bin", hash, fmt.Sprintf("127.0.0.1:%d", port), config); err != nil {
+			t.Fatalf("Sender failed: %v", err)
+		}
+		select {
+		case err := <-receiverDone:
+			if err != nil {
+				t.Fatalf("Receiver failed: %v", err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("Test timed out")
+		}
+		if !bytes.Equal(out.Bytes(), content) {
+			t.Errorf("Expected the stream to arrive in order (hash %q), got %d bytes", hash, out.Len())
+		}
+	}
+
+	if err := SendStream(strings.NewReader(""), 0, "../escape", "", "127.0.0.1:1"); err == nil {
+		t.Error("Expected error for a name with a path component")
+	}
+}
+
+func TestStreamReaderAtReadsInOrder(t *testing.T) {
+	r := &streamReaderAt{r: strings.NewReader("aabbccdd")}
+	p := make([]byte, 2)
+
+	// Skipping ahead discards the data in between
+	if n, err := r.ReadAt(p, 4); err != nil || string(p[:n]) != "cc" {
+		t.Errorf("Expected 'cc' at offset 4, got %q (%v)", p[:n], err)
+	}
+	if _, err := r.ReadAt(p, 0); err == nil {
+		t.Error("Expected an error reading data the stream has already passed")
+	}
+	if n, err := r.ReadAt(make([]byte, 4), 6); err != io.EOF || n != 2 {
+		t.Errorf("Expected a short read at the end of the stream, got %d bytes (%v)", n, err)
+	}
+}
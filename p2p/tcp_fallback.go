@@ -0,0 +1,53 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// udpUnreachable reports whether a QUIC dial definitely failed because UDP didn't get through, as
+// when a firewall refuses it or there's no route. Timeouts don't count: anyone able to drop UDP
+// packets could cause one to force the unencrypted fallback.
+func udpUnreachable(err error) bool {
+	if isHandshakeRejection(err) {
+		return false
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ENETUNREACH) ||
+		errors.Is(err, syscall.EHOSTUNREACH)
+}
+
+// canFallBackToTCP reports whether paths may be sent over TCP after dialErr. Only regular files can
+// be, and not in strict mode or with an expected fingerprint, since the TCP protocol can't verify
+// the receiver.
+func canFallBackToTCP(ctx context.Context, dialErr error, paths []string, config SenderConfig) bool {
+	if !config.TCPFallback || config.DryRun || config.ContentType != "" || config.ExpectFingerprint != "" || StrictModeEnabled() {
+		return false
+	}
+	if ctx.Err() != nil || !udpUnreachable(dialErr) {
+		return false
+	}
+	for _, path := range paths {
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+			return false
+		}
+	}
+	return true
+}
+
+// sendOverTCP sends paths one after the other with the legacy TCP protocol, after dialErr kept the
+// QUIC connection from being made. If the receiver doesn't accept TCP either, both errors are reported.
+func sendOverTCP(ctx context.Context, paths []string, peerAddr string, dialErr error) error {
+	logf("⚠️  No answer from %s over UDP (%v)\n", peerAddr, dialErr)
+	logln("   Falling back to TCP: the transfer won't be encrypted and the receiver isn't verified.")
+
+	for _, path := range paths {
+		if err := SendFileContext(ctx, path, peerAddr); err != nil {
+			return fmt.Errorf("%w (TCP fallback failed too: %v)", dialErr, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package p2p
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+func TestChunkedSendFallsBackToTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	testFile := filepath.Join(t.TempDir(), "fallback.txt")
+	if err := os.WriteFile(testFile, []byte("sent without UDP"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// Nothing answers on the UDP port, as when a firewall drops it, but a TCP receiver listens
+	outputDir := t.TempDir()
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileContext(context.Background(), fmt.Sprintf("%d", port), outputDir)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// Loopback doesn't report ICMP errors to the QUIC dial, so report a refusal the way a firewall would
+	dialErr := fmt.Errorf("failed to write: %w", syscall.ECONNREFUSED)
+	dialQUIC = func(context.Context, string, *tls.Config, *quic.Config) (quic.Connection, error) {
+		return nil, dialErr
+	}
+	defer func() { dialQUIC = quic.DialAddr }()
+
+	config := DefaultSenderConfig()
+	config.DialAttempts = 1
+	if err := SendFileChunkedWithConfig(testFile, fmt.Sprintf("127.0.0.1:%d", port), config); !errors.Is(err, ErrConnectionFailed) {
+		t.Fatalf("Expected no fallback unless it's enabled, got %v", err)
+	}
+	config.TCPFallback = true
+	if err := SendFileChunkedWithConfig(testFile, fmt.Sprintf("127.0.0.1:%d", port), config); err != nil {
+		t.Fatalf("Expected the send to fall back to TCP, got %v", err)
+	}
+	select {
+	case err := <-receiverDone:
+		if err != nil {
+			t.Fatalf("Receiver failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Test timed out")
+	}
+	if data, err := os.ReadFile(filepath.Join(outputDir, "fallback.txt")); err != nil || string(data) != "sent without UDP" {
+		t.Errorf("Expected the file to arrive over TCP, got %q (%v)", data, err)
+	}
+
+	// A dial that only timed out might be an attacker dropping UDP, so it's never downgraded
+	dialErr = context.DeadlineExceeded
+	if err := SendFileChunkedWithConfig(testFile, fmt.Sprintf("127.0.0.1:%d", port), config); !errors.Is(err, ErrConnectionFailed) {
+		t.Errorf("Expected ErrConnectionFailed after a timeout, got %v", err)
+	}
+}
+
+func TestChunkedReceiverAcceptsTCPFallback(t *testing.T) {
+	t.Setenv("LANDROP_TEST_MODE", "1")
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	testFile := filepath.Join(t.TempDir(), "legacy.txt")
+	if err := os.WriteFile(testFile, []byte("from a TCP sender"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	config := DefaultReceiverConfig()
+	config.OutputDir = t.TempDir()
+	config.TCPFallback = true
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), config)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// A single-shot receiver stops after a transfer over either transport
+	if err := SendFile(testFile, fmt.Sprintf("127.0.0.1:%d", port)); err != nil {
+		t.Fatalf("TCP sender failed: %v", err)
+	}
+	select {
+	case err := <-receiverDone:
+		if err != nil {
+			t.Fatalf("Receiver failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Receiver kept waiting after the TCP transfer")
+	}
+	if data, err := os.ReadFile(filepath.Join(config.OutputDir, "legacy.txt")); err != nil || string(data) != "from a TCP sender" {
+		t.Errorf("Expected the file to arrive over TCP, got %q (%v)", data, err)
+	}
+
+	// TCP senders can't be checked against an allowlist
+	config.AllowedDevices = []string{"laptop (aaaa1111)"}
+	if err := ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), config); err == nil {
+		t.Error("Expected TCP fallback with an allowlist to be refused")
+	}
+}
+
+func TestTCPFallbackAppliesReceiverChecks(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "checked.txt")
+	if err := os.WriteFile(testFile, []byte("a file the receiver doesn't want"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	var asked []string
+	for _, test := range []struct {
+		name      string
+		configure func(config *ReceiverConfig)
+		want      error
+	}{
+		{"over the size limit", func(config *ReceiverConfig) { config.MaxFileSize = 8 }, ErrFileTooLarge},
+		{"declined by the policy", func(config *ReceiverConfig) {
+			config.AcceptPolicy = AcceptPolicyFunc(func(request *TransferRequest, peer PeerInfo) (bool, string) {
+				asked = append(asked, request.Filename)
+				return false, "not today"
+			})
+		}, ErrTransferRejected},
+		{"rejected before accepting", func(config *ReceiverConfig) {
+			config.BeforeAccept = func(request *TransferRequest) (bool, string) { return false, "" }
+		}, ErrTransferRejected},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", ":0")
+			if err != nil {
+				t.Fatalf("Failed to find available port: %v", err)
+			}
+			port := listener.Addr().(*net.TCPAddr).Port
+			listener.Close()
+
+			config := DefaultReceiverConfig()
+			config.OutputDir = t.TempDir()
+			config.TCPFallback = true
+			test.configure(&config)
+			receiverDone := make(chan error, 1)
+			go func() {
+				receiverDone <- ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), config)
+			}()
+			time.Sleep(100 * time.Millisecond)
+
+			if err := SendFile(testFile, fmt.Sprintf("127.0.0.1:%d", port)); err == nil {
+				t.Error("Expected the TCP sender to fail")
+			}
+			select {
+			case err := <-receiverDone:
+				if !errors.Is(err, test.want) {
+					t.Errorf("Expected %v, got %v", test.want, err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Receiver kept waiting after the TCP transfer")
+			}
+			if entries, _ := os.ReadDir(config.OutputDir); len(entries) != 0 {
+				t.Errorf("Expected nothing to be written, found %d file(s)", len(entries))
+			}
+		})
+	}
+	if len(asked) != 1 || asked[0] != "checked.txt" {
+		t.Errorf("Expected the policy to be asked about the file once, got %v", asked)
+	}
+
+	// A TCP sender can't prove a pairing PIN
+	if _, err := EnablePairingPIN(); err != nil {
+		t.Fatalf("Failed to enable pairing: %v", err)
+	}
+	defer disablePairingPIN()
+	config := DefaultReceiverConfig()
+	config.TCPFallback = true
+	if err := config.validate(); err == nil {
+		t.Error("Expected TCP fallback with a pairing PIN to be refused")
+	}
+}
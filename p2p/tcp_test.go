@@ -0,0 +1,186 @@
+package p2p
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReceiveFileContextCancellation(t *testing.T) {
+	// Find an available port
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileContext(ctx, fmt.Sprintf("%d", port), t.TempDir())
+	}()
+
+	// Cancel while the receiver is waiting for a connection
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-receiverDone:
+		if !errors.Is(err, ErrTransferInterrupted) {
+			t.Fatalf("Expected ErrTransferInterrupted, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Receiver did not stop after cancellation")
+	}
+}
+
+func TestReceiveFileStripsDirectoryComponents(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	baseDir := t.TempDir()
+	outputDir := filepath.Join(baseDir, "inbox")
+	data := []byte("not your bashrc")
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileContext(context.Background(), fmt.Sprintf("%d", port), outputDir)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	metadata, _ := json.Marshal(FileMetadata{Filename: "nested/dir/.bashrc", FileSize: int64(len(data)), FileHash: calculateTestHash(t, data)})
+	conn.Write(append(metadata, '\n'))
+	reader := bufio.NewReader(conn)
+	if _, err := reader.ReadBytes('\n'); err != nil {
+		t.Fatalf("Failed to read resume response: %v", err)
+	}
+	conn.Write(data)
+
+	if err := <-receiverDone; err != nil {
+		t.Fatalf("Receive failed: %v", err)
+	}
+	if received, err := os.ReadFile(filepath.Join(outputDir, ".bashrc")); err != nil || string(received) != string(data) {
+		t.Fatalf("Expected the file under its base name in the output directory, got %q (%v)", received, err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "nested")); !os.IsNotExist(err) {
+		t.Error("Expected no directories to be created from the peer's filename")
+	}
+}
+
+func TestTCPResumeReplacesPoisonedPartialFile(t *testing.T) {
+	data := make([]byte, 256*1024)
+	for i := range data {
+		data[i] = byte(i * 31 % 251)
+	}
+	sourcePath := filepath.Join(t.TempDir(), "payload.bin")
+	if err := os.WriteFile(sourcePath, data, 0644); err != nil {
+		t.Fatalf("Failed to write source file: %v", err)
+	}
+
+	for _, test := range []struct {
+		name    string
+		partial []byte
+	}{
+		{"matching prefix", data[:100*1024]},
+		{"poisoned prefix", make([]byte, 100*1024)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", ":0")
+			if err != nil {
+				t.Fatalf("Failed to find available port: %v", err)
+			}
+			port := listener.Addr().(*net.TCPAddr).Port
+			listener.Close()
+
+			outputDir := t.TempDir()
+			outputPath := filepath.Join(outputDir, "payload.bin")
+			partialPath := partialFilePath(outputPath)
+			if err := os.WriteFile(partialPath, test.partial, 0644); err != nil {
+				t.Fatalf("Failed to write partial file: %v", err)
+			}
+			if err := saveTCPProgress(partialPath, &FileMetadata{FileSize: int64(len(data)), FileHash: calculateTestHash(t, data)}); err != nil {
+				t.Fatalf("Failed to write progress file: %v", err)
+			}
+
+			receiverDone := make(chan error, 1)
+			go func() {
+				receiverDone <- ReceiveFileContext(context.Background(), fmt.Sprintf("%d", port), outputDir)
+			}()
+			time.Sleep(100 * time.Millisecond)
+
+			if err := SendFile(sourcePath, fmt.Sprintf("127.0.0.1:%d", port)); err != nil {
+				t.Fatalf("Send failed: %v", err)
+			}
+			if err := <-receiverDone; err != nil {
+				t.Fatalf("Receive failed: %v", err)
+			}
+			received, err := os.ReadFile(outputPath)
+			if err != nil || string(received) != string(data) {
+				t.Fatalf("Expected the partial file to end up identical to the source (%d of %d bytes, %v)", len(received), len(data), err)
+			}
+			if _, err := os.Stat(partialPath); !os.IsNotExist(err) {
+				t.Error("Expected the partial file to be renamed once verified")
+			}
+			if _, err := os.Stat(progressFilePath(partialPath)); !os.IsNotExist(err) {
+				t.Error("Expected the progress file to be removed once verified")
+			}
+		})
+	}
+}
+
+func TestTCPReceiveKeepsUnrelatedFile(t *testing.T) {
+	data := []byte("the file being sent, longer than the one already there")
+	sourcePath := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(sourcePath, data, 0644); err != nil {
+		t.Fatalf("Failed to write source file: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	// A shorter file under the same name isn't a partial copy of this one
+	outputDir := t.TempDir()
+	existing := []byte("someone else's notes")
+	if err := os.WriteFile(filepath.Join(outputDir, "notes.txt"), existing, 0644); err != nil {
+		t.Fatalf("Failed to write existing file: %v", err)
+	}
+
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileContext(context.Background(), fmt.Sprintf("%d", port), outputDir)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	if err := SendFile(sourcePath, fmt.Sprintf("127.0.0.1:%d", port)); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if err := <-receiverDone; err != nil {
+		t.Fatalf("Receive failed: %v", err)
+	}
+	if kept, err := os.ReadFile(filepath.Join(outputDir, "notes.txt")); err != nil || string(kept) != string(existing) {
+		t.Errorf("Expected the existing file to be kept, got %q (%v)", kept, err)
+	}
+	if received, err := os.ReadFile(filepath.Join(outputDir, "notes (1).txt")); err != nil || string(received) != string(data) {
+		t.Errorf("Expected the transfer under a numbered name, got %q (%v)", received, err)
+	}
+}
@@ -2,6 +2,7 @@ package p2p
 
 import (
 	"bufio"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
@@ -19,90 +20,122 @@ type FileMetadata struct {
 	Filename string `json:"filename"`
 	FileSize int64  `json:"filesize"`
 	FileHash string `json:"filehash"`
+	// ResumeCheck tells the receiver this sender confirms the partial file's prefix hash
+	ResumeCheck bool `json:"resume_check,omitempty"`
 }
 
 // ResumeResponse is sent from the receiver to the sender.
 type ResumeResponse struct {
 	Offset int64 `json:"offset"`
+	// PrefixHash is the SHA-256 of the partial file's first Offset bytes, sent to senders with ResumeCheck
+	PrefixHash string `json:"prefix_hash,omitempty"`
+}
+
+// ResumeConfirm answers a ResumeResponse carrying a PrefixHash: Offset is where the sender resumes,
+// or 0 when the partial file isn't a prefix of its file and must be sent again in full
+type ResumeConfirm struct {
+	Offset int64 `json:"offset"`
 }
 
 // SendFile handles the logic for sending a file with resume capability.
-func SendFile(filename string, peerAddr string) {
+func SendFile(filename string, peerAddr string) error {
+	return SendFileContext(context.Background(), filename, peerAddr)
+}
+
+// SendFileContext sends a file like SendFile, aborting when ctx is cancelled.
+// Cancellation closes the connection and returns an error wrapping ErrTransferInterrupted.
+func SendFileContext(ctx context.Context, filename string, peerAddr string) error {
 	// 1. Get file info and calculate total file hash.
 	file, err := os.Open(filename)
 	if err != nil {
-		fmt.Printf("Error opening file: %s\n", err)
-		return
+		return fmt.Errorf("error opening file: %w", err)
 	}
 	defer file.Close()
 
 	fileInfo, err := file.Stat()
 	if err != nil {
-		fmt.Printf("Error getting file info: %s\n", err)
-		return
+		return fmt.Errorf("error getting file info: %w", err)
 	}
 
 	hash := sha256.New()
 	if _, err := io.Copy(hash, file); err != nil {
-		fmt.Printf("Error calculating file hash: %s\n", err)
-		return
+		return fmt.Errorf("error calculating file hash: %w", err)
 	}
 	file.Seek(0, 0) // Reset for sending
 
 	metadata := FileMetadata{
-		Filename: filepath.Base(filename),
-		FileSize: fileInfo.Size(),
-		FileHash: hex.EncodeToString(hash.Sum(nil)),
+		Filename:    filepath.Base(filename),
+		FileSize:    fileInfo.Size(),
+		FileHash:    hex.EncodeToString(hash.Sum(nil)),
+		ResumeCheck: true,
 	}
 
 	// 2. Connect and send initial metadata.
-	conn, err := net.Dial("tcp", peerAddr)
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", peerAddr)
 	if err != nil {
-		fmt.Printf("Error connecting to peer: %s\n", err)
-		return
+		return interruptedError(ctx, fmt.Errorf("error connecting to peer: %w", err))
 	}
 	defer conn.Close()
 
+	// Closing the connection unblocks any pending read or write on cancellation
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
 	writer := bufio.NewWriter(conn)
 	reader := bufio.NewReader(conn)
 
 	metadataBytes, _ := json.Marshal(metadata)
 	writer.Write(metadataBytes)
 	writer.WriteByte('\n')
-	writer.Flush()
+	if err := writer.Flush(); err != nil {
+		return interruptedError(ctx, fmt.Errorf("error sending metadata: %w", err))
+	}
 
 	// 3. Wait for the receiver's resume response.
 	responseBytes, err := reader.ReadBytes('\n')
 	if err != nil {
-		fmt.Printf("Error receiving resume response: %s\n", err)
-		return
+		return interruptedError(ctx, fmt.Errorf("error receiving resume response: %w", err))
 	}
 
 	var response ResumeResponse
 	if err := json.Unmarshal(responseBytes, &response); err != nil {
-		fmt.Printf("Error parsing resume response: %s\n", err)
-		return
+		return fmt.Errorf("error parsing resume response: %w", err)
+	}
+
+	// Only resume onto a partial file that really is the start of this one
+	if response.PrefixHash != "" {
+		if !filePrefixMatches(file, response.Offset, response.PrefixHash) {
+			logf("Peer's partial copy doesn't match '%s', sending it again in full\n", metadata.Filename)
+			response.Offset = 0
+		}
+		confirmBytes, _ := json.Marshal(ResumeConfirm{Offset: response.Offset})
+		writer.Write(confirmBytes)
+		writer.WriteByte('\n')
+		if err := writer.Flush(); err != nil {
+			return interruptedError(ctx, fmt.Errorf("error sending resume confirmation: %w", err))
+		}
 	}
 
 	// 4. Seek to the required offset and start streaming.
 	if response.Offset > 0 {
-		fmt.Printf("Peer has %.2f MB already. Resuming transfer...\n", float64(response.Offset)/(1024*1024))
+		logf("Peer has %.2f MB already. Resuming transfer...\n", float64(response.Offset)/(1024*1024))
 		_, err = file.Seek(response.Offset, io.SeekStart)
 		if err != nil {
-			fmt.Printf("Error seeking file: %s\n", err)
-			return
+			return fmt.Errorf("error seeking file: %w", err)
 		}
 	}
 
-	fmt.Printf("Sending file '%s'...\n", metadata.Filename)
+	logf("Sending file '%s'...\n", metadata.Filename)
 	startTime := time.Now()
 
 	bytesSent, err := io.Copy(writer, file)
+	if err == nil {
+		err = writer.Flush()
+	}
 	if err != nil {
-		fmt.Printf("Error sending file data: %s\n", err)
-		return
+		return interruptedError(ctx, fmt.Errorf("error sending file data: %w", err))
 	}
-	writer.Flush()
 
 	duration := time.Since(startTime)
 	speed := float64(bytesSent) / duration.Seconds() / (1024 * 1024)
@@ -110,114 +143,407 @@ func SendFile(filename string, peerAddr string) {
 	// 5. Wait for final ACK from receiver.
 	status, err := reader.ReadString('\n')
 	if err != nil {
-		fmt.Printf("Error waiting for final ack: %s\n", err)
-		return
+		return interruptedError(ctx, fmt.Errorf("error waiting for final ack: %w", err))
 	}
 
-	fmt.Println("\n--- Transfer Result ---")
-	fmt.Printf("File: %s\n", metadata.Filename)
-	fmt.Printf("Speed: %.2f MB/s\n", speed)
-	if strings.TrimSpace(status) == "ACK" {
-		fmt.Println("Status: SUCCESS (Verified by peer)")
-	} else {
-		fmt.Printf("Status: FAILED (Peer reported error)\n")
+	logln("\n--- Transfer Result ---")
+	logf("File: %s\n", metadata.Filename)
+	logf("Speed: %.2f MB/s\n", speed)
+	if strings.TrimSpace(status) != "ACK" {
+		logf("Status: FAILED (Peer reported error)\n")
+		logln("-----------------------")
+		return fmt.Errorf("%w: peer reported %s", ErrChecksumMismatch, strings.TrimSpace(status))
 	}
-	fmt.Println("-----------------------")
+	logln("Status: SUCCESS (Verified by peer)")
+	logln("-----------------------")
+
+	return nil
 }
 
 // ReceiveFile handles listening and receiving a file with resume capability.
-func ReceiveFile(port string) {
+// Files are written to outputDir, or the current directory when it is empty.
+func ReceiveFile(port string, outputDir string) {
+	if err := ReceiveFileContext(context.Background(), port, outputDir); err != nil {
+		logf("Error: %s\n", err)
+	}
+}
+
+// ReceiveFileContext receives a file like ReceiveFile, aborting when ctx is cancelled.
+// Cancellation closes the listener or connection and returns an error wrapping ErrTransferInterrupted.
+func ReceiveFileContext(ctx context.Context, port string, outputDir string) error {
+	if err := ensureOutputDir(outputDir); err != nil {
+		return fmt.Errorf("error preparing output directory: %w", err)
+	}
+
 	// Start discovery listener in background
-	go ListenForDiscovery(port)
-	
-	listener, err := net.Listen("tcp", ":"+port)
+	if err := StartDiscoveryListener(port, CapabilityTCP); err != nil {
+		logf("⚠️  %v - this receiver won't answer discovery requests, but senders can still use its address\n", err)
+	}
+
+	listener, err := net.Listen("tcp", listenAddress(port))
 	if err != nil {
-		fmt.Printf("Error listening on port %s: %s\n", port, err)
-		return
+		return fmt.Errorf("error listening on port %s: %w", port, err)
 	}
 	defer listener.Close()
 
-	fmt.Printf("Listening for incoming files on port %s...\n", port)
+	// Closing the listener unblocks Accept on cancellation
+	stopListener := context.AfterFunc(ctx, func() { listener.Close() })
+	defer stopListener()
+
+	logf("Listening for incoming files on port %s...\n", port)
 
 	conn, err := listener.Accept()
 	if err != nil {
-		fmt.Printf("Error accepting connection: %s\n", err)
-		return
+		return interruptedError(ctx, fmt.Errorf("error accepting connection: %w", err))
 	}
+	// The legacy receiver has always accepted whatever its sender sends
+	return receiveTCPConnection(ctx, conn, ReceiverConfig{OutputDir: outputDir, AutoAccept: true})
+}
+
+// serveTCPFallback receives legacy TCP transfers from listener one at a time, for a chunked
+// receiver accepting senders that can't reach it over UDP, until the listener is closed. With
+// results set only the first transfer is received and its result sent there.
+func serveTCPFallback(ctx context.Context, listener net.Listener, config ReceiverConfig, results chan<- error) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		peerAddr := conn.RemoteAddr().String()
+		logf("⚠️  Receiving from %s over TCP: the transfer isn't encrypted and the sender isn't verified\n", peerAddr)
+		err = receiveTCPConnection(ctx, conn, config)
+		if results != nil {
+			results <- err
+			return
+		}
+		if err != nil {
+			logf("TCP transfer from %s failed: %v\n", peerAddr, err)
+		} else {
+			logf("TCP transfer from %s finished\n", peerAddr)
+		}
+	}
+}
+
+// receiveTCPConnection receives one file from a sender connected over TCP into config.OutputDir,
+// then closes conn. The file goes through the same size, conflict, policy, prompt and disk space
+// checks as one sent over QUIC; the protocol has no rejection message, so a rejected sender's
+// connection is closed.
+func receiveTCPConnection(ctx context.Context, conn net.Conn, config ReceiverConfig) error {
 	defer conn.Close()
 
+	stopConn := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stopConn()
+
 	reader := bufio.NewReader(conn)
 	writer := bufio.NewWriter(conn)
 
 	// 1. Read initial metadata.
 	metadataBytes, err := reader.ReadBytes('\n')
 	if err != nil {
-		fmt.Printf("Error reading metadata: %s\n", err)
-		return
+		return interruptedError(ctx, fmt.Errorf("error reading metadata: %w", err))
 	}
 
 	var metadata FileMetadata
-	json.Unmarshal(metadataBytes, &metadata)
+	if err := json.Unmarshal(metadataBytes, &metadata); err != nil {
+		return fmt.Errorf("%w: invalid file metadata: %v", ErrProtocolMismatch, err)
+	}
 
-	// 2. Check for existing partial file and determine offset.
+	// Never trust the peer-supplied filename as a path.
+	outputPath, err := resolveOutputPath(config.OutputDir, metadata.Filename)
+	if err != nil {
+		return fmt.Errorf("rejecting transfer: %w", err)
+	}
+	if err := checkTCPTransfer(config, &metadata, conn.RemoteAddr().String(), outputPath); err != nil {
+		return err
+	}
+
+	// Keep unrelated files with the same name; write to a numbered name instead
+	usable := func(path string) bool {
+		return canWriteTCPOutput(path, &metadata)
+	}
+	if config.OnConflict == ConflictOverwrite {
+		usable = canOverwriteOutput
+	}
+	claimed, ok := receivingOutputs.claim(outputPath, metadata.FileHash, usable)
+	if !ok {
+		return fmt.Errorf("rejecting transfer: '%s' is already being received by another transfer", outputPath)
+	}
+	defer receivingOutputs.release(claimed)
+	if claimed != outputPath {
+		logf("'%s' already exists or is being received, writing to '%s'\n", outputPath, claimed)
+		outputPath = claimed
+	}
+
+	// 2. Check for this file's partial copy and determine offset. Data only ever goes to the
+	// partial file, which gets the final name once verified, unless that already holds a copy.
+	writePath := partialFilePath(outputPath)
 	var offset int64
-	if _, err := os.Stat(metadata.Filename); err == nil {
-		// File exists, get its size.
-		fileInfo, _ := os.Stat(metadata.Filename)
+	if tcpCopyMatches(outputPath, &metadata) {
+		writePath = outputPath
+		offset = metadata.FileSize
+	} else if fileInfo, err := os.Stat(writePath); err == nil && loadTCPProgress(writePath, &metadata) {
 		offset = fileInfo.Size()
-		fmt.Printf("Partial file '%s' found with size %.2f MB. Requesting resume.\n", metadata.Filename, float64(offset)/(1024*1024))
+		logf("Partial file '%s' found with size %.2f MB. Requesting resume.\n", writePath, float64(offset)/(1024*1024))
+	}
+
+	// Only the bytes still missing need room, so a resumed transfer can finish on a nearly full disk
+	if msg := insufficientSpaceMessage(writePath, metadata.FileSize-offset); msg != "" {
+		logf("Rejecting transfer of '%s': %s\n", metadata.Filename, msg)
+		return fmt.Errorf("%w: %w: %s", ErrTransferRejected, ErrInsufficientSpace, msg)
 	}
 
 	// 3. Send the resume response back to the sender.
 	response := ResumeResponse{Offset: offset}
+	if offset > 0 && metadata.ResumeCheck {
+		prefixHash, err := calculateFilePrefixHash(writePath, offset)
+		if err != nil {
+			return fmt.Errorf("error hashing partial file: %w", err)
+		}
+		response.PrefixHash = prefixHash
+	}
 	responseBytes, _ := json.Marshal(response)
 	writer.Write(responseBytes)
 	writer.WriteByte('\n')
-	writer.Flush()
+	if err := writer.Flush(); err != nil {
+		return interruptedError(ctx, fmt.Errorf("error sending resume response: %w", err))
+	}
 
-	// 4. Open file for appending/writing.
-	// O_CREATE: create if not exists, O_APPEND|O_WRONLY: append in write-only mode.
-	file, err := os.OpenFile(metadata.Filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	// The sender checks the prefix and either resumes or starts over
+	if response.PrefixHash != "" {
+		confirmBytes, err := reader.ReadBytes('\n')
+		if err != nil {
+			return interruptedError(ctx, fmt.Errorf("error reading resume confirmation: %w", err))
+		}
+		var confirm ResumeConfirm
+		if err := json.Unmarshal(confirmBytes, &confirm); err != nil {
+			return fmt.Errorf("%w: invalid resume confirmation: %v", ErrProtocolMismatch, err)
+		}
+		if confirm.Offset != offset {
+			if writePath == outputPath {
+				// A copy under the final name is never rewritten, so the file goes to a new name
+				return fmt.Errorf("%w: '%s' doesn't match the sender's file", ErrChecksumMismatch, outputPath)
+			}
+			logf("Partial file '%s' doesn't match the sender's file, receiving it again in full\n", writePath)
+			offset = 0
+		}
+	}
+
+	// 4. Open the partial file, appending to what's already there when resuming. Only a partial
+	// file recorded for this transfer is ever truncated.
+	flags := os.O_CREATE | os.O_APPEND | os.O_WRONLY
+	if offset == 0 {
+		flags |= os.O_TRUNC
+	}
+	if writePath != outputPath {
+		if err := saveTCPProgress(writePath, &metadata); err != nil {
+			return err
+		}
+	}
+	file, err := os.OpenFile(writePath, flags, 0644)
 	if err != nil {
-		fmt.Printf("Error opening file for writing: %s\n", err)
-		return
+		return fmt.Errorf("error opening file for writing: %w", err)
 	}
 	defer file.Close()
 
 	// 5. Read the rest of the file data.
 	bytesToReceive := metadata.FileSize - offset
-	fmt.Printf("Receiving '%.2f' MB...\n", float64(bytesToReceive)/(1024*1024))
+	logf("Receiving '%.2f' MB...\n", float64(bytesToReceive)/(1024*1024))
 	startTime := time.Now()
 
 	bytesReceived, err := io.CopyN(file, reader, bytesToReceive)
 	if err != nil {
-		fmt.Printf("Error receiving file data: %s\n", err)
-		return
+		return interruptedError(ctx, fmt.Errorf("error receiving file data: %w", err))
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error writing file: %w", err)
 	}
 
 	duration := time.Since(startTime)
 	speed := float64(bytesReceived) / duration.Seconds() / (1024 * 1024)
 
 	// 6. Verify hash of the completed file.
-	fmt.Println("Verifying integrity...")
-	// We MUST re-open the file in read mode to hash it from the beginning.
-	// Note: file.Close() is handled by defer at function exit
-	receivedHash, _ := calculateFileHash(metadata.Filename)
+	logln("Verifying integrity...")
+	receivedHash, _ := calculateFileHash(writePath)
 
 	// 7. Send final ACK/ERR and log results.
 	if receivedHash == metadata.FileHash {
+		if writePath != outputPath {
+			if err := os.Rename(writePath, outputPath); err != nil {
+				writer.WriteString("ERR_WRITE\n")
+				writer.Flush()
+				return fmt.Errorf("error moving verified file into place: %w", err)
+			}
+			removeTCPProgress(writePath)
+		}
 		writer.WriteString("ACK\n")
 		writer.Flush()
-		fmt.Println("\n--- Transfer Complete ---")
-		fmt.Printf("File: %s\n", metadata.Filename)
-		fmt.Printf("Time: %.2fs (%.2f MB/s)\n", duration.Seconds(), speed)
-		fmt.Println("Integrity: SUCCESS ✅")
+		logln("\n--- Transfer Complete ---")
+		logf("File: %s\n", outputPath)
+		logf("Time: %.2fs (%.2f MB/s)\n", duration.Seconds(), speed)
+		logln("Integrity: SUCCESS ✅")
 	} else {
+		// The partial file can't be trusted to resume from, so the next attempt starts over
+		if writePath != outputPath {
+			os.Remove(writePath)
+			removeTCPProgress(writePath)
+		}
 		writer.WriteString("ERR_CHECKSUM\n")
 		writer.Flush()
-		fmt.Println("Integrity: FAILED ❌")
+		logln("Integrity: FAILED ❌")
+		logln("-------------------------")
+		return fmt.Errorf("%w: received file '%s' does not match the sender's hash", ErrChecksumMismatch, outputPath)
+	}
+	logln("-------------------------")
+
+	return nil
+}
+
+// tcpProgress is the sidecar of a partial file received over TCP. The legacy protocol resumes from
+// the partial file's size, so the sidecar records which file it's the start of.
+type tcpProgress struct {
+	FileHash string `json:"file_hash"`
+	FileSize int64  `json:"file_size"`
+}
+
+// saveTCPProgress records that partialPath holds the start of the file metadata describes
+func saveTCPProgress(partialPath string, metadata *FileMetadata) error {
+	data, err := json.Marshal(tcpProgress{FileHash: metadata.FileHash, FileSize: metadata.FileSize})
+	if err != nil {
+		return fmt.Errorf("failed to encode transfer progress: %w", err)
+	}
+	if err := os.WriteFile(progressFilePath(partialPath), data, 0644); err != nil {
+		return fmt.Errorf("failed to save transfer progress: %w", err)
+	}
+	return nil
+}
+
+// loadTCPProgress reports whether partialPath's sidecar records the file metadata describes, and
+// the partial file is no longer than it
+func loadTCPProgress(partialPath string, metadata *FileMetadata) bool {
+	data, err := os.ReadFile(progressFilePath(partialPath))
+	if err != nil {
+		return false
+	}
+	var progress tcpProgress
+	if err := json.Unmarshal(data, &progress); err != nil {
+		return false
+	}
+	info, err := os.Stat(partialPath)
+	return err == nil && !info.IsDir() && progress.FileHash == metadata.FileHash &&
+		progress.FileSize == metadata.FileSize && info.Size() <= metadata.FileSize
+}
+
+// removeTCPProgress deletes partialPath's sidecar once the transfer no longer needs it
+func removeTCPProgress(partialPath string) {
+	if err := os.Remove(progressFilePath(partialPath)); err != nil && !os.IsNotExist(err) {
+		logf("Warning: failed to remove transfer progress: %v\n", err)
+	}
+}
+
+// checkTCPTransfer rejects a file received over TCP that the receiver's configuration wouldn't
+// accept from a QUIC sender, asking its AcceptPolicy or the user unless it auto-accepts
+func checkTCPTransfer(config ReceiverConfig, metadata *FileMetadata, peerAddr, outputPath string) error {
+	request := NewTransferRequest(metadata.Filename, metadata.FileSize, metadata.FileHash, 0)
+	request.HashAlgorithm = HashSHA256
+
+	var reason error
+	var rejectionMsg string
+	if config.MaxFileSize > 0 && metadata.FileSize > config.MaxFileSize {
+		reason = ErrFileTooLarge
+		rejectionMsg = fmt.Sprintf("File is %s, larger than the receiver's %s limit", FormatByteSize(metadata.FileSize), FormatByteSize(config.MaxFileSize))
+	} else if config.OnConflict == ConflictSkip && outputExists(outputPath) {
+		rejectionMsg = "File already exists on the receiver"
+	} else if config.BeforeAccept != nil {
+		if ok, msg := config.BeforeAccept(request); !ok {
+			rejectionMsg = msg
+			if rejectionMsg == "" {
+				rejectionMsg = "Rejected by the receiver's policy"
+			}
+		}
+	}
+	if rejectionMsg == "" && !config.AutoAccept {
+		policy := config.AcceptPolicy
+		if policy == nil {
+			policy = PromptPolicy()
+		}
+		if ok, msg := policy.Decide(request, PeerInfo{Address: peerAddr}); !ok {
+			rejectionMsg = msg
+			if rejectionMsg == "" {
+				rejectionMsg = "Rejected by the receiver's policy"
+			}
+		}
+	}
+	if rejectionMsg == "" {
+		return nil
+	}
+
+	logf("Rejecting transfer of '%s': %s\n", metadata.Filename, rejectionMsg)
+	if reason != nil {
+		return fmt.Errorf("%w: %w: %s", ErrTransferRejected, reason, rejectionMsg)
+	}
+	return fmt.Errorf("%w: %s", ErrTransferRejected, rejectionMsg)
+}
+
+// tcpCopyMatches reports whether path is a file identical to the one metadata describes
+func tcpCopyMatches(path string, metadata *FileMetadata) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() || info.Size() != metadata.FileSize {
+		return false
+	}
+	hash, err := calculateFileHash(path)
+	return err == nil && hash == metadata.FileHash
+}
+
+// canWriteTCPOutput reports whether path is free or already holds an identical copy, and its
+// partial file is free or recorded for this transfer. Any other file, under the final name or the
+// partial one, is kept and the transfer goes to a numbered name instead.
+func canWriteTCPOutput(path string, metadata *FileMetadata) bool {
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return tcpCopyMatches(path, metadata)
+	}
+
+	partialPath := partialFilePath(path)
+	if _, err := os.Stat(partialPath); os.IsNotExist(err) {
+		return true
+	}
+	return loadTCPProgress(partialPath, metadata)
+}
+
+// interruptedError wraps err as ErrTransferInterrupted if it was caused by ctx being cancelled
+func interruptedError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("%w: %v", ErrTransferInterrupted, ctx.Err())
+	}
+	return err
+}
+
+// calculateFilePrefixHash returns the hex SHA-256 of the first size bytes of filename
+func calculateFilePrefixHash(filename string, size int64) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.CopyN(hash, file, size); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// filePrefixMatches reports whether the first size bytes of file hash to prefixHash. The file is
+// left positioned at the start.
+func filePrefixMatches(file *os.File, size int64, prefixHash string) bool {
+	defer file.Seek(0, io.SeekStart)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return false
+	}
+	hash := sha256.New()
+	if _, err := io.CopyN(hash, file, size); err != nil {
+		return false
 	}
-	fmt.Println("-------------------------")
+	return hex.EncodeToString(hash.Sum(nil)) == prefixHash
 }
 
 // calculateFileHash helper remains unchanged.
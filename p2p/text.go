@@ -0,0 +1,74 @@
+package p2p
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ContentTypeText marks a transfer as a text snippet to show rather than a file to save
+const ContentTypeText = "text"
+
+// MaxTextSize is the largest snippet sent or accepted as text, since the receiver holds it in memory
+const MaxTextSize = 1 << 20
+
+// IsText reports whether the request carries a text snippet
+func (r *TransferRequest) IsText() bool {
+	return r.ContentType == ContentTypeText
+}
+
+// TextFilename is the name announced for a snippet sent at now
+func TextFilename(now time.Time) string {
+	return "text-" + now.Format("20060102-150405") + ".txt"
+}
+
+// ValidateText checks that text can be sent as a snippet
+func ValidateText(text string) error {
+	if text == "" {
+		return fmt.Errorf("no text to send")
+	}
+	if len(text) > MaxTextSize {
+		return fmt.Errorf("text is %s, larger than the %s limit; send it as a file instead", FormatByteSize(int64(len(text))), FormatByteSize(MaxTextSize))
+	}
+	if !utf8.ValidString(text) {
+		return fmt.Errorf("text is not valid UTF-8; send it as a file instead")
+	}
+	return nil
+}
+
+// SendTextWithConfig sends text to a chunked receiver, which shows it instead of saving a file.
+// Like SendFileChunkedWithConfig, a rejection isn't an error.
+func SendTextWithConfig(text string, peerAddr string, config SenderConfig) error {
+	if err := ValidateText(text); err != nil {
+		return err
+	}
+	config.ContentType = ContentTypeText
+	return SendStreamWithConfig(strings.NewReader(text), int64(len(text)), TextFilename(time.Now()), "", peerAddr, config)
+}
+
+// handleTextRequest receives a text snippet into memory and shows it once verified
+func (s *receiveSession) handleTextRequest(ctx context.Context, request *TransferRequest, accepted bool, rejectionCode RejectionCode, rejectionMsg string) error {
+	if accepted && (request.IsDir || request.FileSize > MaxTextSize) {
+		logf("Rejecting text '%s': snippets are single files of at most %s\n", request.TargetPath(), FormatByteSize(MaxTextSize))
+		accepted, rejectionMsg = false, fmt.Sprintf("Text snippets must be at most %s", FormatByteSize(MaxTextSize))
+		rejectionCode = RejectionTooLarge
+	}
+
+	var text bytes.Buffer
+	stats, err := s.handleStreamRequest(ctx, request, &text, accepted, rejectionCode, rejectionMsg)
+	if err != nil || request.DryRun {
+		return err
+	}
+	if !utf8.Valid(text.Bytes()) {
+		logf("Warning: text from %s is not valid UTF-8\n", s.peerAddr)
+	}
+
+	logf("\n--- Text from %s ---\n%s\n--- End of text ---\n", s.peerAddr, strings.TrimRight(text.String(), "\n"))
+	if s.config.OnText != nil {
+		s.config.OnText(text.String(), stats)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package p2p
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendText(t *testing.T) {
+	// Set test mode to avoid user input prompts
+	os.Setenv("LANDROP_TEST_MODE", "1")
+	defer os.Unsetenv("LANDROP_TEST_MODE")
+
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	config := DefaultReceiverConfig()
+	config.OutputDir = t.TempDir()
+	var received string
+	var stats *TransferStats
+	config.OnText = func(text string, s *TransferStats) {
+		received, stats = text, s
+	}
+
+	receiverDone := make(chan error, 1)
+	go func() {
+		receiverDone <- ReceiveFileChunkedWithConfig(fmt.Sprintf("%d", port), config)
+	}()
+
+	// Give receiver time to start
+	time.Sleep(100 * time.Millisecond)
+
+	message := "meeting moved to 3pm ☕\n"
+	if err := SendTextWithConfig(message, fmt.Sprintf("127.0.0.1:%d", port), DefaultSenderConfig()); err != nil {
+		t.Fatalf("Sender failed: %v", err)
+	}
+	select {
+	case err := <-receiverDone:
+		if err != nil {
+			t.Fatalf("Receiver failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Test timed out")
+	}
+
+	if received != message {
+		t.Errorf("Expected the text to be delivered, got %q", received)
+	}
+	if stats == nil || stats.Status != "completed" || !strings.HasPrefix(stats.Filename, "text-") {
+		t.Errorf("Expected completed statistics for the snippet, got %+v", stats)
+	}
+	if entries, _ := os.ReadDir(config.OutputDir); len(entries) != 0 {
+		t.Errorf("Expected nothing to be saved for a snippet, found %d entries", len(entries))
+	}
+}
+
+func TestValidateText(t *testing.T) {
+	if err := ValidateText("hello"); err != nil {
+		t.Errorf("Expected short text to be valid, got %v", err)
+	}
+	for _, text := range []string{"", strings.Repeat("a", MaxTextSize+1), "\xff\xfe"} {
+		if err := ValidateText(text); err == nil {
+			t.Errorf("Expected %d bytes of text to be rejected", len(text))
+		}
+	}
+}
@@ -17,8 +17,10 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -33,8 +35,17 @@ type TrustedPeer struct {
 	LastSeen    int64     `json:"last_seen"`
 }
 
-// TrustStore manages persistent storage of trusted peers
-type TrustStore struct {
+// TrustStore is the backend that remembers approved peers.
+// The default implementation is FileTrustStore; NewTLSManager accepts any other.
+type TrustStore interface {
+	AddTrustedPeer(peer *TrustedPeer) error
+	GetTrustedPeer(deviceID string) (*TrustedPeer, bool)
+	IsTrusted(deviceID string) bool
+	GetAllTrustedPeers() map[string]*TrustedPeer
+}
+
+// FileTrustStore manages persistent storage of trusted peers in a JSON file
+type FileTrustStore struct {
 	filePath string
 	peers    map[string]*TrustedPeer
 	mutex    sync.RWMutex
@@ -55,8 +66,13 @@ type TLSManager struct {
 	caKey        *ecdsa.PrivateKey
 	deviceCert   *x509.Certificate
 	deviceKey    *ecdsa.PrivateKey
-	trustStore   *TrustStore
+	trustStore   TrustStore
 	testingMode  bool
+
+	// Client config presenting a pairing certificate, cached per PIN
+	pairingMutex  sync.Mutex
+	pairingConfig *tls.Config
+	pairingPIN    string
 }
 
 // DeviceInfo contains device identification information
@@ -68,23 +84,24 @@ type DeviceInfo struct {
 	CreatedAt     int64  `json:"created_at"`
 }
 
-// NewTLSManager creates a new TLS manager with embedded CA and device certificates
-func NewTLSManager() (*TLSManager, error) {
+// NewTLSManager creates a new TLS manager with embedded CA and device certificates.
+// trustStore may be nil, in which case the file-backed store in ~/.landrop is used.
+func NewTLSManager(trustStore TrustStore) (*TLSManager, error) {
 	// Check if we're in testing mode (environment variable or same device detection)
-	testingMode := os.Getenv("LANDROP_TESTING_MODE") == "true"
+	testingMode := envEnabled(TestingModeEnvVar)
 
 	if testingMode {
-		fmt.Printf("🔧 Creating TLS Manager in TESTING MODE (InsecureSkipVerify=true)\n")
+		logf("🔧 Creating TLS Manager in TESTING MODE (InsecureSkipVerify=true)\n")
 		return createTestingTLSManager()
 	}
 
-	fmt.Printf("🔐 Creating TLS Manager in PRODUCTION MODE with proper certificate chain\n")
-	return createProductionTLSManager()
+	logf("🔐 Creating TLS Manager in PRODUCTION MODE with proper certificate chain\n")
+	return createProductionTLSManager(trustStore)
 }
 
 // createTestingTLSManager creates a simple TLS manager for testing
 func createTestingTLSManager() (*TLSManager, error) {
-	fmt.Printf("🔧 Creating testing TLS Manager with InsecureSkipVerify=true\n")
+	logf("🔧 Creating testing TLS Manager with InsecureSkipVerify=true\n")
 
 	// Create permissive server config for testing
 	testingServerConfig := &tls.Config{
@@ -109,25 +126,29 @@ func createTestingTLSManager() (*TLSManager, error) {
 }
 
 // createPermissiveTLSManager creates a TLS manager that trusts on first use without prompts
-func createPermissiveTLSManager() (*TLSManager, error) {
-	fmt.Printf("🔓 Creating permissive TLS Manager with trust-on-first-use\n")
+func createPermissiveTLSManager(trustStore TrustStore) (*TLSManager, error) {
+	logf("🔓 Creating permissive TLS Manager with trust-on-first-use\n")
 
-	// Create or load trust store
-	trustStore, err := createTrustStore()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create trust store: %w", err)
+	// Create or load trust store unless the caller supplied one
+	if trustStore == nil {
+		defaultStore, err := OpenDefaultTrustStore()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create trust store: %w", err)
+		}
+		trustStore = defaultStore
 	}
 
-	// Generate CA and device certificates
-	caCert, caKey, err := generateCertificateAuthority()
+	// Load the persisted CA and device certificates, generating them on first run
+	dir, err := landropConfigDir()
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate CA: %w", err)
+		return nil, err
 	}
-
-	deviceCert, deviceKey, err := generateDeviceCertificate(caCert, caKey)
+	identity, err := loadOrCreateIdentity(dir)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate device certificate: %w", err)
+		return nil, err
 	}
+	caCert, caKey := identity.caCert, identity.caKey
+	deviceCert, deviceKey := identity.deviceCert, identity.deviceKey
 
 	// Create server TLS config
 	serverConfig, err := createServerTLSConfigWithTrustStore(deviceCert, deviceKey, caCert, trustStore)
@@ -151,25 +172,29 @@ func createPermissiveTLSManager() (*TLSManager, error) {
 }
 
 // createProductionTLSManager creates a full TLS manager with CA and device certificates
-func createProductionTLSManager() (*TLSManager, error) {
-	fmt.Printf("🔐 Creating production TLS Manager with proper CA and device certificates\n")
+func createProductionTLSManager(trustStore TrustStore) (*TLSManager, error) {
+	logf("🔐 Creating production TLS Manager with proper CA and device certificates\n")
 
-	// Create or load trust store
-	trustStore, err := createTrustStore()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create trust store: %w", err)
+	// Create or load trust store unless the caller supplied one
+	if trustStore == nil {
+		defaultStore, err := OpenDefaultTrustStore()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create trust store: %w", err)
+		}
+		trustStore = defaultStore
 	}
 
-	// Generate CA and device certificates
-	caCert, caKey, err := generateCertificateAuthority()
+	// Load the persisted CA and device certificates, generating them on first run
+	dir, err := landropConfigDir()
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate CA: %w", err)
+		return nil, err
 	}
-
-	deviceCert, deviceKey, err := generateDeviceCertificate(caCert, caKey)
+	identity, err := loadOrCreateIdentity(dir)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate device certificate: %w", err)
+		return nil, err
 	}
+	caCert, caKey := identity.caCert, identity.caKey
+	deviceCert, deviceKey := identity.deviceCert, identity.deviceKey
 
 	// Create server TLS config
 	serverConfig, err := createServerTLSConfigWithTrustStore(deviceCert, deviceKey, caCert, trustStore)
@@ -202,35 +227,33 @@ func (tm *TLSManager) GetClientConfig() *tls.Config {
 	return tm.clientConfig
 }
 
-// createTrustStore creates or loads a persistent trust store
-func createTrustStore() (*TrustStore, error) {
-	homeDir, err := os.UserHomeDir()
+// OpenDefaultTrustStore creates or loads the default trust store in ~/.landrop
+func OpenDefaultTrustStore() (*FileTrustStore, error) {
+	dir, err := landropConfigDir()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user home directory: %w", err)
-	}
-
-	landropDir := filepath.Join(homeDir, ".landrop")
-	if err := os.MkdirAll(landropDir, 0700); err != nil {
-		return nil, fmt.Errorf("failed to create .landrop directory: %w", err)
+		return nil, err
 	}
 
-	trustStorePath := filepath.Join(landropDir, "trusted_peers.json")
+	return NewFileTrustStore(filepath.Join(dir, "trusted_peers.json")), nil
+}
 
-	trustStore := &TrustStore{
-		filePath: trustStorePath,
+// NewFileTrustStore creates a trust store backed by the JSON file at path, loading any existing peers
+func NewFileTrustStore(path string) *FileTrustStore {
+	trustStore := &FileTrustStore{
+		filePath: path,
 		peers:    make(map[string]*TrustedPeer),
 	}
 
 	// Load existing trusted peers
 	if err := trustStore.load(); err != nil {
-		fmt.Printf("⚠️  Failed to load trust store: %v (starting with empty trust store)\n", err)
+		logf("⚠️  Failed to load trust store: %v (starting with empty trust store)\n", err)
 	}
 
-	return trustStore, nil
+	return trustStore
 }
 
 // load loads trusted peers from the JSON file
-func (ts *TrustStore) load() error {
+func (ts *FileTrustStore) load() error {
 	ts.mutex.Lock()
 	defer ts.mutex.Unlock()
 
@@ -245,11 +268,8 @@ func (ts *TrustStore) load() error {
 	return json.Unmarshal(data, &ts.peers)
 }
 
-// save saves trusted peers to the JSON file
-func (ts *TrustStore) save() error {
-	ts.mutex.RLock()
-	defer ts.mutex.RUnlock()
-
+// save saves trusted peers to the JSON file; the caller must hold the lock
+func (ts *FileTrustStore) save() error {
 	data, err := json.MarshalIndent(ts.peers, "", "  ")
 	if err != nil {
 		return err
@@ -258,8 +278,8 @@ func (ts *TrustStore) save() error {
 	return ioutil.WriteFile(ts.filePath, data, 0600)
 }
 
-// addTrustedPeer adds a new trusted peer to the store
-func (ts *TrustStore) addTrustedPeer(peer *TrustedPeer) error {
+// AddTrustedPeer adds a new trusted peer to the store
+func (ts *FileTrustStore) AddTrustedPeer(peer *TrustedPeer) error {
 	ts.mutex.Lock()
 	defer ts.mutex.Unlock()
 
@@ -267,8 +287,20 @@ func (ts *TrustStore) addTrustedPeer(peer *TrustedPeer) error {
 	return ts.save()
 }
 
-// getTrustedPeer retrieves a trusted peer by device ID
-func (ts *TrustStore) getTrustedPeer(deviceID string) (*TrustedPeer, bool) {
+// RemoveTrustedPeer revokes trust for a device and saves the store
+func (ts *FileTrustStore) RemoveTrustedPeer(deviceID string) error {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	if _, exists := ts.peers[deviceID]; !exists {
+		return fmt.Errorf("device '%s' is not in the trust store", deviceID)
+	}
+	delete(ts.peers, deviceID)
+	return ts.save()
+}
+
+// GetTrustedPeer retrieves a trusted peer by device ID
+func (ts *FileTrustStore) GetTrustedPeer(deviceID string) (*TrustedPeer, bool) {
 	ts.mutex.RLock()
 	defer ts.mutex.RUnlock()
 
@@ -276,14 +308,14 @@ func (ts *TrustStore) getTrustedPeer(deviceID string) (*TrustedPeer, bool) {
 	return peer, exists
 }
 
-// isTrusted checks if a peer is already trusted
-func (ts *TrustStore) isTrusted(deviceID string) bool {
-	_, exists := ts.getTrustedPeer(deviceID)
+// IsTrusted checks if a peer is already trusted
+func (ts *FileTrustStore) IsTrusted(deviceID string) bool {
+	_, exists := ts.GetTrustedPeer(deviceID)
 	return exists
 }
 
-// getAllTrustedPeers returns all trusted peers
-func (ts *TrustStore) getAllTrustedPeers() map[string]*TrustedPeer {
+// GetAllTrustedPeers returns all trusted peers
+func (ts *FileTrustStore) GetAllTrustedPeers() map[string]*TrustedPeer {
 	ts.mutex.RLock()
 	defer ts.mutex.RUnlock()
 
@@ -294,7 +326,7 @@ func (ts *TrustStore) getAllTrustedPeers() map[string]*TrustedPeer {
 	return result
 }
 
-// getAllLocalIPs returns all non-loopback IPv4 addresses on this machine
+// getAllLocalIPs returns the IPv4 and IPv6 addresses of every up interface, for certificate SANs
 func getAllLocalIPs() []net.IP {
 	var ips []net.IP
 	
@@ -324,13 +356,18 @@ func getAllLocalIPs() []net.IP {
 				ip = v.IP
 			}
 			
-			// Include IPv4 addresses (including loopback as fallback)
-			if ip != nil && ip.To4() != nil {
+			// Include IPv4 and IPv6 addresses (including loopback as fallback)
+			if ip != nil {
 				ips = append(ips, ip)
 			}
 		}
 	}
 	
+	// The bound IP must be covered even if its interface wasn't listed
+	if bound := BindAddress(); bound != nil && !slices.ContainsFunc(ips, bound.Equal) {
+		ips = append(ips, bound)
+	}
+
 	// If no IPs found, fallback to localhost
 	if len(ips) == 0 {
 		ips = []net.IP{net.ParseIP("127.0.0.1")}
@@ -401,13 +438,29 @@ func generateDeviceCertificate(caCert *x509.Certificate, caKey *ecdsa.PrivateKey
 	// Generate unique device ID
 	deviceID := generateDeviceID()
 
+	commonName := fmt.Sprintf("%s (%s)", hostname, deviceID[:8])
+	deviceCert, err := signDeviceCertificate(caCert, caKey, deviceKey, commonName, CertificateValidityDays*24*time.Hour)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return deviceCert, deviceKey, nil
+}
+
+// signDeviceCertificate issues a device certificate for deviceKey with the given device ID (CommonName)
+func signDeviceCertificate(caCert *x509.Certificate, caKey *ecdsa.PrivateKey, deviceKey *ecdsa.PrivateKey, commonName string, validity time.Duration) (*x509.Certificate, error) {
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "unknown"
+	}
+
 	// Create device certificate template
 	notBefore := time.Now()
-	notAfter := notBefore.Add(365 * 24 * time.Hour) // 1 year
+	notAfter := notBefore.Add(validity)
 
 	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to generate device serial number: %w", err)
+		return nil, fmt.Errorf("failed to generate device serial number: %w", err)
 	}
 
 	// Get all local IPs for the certificate
@@ -417,7 +470,7 @@ func generateDeviceCertificate(caCert *x509.Certificate, caKey *ecdsa.PrivateKey
 		SerialNumber: serialNumber,
 		Subject: pkix.Name{
 			Organization: []string{"LanDrop Device"},
-			CommonName:   fmt.Sprintf("%s (%s)", hostname, deviceID[:8]),
+			CommonName:   commonName,
 		},
 		NotBefore:             notBefore,
 		NotAfter:              notAfter,
@@ -431,15 +484,15 @@ func generateDeviceCertificate(caCert *x509.Certificate, caKey *ecdsa.PrivateKey
 	// Generate device certificate signed by CA
 	deviceCertDER, err := x509.CreateCertificate(rand.Reader, &deviceTemplate, caCert, &deviceKey.PublicKey, caKey)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to generate device certificate: %w", err)
+		return nil, fmt.Errorf("failed to generate device certificate: %w", err)
 	}
 
 	deviceCert, err := x509.ParseCertificate(deviceCertDER)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to parse device certificate: %w", err)
+		return nil, fmt.Errorf("failed to parse device certificate: %w", err)
 	}
 
-	return deviceCert, deviceKey, nil
+	return deviceCert, nil
 }
 
 // generateDeviceID creates a unique device identifier
@@ -486,7 +539,7 @@ func createServerTLSConfigWithCA(deviceCert *x509.Certificate, deviceKey *ecdsa.
 }
 
 // createServerTLSConfigWithTrustStore creates a TLS config using CA-signed device certificate with trust store verification
-func createServerTLSConfigWithTrustStore(deviceCert *x509.Certificate, deviceKey *ecdsa.PrivateKey, caCert *x509.Certificate, trustStore *TrustStore) (*tls.Config, error) {
+func createServerTLSConfigWithTrustStore(deviceCert *x509.Certificate, deviceKey *ecdsa.PrivateKey, caCert *x509.Certificate, trustStore TrustStore) (*tls.Config, error) {
 	// Create certificate PEM blocks
 	deviceCertPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: deviceCert.Raw})
 	deviceKeyBytes, err := x509.MarshalPKCS8PrivateKey(deviceKey)
@@ -501,17 +554,15 @@ func createServerTLSConfigWithTrustStore(deviceCert *x509.Certificate, deviceKey
 		return nil, fmt.Errorf("failed to load device certificate and key: %w", err)
 	}
 
-	// Create CA cert pool for client verification (for fallback)
-	caCertPool := x509.NewCertPool()
-	caCertPool.AddCert(caCert)
-
+	// Client certificates are checked by the trust store verifier rather than a fixed CA pool,
+	// since every LanDrop device has its own CA
 	return &tls.Config{
-		Certificates:         []tls.Certificate{cert},
-		NextProtos:           []string{TLSServerName},
-		ClientAuth:           tls.NoClientCert, // Be permissive for better compatibility
-		MinVersion:           tls.VersionTLS12,
-		ServerName:           "", // Accept any server name for flexibility
-		InsecureSkipVerify:   true, // Skip standard verification for better compatibility
+		Certificates:          []tls.Certificate{cert},
+		NextProtos:            []string{TLSServerName},
+		ClientAuth:            tls.RequireAnyClientCert,
+		VerifyPeerCertificate: verifyPeerCertificateWithTrustStore(caCert, trustStore),
+		MinVersion:            tls.VersionTLS12,
+		InsecureSkipVerify:    false,
 	}, nil
 }
 
@@ -523,7 +574,7 @@ func createClientTLSConfigWithCA(caCert *x509.Certificate, deviceCert *x509.Cert
 	deviceCertPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: deviceCert.Raw})
 	deviceKeyBytes, err := x509.MarshalPKCS8PrivateKey(deviceKey)
 	if err != nil {
-		fmt.Printf("⚠️  Failed to marshal device key: %v\n", err)
+		logf("⚠️  Failed to marshal device key: %v\n", err)
 		// Fallback to basic config for testing
 		return createTestingTLSConfig()
 	}
@@ -532,7 +583,7 @@ func createClientTLSConfigWithCA(caCert *x509.Certificate, deviceCert *x509.Cert
 	// Load certificate and key
 	cert, err := tls.X509KeyPair(deviceCertPEM, deviceKeyPEM)
 	if err != nil {
-		fmt.Printf("⚠️  Failed to load device certificate: %v\n", err)
+		logf("⚠️  Failed to load device certificate: %v\n", err)
 		// Fallback to basic config for testing
 		return createTestingTLSConfig()
 	}
@@ -552,12 +603,12 @@ func createClientTLSConfigWithCA(caCert *x509.Certificate, deviceCert *x509.Cert
 }
 
 // createClientTLSConfigPermissive creates a TLS config with permissive trust-on-first-use verification
-func createClientTLSConfigPermissive(caCert *x509.Certificate, deviceCert *x509.Certificate, deviceKey *ecdsa.PrivateKey, trustStore *TrustStore) *tls.Config {
+func createClientTLSConfigPermissive(caCert *x509.Certificate, deviceCert *x509.Certificate, deviceKey *ecdsa.PrivateKey, trustStore TrustStore) *tls.Config {
 	// Create device certificate for client authentication
 	deviceCertPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: deviceCert.Raw})
 	deviceKeyBytes, err := x509.MarshalPKCS8PrivateKey(deviceKey)
 	if err != nil {
-		fmt.Printf("⚠️  Failed to marshal device key: %v\n", err)
+		logf("⚠️  Failed to marshal device key: %v\n", err)
 		return createTestingTLSConfig()
 	}
 	deviceKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: deviceKeyBytes})
@@ -565,7 +616,7 @@ func createClientTLSConfigPermissive(caCert *x509.Certificate, deviceCert *x509.
 	// Load certificate and key
 	cert, err := tls.X509KeyPair(deviceCertPEM, deviceKeyPEM)
 	if err != nil {
-		fmt.Printf("⚠️  Failed to load device certificate: %v\n", err)
+		logf("⚠️  Failed to load device certificate: %v\n", err)
 		return createTestingTLSConfig()
 	}
 
@@ -584,12 +635,12 @@ func createClientTLSConfigPermissive(caCert *x509.Certificate, deviceCert *x509.
 }
 
 // createClientTLSConfigWithTrustStore creates a TLS config with trust-aware verification
-func createClientTLSConfigWithTrustStore(caCert *x509.Certificate, deviceCert *x509.Certificate, deviceKey *ecdsa.PrivateKey, trustStore *TrustStore) *tls.Config {
+func createClientTLSConfigWithTrustStore(caCert *x509.Certificate, deviceCert *x509.Certificate, deviceKey *ecdsa.PrivateKey, trustStore TrustStore) *tls.Config {
 	// Create device certificate for client authentication
 	deviceCertPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: deviceCert.Raw})
 	deviceKeyBytes, err := x509.MarshalPKCS8PrivateKey(deviceKey)
 	if err != nil {
-		fmt.Printf("⚠️  Failed to marshal device key: %v\n", err)
+		logf("⚠️  Failed to marshal device key: %v\n", err)
 		return createTestingTLSConfig()
 	}
 	deviceKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: deviceKeyBytes})
@@ -597,24 +648,26 @@ func createClientTLSConfigWithTrustStore(caCert *x509.Certificate, deviceCert *x
 	// Load certificate and key
 	cert, err := tls.X509KeyPair(deviceCertPEM, deviceKeyPEM)
 	if err != nil {
-		fmt.Printf("⚠️  Failed to load device certificate: %v\n", err)
+		logf("⚠️  Failed to load device certificate: %v\n", err)
 		return createTestingTLSConfig()
 	}
 
+	// Peers are signed by their own CA, so Go's chain verification against RootCAs would abort
+	// the handshake before VerifyPeerCertificate or VerifyConnection runs, and a new device could
+	// never be approved. InsecureSkipVerify only disables that built-in check; the trust store
+	// verifier below is what accepts or rejects the peer (see Peer Verification in the readme).
 	return &tls.Config{
-		Certificates:         []tls.Certificate{cert},
-		ClientAuth:           tls.NoClientCert, // Don't require client certificate for better compatibility
-		InsecureSkipVerify:   true,  // Skip standard verification completely
-		// VerifyPeerCertificate: verificationFunc, // Don't use custom verifier when InsecureSkipVerify=true
-		NextProtos:           []string{TLSServerName},
-		MinVersion:           tls.VersionTLS12,
-		ServerName:           "", // Accept any server name for flexibility
+		Certificates:          []tls.Certificate{cert},
+		InsecureSkipVerify:    true,
+		VerifyPeerCertificate: verifyPeerCertificateWithTrustStore(caCert, trustStore),
+		NextProtos:            []string{TLSServerName},
+		MinVersion:            tls.VersionTLS12,
 	}
 }
 
 // createTestingTLSConfig creates a more permissive TLS config for testing
 func createTestingTLSConfig() *tls.Config {
-	fmt.Printf("🔧 Using testing TLS configuration for same-device communication\n")
+	logf("🔧 Using testing TLS configuration for same-device communication\n")
 
 	return &tls.Config{
 		InsecureSkipVerify:   true, // Allow any certificate for testing
@@ -685,19 +738,39 @@ func generateServerTLSConfig() (*tls.Config, error) {
 
 // createClientTLSConfig creates a TLS config that trusts self-signed certificates for testing
 func createClientTLSConfig() *tls.Config {
-	fmt.Printf("🔧 Using fallback client TLS config with InsecureSkipVerify=true\n")
+	logf("🔧 Using fallback client TLS config with InsecureSkipVerify=true\n")
 	return &tls.Config{
 		InsecureSkipVerify: true,
+		NextProtos:         []string{TLSServerName},
 	}
 }
 
 // Global TLS manager instance
 var globalTLSManager *TLSManager
 
+// StrictModeEnvVar requires interactive approval for every new device when set to "1" or "true"
+const StrictModeEnvVar = "LANDROP_STRICT_MODE"
+
+// strictMode is set by SetStrictMode, e.g. from the --strict flag
+var strictMode atomic.Bool
+
+// SetStrictMode enables or disables strict mode in addition to StrictModeEnvVar
+func SetStrictMode(enabled bool) {
+	strictMode.Store(enabled)
+}
+
+// StrictModeEnabled reports whether unknown peers must be approved interactively instead of auto-trusted
+func StrictModeEnabled() bool {
+	if strictMode.Load() {
+		return true
+	}
+	return envEnabled(StrictModeEnvVar)
+}
+
 // InitializeTLS initializes the global TLS manager
 func InitializeTLS() error {
 	var err error
-	globalTLSManager, err = NewTLSManager()
+	globalTLSManager, err = NewTLSManager(nil)
 	return err
 }
 
@@ -726,17 +799,26 @@ func GetServerTLSConfig() *tls.Config {
 func GetClientTLSConfig() *tls.Config {
 	if globalTLSManager == nil {
 		// Fallback to direct generation if not initialized
-		fmt.Printf("⚠️  Global TLS manager not initialized, using fallback\n")
+		logf("⚠️  Global TLS manager not initialized, using fallback\n")
 		return createClientTLSConfig()
 	}
 	
 	config := globalTLSManager.GetClientConfig()
 	if config == nil {
-		fmt.Printf("⚠️  Client TLS config is nil, using testing config\n")
+		logf("⚠️  Client TLS config is nil, using testing config\n")
 		return createTestingTLSConfig()
 	}
+
+	if pin := currentSenderPairingPIN(); pin != "" {
+		pairingConfig, err := globalTLSManager.pairingClientConfig(pin)
+		if err != nil {
+			logf("⚠️  Failed to create pairing certificate: %v\n", err)
+		} else {
+			return pairingConfig
+		}
+	}
 	
-	fmt.Printf("✅ Using global client TLS config\n")
+	logf("✅ Using global client TLS config\n")
 	return config
 }
 
@@ -826,7 +908,7 @@ func GenerateCertificateFingerprint(cert *x509.Certificate) string {
 // verifyPeerCertificateWithCA creates a custom certificate verification function that checks against our CA
 func verifyPeerCertificateWithCA(caCert *x509.Certificate) func([][]byte, [][]*x509.Certificate) error {
 	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
-		fmt.Printf("🔍 Certificate verification called with %d certificates\n", len(rawCerts))
+		logf("🔍 Certificate verification called with %d certificates\n", len(rawCerts))
 
 		if len(rawCerts) == 0 {
 			return fmt.Errorf("no certificates provided")
@@ -838,7 +920,7 @@ func verifyPeerCertificateWithCA(caCert *x509.Certificate) func([][]byte, [][]*x
 			return fmt.Errorf("failed to parse peer certificate: %w", err)
 		}
 
-		fmt.Printf("🔍 Peer certificate: %s\n", peerCert.Subject.CommonName)
+		logf("🔍 Peer certificate: %s\n", peerCert.Subject.CommonName)
 
 		// Check if certificate is from a LanDrop device
 		if !isLanDropCertificate(peerCert) {
@@ -864,35 +946,26 @@ func verifyPeerCertificateWithCA(caCert *x509.Certificate) func([][]byte, [][]*x
 
 		if _, err := peerCert.Verify(opts); err == nil {
 			// Certificate signed by our CA - valid and trusted
-			fmt.Printf("✅ Peer certificate verified by our CA\n")
-			return nil
-		}
-
-		// Certificate not signed by our CA - check if it's a LanDrop certificate
-		hostname, _ := os.Hostname()
-		peerHostname := extractHostnameFromCN(peerCert.Subject.CommonName)
-
-		if peerHostname == hostname {
-			// Same device, different process - automatically trust
-			fmt.Printf("🔄 Same device detected (%s) - trusting automatically\n", hostname)
+			logf("✅ Peer certificate verified by our CA\n")
 			return nil
 		}
 
-		// Different device, different CA - show approval prompt for trust-on-first-use
-		if !promptForPeerApproval(peerCert) {
+		// Different CA, so a different device: processes on this one share the persisted CA, and a
+		// matching hostname proves nothing. Show approval prompt for trust-on-first-use
+		if !approvePeer(peerCert) {
 			return fmt.Errorf("peer connection rejected by user")
 		}
 
 		// User approved - allow this connection (trust-on-first-use)
-		fmt.Printf("✅ Approved connection to %s (trust-on-first-use)\n", peerCert.Subject.CommonName)
+		logf("✅ Approved connection to %s (trust-on-first-use)\n", peerCert.Subject.CommonName)
 		return nil
 	}
 }
 
 // verifyPeerCertificatePermissive creates a permissive certificate verification function that auto-approves LanDrop certificates
-func verifyPeerCertificatePermissive(caCert *x509.Certificate, trustStore *TrustStore) func([][]byte, [][]*x509.Certificate) error {
+func verifyPeerCertificatePermissive(caCert *x509.Certificate, trustStore TrustStore) func([][]byte, [][]*x509.Certificate) error {
 	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
-		fmt.Printf("🔓 Permissive certificate verification called with %d certificates\n", len(rawCerts))
+		logf("🔓 Permissive certificate verification called with %d certificates\n", len(rawCerts))
 
 		if len(rawCerts) == 0 {
 			return fmt.Errorf("no certificates provided")
@@ -904,7 +977,7 @@ func verifyPeerCertificatePermissive(caCert *x509.Certificate, trustStore *Trust
 			return fmt.Errorf("failed to parse peer certificate: %w", err)
 		}
 
-		fmt.Printf("🔓 Verifying peer certificate: %s\n", peerCert.Subject.CommonName)
+		logf("🔓 Verifying peer certificate: %s\n", peerCert.Subject.CommonName)
 
 		// Check if certificate is from a LanDrop device
 		if !isLanDropCertificate(peerCert) {
@@ -930,7 +1003,7 @@ func verifyPeerCertificatePermissive(caCert *x509.Certificate, trustStore *Trust
 
 		if _, err := peerCert.Verify(opts); err == nil {
 			// Certificate signed by our CA - valid and trusted
-			fmt.Printf("✅ Peer certificate verified by our CA\n")
+			logf("✅ Peer certificate verified by our CA\n")
 			return nil
 		}
 
@@ -940,10 +1013,10 @@ func verifyPeerCertificatePermissive(caCert *x509.Certificate, trustStore *Trust
 
 		if peerHostname == hostname {
 			// Same device, different process - automatically trust
-			fmt.Printf("🔄 Same device detected (%s) - trusting automatically\n", hostname)
+			logf("🔄 Same device detected (%s) - trusting automatically\n", hostname)
 		} else {
 			// Different device - auto-trust in permissive mode
-			fmt.Printf("🔓 Permissive mode: auto-trusting LanDrop device %s\n", peerCert.Subject.CommonName)
+			logf("🔓 Permissive mode: auto-trusting LanDrop device %s\n", peerCert.Subject.CommonName)
 		}
 
 		// Auto-add to trust store for future reference
@@ -960,8 +1033,8 @@ func verifyPeerCertificatePermissive(caCert *x509.Certificate, trustStore *Trust
 			LastSeen:    time.Now().Unix(),
 		}
 
-		if err := trustStore.addTrustedPeer(trustedPeer); err != nil {
-			fmt.Printf("⚠️  Failed to save trusted peer: %v\n", err)
+		if err := trustStore.AddTrustedPeer(trustedPeer); err != nil {
+			logf("⚠️  Failed to save trusted peer: %v\n", err)
 			// Continue anyway - connection was auto-approved
 		}
 
@@ -970,9 +1043,9 @@ func verifyPeerCertificatePermissive(caCert *x509.Certificate, trustStore *Trust
 }
 
 // verifyPeerCertificateWithTrustStore creates a certificate verification function that uses trust store
-func verifyPeerCertificateWithTrustStore(caCert *x509.Certificate, trustStore *TrustStore) func([][]byte, [][]*x509.Certificate) error {
+func verifyPeerCertificateWithTrustStore(caCert *x509.Certificate, trustStore TrustStore) func([][]byte, [][]*x509.Certificate) error {
 	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
-		fmt.Printf("🔍 Enhanced certificate verification called with %d certificates\n", len(rawCerts))
+		logf("🔍 Enhanced certificate verification called with %d certificates\n", len(rawCerts))
 
 		if len(rawCerts) == 0 {
 			return fmt.Errorf("no certificates provided")
@@ -984,7 +1057,7 @@ func verifyPeerCertificateWithTrustStore(caCert *x509.Certificate, trustStore *T
 			return fmt.Errorf("failed to parse peer certificate: %w", err)
 		}
 
-		fmt.Printf("🔍 Verifying peer certificate: %s\n", peerCert.Subject.CommonName)
+		logf("🔍 Verifying peer certificate: %s\n", peerCert.Subject.CommonName)
 
 		// Check if certificate is from a LanDrop device
 		if !isLanDropCertificate(peerCert) {
@@ -999,7 +1072,34 @@ func verifyPeerCertificateWithTrustStore(caCert *x509.Certificate, trustStore *T
 			return fmt.Errorf("certificate has expired")
 		}
 
-		// Try to verify against our CA first
+		// Pin the certificate before anything else may accept it: a known device ID presenting a
+		// different key is not the device we trusted
+		trustedPeer, exists := trustStore.GetTrustedPeer(peerCert.Subject.CommonName)
+		if exists && trustedPeer.Fingerprint == "" {
+			// Saved before fingerprints were pinned, so there's nothing to compare - approve it again
+			logf("🔍 %s has no pinned fingerprint, treating it as a new device\n", peerCert.Subject.CommonName)
+			exists = false
+		}
+		if exists {
+			fingerprint := generateCertificateFingerprint(peerCert)
+			if trustedPeer.Fingerprint != fingerprint && isRenewedCertificate(trustedPeer, peerCert) {
+				// Renewed certificate for the same key - move the pin to the new certificate
+				logf("🔄 %s renewed its certificate, updating pinned fingerprint\n", peerCert.Subject.CommonName)
+				trustedPeer.Fingerprint = fingerprint
+				trustedPeer.DeviceCert = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: peerCert.Raw}))
+				trustStore.AddTrustedPeer(trustedPeer)
+			}
+			if trustedPeer.Fingerprint != fingerprint {
+				logf("\n🚨 WARNING: CERTIFICATE FOR %s HAS CHANGED!\n", peerCert.Subject.CommonName)
+				logf("🚨 Trusted fingerprint:   %s\n", trustedPeer.Fingerprint)
+				logf("🚨 Presented fingerprint: %s\n", fingerprint)
+				logf("🚨 The device may have been reinstalled, or someone may be impersonating it.\n")
+				logf("🚨 If you trust the new key, run 'landrop trust remove \"%s\"' and reconnect to re-approve it.\n\n", peerCert.Subject.CommonName)
+				return fmt.Errorf("%w: fingerprint mismatch for trusted device %s", ErrCertificateInvalid, peerCert.Subject.CommonName)
+			}
+		}
+
+		// Try to verify against our CA
 		caCertPool := x509.NewCertPool()
 		caCertPool.AddCert(caCert)
 
@@ -1010,22 +1110,15 @@ func verifyPeerCertificateWithTrustStore(caCert *x509.Certificate, trustStore *T
 
 		if _, err := peerCert.Verify(opts); err == nil {
 			// Certificate signed by our CA - valid and trusted
-			fmt.Printf("✅ Peer certificate verified by our CA\n")
+			logf("✅ Peer certificate verified by our CA\n")
 			return nil
 		}
 
 		// Certificate not signed by our CA - check trust store for peer's CA
 		peerHostname := extractHostnameFromCN(peerCert.Subject.CommonName)
-		hostname, _ := os.Hostname()
-
-		if peerHostname == hostname {
-			// Same device, different process - automatically trust
-			fmt.Printf("🔄 Same device detected (%s) - trusting automatically\n", hostname)
-			return nil
-		}
 
 		// Check if peer is already in trust store
-		if trustedPeer, exists := trustStore.getTrustedPeer(peerCert.Subject.CommonName); exists {
+		if exists {
 			// Try to verify against the peer's stored CA
 			if trustedPeer.CACert != "" {
 				peerCA, err := parsePEMCertificate([]byte(trustedPeer.CACert))
@@ -1041,9 +1134,9 @@ func verifyPeerCertificateWithTrustStore(caCert *x509.Certificate, trustStore *T
 					if _, err := peerCert.Verify(opts); err == nil {
 						// Update last seen time
 						trustedPeer.LastSeen = time.Now().Unix()
-						trustStore.addTrustedPeer(trustedPeer)
+						trustStore.AddTrustedPeer(trustedPeer)
 
-						fmt.Printf("✅ Peer certificate verified by stored CA: %s\n", peerCert.Subject.CommonName)
+						logf("✅ Peer certificate verified by stored CA: %s\n", peerCert.Subject.CommonName)
 						return nil
 					}
 				}
@@ -1051,21 +1144,35 @@ func verifyPeerCertificateWithTrustStore(caCert *x509.Certificate, trustStore *T
 
 			// If we have the peer stored but verification fails, update last seen anyway
 			trustedPeer.LastSeen = time.Now().Unix()
-			trustStore.addTrustedPeer(trustedPeer)
+			trustStore.AddTrustedPeer(trustedPeer)
 
-			fmt.Printf("✅ Peer already trusted (fallback): %s\n", peerCert.Subject.CommonName)
+			logf("✅ Peer already trusted (fallback): %s\n", peerCert.Subject.CommonName)
 			return nil
 		}
 
-		// New device with different CA - automatically trust any LanDrop certificate
-		fmt.Printf("🔓 Auto-trusting new LanDrop device: %s\n", peerCert.Subject.CommonName)
-		fmt.Printf("🔓 Security note: This is a LanDrop device with auto-approval enabled\n")
+		if pairing, err := checkPairingProof(peerCert); pairing {
+			// Pairing mode - the PIN replaces both auto-trust and the strict mode prompt
+			if err != nil {
+				logf("🚫 Rejected %s: %v\n", peerCert.Subject.CommonName, err)
+				return err
+			}
+			logf("🔢 %s proved the pairing PIN\n", peerCert.Subject.CommonName)
+		} else if StrictModeEnabled() {
+			// Strict mode - unknown devices need interactive approval before they are trusted
+			if err := verifyPeerCertificateWithCA(caCert)(rawCerts, verifiedChains); err != nil {
+				return err
+			}
+		} else {
+			// New device with different CA - automatically trust any LanDrop certificate
+			logf("🔓 Auto-trusting new LanDrop device: %s\n", peerCert.Subject.CommonName)
+			logf("🔓 Security note: This is a LanDrop device with auto-approval enabled\n")
+		}
 
 		// Auto-add to trust store with our CA for future reference
 		ourCAPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caCert.Raw})
 		deviceCertPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: peerCert.Raw})
 
-		trustedPeer := &TrustedPeer{
+		trustedPeer = &TrustedPeer{
 			DeviceID:    peerCert.Subject.CommonName,
 			Hostname:    peerHostname,
 			Fingerprint: generateCertificateFingerprint(peerCert),
@@ -1075,16 +1182,26 @@ func verifyPeerCertificateWithTrustStore(caCert *x509.Certificate, trustStore *T
 			LastSeen:    time.Now().Unix(),
 		}
 
-		if err := trustStore.addTrustedPeer(trustedPeer); err != nil {
-			fmt.Printf("⚠️  Failed to save trusted peer: %v\n", err)
-			// Continue anyway - connection was auto-approved
+		if err := trustStore.AddTrustedPeer(trustedPeer); err != nil {
+			logf("⚠️  Failed to save trusted peer: %v\n", err)
+			// Continue anyway - connection was approved
 		}
 
-		fmt.Printf("✅ Auto-trusted new peer: %s\n", peerCert.Subject.CommonName)
+		logf("✅ Trusted new peer: %s\n", peerCert.Subject.CommonName)
 		return nil
 	}
 }
 
+// isRenewedCertificate reports whether cert re-issues the stored device certificate with the same key
+func isRenewedCertificate(trustedPeer *TrustedPeer, cert *x509.Certificate) bool {
+	storedCert, err := parsePEMCertificate([]byte(trustedPeer.DeviceCert))
+	if err != nil {
+		return false
+	}
+	storedKey, ok := storedCert.PublicKey.(*ecdsa.PublicKey)
+	return ok && storedKey.Equal(cert.PublicKey)
+}
+
 // parsePEMCertificate parses a PEM-encoded certificate
 func parsePEMCertificate(pemData []byte) (*x509.Certificate, error) {
 	block, _ := pem.Decode(pemData)
@@ -1114,6 +1231,9 @@ func isLanDropCertificate(cert *x509.Certificate) bool {
 	return cert.Subject.Organization[0] == "LanDrop Device"
 }
 
+// approvePeer asks whether to trust a device signed by another CA; tests replace it
+var approvePeer = promptForPeerApproval
+
 // promptForPeerApproval asks the user to approve a new peer connection
 func promptForPeerApproval(cert *x509.Certificate) bool {
 	fingerprint := generateCertificateFingerprint(cert)
@@ -0,0 +1,392 @@
+package p2p
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileTrustStorePersistsPeers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trusted_peers.json")
+
+	store := NewFileTrustStore(path)
+	if store.IsTrusted("device-1") {
+		t.Fatal("Expected empty trust store")
+	}
+	if err := store.AddTrustedPeer(&TrustedPeer{DeviceID: "device-1", Hostname: "laptop"}); err != nil {
+		t.Fatalf("Failed to add trusted peer: %v", err)
+	}
+
+	reloaded := NewFileTrustStore(path)
+	peer, ok := reloaded.GetTrustedPeer("device-1")
+	if !ok || peer.Hostname != "laptop" {
+		t.Errorf("Expected reloaded store to contain device-1, got %+v (found=%v)", peer, ok)
+	}
+	if len(reloaded.GetAllTrustedPeers()) != 1 {
+		t.Errorf("Expected 1 trusted peer, got %d", len(reloaded.GetAllTrustedPeers()))
+	}
+}
+
+func TestNewTLSManagerUsesCustomTrustStore(t *testing.T) {
+	t.Setenv("LANDROP_TESTING_MODE", "")
+	t.Setenv("HOME", t.TempDir())
+
+	store := NewFileTrustStore(filepath.Join(t.TempDir(), "trusted_peers.json"))
+	manager, err := NewTLSManager(store)
+	if err != nil {
+		t.Fatalf("Failed to create TLS manager: %v", err)
+	}
+	if manager.trustStore != TrustStore(store) {
+		t.Error("Expected TLS manager to use the supplied trust store")
+	}
+}
+
+func TestFileTrustStoreRemovePeer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trusted_peers.json")
+
+	store := NewFileTrustStore(path)
+	if err := store.AddTrustedPeer(&TrustedPeer{DeviceID: "device-1"}); err != nil {
+		t.Fatalf("Failed to add trusted peer: %v", err)
+	}
+	if err := store.RemoveTrustedPeer("device-1"); err != nil {
+		t.Fatalf("Failed to remove trusted peer: %v", err)
+	}
+	if err := store.RemoveTrustedPeer("device-1"); err == nil {
+		t.Error("Expected error removing an unknown peer")
+	}
+
+	if NewFileTrustStore(path).IsTrusted("device-1") {
+		t.Error("Expected removal to be persisted")
+	}
+}
+
+// newForeignDeviceCertificate creates a LanDrop device certificate for another host, signed by its own CA
+func newForeignDeviceCertificate(t *testing.T, hostname string) *x509.Certificate {
+	t.Helper()
+
+	caCert, caKey, err := generateCertificateAuthority()
+	if err != nil {
+		t.Fatalf("Failed to generate CA: %v", err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			Organization: []string{"LanDrop Device"},
+			CommonName:   hostname + " (abcd1234)",
+		},
+		NotBefore:   time.Now().Add(-time.Minute),
+		NotAfter:    time.Now().Add(time.Hour),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	return cert
+}
+
+func TestTrustStoreVerifierHandlesUnknownPeer(t *testing.T) {
+	t.Setenv("LANDROP_TESTING_MODE", "")
+	t.Setenv("HOME", t.TempDir())
+
+	store := NewFileTrustStore(filepath.Join(t.TempDir(), "trusted_peers.json"))
+	manager, err := NewTLSManager(store)
+	if err != nil {
+		t.Fatalf("Failed to create TLS manager: %v", err)
+	}
+
+	// Both sides must route peer certificates through the trust store verifier
+	clientConfig := manager.GetClientConfig()
+	serverConfig := manager.GetServerConfig()
+	if clientConfig.VerifyPeerCertificate == nil || serverConfig.VerifyPeerCertificate == nil {
+		t.Fatal("Expected client and server configs to install a peer verifier")
+	}
+	if serverConfig.ClientAuth != tls.RequireAnyClientCert {
+		t.Errorf("Expected server to require a client certificate, got %v", serverConfig.ClientAuth)
+	}
+
+	peerCert := newForeignDeviceCertificate(t, "unknown-peer-host")
+	if store.IsTrusted(peerCert.Subject.CommonName) {
+		t.Fatal("Expected peer to be unknown before verification")
+	}
+
+	if err := clientConfig.VerifyPeerCertificate([][]byte{peerCert.Raw}, nil); err != nil {
+		t.Fatalf("Expected unknown LanDrop peer to pass verification, got %v", err)
+	}
+	if !store.IsTrusted(peerCert.Subject.CommonName) {
+		t.Error("Expected verification of an unknown peer to record it in the trust store")
+	}
+
+	if err := serverConfig.VerifyPeerCertificate(nil, nil); err == nil {
+		t.Error("Expected verification without certificates to fail")
+	}
+}
+
+func TestProductionTLSHandshake(t *testing.T) {
+	t.Setenv("LANDROP_TESTING_MODE", "")
+
+	// Each side gets its own home directory, and so its own persisted identity
+	t.Setenv("HOME", t.TempDir())
+	serverManager, err := NewTLSManager(NewFileTrustStore(filepath.Join(t.TempDir(), "server.json")))
+	if err != nil {
+		t.Fatalf("Failed to create server TLS manager: %v", err)
+	}
+	t.Setenv("HOME", t.TempDir())
+	clientManager, err := NewTLSManager(NewFileTrustStore(filepath.Join(t.TempDir(), "client.json")))
+	if err != nil {
+		t.Fatalf("Failed to create client TLS manager: %v", err)
+	}
+
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- tls.Server(serverConn, serverManager.GetServerConfig()).Handshake()
+	}()
+
+	if err := tls.Client(clientConn, clientManager.GetClientConfig()).Handshake(); err != nil {
+		t.Fatalf("Client handshake failed: %v", err)
+	}
+	if err := <-serverErr; err != nil {
+		t.Fatalf("Server handshake failed: %v", err)
+	}
+}
+
+func TestProductionClientRejectsUnverifiedServer(t *testing.T) {
+	t.Setenv("LANDROP_TESTING_MODE", "")
+	t.Setenv("HOME", t.TempDir())
+	clientManager, err := NewTLSManager(NewFileTrustStore(filepath.Join(t.TempDir(), "client.json")))
+	if err != nil {
+		t.Fatalf("Failed to create client TLS manager: %v", err)
+	}
+
+	// InsecureSkipVerify only skips Go's chain check; a certificate the verifier refuses still fails
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"Not LanDrop"}, CommonName: "impostor"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	serverConfig := &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		NextProtos:   []string{TLSServerName},
+	}
+
+	// A real socket, since over an unbuffered net.Pipe the client's alert would wait on a server
+	// still writing its flight
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	conn, err := tls.Dial("tcp", listener.Addr().String(), clientManager.GetClientConfig())
+	if err == nil {
+		conn.Close()
+	}
+	if err == nil || !strings.Contains(err.Error(), "not from a LanDrop device") {
+		t.Fatalf("Expected the trust store verifier to refuse the certificate, got %v", err)
+	}
+}
+
+func TestStrictModeDoesNotTrustLocalHostname(t *testing.T) {
+	SetStrictMode(true)
+	defer SetStrictMode(false)
+	var prompted []string
+	approvePeer = func(cert *x509.Certificate) bool {
+		prompted = append(prompted, cert.Subject.CommonName)
+		return false
+	}
+	defer func() { approvePeer = promptForPeerApproval }()
+
+	caCert, _, err := generateCertificateAuthority()
+	if err != nil {
+		t.Fatalf("Failed to generate CA: %v", err)
+	}
+	store := NewFileTrustStore(filepath.Join(t.TempDir(), "trusted_peers.json"))
+
+	// Anyone can name a certificate after this host, so it mustn't skip the approval prompt
+	hostname, _ := os.Hostname()
+	impostor := newForeignDeviceCertificate(t, hostname)
+	if err := verifyPeerCertificateWithTrustStore(caCert, store)([][]byte{impostor.Raw}, nil); err == nil {
+		t.Fatal("Expected a declined certificate named after this host to be rejected")
+	}
+	if len(prompted) != 1 {
+		t.Errorf("Expected the user to be asked once, got %v", prompted)
+	}
+	if store.IsTrusted(impostor.Subject.CommonName) {
+		t.Error("Expected the declined certificate not to be trusted")
+	}
+}
+
+func TestTrustStoreVerifierPinsFingerprint(t *testing.T) {
+	caCert, _, err := generateCertificateAuthority()
+	if err != nil {
+		t.Fatalf("Failed to generate CA: %v", err)
+	}
+	store := NewFileTrustStore(filepath.Join(t.TempDir(), "trusted_peers.json"))
+	verify := verifyPeerCertificateWithTrustStore(caCert, store)
+
+	peerCert := newForeignDeviceCertificate(t, "pinned-peer-host")
+	if err := store.AddTrustedPeer(&TrustedPeer{
+		DeviceID:    peerCert.Subject.CommonName,
+		Fingerprint: generateCertificateFingerprint(peerCert),
+	}); err != nil {
+		t.Fatalf("Failed to add trusted peer: %v", err)
+	}
+
+	if err := verify([][]byte{peerCert.Raw}, nil); err != nil {
+		t.Fatalf("Expected pinned certificate to verify, got %v", err)
+	}
+
+	// Same CommonName, different key
+	impostor := newForeignDeviceCertificate(t, "pinned-peer-host")
+	if err := verify([][]byte{impostor.Raw}, nil); !errors.Is(err, ErrCertificateInvalid) {
+		t.Errorf("Expected ErrCertificateInvalid for changed fingerprint, got %v", err)
+	}
+}
+
+func TestTrustStoreVerifierPinsLocalHostname(t *testing.T) {
+	caCert, _, err := generateCertificateAuthority()
+	if err != nil {
+		t.Fatalf("Failed to generate CA: %v", err)
+	}
+	store := NewFileTrustStore(filepath.Join(t.TempDir(), "trusted_peers.json"))
+	verify := verifyPeerCertificateWithTrustStore(caCert, store)
+
+	// A trusted device that happens to share this host's name is pinned like any other
+	hostname, _ := os.Hostname()
+	peerCert := newForeignDeviceCertificate(t, hostname)
+	if err := store.AddTrustedPeer(&TrustedPeer{
+		DeviceID:    peerCert.Subject.CommonName,
+		Fingerprint: generateCertificateFingerprint(peerCert),
+	}); err != nil {
+		t.Fatalf("Failed to add trusted peer: %v", err)
+	}
+
+	impostor := newForeignDeviceCertificate(t, hostname)
+	if err := verify([][]byte{impostor.Raw}, nil); !errors.Is(err, ErrCertificateInvalid) {
+		t.Errorf("Expected ErrCertificateInvalid for a changed key under this host's name, got %v", err)
+	}
+}
+
+func TestTrustStoreVerifierReapprovesUnpinnedPeer(t *testing.T) {
+	SetStrictMode(true)
+	defer SetStrictMode(false)
+	approve := false
+	prompts := 0
+	approvePeer = func(*x509.Certificate) bool {
+		prompts++
+		return approve
+	}
+	defer func() { approvePeer = promptForPeerApproval }()
+
+	caCert, _, err := generateCertificateAuthority()
+	if err != nil {
+		t.Fatalf("Failed to generate CA: %v", err)
+	}
+	store := NewFileTrustStore(filepath.Join(t.TempDir(), "trusted_peers.json"))
+	verify := verifyPeerCertificateWithTrustStore(caCert, store)
+
+	// Entries saved before pinning have no fingerprint to compare against
+	peerCert := newForeignDeviceCertificate(t, "unpinned-peer-host")
+	if err := store.AddTrustedPeer(&TrustedPeer{DeviceID: peerCert.Subject.CommonName}); err != nil {
+		t.Fatalf("Failed to add trusted peer: %v", err)
+	}
+
+	if err := verify([][]byte{peerCert.Raw}, nil); err == nil {
+		t.Fatal("Expected an unpinned peer to need approval again")
+	}
+	approve = true
+	if err := verify([][]byte{peerCert.Raw}, nil); err != nil {
+		t.Fatalf("Expected the approved peer to verify, got %v", err)
+	}
+	if prompts != 2 {
+		t.Errorf("Expected the user to be asked each time, got %d prompts", prompts)
+	}
+	peer, _ := store.GetTrustedPeer(peerCert.Subject.CommonName)
+	if peer.Fingerprint != generateCertificateFingerprint(peerCert) {
+		t.Error("Expected the approval to pin the fingerprint")
+	}
+}
+
+func TestTrustStoreVerifierAcceptsRenewedCertificate(t *testing.T) {
+	caCert, caKey, err := generateCertificateAuthority()
+	if err != nil {
+		t.Fatalf("Failed to generate CA: %v", err)
+	}
+	deviceKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	original, err := signDeviceCertificate(caCert, caKey, deviceKey, "renewing-host (abcd1234)", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to sign certificate: %v", err)
+	}
+
+	ourCA, _, err := generateCertificateAuthority()
+	if err != nil {
+		t.Fatalf("Failed to generate CA: %v", err)
+	}
+	store := NewFileTrustStore(filepath.Join(t.TempDir(), "trusted_peers.json"))
+	if err := store.AddTrustedPeer(&TrustedPeer{
+		DeviceID:    original.Subject.CommonName,
+		Fingerprint: generateCertificateFingerprint(original),
+		DeviceCert:  string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: original.Raw})),
+	}); err != nil {
+		t.Fatalf("Failed to add trusted peer: %v", err)
+	}
+
+	renewed, err := signDeviceCertificate(caCert, caKey, deviceKey, original.Subject.CommonName, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to sign renewed certificate: %v", err)
+	}
+	if err := verifyPeerCertificateWithTrustStore(ourCA, store)([][]byte{renewed.Raw}, nil); err != nil {
+		t.Fatalf("Expected renewed certificate with the same key to verify, got %v", err)
+	}
+
+	peer, _ := store.GetTrustedPeer(original.Subject.CommonName)
+	if peer.Fingerprint != generateCertificateFingerprint(renewed) {
+		t.Error("Expected the pinned fingerprint to move to the renewed certificate")
+	}
+}
@@ -0,0 +1,241 @@
+package p2p
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// ReceiverConfig holds the receiver-side options for incoming transfers
+type ReceiverConfig struct {
+	// OutputDir is the directory received files are written to (empty means the current directory)
+	OutputDir string
+
+	// OnProgress, if set, receives progress updates for each incoming file
+	OnProgress ProgressFunc
+
+	// Daemon keeps accepting connections after the first one, serving each concurrently
+	Daemon bool
+
+	// MaxConnections caps the connections a daemon serves at once; senders beyond it are turned
+	// away with ErrReceiverBusy until one finishes (zero means DefaultMaxConnections)
+	MaxConnections int
+
+	// MaxFileSize rejects files larger than this many bytes (zero means unlimited)
+	MaxFileSize int64
+
+	// AllowedDevices, if not empty, restricts senders to these device IDs, or the certificate
+	// fingerprints pinned for them in the trust store; other senders are rejected without prompting.
+	// Hostnames don't match, since a device chooses its own.
+	AllowedDevices []string
+
+	// AutoAccept accepts every incoming transfer without prompting
+	AutoAccept bool
+
+	// Quiet suppresses progress bars and summaries
+	Quiet bool
+
+	// Output, if set, receives the contents of each accepted file in order instead of the output directory.
+	// Directories are rejected, and transfers can't resume.
+	Output io.Writer
+
+	// VerifyExisting records every chunk's checksum while receiving, and before resuming re-checks
+	// the chunks already on disk against them, receiving any that fail, or weren't recorded, again
+	VerifyExisting bool
+
+	// PreserveAttributes gives each received file the sender's permission bits, without setuid,
+	// setgid, sticky or group and world write bits, and its modification time
+	PreserveAttributes bool
+
+	// OnConflict is what happens when a received file's name is already taken: ConflictRename
+	// (the default when empty), ConflictSkip or ConflictOverwrite
+	OnConflict string
+
+	// WriteManifest writes <file>.manifest.json next to each verified file, listing every chunk's checksum
+	WriteManifest bool
+
+	// SharedDirs are the directories peers may pull files from with GetFileChunked. Files outside
+	// them can't be requested, and nothing is shared when empty.
+	SharedDirs []string
+
+	// BeforeAccept, if set, is called for every file and directory request that passed the built-in
+	// checks, before the user is prompted. Returning false rejects it with reason.
+	BeforeAccept func(request *TransferRequest) (accept bool, reason string)
+
+	// AcceptPolicy, if set, decides on requests in place of the interactive prompt (nil means
+	// PromptPolicy). AutoAccept skips it.
+	AcceptPolicy AcceptPolicy
+
+	// AfterReceive, if set, is called with the saved path and final statistics of each file once it
+	// has been verified. Its error is logged; the sender has already been told the file arrived.
+	AfterReceive func(path string, stats *TransferStats) error
+
+	// OnText, if set, is called with each text snippet received, after it has been verified and
+	// shown. Snippets aren't written to the output directory.
+	OnText func(text string, stats *TransferStats)
+
+	// StreamTimeout bounds waiting for each chunk stream (zero means StreamTimeout)
+	StreamTimeout time.Duration
+
+	// TCPFallback also listens on the TCP port of the same number for senders that can't reach
+	// the receiver over UDP, using the legacy TCP protocol. Those transfers aren't encrypted and
+	// the sender isn't verified, so this can't be combined with AllowedDevices, Output, strict
+	// mode or a pairing PIN. MaxFileSize, OnConflict, BeforeAccept, AcceptPolicy and the prompt
+	// still apply.
+	TCPFallback bool
+
+	// TransferTimeout bounds a receive that isn't a daemon, from listening until the transfer ends,
+	// or a pull (zero means no deadline). Daemons run until stopped.
+	TransferTimeout time.Duration
+}
+
+// DefaultReceiverConfig returns the receiver configuration used when none is provided
+func DefaultReceiverConfig() ReceiverConfig {
+	return ReceiverConfig{
+		StreamTimeout:   StreamTimeout,
+		TransferTimeout: DefaultTransferTimeout,
+	}
+}
+
+// validate checks the receiver configuration before listening
+func (c ReceiverConfig) validate() error {
+	if err := ValidateConflictPolicy(c.OnConflict); err != nil {
+		return err
+	}
+	if c.StreamTimeout < 0 || c.TransferTimeout < 0 {
+		return fmt.Errorf("stream and transfer timeouts must not be negative")
+	}
+	if c.MaxConnections < 0 {
+		return fmt.Errorf("max connections must not be negative")
+	}
+	if c.MaxFileSize < 0 {
+		return fmt.Errorf("max file size must not be negative")
+	}
+	if c.TCPFallback && (len(c.AllowedDevices) > 0 || c.Output != nil || StrictModeEnabled() || pairingPINEnabled()) {
+		return fmt.Errorf("TCP fallback can't be combined with an allowlist, strict mode, a pairing PIN or writing to a stream, since TCP senders can't be verified")
+	}
+	return nil
+}
+
+// SenderConfig holds the sender-side options for outgoing transfers
+type SenderConfig struct {
+	// ChunkSize is the size of each chunk sent over its own stream
+	ChunkSize int64
+
+	// AutoChunkSize measures the connection with a few probes before the first request and picks
+	// the chunk size from its round-trip time and throughput instead of using ChunkSize
+	AutoChunkSize bool
+
+	// Compression is the chunk compression to request ("none", "gzip" or "zstd")
+	Compression string
+
+	// MaxRate caps the aggregate send rate in bytes per second (zero means unlimited)
+	MaxRate int64
+
+	// OnProgress, if set, receives progress updates for each outgoing file
+	OnProgress ProgressFunc
+
+	// OnResult, if set, is called with each outgoing file's statistics once its transfer has ended
+	OnResult func(*TransferStats)
+
+	// DialAttempts is how many times to dial the receiver, backing off in between (zero means one attempt)
+	DialAttempts int
+
+	// DialTimeout bounds each dial attempt (zero means DefaultDialTimeout)
+	DialTimeout time.Duration
+
+	// ChunkAttempts is how many times to send a chunk the receiver didn't store, backing off in
+	// between (zero means one attempt)
+	ChunkAttempts int
+
+	// ChunkRetryDelay is the pause before a chunk is first resent; it doubles after each attempt up
+	// to ChunkRetryMaxDelay (zero means resending straight away)
+	ChunkRetryDelay time.Duration
+
+	// Reconnects is how many times to re-dial and resume a file whose connection dropped mid-transfer
+	// (zero means the transfer fails on the first drop)
+	Reconnects int
+
+	// Quiet suppresses progress bars and summaries
+	Quiet bool
+
+	// DryRun stops after the receiver answers the first request, so nothing is written on either side
+	DryRun bool
+
+	// HashAlgorithm hashes the file and its chunks ("sha256" or "blake3"). BLAKE3 is much faster
+	// on fast links, but only receivers that support it accept it; empty means SHA-256.
+	HashAlgorithm string
+
+	// HashUpfront reads the whole file to hash it before the request, as receivers without
+	// hash trailer support need. Otherwise the hash is computed while sending and follows the last chunk.
+	HashUpfront bool
+
+	// StreamTimeout bounds opening each chunk stream (zero means StreamTimeout)
+	StreamTimeout time.Duration
+
+	// TCPFallback sends single files with the legacy TCP protocol when the QUIC dial fails because
+	// UDP is refused or unroutable (never on a timeout). The receiver must accept TCP; the fallback
+	// isn't encrypted and doesn't verify the receiver, so it's off by default and skipped in strict
+	// mode and for directories, dry runs and text.
+	TCPFallback bool
+
+	// ContentType is announced for single files; ContentTypeText asks the receiver to show the
+	// file's contents as text instead of saving it
+	ContentType string
+
+	// TransferTimeout bounds a whole send, from dialing until every file has been sent
+	// (zero means no deadline)
+	TransferTimeout time.Duration
+
+	// ExpectFingerprint, if set, is the receiver's certificate fingerprint, or at least its first
+	// MinExpectedFingerprint hex digits. Each connection is checked after the handshake and, if the
+	// receiver presented another certificate, closed with ErrFingerprintMismatch before anything is
+	// sent. It rules out the TCP fallback, which can't verify the receiver.
+	ExpectFingerprint string
+}
+
+// DefaultSenderConfig returns the sender configuration used when none is provided
+func DefaultSenderConfig() SenderConfig {
+	return SenderConfig{
+		ChunkSize:       DefaultChunkSize,
+		Compression:     CompressionNone,
+		DialAttempts:    DefaultDialAttempts,
+		DialTimeout:     DefaultDialTimeout,
+		ChunkAttempts:   MaxRetries,
+		ChunkRetryDelay: DefaultChunkRetryDelay,
+		Reconnects:      DefaultReconnects,
+		StreamTimeout:   StreamTimeout,
+		TransferTimeout: DefaultTransferTimeout,
+	}
+}
+
+// validate checks the sender configuration before any connection is made
+func (c SenderConfig) validate() error {
+	if err := ValidateCompression(c.Compression); err != nil {
+		return err
+	}
+	if err := ValidateHashAlgorithm(c.HashAlgorithm); err != nil {
+		return err
+	}
+	if c.MaxRate < 0 {
+		return fmt.Errorf("max rate must not be negative")
+	}
+	if c.DialAttempts < 0 || c.DialTimeout < 0 {
+		return fmt.Errorf("dial attempts and timeout must not be negative")
+	}
+	if c.ChunkAttempts < 0 || c.ChunkRetryDelay < 0 {
+		return fmt.Errorf("chunk attempts and retry delay must not be negative")
+	}
+	if c.Reconnects < 0 {
+		return fmt.Errorf("reconnects must not be negative")
+	}
+	if c.StreamTimeout < 0 || c.TransferTimeout < 0 {
+		return fmt.Errorf("stream and transfer timeouts must not be negative")
+	}
+	if c.ExpectFingerprint != "" {
+		if err := ValidateExpectedFingerprint(c.ExpectFingerprint); err != nil {
+			return err
+		}
+	}
+	return ValidateChunkSize(c.ChunkSize)
+}
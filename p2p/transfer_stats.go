@@ -1,11 +1,17 @@
 package p2p
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"strings"
+	"sync"
 	"time"
 )
 
+// ProgressFunc receives progress updates for a transfer: completed and total chunks, and bytes transferred
+type ProgressFunc func(completed, total int, bytes int64)
+
 // TransferStats contains comprehensive transfer statistics
 type TransferStats struct {
 	Filename          string
@@ -18,16 +24,29 @@ type TransferStats struct {
 	Duration          time.Duration
 	AverageSpeed      float64 // in MB/s
 	PeerAddress       string
-	TransferDirection string // "sent" or "received"
-	Status            string // "completed", "failed", "rejected"
-	ChunksRetried     int    // Number of chunks that required retries
-	TotalRetries      int    // Total number of retry attempts
+	TransferDirection string        // "sent" or "received"
+	Status            string        // "completed", "failed", "rejected"
+	Reason            string        // Why the transfer failed or was rejected
+	RejectionCode     RejectionCode // The receiver's reason code when the transfer was rejected
+	ChunksRetried     int           // Number of chunks that required retries
+	TotalRetries      int           // Total number of retry attempts
+	Path              string        // Where a received file is saved, or the file being sent
+	FileHash          string        // The file's verified hash, once known
+
+	// OnProgress is called on every progress update and once on completion, even when quiet.
+	// It runs with the stats locked, so it must not call back into TransferStats.
+	OnProgress ProgressFunc
 
 	// Progress tracking for enhanced UI
-	progressTracker   *ProgressTracker
-	quiet             bool     // Disable output for testing
-	lastProgressTime  time.Time
-	bytesTransferred  int64    // Actual bytes transferred
+	progressTracker  *ProgressTracker
+	quiet            bool // Disable output for testing
+	lastProgressTime time.Time
+	bytesTransferred int64        // Actual bytes transferred
+	speedSamples     speedSamples // Recent byte counts for CurrentSpeed
+	windowedSpeed    bool         // Show CurrentSpeed in the progress bar instead of the average
+
+	// mutex guards the counters above, which are updated by concurrent chunk workers
+	mutex sync.Mutex
 }
 
 // NewTransferStats creates a new transfer stats instance
@@ -35,7 +54,7 @@ func NewTransferStats(filename string, fileSize int64, totalChunks int, peerAddr
 	// Create progress tracker with simple style for compact real-time display
 	progressTracker := NewProgressTracker(filename, fileSize, totalChunks, direction, ProgressStyleSimple)
 
-	return &TransferStats{
+	stats := &TransferStats{
 		Filename:          filename,
 		FileSize:          fileSize,
 		TotalChunks:       totalChunks,
@@ -52,10 +71,15 @@ func NewTransferStats(filename string, fileSize int64, totalChunks int, peerAddr
 		lastProgressTime:  time.Now(),
 		bytesTransferred:  0,
 	}
+	stats.speedSamples.add(stats.StartTime, 0)
+	return stats
 }
 
 // MarkCompleted marks the transfer as completed and calculates final stats
 func (ts *TransferStats) MarkCompleted() {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
 	ts.EndTime = time.Now()
 	ts.Duration = ts.EndTime.Sub(ts.StartTime)
 	ts.Status = "completed"
@@ -65,6 +89,14 @@ func (ts *TransferStats) MarkCompleted() {
 		bytesTransferred := float64(ts.FileSize)
 		ts.AverageSpeed = bytesTransferred / ts.Duration.Seconds() / (1024 * 1024)
 	}
+
+	// Report the final numbers
+	if ts.OnProgress != nil {
+		ts.OnProgress(ts.completedChunks(), ts.TotalChunks, ts.bytesTransferred)
+	}
+
+	appendHistory(ts.historyEntry())
+	notifyTransfer(ts.event())
 }
 
 // MarkFailed marks the transfer as failed
@@ -72,6 +104,10 @@ func (ts *TransferStats) MarkFailed(reason string) {
 	ts.EndTime = time.Now()
 	ts.Duration = ts.EndTime.Sub(ts.StartTime)
 	ts.Status = "failed"
+	ts.Reason = reason
+
+	appendHistory(ts.historyEntry())
+	notifyTransfer(ts.event())
 }
 
 // MarkRejected marks the transfer as rejected
@@ -79,20 +115,81 @@ func (ts *TransferStats) MarkRejected(reason string) {
 	ts.EndTime = time.Now()
 	ts.Duration = ts.EndTime.Sub(ts.StartTime)
 	ts.Status = "rejected"
+	ts.Reason = reason
+
+	appendHistory(ts.historyEntry())
+	notifyTransfer(ts.event())
+}
+
+// historyEntry returns the history log entry for a finished transfer
+func (ts *TransferStats) historyEntry() HistoryEntry {
+	return HistoryEntry{
+		Timestamp:       ts.EndTime,
+		Direction:       ts.TransferDirection,
+		Peer:            ts.PeerAddress,
+		Filename:        ts.Filename,
+		Size:            ts.FileSize,
+		Status:          ts.Status,
+		Reason:          ts.Reason,
+		DurationSeconds: ts.Duration.Seconds(),
+	}
+}
+
+// event returns the notify socket event for a finished transfer
+func (ts *TransferStats) event() TransferEvent {
+	return TransferEvent{
+		Timestamp: ts.EndTime,
+		Direction: ts.TransferDirection,
+		Peer:      ts.PeerAddress,
+		Filename:  ts.Filename,
+		Size:      ts.FileSize,
+		Status:    ts.Status,
+		Reason:    ts.Reason,
+		Path:      ts.Path,
+		Hash:      ts.FileHash,
+	}
 }
 
 // IncrementSentChunks increments the count of sent chunks
 func (ts *TransferStats) IncrementSentChunks() {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
 	ts.SentChunks++
+	ts.speedSamples.add(time.Now(), ts.bytesTransferred)
 }
 
 // IncrementReceivedChunks increments the count of received chunks
 func (ts *TransferStats) IncrementReceivedChunks() {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
 	ts.ReceivedChunks++
+	ts.speedSamples.add(time.Now(), ts.bytesTransferred)
+}
+
+// CurrentSpeed returns the throughput in MB/s over the last SpeedWindow, sampled each time a chunk
+// completes. Unlike AverageSpeed it follows changing conditions and falls towards zero when stalled.
+func (ts *TransferStats) CurrentSpeed() float64 {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	return ts.currentSpeed(time.Now())
+}
+
+// currentSpeed is CurrentSpeed at a given time; the caller holds the mutex
+func (ts *TransferStats) currentSpeed(now time.Time) float64 {
+	return ts.speedSamples.rate(now, SpeedWindow) / (1024 * 1024)
+}
+
+// SetWindowedSpeed makes the progress bar show CurrentSpeed instead of the average since the start
+func (ts *TransferStats) SetWindowedSpeed(enabled bool) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	ts.windowedSpeed = enabled
 }
 
 // AddRetry adds retry statistics
 func (ts *TransferStats) AddRetry(chunkIndex int, retryCount int) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
 	if retryCount > 1 {
 		ts.ChunksRetried++
 		ts.TotalRetries += (retryCount - 1)
@@ -114,40 +211,76 @@ func (ts *TransferStats) GetProgressPercentage() float64 {
 	}
 }
 
-// PrintSummary prints a detailed summary of the transfer
+// PrintSummary prints a detailed summary of the transfer, or its JSON form when SetJSONSummary is in effect
 func (ts *TransferStats) PrintSummary() {
+	if w := jsonSummaryOutput(); w != nil {
+		if err := ts.PrintJSON(w); err != nil {
+			logf("Warning: failed to write transfer summary: %v\n", err)
+		}
+		return
+	}
+
 	if ts.progressTracker != nil {
 		// Use the beautiful progress tracker summary
 		ts.progressTracker.PrintSummary(ts.Status, "")
 	} else {
 		// Fallback to basic summary
-		fmt.Println("\n" + strings.Repeat("=", 60))
-		fmt.Printf("📊 TRANSFER SUMMARY - %s\n", ts.getDirectionEmoji())
-		fmt.Println(strings.Repeat("=", 60))
+		logln("\n" + strings.Repeat("=", 60))
+		logf("📊 TRANSFER SUMMARY - %s\n", ts.getDirectionEmoji())
+		logln(strings.Repeat("=", 60))
 
-		fmt.Printf("📁 File:           %s\n", ts.Filename)
-		fmt.Printf("📦 Size:           %.2f MB\n", float64(ts.FileSize)/(1024*1024))
-		fmt.Printf("🔢 Chunks:         %d total", ts.TotalChunks)
+		logf("📁 File:           %s\n", ts.Filename)
+		logf("📦 Size:           %.2f MB\n", float64(ts.FileSize)/(1024*1024))
+		logf("🔢 Chunks:         %d total", ts.TotalChunks)
 
 		if ts.TransferDirection == "sent" {
-			fmt.Printf(" (%d sent)\n", ts.SentChunks)
+			logf(" (%d sent)\n", ts.SentChunks)
 		} else {
-			fmt.Printf(" (%d received)\n", ts.ReceivedChunks)
+			logf(" (%d received)\n", ts.ReceivedChunks)
 		}
 
-		fmt.Printf("🌐 Peer:           %s\n", ts.PeerAddress)
-		fmt.Printf("⏱️  Duration:       %.2f seconds\n", ts.Duration.Seconds())
-		fmt.Printf("🚀 Average Speed:  %.2f MB/s\n", ts.AverageSpeed)
-		fmt.Printf("✅ Status:         %s\n", ts.getStatusEmoji()+" "+ts.Status)
+		logf("🌐 Peer:           %s\n", ts.PeerAddress)
+		logf("⏱️  Duration:       %.2f seconds\n", ts.Duration.Seconds())
+		logf("🚀 Average Speed:  %.2f MB/s\n", ts.AverageSpeed)
+		logf("✅ Status:         %s\n", ts.getStatusEmoji()+" "+ts.Status)
 
 		if ts.ChunksRetried > 0 {
-			fmt.Printf("🔄 Retries:        %d chunks retried (%d total attempts)\n", ts.ChunksRetried, ts.TotalRetries)
+			logf("🔄 Retries:        %d chunks retried (%d resends)\n", ts.ChunksRetried, ts.TotalRetries)
 		}
 
-		fmt.Println(strings.Repeat("=", 60))
+		logln(strings.Repeat("=", 60))
 	}
 }
 
+// printBatchSummary prints the combined outcome of several transfers made over one session
+func printBatchSummary(results []*TransferStats, elapsed time.Duration) {
+	counts := make(map[string]int)
+	var totalBytes int64
+	for _, stats := range results {
+		counts[stats.Status]++
+		if stats.Status == "completed" {
+			totalBytes += stats.FileSize
+		}
+	}
+
+	logln("\n" + strings.Repeat("=", 60))
+	logf("📦 BATCH SUMMARY - %d files\n", len(results))
+	logln(strings.Repeat("=", 60))
+	logf("✅ Completed:      %d\n", counts["completed"])
+	if counts["rejected"] > 0 {
+		logf("🚫 Rejected:       %d\n", counts["rejected"])
+	}
+	if counts["failed"] > 0 {
+		logf("❌ Failed:         %d\n", counts["failed"])
+	}
+	logf("📦 Transferred:    %.2f MB\n", float64(totalBytes)/(1024*1024))
+	logf("⏱️  Duration:       %.2f seconds\n", elapsed.Seconds())
+	if elapsed.Seconds() > 0 {
+		logf("🚀 Average Speed:  %.2f MB/s\n", float64(totalBytes)/elapsed.Seconds()/(1024*1024))
+	}
+	logln(strings.Repeat("=", 60))
+}
+
 // getDirectionEmoji returns appropriate emoji for transfer direction
 func (ts *TransferStats) getDirectionEmoji() string {
 	if ts.TransferDirection == "sent" {
@@ -170,8 +303,16 @@ func (ts *TransferStats) getStatusEmoji() string {
 	}
 }
 
-// PrintProgress prints current progress with enhanced UI
+// PrintProgress prints current progress with enhanced UI and notifies OnProgress
 func (ts *TransferStats) PrintProgress() {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	completedChunks := ts.completedChunks()
+	if ts.OnProgress != nil {
+		ts.OnProgress(completedChunks, ts.TotalChunks, ts.bytesTransferred)
+	}
+
 	if ts.quiet || ts.progressTracker == nil {
 		return
 	}
@@ -183,13 +324,20 @@ func (ts *TransferStats) PrintProgress() {
 	}
 	ts.lastProgressTime = now
 
-	completedChunks := ts.SentChunks
-	if ts.TransferDirection == "received" {
-		completedChunks = ts.ReceivedChunks
+	// Use the progress tracker for beautiful output
+	speed := -1.0
+	if ts.windowedSpeed {
+		speed = ts.currentSpeed(now)
 	}
+	ts.progressTracker.PrintProgressWithSpeed(completedChunks, ts.bytesTransferred, speed)
+}
 
-	// Use the progress tracker for beautiful output
-	ts.progressTracker.PrintProgress(completedChunks, ts.bytesTransferred)
+// completedChunks returns the chunk count for the transfer direction
+func (ts *TransferStats) completedChunks() int {
+	if ts.TransferDirection == "received" {
+		return ts.ReceivedChunks
+	}
+	return ts.SentChunks
 }
 
 // SetQuiet disables progress output
@@ -202,10 +350,91 @@ func (ts *TransferStats) SetQuiet(quiet bool) {
 
 // UpdateBytesTransferred updates the actual bytes transferred
 func (ts *TransferStats) UpdateBytesTransferred(bytes int64) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
 	ts.bytesTransferred = bytes
 }
 
+// AddBytesTransferred adds to the bytes transferred; chunks may complete in any order
+func (ts *TransferStats) AddBytesTransferred(bytes int64) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	ts.bytesTransferred += bytes
+}
+
 // GetProgressTracker returns the internal progress tracker
 func (ts *TransferStats) GetProgressTracker() *ProgressTracker {
 	return ts.progressTracker
 }
+
+var (
+	jsonSummaryMutex  sync.RWMutex
+	jsonSummaryWriter io.Writer
+)
+
+// SetJSONSummary makes PrintSummary write each transfer's result to w as a single line of JSON
+// instead of the formatted summary; nil restores the formatted summary
+func SetJSONSummary(w io.Writer) {
+	jsonSummaryMutex.Lock()
+	defer jsonSummaryMutex.Unlock()
+	jsonSummaryWriter = w
+}
+
+// jsonSummaryOutput returns the writer set by SetJSONSummary
+func jsonSummaryOutput() io.Writer {
+	jsonSummaryMutex.RLock()
+	defer jsonSummaryMutex.RUnlock()
+	return jsonSummaryWriter
+}
+
+// transferResult is the machine-readable form of TransferStats
+type transferResult struct {
+	Filename         string        `json:"filename"`
+	Size             int64         `json:"size"`
+	Direction        string        `json:"direction"`
+	Peer             string        `json:"peer"`
+	Status           string        `json:"status"`
+	Reason           string        `json:"reason,omitempty"`
+	RejectionCode    RejectionCode `json:"rejection_code,omitempty"`
+	TotalChunks      int           `json:"total_chunks"`
+	CompletedChunks  int           `json:"completed_chunks"`
+	BytesTransferred int64         `json:"bytes_transferred"`
+	DurationSeconds  float64       `json:"duration_seconds"`
+	AverageSpeedMBps float64       `json:"average_speed_mbps"`
+	ChunksRetried    int           `json:"chunks_retried"`
+	TotalRetries     int           `json:"total_retries"`
+}
+
+// MarshalJSON implements json.Marshaler with stable snake_case field names for scripts
+func (ts *TransferStats) MarshalJSON() ([]byte, error) {
+	ts.mutex.Lock()
+	result := transferResult{
+		Filename:         ts.Filename,
+		Size:             ts.FileSize,
+		Direction:        ts.TransferDirection,
+		Peer:             ts.PeerAddress,
+		Status:           ts.Status,
+		Reason:           ts.Reason,
+		RejectionCode:    ts.RejectionCode,
+		TotalChunks:      ts.TotalChunks,
+		CompletedChunks:  ts.completedChunks(),
+		BytesTransferred: ts.bytesTransferred,
+		DurationSeconds:  ts.Duration.Seconds(),
+		AverageSpeedMBps: ts.AverageSpeed,
+		ChunksRetried:    ts.ChunksRetried,
+		TotalRetries:     ts.TotalRetries,
+	}
+	ts.mutex.Unlock()
+
+	return json.Marshal(result)
+}
+
+// PrintJSON writes the transfer result to w as a single line of JSON
+func (ts *TransferStats) PrintJSON(w io.Writer) error {
+	data, err := json.Marshal(ts)
+	if err != nil {
+		return fmt.Errorf("failed to encode transfer summary: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
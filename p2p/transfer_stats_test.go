@@ -0,0 +1,125 @@
+package p2p
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTransferStatsOnProgress(t *testing.T) {
+	stats := NewTransferStats("file.bin", 3000, 3, "127.0.0.1:8080", "sent")
+	stats.SetQuiet(true)
+
+	var calls int
+	var lastCompleted, lastTotal int
+	var lastBytes int64
+	stats.OnProgress = func(completed, total int, bytes int64) {
+		calls++
+		lastCompleted, lastTotal, lastBytes = completed, total, bytes
+	}
+
+	// Quiet mode suppresses terminal output but not the callback
+	for i := 0; i < 3; i++ {
+		stats.IncrementSentChunks()
+		stats.AddBytesTransferred(1000)
+		stats.PrintProgress()
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 progress callbacks, got %d", calls)
+	}
+
+	stats.MarkCompleted()
+	if calls != 4 {
+		t.Errorf("Expected a final callback on completion, got %d calls", calls)
+	}
+	if lastCompleted != 3 || lastTotal != 3 || lastBytes != 3000 {
+		t.Errorf("Expected final progress 3/3 and 3000 bytes, got %d/%d and %d bytes", lastCompleted, lastTotal, lastBytes)
+	}
+}
+
+func TestTransferStatsJSONSummary(t *testing.T) {
+	stats := NewTransferStats("file.bin", 3000, 3, "127.0.0.1:8080", "received")
+	stats.SetQuiet(true)
+	stats.IncrementReceivedChunks()
+	stats.AddBytesTransferred(1000)
+	stats.AddRetry(0, 3)
+	stats.MarkFailed("connection lost")
+
+	var out bytes.Buffer
+	SetJSONSummary(&out)
+	defer SetJSONSummary(nil)
+	stats.PrintSummary()
+
+	if strings.Count(out.String(), "\n") != 1 {
+		t.Fatalf("Expected a single line of JSON, got %q", out.String())
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+		t.Fatalf("Summary is not valid JSON: %v", err)
+	}
+	expected := map[string]interface{}{
+		"filename":          "file.bin",
+		"size":              float64(3000),
+		"direction":         "received",
+		"peer":              "127.0.0.1:8080",
+		"status":            "failed",
+		"reason":            "connection lost",
+		"total_chunks":      float64(3),
+		"completed_chunks":  float64(1),
+		"bytes_transferred": float64(1000),
+		"chunks_retried":    float64(1),
+		"total_retries":     float64(2),
+	}
+	for key, want := range expected {
+		if result[key] != want {
+			t.Errorf("Expected %s = %v, got %v", key, want, result[key])
+		}
+	}
+}
+
+func TestSpeedSamplesWindowedRate(t *testing.T) {
+	start := time.Now()
+	var samples speedSamples
+	samples.add(start, 0)
+
+	// 1 MB/s for 10s, then 4 MB/s for 5s
+	bytes := int64(0)
+	for i := 1; i <= 10; i++ {
+		bytes += 1024 * 1024
+		samples.add(start.Add(time.Duration(i)*time.Second), bytes)
+	}
+	for i := 1; i <= 5; i++ {
+		bytes += 4 * 1024 * 1024
+		samples.add(start.Add(time.Duration(10+i)*time.Second), bytes)
+	}
+
+	now := start.Add(15 * time.Second)
+	if rate := samples.rate(now, SpeedWindow) / (1024 * 1024); rate != 4 {
+		t.Errorf("Expected the last 5s to run at 4 MB/s, got %.2f", rate)
+	}
+
+	// Nothing for 5s more: the window only covers the stall
+	if rate := samples.rate(now.Add(SpeedWindow), SpeedWindow); rate != 0 {
+		t.Errorf("Expected a stalled transfer to report 0, got %.2f", rate)
+	}
+}
+
+func TestSpeedSamplesMergeCloseSamples(t *testing.T) {
+	start := time.Now()
+	var samples speedSamples
+	for i := 0; i < 10*speedSampleCapacity; i++ {
+		samples.add(start.Add(time.Duration(i)*time.Millisecond), int64(i))
+	}
+	if samples.count >= speedSampleCapacity {
+		t.Errorf("Expected samples 1ms apart to be merged, got %d", samples.count)
+	}
+
+	// The newest sample still carries the latest byte count
+	newest := samples.samples[(samples.next+speedSampleCapacity-1)%speedSampleCapacity]
+	if newest.bytes != int64(10*speedSampleCapacity-1) {
+		t.Errorf("Expected the newest sample to hold %d bytes, got %d", 10*speedSampleCapacity-1, newest.bytes)
+	}
+}
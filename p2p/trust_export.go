@@ -0,0 +1,122 @@
+package p2p
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// TrustImportResult summarizes a FileTrustStore.Import
+type TrustImportResult struct {
+	Added     int
+	Updated   int
+	Unchanged int
+	Skipped   []string // One reason per malformed entry or one conflicting with a trusted device
+}
+
+// Export writes every trusted peer to filename in the trust store's own JSON format
+func (ts *FileTrustStore) Export(filename string) error {
+	ts.mutex.RLock()
+	data, err := json.MarshalIndent(ts.peers, "", "  ")
+	ts.mutex.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filename, data, 0600); err != nil {
+		return fmt.Errorf("failed to write trust store export: %w", err)
+	}
+	return nil
+}
+
+// Import merges the peers exported to filename into the store. Entries whose certificates don't
+// parse or don't match their fingerprint are skipped, as are entries for a trusted device with a
+// different fingerprint or CA, since an import must not re-pin a device to another key; otherwise
+// a device in both keeps whichever entry was seen last.
+func (ts *FileTrustStore) Import(filename string) (*TrustImportResult, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trust store export: %w", err)
+	}
+	var imported map[string]*TrustedPeer
+	if err := json.Unmarshal(data, &imported); err != nil {
+		return nil, fmt.Errorf("'%s' is not a trust store export: %w", filename, err)
+	}
+
+	deviceIDs := make([]string, 0, len(imported))
+	for deviceID := range imported {
+		deviceIDs = append(deviceIDs, deviceID)
+	}
+	sort.Strings(deviceIDs)
+
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	result := &TrustImportResult{}
+	for _, deviceID := range deviceIDs {
+		peer := imported[deviceID]
+		if err := validateTrustedPeer(deviceID, peer); err != nil {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: %v", deviceID, err))
+			continue
+		}
+
+		existing, exists := ts.peers[deviceID]
+		switch {
+		case !exists:
+			result.Added++
+		case existing.Fingerprint != "" && existing.Fingerprint != peer.Fingerprint:
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: fingerprint differs from the trusted entry", deviceID))
+			continue
+		case existing.CACert != peer.CACert:
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: CA certificate differs from the trusted entry", deviceID))
+			continue
+		case peer.LastSeen > existing.LastSeen:
+			result.Updated++
+		default:
+			result.Unchanged++
+			continue
+		}
+		ts.peers[deviceID] = peer
+	}
+
+	if result.Added+result.Updated > 0 {
+		if err := ts.save(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// validateTrustedPeer checks an imported entry before it's trusted: its certificates must parse
+// and the device certificate must be the one its fingerprint pins, which is filled in if missing
+func validateTrustedPeer(deviceID string, peer *TrustedPeer) error {
+	if peer == nil {
+		return fmt.Errorf("empty entry")
+	}
+	if peer.DeviceID != deviceID {
+		return fmt.Errorf("entry is for device '%s'", peer.DeviceID)
+	}
+	if peer.DeviceCert == "" {
+		return fmt.Errorf("no device certificate")
+	}
+	deviceCert, err := parsePEMCertificate([]byte(peer.DeviceCert))
+	if err != nil {
+		return fmt.Errorf("invalid device certificate: %v", err)
+	}
+	if deviceCert.Subject.CommonName != deviceID {
+		return fmt.Errorf("device certificate is for '%s'", deviceCert.Subject.CommonName)
+	}
+	fingerprint := generateCertificateFingerprint(deviceCert)
+	if peer.Fingerprint == "" {
+		peer.Fingerprint = fingerprint
+	} else if peer.Fingerprint != fingerprint {
+		return fmt.Errorf("fingerprint doesn't match the device certificate")
+	}
+	if peer.CACert != "" {
+		if _, err := parsePEMCertificate([]byte(peer.CACert)); err != nil {
+			return fmt.Errorf("invalid CA certificate: %v", err)
+		}
+	}
+	return nil
+}
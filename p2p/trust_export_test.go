@@ -0,0 +1,95 @@
+package p2p
+
+import (
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTrustStoreExportImport(t *testing.T) {
+	dir := t.TempDir()
+	certPEM := func(hostname string) (string, string) {
+		cert := newForeignDeviceCertificate(t, hostname)
+		return cert.Subject.CommonName, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+	}
+	alpha, alphaCert := certPEM("alpha")
+	beta, betaCert := certPEM("beta")
+	gamma, gammaCert := certPEM("gamma")
+	delta, deltaCert := certPEM("delta")
+	_, impostorCert := certPEM("delta")
+	epsilon, epsilonCert := certPEM("epsilon")
+	_, otherCA := certPEM("other-ca")
+
+	source := NewFileTrustStore(filepath.Join(dir, "source.json"))
+	for _, peer := range []*TrustedPeer{
+		{DeviceID: alpha, Hostname: "alpha", DeviceCert: alphaCert, LastSeen: 200},
+		{DeviceID: beta, Hostname: "beta-old", DeviceCert: betaCert, LastSeen: 100},
+		{DeviceID: gamma, Hostname: "gamma", DeviceCert: gammaCert, Fingerprint: "not-the-fingerprint", LastSeen: 300},
+		{DeviceID: "no-cert", Hostname: "no-cert", LastSeen: 300},
+		{DeviceID: delta, Hostname: "delta-impostor", DeviceCert: impostorCert, LastSeen: 400},
+		{DeviceID: epsilon, Hostname: "epsilon-new", DeviceCert: epsilonCert, CACert: otherCA, LastSeen: 400},
+	} {
+		if err := source.AddTrustedPeer(peer); err != nil {
+			t.Fatalf("Failed to add trusted peer: %v", err)
+		}
+	}
+	exported := filepath.Join(dir, "export.json")
+	if err := source.Export(exported); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	// The destination already knows alpha from longer ago and beta more recently, and has delta
+	// and epsilon pinned to other certificates than the export, however recent its entries are
+	destination := NewFileTrustStore(filepath.Join(dir, "destination.json"))
+	destination.AddTrustedPeer(&TrustedPeer{DeviceID: alpha, Hostname: "alpha-old", DeviceCert: alphaCert, LastSeen: 50})
+	destination.AddTrustedPeer(&TrustedPeer{DeviceID: beta, Hostname: "beta", DeviceCert: betaCert, LastSeen: 150})
+	deltaPeer := &TrustedPeer{DeviceID: delta, Hostname: "delta", DeviceCert: deltaCert, LastSeen: 10}
+	epsilonPeer := &TrustedPeer{DeviceID: epsilon, Hostname: "epsilon", DeviceCert: epsilonCert, LastSeen: 10}
+	for _, peer := range []*TrustedPeer{deltaPeer, epsilonPeer} {
+		if err := validateTrustedPeer(peer.DeviceID, peer); err != nil {
+			t.Fatal(err)
+		}
+		destination.AddTrustedPeer(peer)
+	}
+
+	result, err := destination.Import(exported)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if result.Added != 0 || result.Updated != 1 || result.Unchanged != 1 || len(result.Skipped) != 4 {
+		t.Fatalf("Unexpected import result: %+v", result)
+	}
+	skipped := strings.Join(result.Skipped, "\n")
+	if !strings.Contains(skipped, gamma+": fingerprint") {
+		t.Errorf("Expected gamma's fingerprint mismatch to be reported, got %v", result.Skipped)
+	}
+	if !strings.Contains(skipped, delta+": fingerprint differs") || !strings.Contains(skipped, epsilon+": CA certificate differs") {
+		t.Errorf("Expected delta and epsilon to be reported as conflicting, got %v", result.Skipped)
+	}
+
+	reloaded := NewFileTrustStore(filepath.Join(dir, "destination.json"))
+	if peer, _ := reloaded.GetTrustedPeer(alpha); peer.Hostname != "alpha" || peer.Fingerprint == "" {
+		t.Errorf("Expected the newer alpha entry with its fingerprint filled in, got %+v", peer)
+	}
+	if peer, _ := reloaded.GetTrustedPeer(beta); peer.Hostname != "beta" {
+		t.Errorf("Expected the destination's newer beta entry to be kept, got %+v", peer)
+	}
+	if peer, _ := reloaded.GetTrustedPeer(delta); peer.Hostname != "delta" || peer.Fingerprint != deltaPeer.Fingerprint {
+		t.Errorf("Expected delta to stay pinned to its trusted certificate, got %+v", peer)
+	}
+	if peer, _ := reloaded.GetTrustedPeer(epsilon); peer.Hostname != "epsilon" || peer.CACert != "" {
+		t.Errorf("Expected epsilon to keep its trusted entry, got %+v", peer)
+	}
+	if reloaded.IsTrusted(gamma) || reloaded.IsTrusted("no-cert") {
+		t.Error("Expected malformed entries not to be imported")
+	}
+
+	if err := os.WriteFile(exported, []byte("not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := destination.Import(exported); err == nil {
+		t.Error("Expected an error importing a file that isn't an export")
+	}
+}
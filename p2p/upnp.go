@@ -0,0 +1,344 @@
+package p2p
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UPnP constants
+const (
+	// ssdpAddress is the multicast group UPnP devices answer M-SEARCH requests on
+	ssdpAddress = "239.255.255.250:1900"
+	// UPnPDiscoveryTimeout is how long to wait for the router to answer an M-SEARCH
+	UPnPDiscoveryTimeout = 3 * time.Second
+	// UPnPLeaseDuration is how long the router keeps a mapping; Maintain renews it at half that
+	UPnPLeaseDuration = 2 * time.Hour
+)
+
+// igdSearchTargets are the device types searched for, newest first
+var igdSearchTargets = []string{
+	"urn:schemas-upnp-org:device:InternetGatewayDevice:2",
+	"urn:schemas-upnp-org:device:InternetGatewayDevice:1",
+}
+
+// UPnPMapping is a UDP port mapping on the router's UPnP internet gateway device, which makes a
+// receiver reachable from outside its NAT
+type UPnPMapping struct {
+	ExternalIP   string
+	ExternalPort int
+	InternalIP   string
+	InternalPort int
+
+	gateway *upnpGateway
+}
+
+// upnpGateway is the WANIPConnection or WANPPPConnection service of an internet gateway device
+type upnpGateway struct {
+	controlURL  string
+	serviceType string
+	client      *http.Client
+}
+
+// MapPortUPnP asks the router to forward UDP port to this machine under the same external port
+// and returns the mapping along with the router's external address. It fails with
+// ErrNetworkUnreachable when no UPnP router answers or the router refuses the mapping.
+func MapPortUPnP(ctx context.Context, port int, description string) (*UPnPMapping, error) {
+	location, err := discoverUPnPGateway(ctx, UPnPDiscoveryTimeout)
+	if err != nil {
+		return nil, err
+	}
+	gateway, err := newUPnPGateway(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	return gateway.mapPort(ctx, port, description)
+}
+
+// ExternalAddress returns the address peers outside the NAT can reach the receiver at
+func (m *UPnPMapping) ExternalAddress() string {
+	return net.JoinHostPort(m.ExternalIP, strconv.Itoa(m.ExternalPort))
+}
+
+// Maintain renews the mapping before its lease runs out until ctx is cancelled
+func (m *UPnPMapping) Maintain(ctx context.Context, description string) {
+	ticker := time.NewTicker(UPnPLeaseDuration / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.gateway.addPortMapping(ctx, m.ExternalPort, m.InternalIP, m.InternalPort, description); err != nil {
+				logf("⚠️  Failed to renew UPnP port mapping: %v\n", err)
+			}
+		}
+	}
+}
+
+// Remove deletes the mapping from the router
+func (m *UPnPMapping) Remove(ctx context.Context) error {
+	_, err := m.gateway.call(ctx, "DeletePortMapping", [][2]string{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(m.ExternalPort)},
+		{"NewProtocol", "UDP"},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove UPnP port mapping: %w", err)
+	}
+	return nil
+}
+
+// discoverUPnPGateway multicasts an SSDP M-SEARCH for internet gateway devices and returns the
+// description URL of the first that answers
+func discoverUPnPGateway(ctx context.Context, timeout time.Duration) (string, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return "", fmt.Errorf("%w: failed to open UPnP discovery socket: %v", ErrNetworkUnreachable, err)
+	}
+	defer conn.Close()
+
+	ssdpAddr, err := net.ResolveUDPAddr("udp4", ssdpAddress)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrAddressResolution, err)
+	}
+	for _, target := range igdSearchTargets {
+		search := "M-SEARCH * HTTP/1.1\r\n" +
+			"HOST: " + ssdpAddress + "\r\n" +
+			"MAN: \"ssdp:discover\"\r\n" +
+			"MX: 2\r\n" +
+			"ST: " + target + "\r\n\r\n"
+		if _, err := conn.WriteToUDP([]byte(search), ssdpAddr); err != nil {
+			return "", fmt.Errorf("%w: failed to send UPnP discovery: %v", ErrNetworkUnreachable, err)
+		}
+	}
+
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.SetReadDeadline(deadline)
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return "", fmt.Errorf("%w: no UPnP router answered within %v", ErrNetworkUnreachable, timeout)
+		}
+		if location := ssdpLocation(buf[:n]); location != "" {
+			return location, nil
+		}
+	}
+}
+
+// ssdpLocation returns the LOCATION header of an SSDP response, or "" if it has none
+func ssdpLocation(response []byte) string {
+	reader := textproto.NewReader(bufio.NewReader(bytes.NewReader(response)))
+	if _, err := reader.ReadLine(); err != nil {
+		return ""
+	}
+	header, err := reader.ReadMIMEHeader()
+	if err != nil && len(header) == 0 {
+		return ""
+	}
+	return header.Get("Location")
+}
+
+// upnpDevice is the part of a UPnP device description needed to find the WAN connection service
+type upnpDevice struct {
+	Services []struct {
+		ServiceType string `xml:"serviceType"`
+		ControlURL  string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []upnpDevice `xml:"deviceList>device"`
+}
+
+// newUPnPGateway fetches the device description at location and finds its WAN connection service
+func newUPnPGateway(ctx context.Context, location string) (*upnpGateway, error) {
+	client := &http.Client{Timeout: UPnPDiscoveryTimeout}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid UPnP description URL '%s'", ErrNetworkUnreachable, location)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to fetch UPnP device description: %v", ErrNetworkUnreachable, err)
+	}
+	defer response.Body.Close()
+
+	var description struct {
+		URLBase string     `xml:"URLBase"`
+		Device  upnpDevice `xml:"device"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&description); err != nil {
+		return nil, fmt.Errorf("%w: invalid UPnP device description: %v", ErrNetworkUnreachable, err)
+	}
+
+	serviceType, controlPath := findWANConnection(description.Device)
+	if controlPath == "" {
+		return nil, fmt.Errorf("%w: the UPnP router offers no WAN connection service", ErrNetworkUnreachable)
+	}
+	base, err := url.Parse(location)
+	if description.URLBase != "" {
+		base, err = url.Parse(description.URLBase)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid UPnP base URL: %v", ErrNetworkUnreachable, err)
+	}
+	control, err := base.Parse(controlPath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid UPnP control URL '%s'", ErrNetworkUnreachable, controlPath)
+	}
+	return &upnpGateway{controlURL: control.String(), serviceType: serviceType, client: client}, nil
+}
+
+// findWANConnection searches the device tree for a WANIPConnection or WANPPPConnection service
+// and returns its type and control URL
+func findWANConnection(device upnpDevice) (string, string) {
+	for _, service := range device.Services {
+		if strings.Contains(service.ServiceType, ":WANIPConnection:") || strings.Contains(service.ServiceType, ":WANPPPConnection:") {
+			return service.ServiceType, service.ControlURL
+		}
+	}
+	for _, child := range device.Devices {
+		if serviceType, controlURL := findWANConnection(child); controlURL != "" {
+			return serviceType, controlURL
+		}
+	}
+	return "", ""
+}
+
+// mapPort requests the mapping for port and looks up the router's external address
+func (g *upnpGateway) mapPort(ctx context.Context, port int, description string) (*UPnPMapping, error) {
+	internalIP, err := g.localAddress()
+	if err != nil {
+		return nil, err
+	}
+	if err := g.addPortMapping(ctx, port, internalIP, port, description); err != nil {
+		return nil, err
+	}
+
+	mapping := &UPnPMapping{ExternalPort: port, InternalIP: internalIP, InternalPort: port, gateway: g}
+	values, err := g.call(ctx, "GetExternalIPAddress", nil)
+	if err != nil || values["NewExternalIPAddress"] == "" {
+		mapping.Remove(ctx)
+		return nil, fmt.Errorf("%w: the UPnP router didn't report its external address: %v", ErrNetworkUnreachable, err)
+	}
+	mapping.ExternalIP = values["NewExternalIPAddress"]
+	return mapping, nil
+}
+
+// addPortMapping asks the router to forward externalPort over UDP to internalIP:internalPort
+func (g *upnpGateway) addPortMapping(ctx context.Context, externalPort int, internalIP string, internalPort int, description string) error {
+	_, err := g.call(ctx, "AddPortMapping", [][2]string{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(externalPort)},
+		{"NewProtocol", "UDP"},
+		{"NewInternalPort", strconv.Itoa(internalPort)},
+		{"NewInternalClient", internalIP},
+		{"NewEnabled", "1"},
+		{"NewPortMappingDescription", description},
+		{"NewLeaseDuration", strconv.Itoa(int(UPnPLeaseDuration.Seconds()))},
+	})
+	if err != nil {
+		return fmt.Errorf("%w: the UPnP router refused the port mapping: %v", ErrNetworkUnreachable, err)
+	}
+	return nil
+}
+
+// localAddress returns this machine's address on the interface that reaches the router
+func (g *upnpGateway) localAddress() (string, error) {
+	// Forward to the bound interface, since the receiver isn't listening on the others
+	if ip := BindAddress(); ip != nil && ip.To4() != nil {
+		return ip.String(), nil
+	}
+	control, err := url.Parse(g.controlURL)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid UPnP control URL '%s'", ErrNetworkUnreachable, g.controlURL)
+	}
+	// Dialing UDP sends nothing; it only picks the route
+	conn, err := net.Dial("udp4", net.JoinHostPort(control.Hostname(), "1900"))
+	if err != nil {
+		return "", fmt.Errorf("%w: no route to the UPnP router: %v", ErrNetworkUnreachable, err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String(), nil
+}
+
+// call invokes a SOAP action on the gateway's WAN connection service and returns the response's
+// arguments by name
+func (g *upnpGateway) call(ctx context.Context, action string, args [][2]string) (map[string]string, error) {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">` +
+		`<s:Body><u:` + action + ` xmlns:u="` + g.serviceType + `">`)
+	for _, arg := range args {
+		body.WriteString("<" + arg[0] + ">")
+		xml.EscapeText(&body, []byte(arg[1]))
+		body.WriteString("</" + arg[0] + ">")
+	}
+	body.WriteString(`</u:` + action + `></s:Body></s:Envelope>`)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, g.controlURL, &body)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	request.Header.Set("SOAPAction", `"`+g.serviceType+"#"+action+`"`)
+	response, err := g.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	values, err := parseSOAPResponse(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", action, err)
+	}
+	if response.StatusCode != http.StatusOK {
+		if values["errorCode"] != "" {
+			return nil, fmt.Errorf("%s failed with UPnP error %s (%s)", action, values["errorCode"], values["errorDescription"])
+		}
+		return nil, fmt.Errorf("%s failed with HTTP status %s", action, response.Status)
+	}
+	return values, nil
+}
+
+// parseSOAPResponse collects the text of every leaf element in a SOAP response, which holds the
+// output arguments of an action or the errorCode and errorDescription of a fault
+func parseSOAPResponse(r io.Reader) (map[string]string, error) {
+	values := make(map[string]string)
+	decoder := xml.NewDecoder(r)
+	var current string
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid SOAP response: %w", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			current = t.Name.Local
+			text.Reset()
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if t.Name.Local == current {
+				values[current] = strings.TrimSpace(text.String())
+			}
+			current = ""
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestUPnPPortMapping(t *testing.T) {
+	const serviceType = "urn:schemas-upnp-org:service:WANIPConnection:1"
+	var mutex sync.Mutex
+	var actions []string
+	var addBody string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rootDesc.xml", func(w http.ResponseWriter, r *http.Request) {
+		// The WAN service sits two devices deep, as on most routers
+		io.WriteString(w, `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+    <deviceList><device>
+      <deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+      <deviceList><device>
+        <deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+        <serviceList><service>
+          <serviceType>`+serviceType+`</serviceType>
+          <controlURL>/ctl/IPConn</controlURL>
+        </service></serviceList>
+      </device></deviceList>
+    </device></deviceList>
+  </device>
+</root>`)
+	})
+	mux.HandleFunc("/ctl/IPConn", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		action := strings.TrimSuffix(strings.TrimPrefix(r.Header.Get("SOAPAction"), `"`+serviceType+"#"), `"`)
+		mutex.Lock()
+		actions = append(actions, action)
+		mutex.Unlock()
+
+		switch action {
+		case "AddPortMapping":
+			addBody = string(body)
+			io.WriteString(w, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><u:AddPortMappingResponse xmlns:u="`+serviceType+`"/></s:Body></s:Envelope>`)
+		case "GetExternalIPAddress":
+			io.WriteString(w, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><u:GetExternalIPAddressResponse xmlns:u="`+serviceType+`"><NewExternalIPAddress>203.0.113.7</NewExternalIPAddress></u:GetExternalIPAddressResponse></s:Body></s:Envelope>`)
+		case "DeletePortMapping":
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><s:Fault><detail><UPnPError><errorCode>714</errorCode><errorDescription>NoSuchEntryInArray</errorDescription></UPnPError></detail></s:Fault></s:Body></s:Envelope>`)
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	ctx := context.Background()
+	gateway, err := newUPnPGateway(ctx, server.URL+"/rootDesc.xml")
+	if err != nil {
+		t.Fatalf("Failed to read the device description: %v", err)
+	}
+	if gateway.controlURL != server.URL+"/ctl/IPConn" || gateway.serviceType != serviceType {
+		t.Fatalf("Expected the nested WANIPConnection service, got %s at %s", gateway.serviceType, gateway.controlURL)
+	}
+
+	mapping, err := gateway.mapPort(ctx, 8080, "LanDrop receiver")
+	if err != nil {
+		t.Fatalf("Port mapping failed: %v", err)
+	}
+	if mapping.ExternalAddress() != "203.0.113.7:8080" {
+		t.Errorf("Expected external address 203.0.113.7:8080, got %s", mapping.ExternalAddress())
+	}
+	for _, arg := range []string{"<NewExternalPort>8080</NewExternalPort>", "<NewProtocol>UDP</NewProtocol>", "<NewInternalClient>127.0.0.1</NewInternalClient>"} {
+		if !strings.Contains(addBody, arg) {
+			t.Errorf("Expected AddPortMapping to carry %s, got %s", arg, addBody)
+		}
+	}
+
+	// The router's fault is reported with its code
+	if err := mapping.Remove(ctx); err == nil || !strings.Contains(err.Error(), "714") {
+		t.Errorf("Expected the UPnP error code in the removal failure, got %v", err)
+	}
+	if strings.Join(actions, ",") != "AddPortMapping,GetExternalIPAddress,DeletePortMapping" {
+		t.Errorf("Unexpected SOAP actions: %v", actions)
+	}
+}
+
+func TestUPnPGatewayWithoutWANService(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<root><device><deviceType>urn:schemas-upnp-org:device:MediaServer:1</deviceType></device></root>`)
+	}))
+	defer server.Close()
+
+	if _, err := newUPnPGateway(context.Background(), server.URL); !errors.Is(err, ErrNetworkUnreachable) {
+		t.Errorf("Expected ErrNetworkUnreachable for a device without a WAN connection, got %v", err)
+	}
+}
+
+func TestSSDPLocation(t *testing.T) {
+	response := "HTTP/1.1 200 OK\r\nCACHE-CONTROL: max-age=120\r\nLOCATION: http://192.168.1.1:5000/rootDesc.xml\r\nST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n\r\n"
+	if location := ssdpLocation([]byte(response)); location != "http://192.168.1.1:5000/rootDesc.xml" {
+		t.Errorf("Expected the LOCATION header, got %q", location)
+	}
+	if location := ssdpLocation([]byte("garbage")); location != "" {
+		t.Errorf("Expected no location for a malformed response, got %q", location)
+	}
+}